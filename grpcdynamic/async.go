@@ -0,0 +1,162 @@
+package grpcdynamic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// ErrQueueFull is returned from AsyncInvoker.Enqueue when the invoker's queue
+// has no room for another request.
+var ErrQueueFull = errors.New("async invoker queue is full")
+
+// ErrInvokerClosed is returned from AsyncInvoker.Enqueue after the invoker
+// has been closed.
+var ErrInvokerClosed = errors.New("async invoker is closed")
+
+const defaultAsyncQueueSize = 100
+
+// AsyncOptions configures an AsyncInvoker.
+type AsyncOptions struct {
+	// The maximum number of requests that can be queued, waiting to be
+	// sent. If zero or negative, a default of 100 is used.
+	QueueSize int
+	// The number of requests that can be in flight at any given time. If
+	// zero or negative, a default of one is used.
+	Workers int
+	// The timeout applied to each RPC. If zero, RPCs have no deadline,
+	// other than those set via call options or a service config.
+	Timeout time.Duration
+	// If non-nil, this is called with each request that fails and the
+	// error with which it failed. It may be called concurrently from
+	// multiple goroutines, if Workers is greater than one.
+	OnError func(req BatchRequest, err error)
+}
+
+// AsyncInvoker sends unary RPCs in the background. It is intended for
+// fire-and-forget RPCs, like those that send telemetry, where callers must
+// not block on a slow or unavailable server. Requests are added to a bounded
+// queue and sent by a fixed pool of worker goroutines. Responses are
+// discarded; failures are reported via AsyncOptions.OnError.
+//
+// An AsyncInvoker is safe for concurrent use. It must be closed when no
+// longer needed, to stop its worker goroutines.
+type AsyncInvoker struct {
+	stub    *Stub
+	opts    AsyncOptions
+	queue   chan BatchRequest
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncInvoker creates a new AsyncInvoker that uses s to send RPCs. The
+// invoker's worker goroutines are started immediately.
+func (s *Stub) NewAsyncInvoker(opts AsyncOptions) *AsyncInvoker {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultAsyncQueueSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &AsyncInvoker{
+		stub:   s,
+		opts:   opts,
+		queue:  make(chan BatchRequest, opts.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	a.workers.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go a.work()
+	}
+	return a
+}
+
+// Enqueue adds the given request to the queue, to be sent in the background,
+// and returns immediately. It returns ErrQueueFull if the queue has no room,
+// in which case the request is dropped, or ErrInvokerClosed if the invoker
+// has been closed. It also returns an error if the request's method is not
+// unary or if its request message is not the method's input type.
+func (a *AsyncInvoker) Enqueue(req BatchRequest) error {
+	if req.Method.IsStreamingClient() || req.Method.IsStreamingServer() {
+		return fmt.Errorf("AsyncInvoker is for unary methods; %q is %s", req.Method.FullName(), methodType(req.Method))
+	}
+	if err := checkMessageType(req.Method.Input(), req.Request); err != nil {
+		return err
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrInvokerClosed
+	}
+	select {
+	case a.queue <- req:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting new requests and waits for all queued and in-flight
+// requests to finish. If the given context is done before they finish, the
+// remaining requests are cancelled (and reported via OnError with a
+// cancellation error) and Close returns the context's error.
+func (a *AsyncInvoker) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		a.cancel()
+		return nil
+	case <-ctx.Done():
+		a.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (a *AsyncInvoker) work() {
+	defer a.workers.Done()
+	for req := range a.queue {
+		a.send(req)
+	}
+}
+
+func (a *AsyncInvoker) send(req BatchRequest) {
+	ctx := a.ctx
+	if err := ctx.Err(); err != nil {
+		// invoker was closed and its context cancelled, so don't bother sending
+		if a.opts.OnError != nil {
+			a.opts.OnError(req, status.FromContextError(err).Err())
+		}
+		return
+	}
+	if a.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.opts.Timeout)
+		defer cancel()
+	}
+	_, err := a.stub.InvokeRpc(ctx, req.Method, req.Request, req.CallOptions...)
+	if err != nil && a.opts.OnError != nil {
+		a.opts.OnError(req, err)
+	}
+}
@@ -0,0 +1,94 @@
+package grpcdynamic
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	grpctestprotos "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+)
+
+func TestAsyncInvoker(t *testing.T) {
+	channel := &fakeChannel{errs: []error{status.Error(codes.Unavailable, "oops")}}
+	var mu sync.Mutex
+	var failed []error
+	invoker := NewStub(channel).NewAsyncInvoker(AsyncOptions{
+		Workers: 4,
+		OnError: func(_ BatchRequest, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err)
+		},
+	})
+	for i := 0; i < 10; i++ {
+		err := invoker.Enqueue(BatchRequest{Method: unaryMd, Request: &grpctestprotos.SimpleRequest{}})
+		require.NoError(t, err)
+	}
+	err := invoker.Enqueue(BatchRequest{Method: unaryMd, Request: &grpctestprotos.Payload{}})
+	require.ErrorContains(t, err, "expecting message of type grpc.testing.SimpleRequest")
+	err = invoker.Enqueue(BatchRequest{Method: serverStreamingMd, Request: &grpctestprotos.StreamingOutputCallRequest{}})
+	require.ErrorContains(t, err, "AsyncInvoker is for unary methods")
+
+	require.NoError(t, invoker.Close(context.Background()))
+	require.Equal(t, 10, channel.numAttempts())
+	require.Len(t, failed, 1)
+	require.Equal(t, codes.Unavailable, status.Code(failed[0]))
+
+	err = invoker.Enqueue(BatchRequest{Method: unaryMd, Request: &grpctestprotos.SimpleRequest{}})
+	require.ErrorIs(t, err, ErrInvokerClosed)
+	// closing again is fine
+	require.NoError(t, invoker.Close(context.Background()))
+}
+
+func TestAsyncInvoker_QueueFull(t *testing.T) {
+	// the first request hangs until cancelled
+	channel := &fakeChannel{block: map[int]bool{1: true}}
+	var mu sync.Mutex
+	var failed []error
+	invoker := NewStub(channel).NewAsyncInvoker(AsyncOptions{
+		QueueSize: 2,
+		OnError: func(_ BatchRequest, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err)
+		},
+	})
+	req := BatchRequest{Method: unaryMd, Request: &grpctestprotos.SimpleRequest{}}
+	require.NoError(t, invoker.Enqueue(req))
+	require.Eventually(t, func() bool {
+		return channel.numAttempts() == 1
+	}, 5*time.Second, time.Millisecond)
+
+	// the one worker is busy, so only two more fit in the queue
+	require.NoError(t, invoker.Enqueue(req))
+	require.NoError(t, invoker.Enqueue(req))
+	require.ErrorIs(t, invoker.Enqueue(req), ErrQueueFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, invoker.Close(ctx), context.DeadlineExceeded)
+	require.Len(t, failed, 3)
+	for _, err := range failed {
+		require.Equal(t, codes.Canceled, status.Code(err))
+	}
+}
+
+func TestAsyncInvoker_Timeout(t *testing.T) {
+	channel := &fakeChannel{block: map[int]bool{1: true}}
+	var failed []error
+	invoker := NewStub(channel).NewAsyncInvoker(AsyncOptions{
+		Timeout: 10 * time.Millisecond,
+		OnError: func(_ BatchRequest, err error) {
+			failed = append(failed, err)
+		},
+	})
+	require.NoError(t, invoker.Enqueue(BatchRequest{Method: unaryMd, Request: &grpctestprotos.SimpleRequest{}}))
+	require.NoError(t, invoker.Close(context.Background()))
+	require.Len(t, failed, 1)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(failed[0]))
+}
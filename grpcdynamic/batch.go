@@ -0,0 +1,77 @@
+package grpcdynamic
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// BatchRequest is a single unary RPC to be sent as part of a batch via
+// Stub.InvokeBatch.
+type BatchRequest struct {
+	// The method to invoke. It must be a unary method.
+	Method protoreflect.MethodDescriptor
+	// The request message to send.
+	Request proto.Message
+	// Options to use when invoking this RPC.
+	CallOptions []grpc.CallOption
+}
+
+// BatchResult is the outcome of a single RPC sent as part of a batch via
+// Stub.InvokeBatch. Exactly one of Response and Error will be non-nil.
+type BatchResult struct {
+	Response proto.Message
+	Error    error
+}
+
+// InvokeBatch sends the given unary RPCs and returns their results. The
+// requests may be for different methods. At most concurrency RPCs will be in
+// flight at any given time. If concurrency is zero or negative, all RPCs are
+// sent concurrently.
+//
+// The returned slice has the same length as the given requests and the result
+// at a given index corresponds to the request at that index. A failure of one
+// RPC does not stop the others from being sent, so callers must examine every
+// result for errors. If the given context is cancelled, RPCs that have not yet
+// been sent will not be sent, and their results will contain the context error.
+func (s *Stub) InvokeBatch(ctx context.Context, requests []BatchRequest, concurrency int) []BatchResult {
+	results := make([]BatchResult, len(requests))
+	if concurrency <= 0 || concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range requests {
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(requests); j++ {
+				results[j].Error = err
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			req := &requests[i]
+			resp, err := s.InvokeRpc(ctx, req.Method, req.Request, req.CallOptions...)
+			if err != nil {
+				results[i].Error = err
+			} else {
+				results[i].Response = resp
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
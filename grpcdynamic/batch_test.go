@@ -0,0 +1,52 @@
+package grpcdynamic
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	grpctestprotos "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+)
+
+func TestInvokeBatch(t *testing.T) {
+	var requests []BatchRequest
+	for i := 0; i < 20; i++ {
+		requests = append(requests, BatchRequest{
+			Method: unaryMd,
+			Request: &grpctestprotos.SimpleRequest{
+				Payload: &grpctestprotos.Payload{Body: []byte(fmt.Sprintf("request %d", i))},
+			},
+		})
+	}
+	// wrong message type and non-unary method
+	requests = append(requests,
+		BatchRequest{Method: unaryMd, Request: &grpctestprotos.Payload{}},
+		BatchRequest{Method: serverStreamingMd, Request: &grpctestprotos.StreamingOutputCallRequest{}},
+	)
+
+	for _, concurrency := range []int{0, 1, 4, 100} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			results := stub.InvokeBatch(context.Background(), requests, concurrency)
+			require.Len(t, results, len(requests))
+			for i := 0; i < 20; i++ {
+				require.NoError(t, results[i].Error)
+				resp := results[i].Response.(*grpctestprotos.SimpleResponse)
+				require.Equal(t, fmt.Sprintf("request %d", i), string(resp.GetPayload().GetBody()))
+			}
+			require.ErrorContains(t, results[20].Error, "expecting message of type grpc.testing.SimpleRequest")
+			require.Nil(t, results[20].Response)
+			require.ErrorContains(t, results[21].Error, "InvokeRpc is for unary methods")
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := stub.InvokeBatch(ctx, requests[:5], 1)
+	for _, result := range results {
+		require.ErrorIs(t, result.Error, context.Canceled)
+	}
+
+	require.Empty(t, stub.InvokeBatch(context.Background(), nil, 0))
+}
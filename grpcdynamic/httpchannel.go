@@ -0,0 +1,768 @@
+package grpcdynamic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// HTTPProtocol is an RPC protocol that, unlike gRPC, can be used over
+// HTTP/1.1 and does not require HTTP trailers.
+type HTTPProtocol int
+
+const (
+	// ProtocolConnect is the Connect protocol, described at
+	// https://connectrpc.com/docs/protocol.
+	ProtocolConnect = HTTPProtocol(iota + 1)
+	// ProtocolGRPCWeb is the gRPC-Web protocol, described at
+	// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md.
+	ProtocolGRPCWeb
+)
+
+// String returns a human-readable name for the protocol.
+func (p HTTPProtocol) String() string {
+	switch p {
+	case ProtocolConnect:
+		return "Connect"
+	case ProtocolGRPCWeb:
+		return "gRPC-Web"
+	default:
+		return fmt.Sprintf("HTTPProtocol(%d)", int(p))
+	}
+}
+
+// NewHTTPChannel returns a channel that sends RPCs to the server at the given
+// base URL using the given protocol. The returned channel can be used with
+// NewStub, so dynamic stubs can invoke methods on servers that do not support
+// gRPC, such as servers behind proxies or platforms that do not support HTTP/2
+// trailers. If client is nil, http.DefaultClient is used.
+//
+// The base URL is the scheme, host, and an optional path prefix; for a method
+// "foo.bar.Service/Method", requests are sent to
+// "<baseURL>/foo.bar.Service/Method". Messages are sent and received in the
+// protobuf binary format and are not compressed.
+//
+// With the Connect protocol, all kinds of methods are supported. Bidi-streaming
+// methods are only full-duplex if both the client and the server support
+// full-duplex HTTP, which typically requires HTTP/2. Otherwise, the caller
+// must close the send side of the stream before receiving responses. The
+// gRPC-Web protocol does not support client-streaming or bidi-streaming
+// methods, so attempts to invoke them with ProtocolGRPCWeb fail with an error
+// whose code is Unimplemented. The only call options supported are
+// grpc.Header and grpc.Trailer; all others are ignored.
+//
+// Request metadata in the outgoing context, added with functions like
+// metadata.AppendToOutgoingContext, is sent as HTTP request headers. Errors
+// returned by the server, including any rich error details, are returned as
+// errors that carry a gRPC status, the same as when using a gRPC channel.
+//
+// Response messages larger than 4MiB are rejected with an error whose code is
+// ResourceExhausted. This limit can be changed with WithMaxReceiveMessageSize.
+func NewHTTPChannel(client *http.Client, baseURL string, protocol HTTPProtocol, opts ...HTTPChannelOption) grpc.ClientConnInterface {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ch := &httpChannel{
+		client:         client,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		protocol:       protocol,
+		maxReceiveSize: defaultMaxReceiveMessageSize,
+	}
+	for _, opt := range opts {
+		opt.apply(ch)
+	}
+	return ch
+}
+
+// HTTPChannelOption is an option that can be used to customize behavior when
+// creating a channel with NewHTTPChannel.
+type HTTPChannelOption interface {
+	apply(*httpChannel)
+}
+
+type httpChannelOptionFunc func(*httpChannel)
+
+func (f httpChannelOptionFunc) apply(ch *httpChannel) {
+	f(ch)
+}
+
+// WithMaxReceiveMessageSize returns an HTTPChannelOption that sets the maximum
+// size, in bytes, of a response message that the channel will accept. This
+// bounds how much memory is allocated for each message, regardless of the size
+// that the server claims it to be. The limit also applies to the end-of-stream
+// message of the Connect protocol and to the trailers of the gRPC-Web protocol,
+// which are sent like messages. If not specified or not positive, the
+// default of 4MiB is used, which is the same as the default for gRPC channels.
+func WithMaxReceiveMessageSize(size int) HTTPChannelOption {
+	return httpChannelOptionFunc(func(ch *httpChannel) {
+		if size <= 0 {
+			size = defaultMaxReceiveMessageSize
+		}
+		ch.maxReceiveSize = size
+	})
+}
+
+const defaultMaxReceiveMessageSize = 4 * 1024 * 1024
+
+type httpChannel struct {
+	client         *http.Client
+	baseURL        string
+	protocol       HTTPProtocol
+	maxReceiveSize int
+}
+
+var _ grpc.ClientConnInterface = (*httpChannel)(nil)
+
+func (ch *httpChannel) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	if ch.protocol == ProtocolConnect {
+		header, trailer, err := ch.invokeConnectUnary(ctx, method, args, reply)
+		setResponseMetadata(opts, header, trailer)
+		return err
+	}
+	// gRPC-Web unary calls are just streams with one response message
+	stream := ch.newStream(ctx, method)
+	defer stream.cancel()
+	err := stream.SendMsg(args)
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err == nil {
+		err = stream.RecvMsg(reply)
+	}
+	if err == nil {
+		// make sure there are no more response messages
+		if err = stream.RecvMsg(&anypb.Any{}); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = status.Errorf(codes.Internal, "unary method %s returned more than one response message", method)
+			stream.finish(err)
+		}
+	} else if err == io.EOF {
+		err = status.Errorf(codes.Internal, "unary method %s returned no response message", method)
+	}
+	header, _ := stream.Header()
+	setResponseMetadata(opts, header, stream.Trailer())
+	return err
+}
+
+func (ch *httpChannel) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+	if desc.ClientStreams {
+		if ch.protocol != ProtocolConnect {
+			return nil, status.Errorf(codes.Unimplemented, "%v channel does not support client-streaming method %s", ch.protocol, method)
+		}
+		return ch.newClientStream(ctx, method)
+	}
+	return ch.newStream(ctx, method), nil
+}
+
+func (ch *httpChannel) newRequest(ctx context.Context, method string, contentType string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.baseURL+method, body)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for key, vals := range md {
+		for _, val := range vals {
+			if strings.HasSuffix(key, "-bin") {
+				val = base64.RawStdEncoding.EncodeToString([]byte(val))
+			}
+			req.Header.Add(key, val)
+		}
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch ch.protocol {
+	case ProtocolConnect:
+		req.Header.Set("Connect-Protocol-Version", "1")
+	case ProtocolGRPCWeb:
+		req.Header.Set("X-Grpc-Web", "1")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutMillis := time.Until(deadline).Milliseconds()
+		if timeoutMillis < 1 {
+			timeoutMillis = 1
+		}
+		if ch.protocol == ProtocolConnect {
+			req.Header.Set("Connect-Timeout-Ms", strconv.FormatInt(timeoutMillis, 10))
+		} else {
+			req.Header.Set("Grpc-Timeout", strconv.FormatInt(timeoutMillis, 10)+"m")
+		}
+	}
+	return req, nil
+}
+
+func (ch *httpChannel) invokeConnectUnary(ctx context.Context, method string, args, reply any) (header, trailer metadata.MD, err error) {
+	data, err := marshalMessage(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := ch.newRequest(ctx, method, "application/proto", bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := ch.client.Do(req)
+	if err != nil {
+		return nil, nil, httpTransportError(ctx, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	// In the Connect protocol, unary trailers are sent as headers with a prefix.
+	trailerHeaders := http.Header{}
+	for key, vals := range resp.Header {
+		if strings.HasPrefix(key, "Trailer-") {
+			trailerHeaders[strings.TrimPrefix(key, "Trailer-")] = vals
+			delete(resp.Header, key)
+		}
+	}
+	header, trailer = metadataFromHeaders(resp.Header), metadataFromHeaders(trailerHeaders)
+	if resp.StatusCode != http.StatusOK {
+		return header, trailer, connectError(resp.StatusCode, readErrorBody(resp.Body, ch.maxReceiveSize))
+	}
+	body, err := readMessage(resp.Body, ch.maxReceiveSize)
+	if err != nil {
+		return header, trailer, readError(ctx, err)
+	}
+	if err := unmarshalMessage(body, reply); err != nil {
+		return header, trailer, err
+	}
+	return header, trailer, nil
+}
+
+func (ch *httpChannel) newStream(ctx context.Context, method string) *httpStream {
+	ctx, cancel := context.WithCancel(ctx)
+	return &httpStream{ch: ch, ctx: ctx, cancel: cancel, method: method, ready: make(chan struct{})}
+}
+
+// newClientStream returns a stream for a client-streaming or bidi-streaming
+// RPC. The request is sent immediately, and request messages are written to
+// its body as they are sent.
+func (ch *httpChannel) newClientStream(ctx context.Context, method string) (*httpStream, error) {
+	s := ch.newStream(ctx, method)
+	pr, pw := io.Pipe()
+	req, err := ch.newRequest(s.ctx, method, "application/connect+proto", pr)
+	if err != nil {
+		s.cancel()
+		return nil, err
+	}
+	s.bodyReader, s.bodyWriter = pr, pw
+	s.sent = true
+	go func() {
+		resp, err := ch.client.Do(req)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		defer close(s.ready)
+		if err != nil {
+			s.finishLocked(httpTransportError(s.ctx, err))
+			return
+		}
+		s.handleResponseLocked(resp)
+	}()
+	return s, nil
+}
+
+// httpStream is a grpc.ClientStream. For unary and server-streaming RPCs, the
+// request is sent when CloseSend is called. For other RPCs, the request is
+// sent when the stream is created. See httpChannel.newClientStream.
+//
+// The mutex only guards the fields below it. It is not held while sending the
+// request or reading the response body, so that Header, Trailer, and finish
+// (which is how the stream gets cancelled) do not block on network I/O.
+type httpStream struct {
+	ch     *httpChannel
+	ctx    context.Context
+	cancel context.CancelFunc
+	method string
+	// closed once the response headers are received or the request fails
+	ready chan struct{}
+
+	// These are only set for client-streaming and bidi-streaming RPCs.
+	// Request messages are written to bodyWriter.
+	bodyReader *io.PipeReader
+	bodyWriter *io.PipeWriter
+
+	mu   sync.Mutex
+	req  []byte
+	sent bool
+	// set once ready is closed, unless the request failed
+	resp    *http.Response
+	header  metadata.MD
+	trailer metadata.MD
+	// once set, the stream is finished and this is returned from RecvMsg
+	err error
+}
+
+var _ grpc.ClientStream = (*httpStream)(nil)
+
+func (s *httpStream) Header() (metadata.MD, error) {
+	if err := s.waitReady(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.header, nil
+}
+
+// waitReady waits until the response headers are received or the request
+// fails. It returns an error if the request has not been sent and the stream
+// is not already finished.
+func (s *httpStream) waitReady() error {
+	s.mu.Lock()
+	sent, finished := s.sent, s.err != nil
+	s.mu.Unlock()
+	if sent {
+		<-s.ready
+	} else if !finished {
+		return status.Error(codes.Internal, "request has not been sent")
+	}
+	return nil
+}
+
+func (s *httpStream) Trailer() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trailer
+}
+
+func (s *httpStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *httpStream) SendMsg(m any) error {
+	if s.bodyWriter != nil {
+		return s.sendStreamMsg(m)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.req != nil || s.sent {
+		return status.Errorf(codes.Internal, "%v channel can only send one request message", s.ch.protocol)
+	}
+	data, err := marshalMessage(m)
+	if err != nil {
+		return err
+	}
+	s.req = data
+	return nil
+}
+
+// sendStreamMsg writes a request message to the body of a client-streaming
+// or bidi-streaming RPC. This does not acquire s.mu, so it does not block,
+// or get blocked by, concurrent calls to RecvMsg.
+func (s *httpStream) sendStreamMsg(m any) error {
+	data, err := marshalMessage(m)
+	if err != nil {
+		return err
+	}
+	if _, err := s.bodyWriter.Write(appendEnvelope(nil, 0, data)); err != nil {
+		// Like gRPC, the reason the RPC ended is returned from RecvMsg.
+		return io.EOF
+	}
+	return nil
+}
+
+func (s *httpStream) CloseSend() error {
+	if s.bodyWriter != nil {
+		_ = s.bodyWriter.Close()
+		return nil
+	}
+	s.mu.Lock()
+	if s.sent || s.err != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.req == nil {
+		s.mu.Unlock()
+		return status.Error(codes.Internal, "no request message was sent")
+	}
+	s.sent = true
+	body := appendEnvelope(nil, 0, s.req)
+	s.mu.Unlock()
+
+	defer close(s.ready)
+	contentType := "application/grpc-web+proto"
+	if s.ch.protocol == ProtocolConnect {
+		contentType = "application/connect+proto"
+	}
+	req, err := s.ch.newRequest(s.ctx, s.method, contentType, bytes.NewReader(body))
+	if err != nil {
+		s.finish(err)
+		return nil
+	}
+	resp, err := s.ch.client.Do(req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// like gRPC, errors are reported when receiving messages
+		s.finishLocked(httpTransportError(s.ctx, err))
+		return nil
+	}
+	s.handleResponseLocked(resp)
+	return nil
+}
+
+func (s *httpStream) handleResponseLocked(resp *http.Response) {
+	if s.err != nil {
+		// stream was finished while the request was being sent
+		_ = resp.Body.Close()
+		return
+	}
+	s.resp = resp
+	s.header = metadataFromHeaders(resp.Header)
+	if resp.StatusCode != http.StatusOK {
+		if s.ch.protocol == ProtocolConnect {
+			s.finishLocked(connectError(resp.StatusCode, readErrorBody(resp.Body, s.ch.maxReceiveSize)))
+		} else {
+			s.finishLocked(status.Error(codeFromHTTPStatus(resp.StatusCode), http.StatusText(resp.StatusCode)))
+		}
+		return
+	}
+	if s.ch.protocol == ProtocolGRPCWeb && resp.Header.Get("Grpc-Status") != "" {
+		// trailers-only response: the status is in the headers
+		s.trailer = s.header
+		s.finishLocked(grpcWebStatus(resp.Header))
+	}
+}
+
+func (s *httpStream) RecvMsg(m any) error {
+	if err := s.waitReady(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	resp, err := s.resp, s.err
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// The body is read without holding the lock. If the stream is finished
+	// concurrently, closing the body interrupts the read.
+	flags, data, err := readEnvelope(resp.Body, s.ch.maxReceiveSize)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = status.Errorf(codes.Internal, "%v response ended without a status", s.ch.protocol)
+		} else {
+			err = readError(s.ctx, err)
+		}
+		s.finishLocked(err)
+		return err
+	}
+	switch {
+	case flags&flagCompressed != 0:
+		s.finishLocked(status.Error(codes.Internal, "received compressed message but compression was not requested"))
+	case s.ch.protocol == ProtocolConnect && flags&flagConnectEndStream != 0:
+		s.finishLocked(s.connectEndStream(data))
+	case s.ch.protocol == ProtocolGRPCWeb && flags&flagGRPCWebTrailers != 0:
+		s.finishLocked(s.grpcWebTrailers(data))
+	default:
+		if err := unmarshalMessage(data, m); err != nil {
+			s.finishLocked(err)
+			return err
+		}
+		return nil
+	}
+	return s.err
+}
+
+func (s *httpStream) connectEndStream(data []byte) error {
+	var endStream struct {
+		Error    *connectErrorJSON   `json:"error"`
+		Metadata map[string][]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &endStream); err != nil {
+		return status.Errorf(codes.Internal, "invalid end-of-stream message: %v", err)
+	}
+	s.trailer = metadataFromHeaders(endStream.Metadata)
+	if endStream.Error != nil {
+		return endStream.Error.asError()
+	}
+	return io.EOF
+}
+
+func (s *httpStream) grpcWebTrailers(data []byte) error {
+	// trailers are formatted like an HTTP/1.1 header block
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(data, "\r\n"...))))
+	mimeHeader, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return status.Errorf(codes.Internal, "invalid trailers: %v", err)
+	}
+	s.trailer = metadataFromHeaders(mimeHeader)
+	return grpcWebStatus(http.Header(mimeHeader))
+}
+
+func (s *httpStream) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finishLocked(err)
+}
+
+func (s *httpStream) finishLocked(err error) {
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	if s.resp != nil {
+		_ = s.resp.Body.Close()
+	}
+	if s.bodyReader != nil {
+		// unblock any pending SendMsg
+		_ = s.bodyReader.CloseWithError(io.ErrClosedPipe)
+	}
+	s.cancel()
+}
+
+const (
+	flagCompressed       = 0x01
+	flagConnectEndStream = 0x02
+	flagGRPCWebTrailers  = 0x80
+)
+
+func appendEnvelope(buf []byte, flags byte, data []byte) []byte {
+	buf = append(buf, flags)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	return append(buf, data...)
+}
+
+// readEnvelope reads one enveloped message from r. If the envelope says the
+// message is larger than maxSize, an error is returned without reading or
+// allocating space for it.
+func readEnvelope(r io.Reader, maxSize int) (byte, []byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if uint64(size) > uint64(maxSize) {
+		return 0, nil, messageTooLarge(uint64(size), maxSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return prefix[0], data, nil
+}
+
+// readMessage reads all of r, which is a message that must be no larger than
+// maxSize.
+func readMessage(r io.Reader, maxSize int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, messageTooLarge(uint64(len(data)), maxSize)
+	}
+	return data, nil
+}
+
+// readErrorBody reads the body of a response that indicates an error. Errors
+// reading it are ignored, and it is truncated if larger than maxSize, since
+// the response's HTTP status is used when the body cannot be parsed.
+func readErrorBody(r io.Reader, maxSize int) []byte {
+	data, _ := io.ReadAll(io.LimitReader(r, int64(maxSize)))
+	return data
+}
+
+func messageTooLarge(size uint64, maxSize int) error {
+	return status.Errorf(codes.ResourceExhausted, "received message larger than max (%d vs. %d)", size, maxSize)
+}
+
+// readError converts an error from reading a response body into an error
+// with a gRPC status.
+func readError(ctx context.Context, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return httpTransportError(ctx, err)
+}
+
+func marshalMessage(m any) ([]byte, error) {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "message is %T, not a proto.Message", m)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to marshal request: %v", err)
+	}
+	return data, nil
+}
+
+func unmarshalMessage(data []byte, m any) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "message is %T, not a proto.Message", m)
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return status.Errorf(codes.Internal, "failed to unmarshal response: %v", err)
+	}
+	return nil
+}
+
+func setResponseMetadata(opts []grpc.CallOption, header, trailer metadata.MD) {
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			*opt.HeaderAddr = header
+		case *grpc.HeaderCallOption:
+			*opt.HeaderAddr = header
+		case grpc.TrailerCallOption:
+			*opt.TrailerAddr = trailer
+		case *grpc.TrailerCallOption:
+			*opt.TrailerAddr = trailer
+		}
+	}
+}
+
+func metadataFromHeaders[H ~map[string][]string](headers H) metadata.MD {
+	md := metadata.MD{}
+	for key, vals := range headers {
+		key = strings.ToLower(key)
+		switch key {
+		case "grpc-status", "grpc-message", "grpc-status-details-bin":
+			continue
+		}
+		for _, val := range vals {
+			if strings.HasSuffix(key, "-bin") {
+				if decoded, err := decodeBinaryHeader(val); err == nil {
+					val = string(decoded)
+				}
+			}
+			md[key] = append(md[key], val)
+		}
+	}
+	return md
+}
+
+func decodeBinaryHeader(val string) ([]byte, error) {
+	// padding is optional
+	if len(val)%4 == 0 {
+		return base64.StdEncoding.DecodeString(val)
+	}
+	return base64.RawStdEncoding.DecodeString(val)
+}
+
+func httpTransportError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+func grpcWebStatus(headers http.Header) error {
+	if details := headers.Get("Grpc-Status-Details-Bin"); details != "" {
+		if data, err := decodeBinaryHeader(details); err == nil {
+			var st spb.Status
+			if proto.Unmarshal(data, &st) == nil {
+				if st.Code == int32(codes.OK) {
+					return io.EOF
+				}
+				return status.FromProto(&st).Err()
+			}
+		}
+	}
+	code, err := strconv.Atoi(headers.Get("Grpc-Status"))
+	if err != nil {
+		return status.Errorf(codes.Internal, "invalid grpc-status %q", headers.Get("Grpc-Status"))
+	}
+	if code == int(codes.OK) {
+		return io.EOF
+	}
+	msg := headers.Get("Grpc-Message")
+	if unescaped, err := url.PathUnescape(msg); err == nil {
+		msg = unescaped
+	}
+	return status.Error(codes.Code(code), msg)
+}
+
+type connectErrorJSON struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"details"`
+}
+
+func (e *connectErrorJSON) asError() error {
+	st := &spb.Status{Code: int32(codes.Unknown), Message: e.Message}
+	if code, ok := connectCodes[e.Code]; ok {
+		st.Code = int32(code)
+	}
+	for _, detail := range e.Details {
+		value, err := decodeBinaryHeader(detail.Value)
+		if err != nil {
+			continue
+		}
+		st.Details = append(st.Details, &anypb.Any{TypeUrl: "type.googleapis.com/" + detail.Type, Value: value})
+	}
+	return status.FromProto(st).Err()
+}
+
+func connectError(httpStatus int, body []byte) error {
+	var connErr connectErrorJSON
+	if err := json.Unmarshal(body, &connErr); err != nil || connErr.Code == "" {
+		return status.Error(codeFromHTTPStatus(httpStatus), http.StatusText(httpStatus))
+	}
+	return connErr.asError()
+}
+
+// connectCodes maps the names of codes in the Connect protocol to gRPC codes.
+// They are the same as the gRPC names, but in lower-case.
+var connectCodes = func() map[string]codes.Code {
+	m := make(map[string]codes.Code, len(codeMappings))
+	for code, mapping := range codeMappings {
+		m[strings.ToLower(mapping.name)] = codes.Code(code)
+	}
+	// spelled differently in Connect
+	m["canceled"] = codes.Canceled
+	return m
+}()
+
+// codeFromHTTPStatus returns the code for a response whose HTTP status is not
+// 200 and that does not otherwise indicate a code. This uses the mapping in
+// https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md,
+// which is also used by the Connect protocol.
+func codeFromHTTPStatus(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
@@ -0,0 +1,402 @@
+package grpcdynamic
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	grpctestprotos "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+)
+
+func TestHTTPChannel(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(serveHTTPTestService))
+	defer svr.Close()
+
+	for _, protocol := range []HTTPProtocol{ProtocolConnect, ProtocolGRPCWeb} {
+		t.Run(protocol.String(), func(t *testing.T) {
+			stub := NewStub(NewHTTPChannel(svr.Client(), svr.URL, protocol))
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "x-test", "abc", "x-test-bin", "\x00\x01")
+
+			var header, trailer metadata.MD
+			resp, err := stub.InvokeRpc(ctx, unaryMd, &grpctestprotos.SimpleRequest{Payload: payload}, grpc.Header(&header), grpc.Trailer(&trailer))
+			require.NoError(t, err)
+			require.True(t, proto.Equal(&grpctestprotos.SimpleResponse{Payload: payload}, resp))
+			require.Equal(t, []string{"abc"}, header.Get("x-echo"))
+			require.Equal(t, []string{"\x00\x01"}, header.Get("x-echo-bin"))
+			require.Equal(t, []string{"done"}, trailer.Get("x-trailer"))
+
+			ss, err := stub.InvokeRpcServerStream(ctx, serverStreamingMd, &grpctestprotos.StreamingOutputCallRequest{
+				Payload:            payload,
+				ResponseParameters: []*grpctestprotos.ResponseParameters{{}, {}, {}},
+			})
+			require.NoError(t, err)
+			header, err = ss.Header()
+			require.NoError(t, err)
+			require.Equal(t, []string{"abc"}, header.Get("x-echo"))
+			msgs, err := ss.Collect(context.Background(), 0, 0)
+			require.NoError(t, err)
+			require.Len(t, msgs, 3)
+			for _, msg := range msgs {
+				require.True(t, proto.Equal(&grpctestprotos.StreamingOutputCallResponse{Payload: payload}, msg))
+			}
+			require.Equal(t, []string{"done"}, ss.Trailer().Get("x-trailer"))
+
+			// errors
+			failCtx := metadata.AppendToOutgoingContext(ctx, "x-fail", "true")
+			_, err = stub.InvokeRpc(failCtx, unaryMd, &grpctestprotos.SimpleRequest{Payload: payload})
+			checkHTTPTestError(t, err)
+			ss, err = stub.InvokeRpcServerStream(failCtx, serverStreamingMd, &grpctestprotos.StreamingOutputCallRequest{
+				ResponseParameters: []*grpctestprotos.ResponseParameters{{}},
+			})
+			require.NoError(t, err)
+			msgs, err = ss.Collect(context.Background(), 0, 0)
+			require.Len(t, msgs, 1)
+			checkHTTPTestError(t, err)
+
+			if protocol == ProtocolGRPCWeb {
+				_, err = stub.InvokeRpcClientStream(ctx, clientStreamingMd)
+				require.Equal(t, codes.Unimplemented, status.Code(err))
+				_, err = stub.InvokeRpcBidiStream(ctx, bidiStreamingMd)
+				require.Equal(t, codes.Unimplemented, status.Code(err))
+			} else {
+				testHTTPChannelClientStreams(t, ctx, stub)
+			}
+			// server doesn't implement this method, so it returns 404
+			emptyMd := unaryMd.Parent().(protoreflect.ServiceDescriptor).Methods().ByName("EmptyCall")
+			_, err = stub.InvokeRpc(ctx, emptyMd, &emptypb.Empty{})
+			require.Equal(t, codes.Unimplemented, status.Code(err))
+		})
+	}
+}
+
+func TestHTTPChannel_MaxReceiveMessageSize(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(serveHTTPTestService))
+	defer svr.Close()
+	// claims a huge message, but doesn't actually send it
+	hugeSvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		_, _ = w.Write([]byte{0, 0xff, 0xff, 0xff, 0xff})
+	}))
+	defer hugeSvr.Close()
+
+	for _, protocol := range []HTTPProtocol{ProtocolConnect, ProtocolGRPCWeb} {
+		t.Run(protocol.String(), func(t *testing.T) {
+			ctx := context.Background()
+			// larger than the end-of-stream message or trailers, which are also
+			// subject to the limit
+			payload := &grpctestprotos.Payload{Body: bytes.Repeat([]byte{1}, 100)}
+			req := &grpctestprotos.StreamingOutputCallRequest{
+				Payload:            payload,
+				ResponseParameters: []*grpctestprotos.ResponseParameters{{}},
+			}
+			size := proto.Size(&grpctestprotos.SimpleResponse{Payload: payload})
+
+			// exactly at the limit is allowed
+			stub := NewStub(NewHTTPChannel(svr.Client(), svr.URL, protocol, WithMaxReceiveMessageSize(size)))
+			_, err := stub.InvokeRpc(ctx, unaryMd, &grpctestprotos.SimpleRequest{Payload: payload})
+			require.NoError(t, err)
+			ss, err := stub.InvokeRpcServerStream(ctx, serverStreamingMd, req)
+			require.NoError(t, err)
+			_, err = ss.Collect(ctx, 0, 0)
+			require.NoError(t, err)
+
+			stub = NewStub(NewHTTPChannel(svr.Client(), svr.URL, protocol, WithMaxReceiveMessageSize(size-1)))
+			_, err = stub.InvokeRpc(ctx, unaryMd, &grpctestprotos.SimpleRequest{Payload: payload})
+			require.Equal(t, codes.ResourceExhausted, status.Code(err), "%v", err)
+			ss, err = stub.InvokeRpcServerStream(ctx, serverStreamingMd, req)
+			require.NoError(t, err)
+			_, err = ss.Collect(ctx, 0, 0)
+			require.Equal(t, codes.ResourceExhausted, status.Code(err), "%v", err)
+
+			// default limit
+			stub = NewStub(NewHTTPChannel(hugeSvr.Client(), hugeSvr.URL, protocol))
+			ss, err = stub.InvokeRpcServerStream(ctx, serverStreamingMd, req)
+			require.NoError(t, err)
+			_, err = ss.Collect(ctx, 0, 0)
+			require.Equal(t, codes.ResourceExhausted, status.Code(err), "%v", err)
+			require.ErrorContains(t, err, "received message larger than max (4294967295 vs. 4194304)")
+		})
+	}
+}
+
+func TestHTTPChannel_HeaderWhileReceiving(t *testing.T) {
+	// sends headers, and then blocks until the request is cancelled
+	blockingSvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("X-Echo", "abc")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer blockingSvr.Close()
+
+	for _, protocol := range []HTTPProtocol{ProtocolConnect, ProtocolGRPCWeb} {
+		t.Run(protocol.String(), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stub := NewStub(NewHTTPChannel(blockingSvr.Client(), blockingSvr.URL, protocol))
+			ss, err := stub.InvokeRpcServerStream(ctx, serverStreamingMd, &grpctestprotos.StreamingOutputCallRequest{
+				ResponseParameters: []*grpctestprotos.ResponseParameters{{}},
+			})
+			require.NoError(t, err)
+
+			recvErr := make(chan error, 1)
+			go func() {
+				_, err := ss.RecvMsg()
+				recvErr <- err
+			}()
+			// give RecvMsg a chance to block reading the body
+			select {
+			case err := <-recvErr:
+				t.Fatalf("RecvMsg should have blocked, instead returned %v", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			// these must not wait for RecvMsg
+			done := make(chan struct{})
+			var header, trailer metadata.MD
+			go func() {
+				defer close(done)
+				header, err = ss.Header()
+				trailer = ss.Trailer()
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Header and Trailer blocked while RecvMsg was in progress")
+			}
+			require.NoError(t, err)
+			require.Equal(t, []string{"abc"}, header.Get("x-echo"))
+			require.Nil(t, trailer)
+
+			cancel()
+			select {
+			case err := <-recvErr:
+				require.Equal(t, codes.Canceled, status.Code(err), "%v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("RecvMsg did not return after cancellation")
+			}
+		})
+	}
+}
+
+func testHTTPChannelClientStreams(t *testing.T, ctx context.Context, stub *Stub) {
+	cs, err := stub.InvokeRpcClientStream(ctx, clientStreamingMd)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, cs.SendMsg(&grpctestprotos.StreamingInputCallRequest{Payload: payload}))
+	}
+	resp, err := cs.CloseAndReceive()
+	require.NoError(t, err)
+	require.True(t, proto.Equal(&grpctestprotos.StreamingInputCallResponse{AggregatedPayloadSize: int32(3 * len(payload.Body))}, resp))
+	header, err := cs.Header()
+	require.NoError(t, err)
+	require.Equal(t, []string{"abc"}, header.Get("x-echo"))
+	require.Equal(t, []string{"done"}, cs.Trailer().Get("x-trailer"))
+
+	// The test server is HTTP/1.1, which is half-duplex, so all requests
+	// are sent before receiving any responses.
+	bs, err := stub.InvokeRpcBidiStream(ctx, bidiStreamingMd)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, bs.SendMsg(&grpctestprotos.StreamingOutputCallRequest{
+			Payload:            payload,
+			ResponseParameters: []*grpctestprotos.ResponseParameters{{}, {}},
+		}))
+	}
+	require.NoError(t, bs.CloseSend())
+	var count int
+	for {
+		msg, err := bs.RecvMsg()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.True(t, proto.Equal(&grpctestprotos.StreamingOutputCallResponse{Payload: payload}, msg))
+		count++
+	}
+	require.Equal(t, 4, count)
+	require.Equal(t, []string{"done"}, bs.Trailer().Get("x-trailer"))
+
+	// errors
+	failCtx := metadata.AppendToOutgoingContext(ctx, "x-fail", "true")
+	cs, err = stub.InvokeRpcClientStream(failCtx, clientStreamingMd)
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(&grpctestprotos.StreamingInputCallRequest{Payload: payload}))
+	_, err = cs.CloseAndReceive()
+	checkHTTPTestError(t, err)
+}
+
+func checkHTTPTestError(t *testing.T, err error) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	require.True(t, ok, "not a status error: %v", err)
+	require.Equal(t, codes.FailedPrecondition, st.Code())
+	require.Equal(t, "failed: 100% intentional", st.Message())
+	require.Len(t, st.Details(), 1)
+	require.True(t, proto.Equal(wrapperspb.String("detail"), st.Details()[0].(proto.Message)))
+}
+
+// serveHTTPTestService is a minimal server for the Connect and gRPC-Web
+// protocols that implements the methods of grpc.testing.TestService, except
+// for EmptyCall. It reads all request messages before sending responses.
+func serveHTTPTestService(w http.ResponseWriter, r *http.Request) {
+	connect := r.Header.Get("Connect-Protocol-Version") == "1"
+	enveloped := !connect || r.Header.Get("Content-Type") == "application/connect+proto"
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requests := [][]byte{data}
+	if enveloped {
+		requests = nil
+		for body := bytes.NewReader(data); body.Len() > 0; {
+			_, data, err = readEnvelope(body, defaultMaxReceiveMessageSize)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			requests = append(requests, data)
+		}
+	}
+	var responses []proto.Message
+	var aggregatedSize int
+	for _, data := range requests {
+		switch r.URL.Path {
+		case "/grpc.testing.TestService/UnaryCall":
+			var req grpctestprotos.SimpleRequest
+			if err := proto.Unmarshal(data, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			responses = append(responses, &grpctestprotos.SimpleResponse{Payload: req.Payload})
+		case "/grpc.testing.TestService/StreamingInputCall":
+			var req grpctestprotos.StreamingInputCallRequest
+			if err := proto.Unmarshal(data, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			aggregatedSize += len(req.Payload.GetBody())
+		case "/grpc.testing.TestService/StreamingOutputCall", "/grpc.testing.TestService/FullDuplexCall":
+			var req grpctestprotos.StreamingOutputCallRequest
+			if err := proto.Unmarshal(data, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for range req.ResponseParameters {
+				responses = append(responses, &grpctestprotos.StreamingOutputCallResponse{Payload: req.Payload})
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+	}
+	switch r.URL.Path {
+	case "/grpc.testing.TestService/StreamingInputCall":
+		responses = append(responses, &grpctestprotos.StreamingInputCallResponse{AggregatedPayloadSize: int32(aggregatedSize)})
+	case "/grpc.testing.TestService/UnaryCall",
+		"/grpc.testing.TestService/StreamingOutputCall",
+		"/grpc.testing.TestService/FullDuplexCall":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("X-Echo", r.Header.Get("X-Test"))
+	w.Header().Set("X-Echo-Bin", r.Header.Get("X-Test-Bin"))
+	var st *status.Status
+	if r.Header.Get("X-Fail") != "" {
+		st, _ = status.New(codes.FailedPrecondition, "failed: 100% intentional").WithDetails(wrapperspb.String("detail"))
+		if !enveloped {
+			// unary errors have no response messages
+			responses = nil
+		} else {
+			responses = responses[:1]
+		}
+	}
+
+	if !enveloped {
+		// Connect unary
+		if st != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(connectErrorForTest(st))
+			return
+		}
+		w.Header().Set("Content-Type", "application/proto")
+		w.Header().Set("Trailer-X-Trailer", "done")
+		data, _ := proto.Marshal(responses[0])
+		_, _ = w.Write(data)
+		return
+	}
+
+	if connect {
+		w.Header().Set("Content-Type", "application/connect+proto")
+	} else {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+	}
+	var out []byte
+	for _, resp := range responses {
+		data, _ := proto.Marshal(resp)
+		out = appendEnvelope(out, 0, data)
+	}
+	if connect {
+		endStream := map[string]any{"metadata": map[string][]string{"x-trailer": {"done"}}}
+		if st != nil {
+			endStream["error"] = json.RawMessage(connectErrorForTest(st))
+		}
+		data, _ := json.Marshal(endStream)
+		out = appendEnvelope(out, flagConnectEndStream, data)
+	} else {
+		trailers := "x-trailer: done\r\n"
+		if st != nil {
+			details, _ := proto.Marshal(st.Proto())
+			trailers += fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\ngrpc-status-details-bin: %s\r\n",
+				st.Code(), url.PathEscape(st.Message()), base64.RawStdEncoding.EncodeToString(details))
+		} else {
+			trailers += "grpc-status: 0\r\n"
+		}
+		out = appendEnvelope(out, flagGRPCWebTrailers, []byte(trailers))
+	}
+	_, _ = w.Write(out)
+}
+
+func connectErrorForTest(st *status.Status) []byte {
+	type detail struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	var details []detail
+	for _, d := range st.Proto().Details {
+		details = append(details, detail{
+			Type:  strings.TrimPrefix(d.TypeUrl, "type.googleapis.com/"),
+			Value: base64.RawStdEncoding.EncodeToString(d.Value),
+		})
+	}
+	data, _ := json.Marshal(map[string]any{
+		"code":    "failed_precondition",
+		"message": st.Message(),
+		"details": details,
+	})
+	return data
+}
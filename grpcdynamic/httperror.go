@@ -0,0 +1,150 @@
+package grpcdynamic
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// ProblemContentType is the media type of the body written by
+// WriteProblemDetails.
+const ProblemContentType = "application/problem+json"
+
+// HTTPStatusFromCode returns the HTTP status code that corresponds to the
+// given gRPC status code. This uses the same mapping as HTTP/JSON transcoding
+// gateways, which is documented in google/rpc/code.proto. Unrecognized codes
+// map to 500 (Internal Server Error).
+func HTTPStatusFromCode(code codes.Code) int {
+	if int(code) < len(codeMappings) {
+		return codeMappings[code].httpStatus
+	}
+	return http.StatusInternalServerError
+}
+
+// ProblemDetails is an HTTP API error response, as described by RFC 9457,
+// that represents a gRPC error. In addition to the standard members, it
+// includes the name of the gRPC code and any rich error details that were
+// attached to the gRPC status. So, when marshaled to JSON, it is a superset of
+// the google.rpc.Status JSON format: the Code field holds the name of the code
+// instead of its numeric value, as in the JSON format used by many REST
+// gateways.
+type ProblemDetails struct {
+	// A URI that identifies the problem type. Since the problem is fully
+	// described by the status code, this is always "about:blank".
+	Type string `json:"type"`
+	// A short summary of the problem. This is the text for the HTTP status.
+	Title string `json:"title"`
+	// The HTTP status code.
+	Status int `json:"status"`
+	// The message from the gRPC status.
+	Detail string `json:"detail,omitempty"`
+	// The name of the gRPC status code, like "NOT_FOUND".
+	Code string `json:"code"`
+	// The rich error details attached to the gRPC status, each formatted as
+	// the JSON form of a google.protobuf.Any.
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// NewProblemDetails converts the given error, which is typically returned from
+// one of the Invoke* methods of a Stub, into problem details. Errors that do
+// not carry a gRPC status are treated as having code Unknown, unless they are
+// context errors, in which case the code is Canceled or DeadlineExceeded.
+//
+// The given resolver is used to format the status's rich error details. If it
+// is nil, protoregistry.GlobalTypes is used. Details whose types cannot be
+// resolved are formatted with their raw bytes, base64-encoded, in a "value"
+// property.
+//
+// This returns nil if err is nil.
+func NewProblemDetails(err error, res protoresolve.SerializationResolver) *ProblemDetails {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		st = status.FromContextError(err)
+	}
+	if res == nil {
+		res = protoregistry.GlobalTypes
+	}
+	httpStatus := HTTPStatusFromCode(st.Code())
+	problem := &ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(httpStatus),
+		Status: httpStatus,
+		Detail: st.Message(),
+		Code:   codeName(st.Code()),
+	}
+	for _, detail := range st.Proto().GetDetails() {
+		problem.Details = append(problem.Details, detailToJSON(detail, res))
+	}
+	return problem
+}
+
+// WriteProblemDetails writes the given error to w as an HTTP response whose
+// body is problem details, as computed by NewProblemDetails. If err is nil, it
+// is treated as an error with code Unknown.
+func WriteProblemDetails(w http.ResponseWriter, err error, res protoresolve.SerializationResolver) error {
+	problem := NewProblemDetails(err, res)
+	if problem == nil {
+		problem = NewProblemDetails(status.Error(codes.Unknown, ""), res)
+	}
+	data, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	_, err = w.Write(data)
+	return err
+}
+
+func detailToJSON(detail *anypb.Any, res protoresolve.SerializationResolver) json.RawMessage {
+	data, err := protojson.MarshalOptions{Resolver: res}.Marshal(detail)
+	if err == nil {
+		return data
+	}
+	data, _ = json.Marshal(map[string]string{
+		"@type": detail.GetTypeUrl(),
+		"value": base64.StdEncoding.EncodeToString(detail.GetValue()),
+	})
+	return data
+}
+
+func codeName(code codes.Code) string {
+	if int(code) < len(codeMappings) {
+		return codeMappings[code].name
+	}
+	return codeMappings[codes.Unknown].name
+}
+
+var codeMappings = [...]struct {
+	name       string
+	httpStatus int
+}{
+	codes.OK:                 {"OK", http.StatusOK},
+	codes.Canceled:           {"CANCELLED", 499}, // Client Closed Request
+	codes.Unknown:            {"UNKNOWN", http.StatusInternalServerError},
+	codes.InvalidArgument:    {"INVALID_ARGUMENT", http.StatusBadRequest},
+	codes.DeadlineExceeded:   {"DEADLINE_EXCEEDED", http.StatusGatewayTimeout},
+	codes.NotFound:           {"NOT_FOUND", http.StatusNotFound},
+	codes.AlreadyExists:      {"ALREADY_EXISTS", http.StatusConflict},
+	codes.PermissionDenied:   {"PERMISSION_DENIED", http.StatusForbidden},
+	codes.ResourceExhausted:  {"RESOURCE_EXHAUSTED", http.StatusTooManyRequests},
+	codes.FailedPrecondition: {"FAILED_PRECONDITION", http.StatusBadRequest},
+	codes.Aborted:            {"ABORTED", http.StatusConflict},
+	codes.OutOfRange:         {"OUT_OF_RANGE", http.StatusBadRequest},
+	codes.Unimplemented:      {"UNIMPLEMENTED", http.StatusNotImplemented},
+	codes.Internal:           {"INTERNAL", http.StatusInternalServerError},
+	codes.Unavailable:        {"UNAVAILABLE", http.StatusServiceUnavailable},
+	codes.DataLoss:           {"DATA_LOSS", http.StatusInternalServerError},
+	codes.Unauthenticated:    {"UNAUTHENTICATED", http.StatusUnauthorized},
+}
@@ -0,0 +1,70 @@
+package grpcdynamic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	require.Equal(t, http.StatusOK, HTTPStatusFromCode(codes.OK))
+	require.Equal(t, 499, HTTPStatusFromCode(codes.Canceled))
+	require.Equal(t, http.StatusNotFound, HTTPStatusFromCode(codes.NotFound))
+	require.Equal(t, http.StatusBadRequest, HTTPStatusFromCode(codes.FailedPrecondition))
+	require.Equal(t, http.StatusTooManyRequests, HTTPStatusFromCode(codes.ResourceExhausted))
+	require.Equal(t, http.StatusUnauthorized, HTTPStatusFromCode(codes.Unauthenticated))
+	require.Equal(t, http.StatusInternalServerError, HTTPStatusFromCode(codes.Code(100)))
+}
+
+func TestNewProblemDetails(t *testing.T) {
+	require.Nil(t, NewProblemDetails(nil, nil))
+
+	problem := NewProblemDetails(fmt.Errorf("wrapped: %w", context.DeadlineExceeded), nil)
+	require.Equal(t, &ProblemDetails{
+		Type:   "about:blank",
+		Title:  "Gateway Timeout",
+		Status: http.StatusGatewayTimeout,
+		Detail: "wrapped: context deadline exceeded",
+		Code:   "DEADLINE_EXCEEDED",
+	}, problem)
+
+	problem = NewProblemDetails(fmt.Errorf("not a status"), nil)
+	require.Equal(t, http.StatusInternalServerError, problem.Status)
+	require.Equal(t, "UNKNOWN", problem.Code)
+}
+
+func TestWriteProblemDetails(t *testing.T) {
+	known, err := anypb.New(durationpb.New(1500000000))
+	require.NoError(t, err)
+	unknown := &anypb.Any{TypeUrl: "type.googleapis.com/foo.Bar", Value: []byte{1, 2, 3}}
+	stProto := status.New(codes.NotFound, "no such book").Proto()
+	stProto.Details = []*anypb.Any{known, unknown}
+	st := status.FromProto(stProto)
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, WriteProblemDetails(rec, st.Err(), nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, ProblemContentType, rec.Header().Get("Content-Type"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, map[string]any{
+		"type":   "about:blank",
+		"title":  "Not Found",
+		"status": float64(404),
+		"detail": "no such book",
+		"code":   "NOT_FOUND",
+		"details": []any{
+			map[string]any{"@type": "type.googleapis.com/google.protobuf.Duration", "value": "1.500s"},
+			map[string]any{"@type": "type.googleapis.com/foo.Bar", "value": "AQID"},
+		},
+	}, body)
+}
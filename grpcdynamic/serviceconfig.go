@@ -0,0 +1,361 @@
+package grpcdynamic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxAttemptsLimit is the upper bound on the number of attempts for a retry
+// or hedging policy. Larger values in a service config are reduced to this,
+// like the gRPC runtime does.
+const maxAttemptsLimit = 5
+
+// ServiceConfig is the per-method configuration from a gRPC service config.
+// It is used with WithServiceConfig to apply timeouts, retry policies, and
+// hedging policies to RPCs sent by a Stub.
+type ServiceConfig struct {
+	// keyed by "service/method", "service/" for all methods of a service,
+	// or "/" for the default config
+	methods map[string]*methodConfig
+}
+
+type methodConfig struct {
+	timeout time.Duration
+	retry   *retryPolicy
+	hedging *hedgingPolicy
+}
+
+type retryPolicy struct {
+	maxAttempts       int
+	initialBackoff    time.Duration
+	maxBackoff        time.Duration
+	backoffMultiplier float64
+	retryableCodes    map[codes.Code]bool
+}
+
+type hedgingPolicy struct {
+	maxAttempts   int
+	hedgingDelay  time.Duration
+	nonFatalCodes map[codes.Code]bool
+}
+
+// ParseServiceConfig parses the given gRPC service config, in JSON format.
+// This is the same format accepted by grpc.WithDefaultServiceConfig. Only
+// the "methodConfig" entries of the service config are used; other settings,
+// like load balancing configuration, are ignored.
+//
+// An error is returned if the JSON is malformed or if a method config is
+// invalid, for example if it has both a retry policy and a hedging policy,
+// or if more than one method config has the same name.
+func ParseServiceConfig(data []byte) (*ServiceConfig, error) {
+	var cfg struct {
+		MethodConfig []struct {
+			Name []struct {
+				Service string `json:"service"`
+				Method  string `json:"method"`
+			} `json:"name"`
+			Timeout     *string `json:"timeout"`
+			RetryPolicy *struct {
+				MaxAttempts          int          `json:"maxAttempts"`
+				InitialBackoff       string       `json:"initialBackoff"`
+				MaxBackoff           string       `json:"maxBackoff"`
+				BackoffMultiplier    float64      `json:"backoffMultiplier"`
+				RetryableStatusCodes []codes.Code `json:"retryableStatusCodes"`
+			} `json:"retryPolicy"`
+			HedgingPolicy *struct {
+				MaxAttempts         int          `json:"maxAttempts"`
+				HedgingDelay        *string      `json:"hedgingDelay"`
+				NonFatalStatusCodes []codes.Code `json:"nonFatalStatusCodes"`
+			} `json:"hedgingPolicy"`
+		} `json:"methodConfig"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse service config: %w", err)
+	}
+
+	result := &ServiceConfig{methods: map[string]*methodConfig{}}
+	for i, jsonConfig := range cfg.MethodConfig {
+		var mc methodConfig
+		if jsonConfig.Timeout != nil {
+			timeout, err := parseDuration(*jsonConfig.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("method config #%d: invalid timeout: %w", i+1, err)
+			}
+			mc.timeout = timeout
+		}
+		if jsonConfig.RetryPolicy != nil && jsonConfig.HedgingPolicy != nil {
+			return nil, fmt.Errorf("method config #%d: cannot have both a retry policy and a hedging policy", i+1)
+		}
+		if rp := jsonConfig.RetryPolicy; rp != nil {
+			if rp.MaxAttempts <= 1 {
+				return nil, fmt.Errorf("method config #%d: retry policy: maxAttempts must be greater than 1", i+1)
+			}
+			initialBackoff, err := parseDuration(rp.InitialBackoff)
+			if err != nil || initialBackoff <= 0 {
+				return nil, fmt.Errorf("method config #%d: retry policy: initialBackoff must be a positive duration", i+1)
+			}
+			maxBackoff, err := parseDuration(rp.MaxBackoff)
+			if err != nil || maxBackoff <= 0 {
+				return nil, fmt.Errorf("method config #%d: retry policy: maxBackoff must be a positive duration", i+1)
+			}
+			if rp.BackoffMultiplier <= 0 {
+				return nil, fmt.Errorf("method config #%d: retry policy: backoffMultiplier must be positive", i+1)
+			}
+			if len(rp.RetryableStatusCodes) == 0 {
+				return nil, fmt.Errorf("method config #%d: retry policy: retryableStatusCodes must not be empty", i+1)
+			}
+			mc.retry = &retryPolicy{
+				maxAttempts:       min(rp.MaxAttempts, maxAttemptsLimit),
+				initialBackoff:    initialBackoff,
+				maxBackoff:        maxBackoff,
+				backoffMultiplier: rp.BackoffMultiplier,
+				retryableCodes:    codeSet(rp.RetryableStatusCodes),
+			}
+		}
+		if hp := jsonConfig.HedgingPolicy; hp != nil {
+			if hp.MaxAttempts <= 1 {
+				return nil, fmt.Errorf("method config #%d: hedging policy: maxAttempts must be greater than 1", i+1)
+			}
+			var delay time.Duration
+			if hp.HedgingDelay != nil {
+				var err error
+				delay, err = parseDuration(*hp.HedgingDelay)
+				if err != nil {
+					return nil, fmt.Errorf("method config #%d: hedging policy: invalid hedgingDelay: %w", i+1, err)
+				}
+			}
+			mc.hedging = &hedgingPolicy{
+				maxAttempts:   min(hp.MaxAttempts, maxAttemptsLimit),
+				hedgingDelay:  delay,
+				nonFatalCodes: codeSet(hp.NonFatalStatusCodes),
+			}
+		}
+		for _, name := range jsonConfig.Name {
+			if name.Service == "" && name.Method != "" {
+				return nil, fmt.Errorf("method config #%d: name with method %q must also have a service", i+1, name.Method)
+			}
+			key := name.Service + "/" + name.Method
+			if _, ok := result.methods[key]; ok {
+				return nil, fmt.Errorf("method config #%d: duplicate name %q", i+1, key)
+			}
+			result.methods[key] = &mc
+		}
+	}
+	return result, nil
+}
+
+// parseDuration parses a duration in the JSON format for google.protobuf.Duration,
+// which is a number of seconds with an "s" suffix, like "1.5s".
+func parseDuration(s string) (time.Duration, error) {
+	if !strings.HasSuffix(s, "s") {
+		return 0, fmt.Errorf("%q is not a valid duration: missing \"s\" suffix", s)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid duration", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%q is not a valid duration: must not be negative", s)
+	}
+	return d, nil
+}
+
+func codeSet(codeList []codes.Code) map[codes.Code]bool {
+	set := make(map[codes.Code]bool, len(codeList))
+	for _, code := range codeList {
+		set[code] = true
+	}
+	return set
+}
+
+// forMethod returns the config for the given method, or nil if there is none.
+func (c *ServiceConfig) forMethod(md protoreflect.MethodDescriptor) *methodConfig {
+	if c == nil {
+		return nil
+	}
+	svc := string(md.Parent().FullName())
+	if mc, ok := c.methods[svc+"/"+string(md.Name())]; ok {
+		return mc
+	}
+	if mc, ok := c.methods[svc+"/"]; ok {
+		return mc
+	}
+	return c.methods["/"]
+}
+
+// WithServiceConfig returns a StubOption that causes a Stub to apply the
+// method configs in the given service config to the RPCs it sends. This
+// gives dynamic RPCs the same service-config-driven behavior that the gRPC
+// runtime provides to generated stubs:
+//   - If a method config has a timeout, it is applied as a deadline to the
+//     RPC's context. If the context already has an earlier deadline, that
+//     deadline is used.
+//   - If a method config has a retry policy, failed unary RPCs are retried
+//     per the policy, with exponential backoff, when they fail with one of
+//     the policy's retryable status codes.
+//   - If a method config has a hedging policy, unary RPCs are hedged per the
+//     policy: additional copies of the RPC are sent, each after the policy's
+//     hedging delay, until one succeeds or fails with a fatal status code.
+//
+// Retry and hedging policies are not applied to streaming RPCs.
+//
+// A *grpc.ClientConn already applies its own service config (such as one
+// provided via grpc.WithDefaultServiceConfig) to RPCs sent by a Stub. So this
+// option is for use with other channels, such as an HTTPChannel. If used with
+// a *grpc.ClientConn that has its own retry or hedging policy, each attempt
+// sent by the Stub may be retried or hedged again by the ClientConn.
+func WithServiceConfig(cfg *ServiceConfig) StubOption {
+	return stubOptionFunc(func(s *Stub) {
+		s.serviceConfig = cfg
+	})
+}
+
+// callContext returns a context for an RPC of the given method, which has
+// the method's configured timeout applied, if any.
+func (mc *methodConfig) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if mc == nil || mc.timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, mc.timeout)
+}
+
+// invoke sends a unary RPC using the given function, applying the method's
+// retry or hedging policy, if any.
+func (mc *methodConfig) invoke(ctx context.Context, opts []grpc.CallOption, call func(context.Context, []grpc.CallOption) (proto.Message, error)) (proto.Message, error) {
+	switch {
+	case mc == nil:
+		return call(ctx, opts)
+	case mc.retry != nil:
+		return mc.retry.invoke(ctx, opts, call)
+	case mc.hedging != nil:
+		return mc.hedging.invoke(ctx, opts, call)
+	default:
+		return call(ctx, opts)
+	}
+}
+
+func (p *retryPolicy) invoke(ctx context.Context, opts []grpc.CallOption, call func(context.Context, []grpc.CallOption) (proto.Message, error)) (proto.Message, error) {
+	backoff := p.initialBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := call(ctx, opts)
+		if err == nil || attempt == p.maxAttempts || !p.retryableCodes[status.Code(err)] {
+			return resp, err
+		}
+		// As in the gRPC runtime, the actual delay is randomized, up to
+		// the current backoff.
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(backoff)) + 1))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		// Computed as a float so it can't overflow. It is at least 1ns since
+		// a multiplier less than 1 can otherwise shrink it to zero.
+		next := float64(backoff) * p.backoffMultiplier
+		if next >= float64(p.maxBackoff) {
+			backoff = p.maxBackoff
+		} else {
+			backoff = max(time.Duration(next), 1)
+		}
+	}
+}
+
+func (p *hedgingPolicy) invoke(ctx context.Context, opts []grpc.CallOption, call func(context.Context, []grpc.CallOption) (proto.Message, error)) (proto.Message, error) {
+	// cancels outstanding attempts once we have a result
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp   proto.Message
+		err    error
+		finish func()
+	}
+	results := make(chan result, p.maxAttempts)
+	sent := 0
+	send := func() {
+		sent++
+		attemptOpts, finish := perAttemptOptions(opts)
+		go func() {
+			resp, err := call(ctx, attemptOpts)
+			results <- result{resp: resp, err: err, finish: finish}
+		}()
+	}
+
+	send()
+	var last result
+	for received := 0; received < sent; {
+		var delay <-chan time.Time
+		var timer *time.Timer
+		if sent < p.maxAttempts {
+			timer = time.NewTimer(p.hedgingDelay)
+			delay = timer.C
+		}
+		select {
+		case <-delay:
+			send()
+		case last = <-results:
+			if timer != nil {
+				timer.Stop()
+			}
+			received++
+			if last.err == nil || !p.nonFatalCodes[status.Code(last.err)] {
+				last.finish()
+				return last.resp, last.err
+			}
+			// A non-fatal failure means the next attempt is sent
+			// immediately, without waiting for the hedging delay.
+			if sent < p.maxAttempts {
+				send()
+			}
+		}
+	}
+	last.finish()
+	return last.resp, last.err
+}
+
+// perAttemptOptions returns a copy of the given call options, suitable for
+// use with concurrent attempts of the same RPC. Options that store values
+// when the RPC completes (such as grpc.Header) are replaced with ones that
+// store the values for the attempt. The returned function copies the
+// values from the attempt to the locations given by the original options.
+// It should be called once it is known which attempt's values to use.
+func perAttemptOptions(opts []grpc.CallOption) ([]grpc.CallOption, func()) {
+	attemptOpts := make([]grpc.CallOption, len(opts))
+	var finishers []func()
+	for i, opt := range opts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			var md metadata.MD
+			attemptOpts[i] = grpc.Header(&md)
+			finishers = append(finishers, func() { *opt.HeaderAddr = md })
+		case grpc.TrailerCallOption:
+			var md metadata.MD
+			attemptOpts[i] = grpc.Trailer(&md)
+			finishers = append(finishers, func() { *opt.TrailerAddr = md })
+		case grpc.PeerCallOption:
+			var p peer.Peer
+			attemptOpts[i] = grpc.Peer(&p)
+			finishers = append(finishers, func() { *opt.PeerAddr = p })
+		default:
+			attemptOpts[i] = opt
+		}
+	}
+	return attemptOpts, func() {
+		for _, finish := range finishers {
+			finish()
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package grpcdynamic
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	grpctestprotos "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+)
+
+func TestParseServiceConfig(t *testing.T) {
+	cfg, err := ParseServiceConfig([]byte(`{
+		"loadBalancingConfig": [{"round_robin": {}}],
+		"methodConfig": [
+			{
+				"name": [{"service": "grpc.testing.TestService", "method": "UnaryCall"}],
+				"timeout": "1.5s",
+				"retryPolicy": {
+					"maxAttempts": 10,
+					"initialBackoff": "0.1s",
+					"maxBackoff": "1s",
+					"backoffMultiplier": 2,
+					"retryableStatusCodes": ["UNAVAILABLE", 4]
+				}
+			},
+			{
+				"name": [{"service": "grpc.testing.TestService"}],
+				"hedgingPolicy": {"maxAttempts": 3, "hedgingDelay": "0.5s", "nonFatalStatusCodes": ["UNAVAILABLE"]}
+			},
+			{
+				"name": [{}],
+				"timeout": "10s"
+			}
+		]
+	}`))
+	require.NoError(t, err)
+
+	mc := cfg.forMethod(unaryMd)
+	require.Equal(t, 1500*time.Millisecond, mc.timeout)
+	require.Nil(t, mc.hedging)
+	require.Equal(t, &retryPolicy{
+		maxAttempts:       maxAttemptsLimit,
+		initialBackoff:    100 * time.Millisecond,
+		maxBackoff:        time.Second,
+		backoffMultiplier: 2,
+		retryableCodes:    map[codes.Code]bool{codes.Unavailable: true, codes.DeadlineExceeded: true},
+	}, mc.retry)
+
+	mc = cfg.forMethod(bidiStreamingMd)
+	require.Zero(t, mc.timeout)
+	require.Nil(t, mc.retry)
+	require.Equal(t, &hedgingPolicy{
+		maxAttempts:   3,
+		hedgingDelay:  500 * time.Millisecond,
+		nonFatalCodes: map[codes.Code]bool{codes.Unavailable: true},
+	}, mc.hedging)
+
+	unimplemented := grpctestprotos.File_grpc_test_proto.Services().ByName("UnimplementedService")
+	mc = cfg.forMethod(unimplemented.Methods().Get(0))
+	require.Equal(t, 10*time.Second, mc.timeout)
+
+	testCases := map[string]string{
+		"retry and hedging":     `{"methodConfig": [{"name": [{}], "retryPolicy": {"maxAttempts": 2, "initialBackoff": "1s", "maxBackoff": "1s", "backoffMultiplier": 1, "retryableStatusCodes": ["UNAVAILABLE"]}, "hedgingPolicy": {"maxAttempts": 2}}]}`,
+		"bad timeout":           `{"methodConfig": [{"name": [{}], "timeout": "1m"}]}`,
+		"bad status code":       `{"methodConfig": [{"name": [{}], "hedgingPolicy": {"maxAttempts": 2, "nonFatalStatusCodes": ["SO_BAD"]}}]}`,
+		"no retryable codes":    `{"methodConfig": [{"name": [{}], "retryPolicy": {"maxAttempts": 2, "initialBackoff": "1s", "maxBackoff": "1s", "backoffMultiplier": 1}}]}`,
+		"method but no service": `{"methodConfig": [{"name": [{"method": "Foo"}]}]}`,
+		"duplicate name":        `{"methodConfig": [{"name": [{"service": "foo.Bar"}]}, {"name": [{"service": "foo.Bar"}]}]}`,
+	}
+	for name, cfgJSON := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseServiceConfig([]byte(cfgJSON))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestServiceConfig_Timeout(t *testing.T) {
+	cfg, err := ParseServiceConfig([]byte(`{"methodConfig": [{"name": [{"service": "grpc.testing.TestService"}], "timeout": "5s"}]}`))
+	require.NoError(t, err)
+	channel := &fakeChannel{}
+	s := NewStub(channel, WithServiceConfig(cfg))
+
+	_, err = s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{})
+	require.NoError(t, err)
+	require.Len(t, channel.deadlines, 1)
+	require.WithinDuration(t, time.Now().Add(5*time.Second), channel.deadlines[0], time.Second)
+
+	// an earlier deadline in the context takes precedence
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = s.InvokeRpc(ctx, unaryMd, &grpctestprotos.SimpleRequest{})
+	require.NoError(t, err)
+	require.Len(t, channel.deadlines, 2)
+	deadline, _ := ctx.Deadline()
+	require.Equal(t, deadline, channel.deadlines[1])
+}
+
+func TestServiceConfig_Retry(t *testing.T) {
+	cfg, err := ParseServiceConfig([]byte(`{"methodConfig": [{
+		"name": [{"service": "grpc.testing.TestService"}],
+		"retryPolicy": {"maxAttempts": 3, "initialBackoff": "0.01s", "maxBackoff": "0.01s", "backoffMultiplier": 1, "retryableStatusCodes": ["UNAVAILABLE"]}
+	}]}`))
+	require.NoError(t, err)
+
+	// succeeds after retries
+	channel := &fakeChannel{errs: []error{status.Error(codes.Unavailable, "1"), status.Error(codes.Unavailable, "2")}}
+	s := NewStub(channel, WithServiceConfig(cfg))
+	_, err = s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 3, channel.attempts)
+
+	// gives up after max attempts
+	channel = &fakeChannel{errs: []error{status.Error(codes.Unavailable, "1"), status.Error(codes.Unavailable, "2"), status.Error(codes.Unavailable, "3")}}
+	s = NewStub(channel, WithServiceConfig(cfg))
+	_, err = s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, "3", status.Convert(err).Message())
+	require.Equal(t, 3, channel.attempts)
+
+	// non-retryable codes are not retried
+	channel = &fakeChannel{errs: []error{status.Error(codes.InvalidArgument, "1")}}
+	s = NewStub(channel, WithServiceConfig(cfg))
+	_, err = s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, 1, channel.attempts)
+
+	// a multiplier less than 1 can shrink the backoff, but not to zero
+	cfg, err = ParseServiceConfig([]byte(`{"methodConfig": [{
+		"name": [{"service": "grpc.testing.TestService"}],
+		"retryPolicy": {"maxAttempts": 5, "initialBackoff": "0.000000002s", "maxBackoff": "1s", "backoffMultiplier": 0.1, "retryableStatusCodes": ["UNAVAILABLE"]}
+	}]}`))
+	require.NoError(t, err)
+	channel = &fakeChannel{errs: []error{status.Error(codes.Unavailable, "1"), status.Error(codes.Unavailable, "2"), status.Error(codes.Unavailable, "3")}}
+	s = NewStub(channel, WithServiceConfig(cfg))
+	_, err = s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 4, channel.attempts)
+}
+
+func TestServiceConfig_Hedging(t *testing.T) {
+	cfg, err := ParseServiceConfig([]byte(`{"methodConfig": [{
+		"name": [{"service": "grpc.testing.TestService"}],
+		"hedgingPolicy": {"maxAttempts": 3, "hedgingDelay": "0.05s", "nonFatalStatusCodes": ["UNAVAILABLE"]}
+	}]}`))
+	require.NoError(t, err)
+
+	// the first attempt hangs, so the hedged attempt provides the response
+	channel := &fakeChannel{block: map[int]bool{1: true}}
+	s := NewStub(channel, WithServiceConfig(cfg))
+	var hdr metadata.MD
+	resp, err := s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{}, grpc.Header(&hdr))
+	require.NoError(t, err)
+	require.Equal(t, 2, channel.numAttempts())
+	require.Equal(t, []string{"2"}, hdr.Get("attempt"))
+	require.Equal(t, "2", string(resp.(*grpctestprotos.SimpleResponse).GetPayload().GetBody()))
+
+	// a fatal error stops hedging
+	channel = &fakeChannel{errs: []error{status.Error(codes.InvalidArgument, "1")}}
+	s = NewStub(channel, WithServiceConfig(cfg))
+	_, err = s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, 1, channel.numAttempts())
+
+	// non-fatal errors send the next attempt immediately
+	channel = &fakeChannel{errs: []error{status.Error(codes.Unavailable, "1"), status.Error(codes.Unavailable, "2"), status.Error(codes.Unavailable, "3")}}
+	s = NewStub(channel, WithServiceConfig(cfg))
+	start := time.Now()
+	_, err = s.InvokeRpc(context.Background(), unaryMd, &grpctestprotos.SimpleRequest{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 3, channel.numAttempts())
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+// fakeChannel is a channel for unary RPCs that records the attempts it
+// receives. Each attempt fails with the next error in errs; once errs is
+// exhausted, attempts succeed, sending back the attempt number in the
+// response payload and in response headers.
+type fakeChannel struct {
+	mu        sync.Mutex
+	errs      []error
+	block     map[int]bool
+	attempts  int
+	deadlines []time.Time
+}
+
+func (c *fakeChannel) numAttempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts
+}
+
+func (c *fakeChannel) Invoke(ctx context.Context, _ string, _, reply any, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	c.attempts++
+	attempt := c.attempts
+	if deadline, ok := ctx.Deadline(); ok {
+		c.deadlines = append(c.deadlines, deadline)
+	}
+	var err error
+	if len(c.errs) > 0 {
+		err = c.errs[0]
+		c.errs = c.errs[1:]
+	}
+	c.mu.Unlock()
+
+	if c.block[attempt] {
+		<-ctx.Done()
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	if err != nil {
+		return err
+	}
+	body := []byte{byte('0' + attempt)}
+	proto.Merge(reply.(proto.Message), &grpctestprotos.SimpleResponse{Payload: &grpctestprotos.Payload{Body: body}})
+	for _, opt := range opts {
+		if hdr, ok := opt.(grpc.HeaderCallOption); ok {
+			*hdr.HeaderAddr = metadata.Pairs("attempt", string(body))
+		}
+	}
+	return nil
+}
+
+func (c *fakeChannel) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "streams not supported")
+}
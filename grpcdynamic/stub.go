@@ -6,6 +6,7 @@ package grpcdynamic
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
@@ -22,8 +23,10 @@ import (
 
 // Stub is an RPC client stub, used for dynamically dispatching RPCs to a server.
 type Stub struct {
-	channel  grpc.ClientConnInterface
-	resolver protoresolve.SerializationResolver
+	channel       grpc.ClientConnInterface
+	resolver      protoresolve.SerializationResolver
+	anys          anyResolution
+	serviceConfig *ServiceConfig
 }
 
 // NewStub creates a new RPC stub that uses the given channel for dispatching RPCs.
@@ -57,6 +60,103 @@ func WithResolver(res protoresolve.SerializationResolver) StubOption {
 	})
 }
 
+// WithAnyResolution returns a StubOption that causes a Stub to eagerly unpack the
+// contents of google.protobuf.Any messages in response messages. The contents are
+// resolved using the resolver configured via WithResolver or, if none was
+// configured, [protoregistry.GlobalTypes]. The given function is called for each
+// Any message, with the unpacked message or, if the contents could not be
+// resolved, with the error. It is called before the response is returned to the
+// caller. If the function returns an error, the RPC operation that received the
+// response returns that error. So the function decides whether an Any message
+// whose contents cannot be resolved is skipped or fails the operation.
+//
+// Resolution is recursive: messages contained in Any messages are also searched
+// for Any messages, up to the given maximum depth. A depth of one means that only
+// Any messages in the response itself are resolved, not any inside of them. If
+// maxDepth is zero or negative, a default depth of 16 is used.
+//
+// If the given function is nil, the contents of Any messages are only checked:
+// the RPC operation fails if the contents of any of them cannot be resolved.
+//
+// The unpacked messages are not stored in the response. A google.protobuf.Any
+// message holds its contents only in serialized form, so there is no place in
+// the response to put the unpacked message. To get the unpacked messages along
+// with the response, use the ResolvedAnys call option.
+func WithAnyResolution(maxDepth int, fn func(*ResolvedAny) error) StubOption {
+	return stubOptionFunc(func(s *Stub) {
+		if maxDepth <= 0 {
+			maxDepth = defaultAnyDepth
+		}
+		s.anys = anyResolution{maxDepth: maxDepth, fn: fn}
+	})
+}
+
+// ResolvedAny is a google.protobuf.Any message found in a response message. See
+// WithAnyResolution and ResolvedAnys.
+type ResolvedAny struct {
+	// The location of the Any message, relative to the response message or,
+	// if Parent is not nil, relative to the contents of Parent. The path is
+	// in the same form as the paths provided by [protomessage.Walk].
+	Path []any
+	// The Any message itself.
+	Any proto.Message
+	// The unpacked contents of the Any message. This is nil if the contents
+	// could not be resolved, in which case Err is not nil.
+	Message proto.Message
+	// The reason the contents could not be resolved, if Message is nil.
+	Err error
+	// The Any message whose contents contain this one, or nil if this Any
+	// message is in the response message itself.
+	Parent *ResolvedAny
+}
+
+type anyResolution struct {
+	maxDepth int
+	fn       func(*ResolvedAny) error
+	// if non-nil, all resolved Any messages are stored here
+	dest *[]*ResolvedAny
+}
+
+// ResolvedAnys returns a CallOption that stores the google.protobuf.Any messages
+// found in a response, along with their unpacked contents, into dest. This
+// provides the unpacked messages for a response without having to search it
+// for Any messages. The Any messages are stored in the order in which they are
+// found, with each Any message before those inside its contents.
+//
+// If the Stub was created with WithAnyResolution, its maximum depth and function
+// are used. Otherwise, Any messages are resolved up to a default depth of 16,
+// and those whose contents cannot be resolved are stored with a non-nil Err
+// but do not cause the operation to fail.
+//
+// For streaming methods, dest is overwritten each time a response message is
+// received, so that it contains the Any messages for the most recently received
+// message. If resolution fails (see WithAnyResolution), dest is set to nil.
+func ResolvedAnys(dest *[]*ResolvedAny) grpc.CallOption {
+	return resolvedAnysOption{dest: dest}
+}
+
+type resolvedAnysOption struct {
+	grpc.EmptyCallOption
+	dest *[]*ResolvedAny
+}
+
+// forCall returns the Any resolution to use for an operation with the
+// given call options.
+func (r anyResolution) forCall(opts []grpc.CallOption) anyResolution {
+	for _, opt := range opts {
+		if opt, ok := opt.(resolvedAnysOption); ok {
+			r.dest = opt.dest
+		}
+	}
+	if r.dest != nil && r.maxDepth <= 0 {
+		r.maxDepth = defaultAnyDepth
+		r.fn = func(*ResolvedAny) error { return nil }
+	}
+	return r
+}
+
+const defaultAnyDepth = 16
+
 func requestMethod(md protoreflect.MethodDescriptor) string {
 	return fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
 }
@@ -69,12 +169,21 @@ func (s *Stub) InvokeRpc(ctx context.Context, method protoreflect.MethodDescript
 	if err := checkMessageType(method.Input(), request); err != nil {
 		return nil, err
 	}
-	resp := newMessage(method.Output(), s.resolver)
-	if err := s.channel.Invoke(ctx, requestMethod(method), request, resp, opts...); err != nil {
+	mc := s.serviceConfig.forMethod(method)
+	ctx, cancel := mc.callContext(ctx)
+	defer cancel()
+	resp, err := mc.invoke(ctx, opts, func(ctx context.Context, opts []grpc.CallOption) (proto.Message, error) {
+		resp := newMessage(method.Output(), s.resolver)
+		if err := s.channel.Invoke(ctx, requestMethod(method), request, resp, opts...); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	if s.resolver != nil {
-		protomessage.ReparseUnrecognized(resp, s.resolver)
+	if err := processResponse(resp, s.resolver, s.anys.forCall(opts)); err != nil {
+		return nil, err
 	}
 	return resp, nil
 }
@@ -87,7 +196,7 @@ func (s *Stub) InvokeRpcServerStream(ctx context.Context, method protoreflect.Me
 	if err := checkMessageType(method.Input(), request); err != nil {
 		return nil, err
 	}
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := s.serviceConfig.forMethod(method).callContext(ctx)
 	sd := grpc.StreamDesc{
 		StreamName:    string(method.Name()),
 		ServerStreams: method.IsStreamingServer(),
@@ -113,7 +222,7 @@ func (s *Stub) InvokeRpcServerStream(ctx context.Context, method protoreflect.Me
 		<-cs.Context().Done()
 		cancel()
 	}()
-	return &ServerStream{cs, method.Output(), s.resolver}, nil
+	return &ServerStream{cs, method.Output(), s.resolver, s.anys.forCall(opts), cancel}, nil
 }
 
 // InvokeRpcClientStream creates a new stream that is used to send request messages and, at the end,
@@ -122,7 +231,7 @@ func (s *Stub) InvokeRpcClientStream(ctx context.Context, method protoreflect.Me
 	if !method.IsStreamingClient() || method.IsStreamingServer() {
 		return nil, fmt.Errorf("InvokeRpcClientStream is for client-streaming methods; %q is %s", method.FullName(), methodType(method))
 	}
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := s.serviceConfig.forMethod(method).callContext(ctx)
 	sd := grpc.StreamDesc{
 		StreamName:    string(method.Name()),
 		ServerStreams: method.IsStreamingServer(),
@@ -138,7 +247,7 @@ func (s *Stub) InvokeRpcClientStream(ctx context.Context, method protoreflect.Me
 		<-cs.Context().Done()
 		cancel()
 	}()
-	return &ClientStream{cs, method, s.resolver, cancel}, nil
+	return &ClientStream{cs, method, s.resolver, s.anys.forCall(opts), cancel}, nil
 }
 
 // InvokeRpcBidiStream creates a new stream that is used to both send request messages and receive response
@@ -147,6 +256,7 @@ func (s *Stub) InvokeRpcBidiStream(ctx context.Context, method protoreflect.Meth
 	if !method.IsStreamingClient() || !method.IsStreamingServer() {
 		return nil, fmt.Errorf("InvokeRpcBidiStream is for bidi-streaming methods; %q is %s", method.FullName(), methodType(method))
 	}
+	ctx, cancel := s.serviceConfig.forMethod(method).callContext(ctx)
 	sd := grpc.StreamDesc{
 		StreamName:    string(method.Name()),
 		ServerStreams: method.IsStreamingServer(),
@@ -154,9 +264,15 @@ func (s *Stub) InvokeRpcBidiStream(ctx context.Context, method protoreflect.Meth
 	}
 	cs, err := s.channel.NewStream(ctx, &sd, requestMethod(method), opts...)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return &BidiStream{cs, method.Input(), method.Output(), s.resolver}, nil
+	go func() {
+		// when the new stream is finished, also cleanup the parent context
+		<-cs.Context().Done()
+		cancel()
+	}()
+	return &BidiStream{cs, method.Input(), method.Output(), s.resolver, s.anys.forCall(opts)}, nil
 }
 
 func methodType(md protoreflect.MethodDescriptor) string {
@@ -186,6 +302,8 @@ type ServerStream struct {
 	stream   grpc.ClientStream
 	respType protoreflect.MessageDescriptor
 	resolver protoresolve.SerializationResolver
+	anys     anyResolution
+	cancel   context.CancelFunc
 }
 
 // Header returns any header metadata sent by the server (blocks if necessary until headers are
@@ -213,18 +331,104 @@ func (s *ServerStream) RecvMsg() (proto.Message, error) {
 	if err := s.stream.RecvMsg(resp); err != nil {
 		return nil, err
 	}
-	if s.resolver != nil {
-		protomessage.ReparseUnrecognized(resp, s.resolver)
+	if err := processResponse(resp, s.resolver, s.anys); err != nil {
+		return nil, err
 	}
 	return resp, nil
 }
 
+// Iter returns an iterator over the remaining messages in the response stream.
+// The iterator yields each message with a nil error. If the stream terminates
+// abnormally, the iterator then yields a nil message and the error. Normal
+// completion of the stream (io.EOF) is not yielded. Callers may stop the
+// iteration early and later resume receiving messages via RecvMsg or another
+// call to Iter.
+//
+// If the given context is cancelled or its deadline expires, the stream is
+// cancelled, even if the iterator is blocked waiting for a message, and the
+// iterator yields the context's error.
+//
+// The returned function has the same signature as iter.Seq2, so with Go 1.23
+// or later, it can be used in a for-range loop:
+//
+//	for msg, err := range stream.Iter(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    // process msg
+//	}
+func (s *ServerStream) Iter(ctx context.Context) func(yield func(proto.Message, error) bool) {
+	return func(yield func(proto.Message, error) bool) {
+		stop := context.AfterFunc(ctx, s.cancel)
+		defer stop()
+		for {
+			msg, err := s.RecvMsg()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
+				yield(nil, err)
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ErrStreamLimitExceeded is the error returned from ServerStream.Collect when
+// the stream contains more messages or more bytes than allowed.
+var ErrStreamLimitExceeded = errors.New("response stream exceeded limit")
+
+// Collect receives all remaining messages in the response stream and returns
+// them. If the stream terminates abnormally, the messages received so far are
+// returned along with the error. The given context can be used to cancel the
+// operation, in the same way as the context given to Iter.
+//
+// To protect against runaway streams, Collect accepts limits on the number of
+// messages and on their total size in bytes, as computed by proto.Size. If
+// either limit is exceeded, the stream is cancelled and Collect returns the
+// messages received so far, which are within the limits, along with an error
+// that wraps ErrStreamLimitExceeded. A limit that is zero or negative means no
+// limit.
+func (s *ServerStream) Collect(ctx context.Context, maxMessages, maxBytes int) ([]proto.Message, error) {
+	var msgs []proto.Message
+	var size int
+	var err error
+	s.Iter(ctx)(func(msg proto.Message, iterErr error) bool {
+		if iterErr != nil {
+			err = iterErr
+			return false
+		}
+		if maxMessages > 0 && len(msgs) == maxMessages {
+			err = fmt.Errorf("%w: more than %d messages", ErrStreamLimitExceeded, maxMessages)
+			return false
+		}
+		size += proto.Size(msg)
+		if maxBytes > 0 && size > maxBytes {
+			err = fmt.Errorf("%w: more than %d bytes", ErrStreamLimitExceeded, maxBytes)
+			return false
+		}
+		msgs = append(msgs, msg)
+		return true
+	})
+	if errors.Is(err, ErrStreamLimitExceeded) {
+		s.cancel()
+	}
+	return msgs, err
+}
+
 // ClientStream represents a response stream from a client. Messages in the stream can be sent
 // and, when done, the unary server message and header and trailer metadata can be queried.
 type ClientStream struct {
 	stream   grpc.ClientStream
 	method   protoreflect.MethodDescriptor
 	resolver protoresolve.SerializationResolver
+	anys     anyResolution
 	cancel   context.CancelFunc
 }
 
@@ -262,8 +466,9 @@ func (s *ClientStream) CloseAndReceive() (proto.Message, error) {
 	if err := s.stream.RecvMsg(resp); err != nil {
 		return nil, err
 	}
-	if s.resolver != nil {
-		protomessage.ReparseUnrecognized(resp, s.resolver)
+	if err := processResponse(resp, s.resolver, s.anys); err != nil {
+		s.cancel()
+		return nil, err
 	}
 
 	// make sure we get EOF for a second message
@@ -285,6 +490,7 @@ type BidiStream struct {
 	reqType  protoreflect.MessageDescriptor
 	respType protoreflect.MessageDescriptor
 	resolver protoresolve.SerializationResolver
+	anys     anyResolution
 }
 
 // Header returns any header metadata sent by the server (blocks if necessary until headers are
@@ -326,8 +532,8 @@ func (s *BidiStream) RecvMsg() (proto.Message, error) {
 	if err := s.stream.RecvMsg(resp); err != nil {
 		return nil, err
 	}
-	if s.resolver != nil {
-		protomessage.ReparseUnrecognized(resp, s.resolver)
+	if err := processResponse(resp, s.resolver, s.anys); err != nil {
+		return nil, err
 	}
 	return resp, nil
 }
@@ -342,3 +548,64 @@ func newMessage(md protoreflect.MessageDescriptor, resolver protoresolve.Seriali
 	}
 	return dynamicpb.NewMessage(md)
 }
+
+func processResponse(resp proto.Message, resolver protoresolve.SerializationResolver, anys anyResolution) error {
+	if resolver != nil {
+		protomessage.ReparseUnrecognized(resp, resolver)
+	}
+	if anys.maxDepth <= 0 {
+		return nil
+	}
+	if anys.dest == nil {
+		return anys.resolve(resp, resolver, nil, anys.maxDepth)
+	}
+	var resolved []*ResolvedAny
+	fn := anys.fn
+	anys.fn = func(r *ResolvedAny) error {
+		resolved = append(resolved, r)
+		if fn == nil {
+			return r.Err
+		}
+		return fn(r)
+	}
+	if err := anys.resolve(resp, resolver, nil, anys.maxDepth); err != nil {
+		*anys.dest = nil
+		return err
+	}
+	*anys.dest = resolved
+	return nil
+}
+
+func (r anyResolution) resolve(msg proto.Message, resolver protoresolve.SerializationResolver, parent *ResolvedAny, remainingDepth int) error {
+	var err error
+	protomessage.Walk(msg.ProtoReflect(), func(path []any, val protoreflect.Message) bool {
+		if val.Descriptor().FullName() != anyMessageName {
+			return true
+		}
+		resolved := &ResolvedAny{
+			Path:   append([]any(nil), path...),
+			Any:    val.Interface(),
+			Parent: parent,
+		}
+		resolved.Message, resolved.Err = protomessage.UnpackAny(val.Interface(), resolver)
+		if resolved.Err != nil {
+			resolved.Message = nil
+			resolved.Err = fmt.Errorf("failed to resolve contents of %s at path %v: %w", anyMessageName, resolved.Path, resolved.Err)
+		}
+		if r.fn == nil {
+			err = resolved.Err
+		} else {
+			err = r.fn(resolved)
+		}
+		if err != nil {
+			return false
+		}
+		if resolved.Message != nil && remainingDepth > 1 {
+			err = r.resolve(resolved.Message, resolver, resolved, remainingDepth-1)
+		}
+		return err == nil
+	})
+	return err
+}
+
+const anyMessageName = "google.protobuf.Any"
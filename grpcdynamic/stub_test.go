@@ -13,9 +13,14 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/jhump/protoreflect/v2/grpcreflect"
 	grpctesting "github.com/jhump/protoreflect/v2/internal/testing"
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
 	grpctestprotos "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
 )
 
@@ -124,6 +129,68 @@ func TestServerStreamingRpc(t *testing.T) {
 	require.Equal(t, io.EOF, err, "Incorrect number of messages in response")
 }
 
+func TestServerStreamingRpc_Iter(t *testing.T) {
+	invoke := func(numResponses int) *ServerStream {
+		ss, err := stub.InvokeRpcServerStream(context.Background(), serverStreamingMd, &grpctestprotos.StreamingOutputCallRequest{
+			Payload:            payload,
+			ResponseParameters: make([]*grpctestprotos.ResponseParameters, numResponses),
+		})
+		require.NoError(t, err, "Failed to invoke server-streaming RPC")
+		return ss
+	}
+
+	var count int
+	invoke(3).Iter(context.Background())(func(msg proto.Message, err error) bool {
+		require.NoError(t, err)
+		require.True(t, proto.Equal(payload, msg.(*grpctestprotos.StreamingOutputCallResponse).Payload))
+		count++
+		return true
+	})
+	require.Equal(t, 3, count)
+
+	// stopping early allows resuming later
+	ss := invoke(3)
+	ss.Iter(context.Background())(func(proto.Message, error) bool {
+		return false
+	})
+	msgs, err := ss.Collect(context.Background(), 0, 0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msgs, err = invoke(3).Collect(ctx, 0, 0)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, msgs)
+}
+
+func TestServerStreamingRpc_CollectLimits(t *testing.T) {
+	invoke := func() *ServerStream {
+		ss, err := stub.InvokeRpcServerStream(context.Background(), serverStreamingMd, &grpctestprotos.StreamingOutputCallRequest{
+			Payload:            payload,
+			ResponseParameters: make([]*grpctestprotos.ResponseParameters, 5),
+		})
+		require.NoError(t, err, "Failed to invoke server-streaming RPC")
+		return ss
+	}
+	msgSize := proto.Size(&grpctestprotos.StreamingOutputCallResponse{Payload: payload})
+
+	msgs, err := invoke().Collect(context.Background(), 5, 5*msgSize)
+	require.NoError(t, err)
+	require.Len(t, msgs, 5)
+
+	msgs, err = invoke().Collect(context.Background(), 2, 0)
+	require.ErrorIs(t, err, ErrStreamLimitExceeded)
+	require.Len(t, msgs, 2)
+
+	ss := invoke()
+	msgs, err = ss.Collect(context.Background(), 0, 3*msgSize+1)
+	require.ErrorIs(t, err, ErrStreamLimitExceeded)
+	require.Len(t, msgs, 3)
+	// the stream is cancelled
+	require.ErrorIs(t, ss.Context().Err(), context.Canceled)
+}
+
 func TestBidiStreamingRpc(t *testing.T) {
 	bds, err := stub.InvokeRpcBidiStream(context.Background(), bidiStreamingMd)
 	require.NoError(t, err)
@@ -143,3 +210,98 @@ func TestBidiStreamingRpc(t *testing.T) {
 	_, err = bds.RecvMsg()
 	require.Equal(t, io.EOF, err, "Incorrect number of messages in response")
 }
+
+func TestResolveAnys(t *testing.T) {
+	unknownAny := &anypb.Any{TypeUrl: "type.googleapis.com/foo.bar.Baz"}
+	nested := &testprotos.TestWellKnownTypes{Extras: []*anypb.Any{unknownAny}}
+	nestedAny, err := anypb.New(nested)
+	require.NoError(t, err)
+	strAny, err := anypb.New(wrapperspb.String("abc"))
+	require.NoError(t, err)
+	msg := &testprotos.TestWellKnownTypes{Extras: []*anypb.Any{strAny, nestedAny}}
+
+	var resolved []*ResolvedAny
+	collect := func(r *ResolvedAny) error {
+		resolved = append(resolved, r)
+		return nil
+	}
+
+	// Only top-level Any messages are resolved.
+	err = anyResolution{maxDepth: 1, fn: collect}.resolve(msg, nil, nil, 1)
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+	require.Equal(t, []any{protoreflect.FieldNumber(13), 0}, resolved[0].Path)
+	require.True(t, proto.Equal(wrapperspb.String("abc"), resolved[0].Message))
+	require.Same(t, strAny, resolved[0].Any)
+	require.Equal(t, []any{protoreflect.FieldNumber(13), 1}, resolved[1].Path)
+	require.True(t, proto.Equal(nested, resolved[1].Message))
+
+	// Nested Any message refers to unknown type, which is reported to the
+	// function but is not fatal unless the function says so.
+	resolved = nil
+	err = anyResolution{maxDepth: 2, fn: collect}.resolve(msg, nil, nil, 2)
+	require.NoError(t, err)
+	require.Len(t, resolved, 3)
+	unresolved := resolved[2]
+	require.Nil(t, unresolved.Message)
+	require.ErrorIs(t, unresolved.Err, protoregistry.NotFound)
+	require.ErrorContains(t, unresolved.Err, "failed to resolve contents of google.protobuf.Any at path [13 0]")
+	require.Same(t, resolved[1], unresolved.Parent)
+
+	failOnError := func(r *ResolvedAny) error {
+		return r.Err
+	}
+	err = anyResolution{maxDepth: 2, fn: failOnError}.resolve(msg, nil, nil, 2)
+	require.ErrorIs(t, err, protoregistry.NotFound)
+
+	// Without a function, unresolvable contents are an error.
+	err = anyResolution{maxDepth: 1}.resolve(msg, nil, nil, 1)
+	require.NoError(t, err)
+	err = anyResolution{maxDepth: 2}.resolve(msg, nil, nil, 2)
+	require.ErrorIs(t, err, protoregistry.NotFound)
+
+	// Resolution applies to dynamic messages, too.
+	dynMsg := dynamicpb.NewMessage(msg.ProtoReflect().Descriptor())
+	proto.Merge(dynMsg, msg)
+	err = anyResolution{maxDepth: defaultAnyDepth, fn: failOnError}.resolve(dynMsg, nil, nil, defaultAnyDepth)
+	require.ErrorIs(t, err, protoregistry.NotFound)
+}
+
+func TestResolvedAnysOption(t *testing.T) {
+	unknownAny := &anypb.Any{TypeUrl: "type.googleapis.com/foo.bar.Baz"}
+	nested := &testprotos.TestWellKnownTypes{Extras: []*anypb.Any{unknownAny}}
+	nestedAny, err := anypb.New(nested)
+	require.NoError(t, err)
+	strAny, err := anypb.New(wrapperspb.String("abc"))
+	require.NoError(t, err)
+	msg := &testprotos.TestWellKnownTypes{Extras: []*anypb.Any{strAny, nestedAny}}
+
+	// Without WithAnyResolution, the option resolves to the default depth
+	// and unresolvable contents are not an error.
+	var resolved []*ResolvedAny
+	err = processResponse(msg, nil, anyResolution{}.forCall([]grpc.CallOption{ResolvedAnys(&resolved)}))
+	require.NoError(t, err)
+	require.Len(t, resolved, 3)
+	require.True(t, proto.Equal(wrapperspb.String("abc"), resolved[0].Message))
+	require.True(t, proto.Equal(nested, resolved[1].Message))
+	require.Same(t, resolved[1], resolved[2].Parent)
+	require.ErrorIs(t, resolved[2].Err, protoregistry.NotFound)
+
+	// The configured depth is used.
+	anys := anyResolution{maxDepth: 1, fn: func(*ResolvedAny) error { return nil }}
+	err = processResponse(msg, nil, anys.forCall([]grpc.CallOption{ResolvedAnys(&resolved)}))
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+
+	// If the configured resolution fails, nothing is stored.
+	err = processResponse(msg, nil, anyResolution{maxDepth: 2}.forCall([]grpc.CallOption{ResolvedAnys(&resolved)}))
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	require.Nil(t, resolved)
+
+	// The option is also applied to responses from an RPC.
+	resolved = []*ResolvedAny{{}}
+	req := &grpctestprotos.SimpleRequest{Payload: payload}
+	_, err = stub.InvokeRpc(context.Background(), unaryMd, req, ResolvedAnys(&resolved))
+	require.NoError(t, err)
+	require.Empty(t, resolved)
+}
@@ -0,0 +1,266 @@
+package grpcdynamic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+var placeholderRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)}`)
+
+// RequestTemplate is a prototype of a request message for a method, which can
+// contain variables whose values are supplied when the template is rendered
+// into a request message.
+//
+// Templates are defined in the protobuf JSON format. Variables are placeholders
+// of the form "${name}" that appear inside JSON string literals, so a template
+// is always valid JSON. If a string literal consists of exactly one placeholder,
+// like "${count}", the entire string is replaced with the variable's value,
+// which need not be a string. This allows variables to provide numbers, booleans,
+// lists, and even entire messages. Otherwise, the string value of each variable
+// is interpolated into the string literal. For example:
+//
+//	{
+//	  "name": "users/${user_id}",
+//	  "page_size": "${page_size}",
+//	  "filter": { "labels": "${labels}" }
+//	}
+type RequestTemplate struct {
+	method    protoreflect.MethodDescriptor
+	resolver  protoresolve.SerializationResolver
+	template  any
+	variables []string
+}
+
+// NewRequestTemplate creates a template for requests to the given method. The
+// given template must be valid JSON. The given resolver is used to resolve
+// extensions and the contents of google.protobuf.Any messages when rendering the
+// template. If nil, [protoregistry.GlobalTypes] is used.
+//
+// An error is returned if the template is not valid JSON, including when it has
+// anything other than whitespace after the JSON value. If the template has no
+// variables, an error is also returned if it is not a valid request for the method.
+// Templates with variables can only be fully validated when they are rendered.
+func NewRequestTemplate(method protoreflect.MethodDescriptor, template string, res protoresolve.SerializationResolver) (*RequestTemplate, error) {
+	dec := json.NewDecoder(strings.NewReader(template))
+	dec.UseNumber()
+	var tmpl any
+	if err := dec.Decode(&tmpl); err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %w", method.FullName(), err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return nil, fmt.Errorf("invalid template for %s: unexpected data after JSON value", method.FullName())
+	}
+	if res == nil {
+		res = protoregistry.GlobalTypes
+	}
+	vars := map[string]struct{}{}
+	collectVariables(tmpl, vars)
+	variables := make([]string, 0, len(vars))
+	for v := range vars {
+		variables = append(variables, v)
+	}
+	sort.Strings(variables)
+	t := &RequestTemplate{
+		method:    method,
+		resolver:  res,
+		template:  tmpl,
+		variables: variables,
+	}
+	if len(variables) == 0 {
+		// validate that the template is a valid request message
+		if _, err := t.Render(nil); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// NewRequestTemplateFromMessage creates a template for requests to the given
+// method using the given request message as a prototype. String fields in the
+// given message may contain placeholders, in which case they are treated as
+// variables. This is most useful for string fields. Non-string values can only
+// be provided by variables in templates created with NewRequestTemplate.
+func NewRequestTemplateFromMessage(method protoreflect.MethodDescriptor, request proto.Message, res protoresolve.SerializationResolver) (*RequestTemplate, error) {
+	if err := checkMessageType(method.Input(), request); err != nil {
+		return nil, err
+	}
+	if res == nil {
+		res = protoregistry.GlobalTypes
+	}
+	data, err := protojson.MarshalOptions{Resolver: res}.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return NewRequestTemplate(method, string(data), res)
+}
+
+// Method returns the method for which this template defines requests.
+func (t *RequestTemplate) Method() protoreflect.MethodDescriptor {
+	return t.method
+}
+
+// Variables returns the names of all variables referenced by the template, in
+// sorted order.
+func (t *RequestTemplate) Variables() []string {
+	return append([]string(nil), t.variables...)
+}
+
+// Render renders the template into a request message, substituting the given
+// values for all variables in the template. An error is returned if a value is
+// not provided for every variable or if the result of substitution is not a
+// valid request message.
+//
+// Values that are proto.Message instances are first converted to JSON using the
+// protobuf JSON format. All other values are converted to JSON using the
+// encoding/json package, except when they are interpolated into a larger string,
+// in which case they are formatted using fmt.Sprint.
+func (t *RequestTemplate) Render(vars map[string]any) (proto.Message, error) {
+	// check for missing variables up front, in sorted order, so the error
+	// reported is deterministic
+	for _, name := range t.variables {
+		if _, ok := vars[name]; !ok {
+			return nil, fmt.Errorf("failed to render template for %s: no value provided for variable %q", t.method.FullName(), name)
+		}
+	}
+	rendered, err := t.substitute(t.template, vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template for %s: %w", t.method.FullName(), err)
+	}
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template for %s: %w", t.method.FullName(), err)
+	}
+	req := newMessage(t.method.Input(), t.resolver)
+	if err := (protojson.UnmarshalOptions{Resolver: t.resolver}).Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("failed to render template for %s: %w", t.method.FullName(), err)
+	}
+	return req, nil
+}
+
+func (t *RequestTemplate) substitute(val any, vars map[string]any) (any, error) {
+	switch val := val.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(val))
+		for k, v := range val {
+			var err error
+			if result[k], err = t.substitute(v, vars); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(val))
+		for i, v := range val {
+			var err error
+			if result[i], err = t.substitute(v, vars); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case string:
+		if match := placeholderRegex.FindStringSubmatchIndex(val); match != nil && match[0] == 0 && match[1] == len(val) {
+			// entire string is a single placeholder
+			v, err := t.lookup(val[match[2]:match[3]], vars)
+			if err != nil {
+				return nil, err
+			}
+			if msg, ok := v.(proto.Message); ok {
+				data, err := protojson.MarshalOptions{Resolver: t.resolver}.Marshal(msg)
+				if err != nil {
+					return nil, err
+				}
+				return json.RawMessage(data), nil
+			}
+			return v, nil
+		}
+		var err error
+		result := placeholderRegex.ReplaceAllStringFunc(val, func(s string) string {
+			if err != nil {
+				return ""
+			}
+			var v any
+			v, err = t.lookup(s[2:len(s)-1], vars)
+			return fmt.Sprint(v)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	default:
+		return val, nil
+	}
+}
+
+func (t *RequestTemplate) lookup(name string, vars map[string]any) (any, error) {
+	v, ok := vars[name]
+	if !ok {
+		return nil, fmt.Errorf("no value provided for variable %q", name)
+	}
+	return v, nil
+}
+
+func collectVariables(val any, vars map[string]struct{}) {
+	switch val := val.(type) {
+	case map[string]any:
+		for _, v := range val {
+			collectVariables(v, vars)
+		}
+	case []any:
+		for _, v := range val {
+			collectVariables(v, vars)
+		}
+	case string:
+		for _, match := range placeholderRegex.FindAllStringSubmatch(val, -1) {
+			vars[match[1]] = struct{}{}
+		}
+	}
+}
+
+// RequestTemplates is a collection of request templates, keyed by the fully
+// qualified name of the method. It is safe for concurrent use.
+type RequestTemplates struct {
+	mu        sync.RWMutex
+	templates map[protoreflect.FullName]*RequestTemplate
+}
+
+// Add adds the given template to the collection, replacing any template that
+// was previously added for the same method.
+func (r *RequestTemplates) Add(t *RequestTemplate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.templates == nil {
+		r.templates = map[protoreflect.FullName]*RequestTemplate{}
+	}
+	r.templates[t.method.FullName()] = t
+}
+
+// Get returns the template for the method with the given name or nil if no
+// such template has been added.
+func (r *RequestTemplates) Get(method protoreflect.FullName) *RequestTemplate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.templates[method]
+}
+
+// Render renders the template for the method with the given name using the
+// given variables. An error is returned if there is no template for the given
+// method.
+func (r *RequestTemplates) Render(method protoreflect.FullName, vars map[string]any) (proto.Message, error) {
+	t := r.Get(method)
+	if t == nil {
+		return nil, fmt.Errorf("no request template for method %s", method)
+	}
+	return t.Render(vars)
+}
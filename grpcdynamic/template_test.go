@@ -0,0 +1,94 @@
+package grpcdynamic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	grpctestprotos "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+)
+
+func TestRequestTemplate(t *testing.T) {
+	tmpl, err := NewRequestTemplate(unaryMd, `{
+		"responseSize": "${size}",
+		"fillUsername": "${fill}",
+		"payload": "${payload}",
+		"responseStatus": {"code": 3, "message": "error in ${region}: ${reason}"}
+	}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"fill", "payload", "reason", "region", "size"}, tmpl.Variables())
+
+	req, err := tmpl.Render(map[string]any{
+		"size":    123,
+		"fill":    true,
+		"payload": payload,
+		"region":  "us-east1",
+		"reason":  "oops",
+	})
+	require.NoError(t, err)
+	expected := &grpctestprotos.SimpleRequest{
+		ResponseSize: 123,
+		FillUsername: true,
+		Payload:      payload,
+		ResponseStatus: &grpctestprotos.EchoStatus{
+			Code:    3,
+			Message: "error in us-east1: oops",
+		},
+	}
+	require.True(t, proto.Equal(expected, req), "%v != %v", expected, req)
+
+	// rendered request can be used to invoke the method
+	_, err = stub.InvokeRpc(context.Background(), unaryMd, req)
+	require.NoError(t, err)
+
+	_, err = tmpl.Render(map[string]any{"size": 123})
+	require.ErrorContains(t, err, `no value provided for variable "fill"`)
+
+	_, err = tmpl.Render(map[string]any{
+		"size":    "abc",
+		"fill":    true,
+		"payload": payload,
+		"region":  "us-east1",
+		"reason":  "oops",
+	})
+	require.ErrorContains(t, err, "failed to render template for grpc.testing.TestService.UnaryCall")
+}
+
+func TestRequestTemplate_Invalid(t *testing.T) {
+	_, err := NewRequestTemplate(unaryMd, `{"responseSize": `, nil)
+	require.ErrorContains(t, err, "invalid template for grpc.testing.TestService.UnaryCall")
+	_, err = NewRequestTemplate(unaryMd, `{"foo": "bar"}`, nil)
+	require.ErrorContains(t, err, "failed to render template")
+	// trailing data after the JSON value
+	_, err = NewRequestTemplate(unaryMd, `{"responseSize": 1} {"responseSize": 2}`, nil)
+	require.ErrorContains(t, err, "unexpected data after JSON value")
+	_, err = NewRequestTemplate(unaryMd, `{"responseSize": 1} junk`, nil)
+	require.ErrorContains(t, err, "unexpected data after JSON value")
+	_, err = NewRequestTemplate(unaryMd, "{\"responseSize\": 1}\n  \n", nil)
+	require.NoError(t, err)
+}
+
+func TestRequestTemplates(t *testing.T) {
+	tmpl, err := NewRequestTemplateFromMessage(unaryMd, &grpctestprotos.SimpleRequest{
+		ResponseStatus: &grpctestprotos.EchoStatus{Message: "hello, ${name}"},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"name"}, tmpl.Variables())
+
+	_, err = NewRequestTemplateFromMessage(unaryMd, &grpctestprotos.Payload{}, nil)
+	require.Error(t, err)
+
+	var templates RequestTemplates
+	templates.Add(tmpl)
+	require.Same(t, tmpl, templates.Get(unaryMd.FullName()))
+	require.Nil(t, templates.Get(serverStreamingMd.FullName()))
+
+	req, err := templates.Render(unaryMd.FullName(), map[string]any{"name": "world"})
+	require.NoError(t, err)
+	require.Equal(t, "hello, world", req.(*grpctestprotos.SimpleRequest).GetResponseStatus().GetMessage())
+
+	_, err = templates.Render(serverStreamingMd.FullName(), nil)
+	require.ErrorContains(t, err, "no request template for method grpc.testing.TestService.StreamingOutputCall")
+}
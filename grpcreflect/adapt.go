@@ -3,6 +3,9 @@ package grpcreflect
 //lint:file-ignore SA1019 The refv1alpha package is deprecated, but we need it in order to adapt it to new version
 
 import (
+	"io"
+
+	"google.golang.org/grpc"
 	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	refv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 )
@@ -154,3 +157,133 @@ func toV1Response(v1alpha *refv1alpha.ServerReflectionResponse) *refv1.ServerRef
 	}
 	return &v1
 }
+
+func toV1AlphaResponse(v1 *refv1.ServerReflectionResponse) *refv1alpha.ServerReflectionResponse {
+	var v1alpha refv1alpha.ServerReflectionResponse
+	v1alpha.ValidHost = v1.ValidHost
+	if v1.OriginalRequest != nil {
+		v1alpha.OriginalRequest = toV1AlphaRequest(v1.OriginalRequest)
+	}
+	switch mr := v1.MessageResponse.(type) {
+	case *refv1.ServerReflectionResponse_FileDescriptorResponse:
+		if mr != nil {
+			v1alpha.MessageResponse = &refv1alpha.ServerReflectionResponse_FileDescriptorResponse{
+				FileDescriptorResponse: &refv1alpha.FileDescriptorResponse{
+					FileDescriptorProto: mr.FileDescriptorResponse.GetFileDescriptorProto(),
+				},
+			}
+		}
+	case *refv1.ServerReflectionResponse_AllExtensionNumbersResponse:
+		if mr != nil {
+			v1alpha.MessageResponse = &refv1alpha.ServerReflectionResponse_AllExtensionNumbersResponse{
+				AllExtensionNumbersResponse: &refv1alpha.ExtensionNumberResponse{
+					BaseTypeName:    mr.AllExtensionNumbersResponse.GetBaseTypeName(),
+					ExtensionNumber: mr.AllExtensionNumbersResponse.GetExtensionNumber(),
+				},
+			}
+		}
+	case *refv1.ServerReflectionResponse_ListServicesResponse:
+		if mr != nil {
+			svcs := make([]*refv1alpha.ServiceResponse, len(mr.ListServicesResponse.GetService()))
+			for i, svc := range mr.ListServicesResponse.GetService() {
+				svcs[i] = &refv1alpha.ServiceResponse{
+					Name: svc.GetName(),
+				}
+			}
+			v1alpha.MessageResponse = &refv1alpha.ServerReflectionResponse_ListServicesResponse{
+				ListServicesResponse: &refv1alpha.ListServiceResponse{
+					Service: svcs,
+				},
+			}
+		}
+	case *refv1.ServerReflectionResponse_ErrorResponse:
+		if mr != nil {
+			v1alpha.MessageResponse = &refv1alpha.ServerReflectionResponse_ErrorResponse{
+				ErrorResponse: &refv1alpha.ErrorResponse{
+					ErrorCode:    mr.ErrorResponse.GetErrorCode(),
+					ErrorMessage: mr.ErrorResponse.GetErrorMessage(),
+				},
+			}
+		}
+	default:
+		// no value set
+	}
+	return &v1alpha
+}
+
+// NewV1AlphaServerFromV1 returns an implementation of the v1alpha version of
+// the server reflection service that forwards all requests to a server that
+// supports the v1 version, using the given stub. This can be used to build a
+// small proxy that lets older clients, which only support v1alpha, query
+// newer servers, which only support v1.
+func NewV1AlphaServerFromV1(stub refv1.ServerReflectionClient) refv1alpha.ServerReflectionServer {
+	return v1AlphaServerFromV1{stub: stub}
+}
+
+type v1AlphaServerFromV1 struct {
+	stub refv1.ServerReflectionClient
+}
+
+func (s v1AlphaServerFromV1) ServerReflectionInfo(stream refv1alpha.ServerReflection_ServerReflectionInfoServer) error {
+	upstream, err := s.stub.ServerReflectionInfo(stream.Context())
+	if err != nil {
+		return err
+	}
+	return proxyReflection(stream, upstream, toV1Request, toV1AlphaResponse)
+}
+
+// NewV1ServerFromV1Alpha returns an implementation of the v1 version of the
+// server reflection service that forwards all requests to a server that only
+// supports the v1alpha version, using the given stub. This can be used to
+// build a small proxy that lets newer clients, which only support v1, query
+// older servers, which only support v1alpha.
+func NewV1ServerFromV1Alpha(stub refv1alpha.ServerReflectionClient) refv1.ServerReflectionServer {
+	return v1ServerFromV1Alpha{stub: stub}
+}
+
+type v1ServerFromV1Alpha struct {
+	stub refv1alpha.ServerReflectionClient
+}
+
+func (s v1ServerFromV1Alpha) ServerReflectionInfo(stream refv1.ServerReflection_ServerReflectionInfoServer) error {
+	upstream, err := s.stub.ServerReflectionInfo(stream.Context())
+	if err != nil {
+		return err
+	}
+	return proxyReflection(stream, upstream, toV1AlphaRequest, toV1Response)
+}
+
+// proxyReflection forwards each request received on the given server stream
+// to the given upstream, and then forwards the upstream's response back. The
+// reflection protocol has exactly one response for each request, so they can
+// be handled one at a time.
+func proxyReflection[DownReq, DownResp, UpReq, UpResp any](
+	downstream grpc.BidiStreamingServer[DownReq, DownResp],
+	upstream grpc.BidiStreamingClient[UpReq, UpResp],
+	convertRequest func(*DownReq) *UpReq,
+	convertResponse func(*UpResp) *DownResp,
+) error {
+	for {
+		req, err := downstream.Recv()
+		if err == io.EOF {
+			return upstream.CloseSend()
+		}
+		if err != nil {
+			return err
+		}
+		if err := upstream.Send(convertRequest(req)); err != nil {
+			if err == io.EOF {
+				// get the actual error from Recv
+				_, err = upstream.Recv()
+			}
+			return err
+		}
+		resp, err := upstream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := downstream.Send(convertResponse(resp)); err != nil {
+			return err
+		}
+	}
+}
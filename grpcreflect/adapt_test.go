@@ -0,0 +1,80 @@
+package grpcreflect
+
+//lint:file-ignore SA1019 The refv1alpha package is deprecated, but we need it in order to test adapting it
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	refv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	testprotosgrpc "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+)
+
+func TestVersionAdapterServers(t *testing.T) {
+	// v1 only
+	v1Svr := grpc.NewServer()
+	testprotosgrpc.RegisterDummyServiceServer(v1Svr, testService{})
+	refv1.RegisterServerReflectionServer(v1Svr, reflection.NewServerV1(reflection.ServerOptions{Services: v1Svr}))
+	v1Conn := startTestServer(t, v1Svr)
+	// v1alpha only
+	v1AlphaSvr := grpc.NewServer()
+	testprotosgrpc.RegisterDummyServiceServer(v1AlphaSvr, testService{})
+	refv1alpha.RegisterServerReflectionServer(v1AlphaSvr, reflection.NewServer(reflection.ServerOptions{Services: v1AlphaSvr}))
+	v1AlphaConn := startTestServer(t, v1AlphaSvr)
+
+	// proxy that serves v1alpha backed by v1 and vice versa
+	proxySvr := grpc.NewServer()
+	refv1alpha.RegisterServerReflectionServer(proxySvr, NewV1AlphaServerFromV1(refv1.NewServerReflectionClient(v1Conn)))
+	refv1.RegisterServerReflectionServer(proxySvr, NewV1ServerFromV1Alpha(refv1alpha.NewServerReflectionClient(v1AlphaConn)))
+	proxyConn := startTestServer(t, proxySvr)
+
+	ctx := context.Background()
+	clients := map[string]*Client{
+		"v1alpha from v1": NewClientV1Alpha(ctx, refv1alpha.NewServerReflectionClient(proxyConn)),
+		"v1 from v1alpha": NewClientV1(ctx, refv1.NewServerReflectionClient(proxyConn)),
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			defer client.Reset()
+			svcs, err := client.ListServices()
+			require.NoError(t, err)
+			require.Contains(t, svcs, protoreflect.FullName("testprotos.DummyService"))
+
+			fd, err := client.FileContainingSymbol("testprotos.DummyService")
+			require.NoError(t, err)
+			require.Equal(t, "grpc/dummy.proto", fd.Path())
+
+			nums, err := client.AllExtensionNumbersForType("testprotos.AnotherTestMessage")
+			require.NoError(t, err)
+			require.NotEmpty(t, nums)
+
+			// errors are forwarded, too
+			_, err = client.FileByFilename("does not exist")
+			require.True(t, IsElementNotFoundError(err))
+		})
+	}
+}
+
+func startTestServer(t *testing.T, svr *grpc.Server) *grpc.ClientConn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	t.Cleanup(svr.Stop)
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = cc.Close()
+	})
+	return cc
+}
@@ -5,11 +5,13 @@ package grpcreflect
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,12 +20,14 @@ import (
 	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	refv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 
+	"github.com/jhump/protoreflect/v2/internal"
 	"github.com/jhump/protoreflect/v2/protoresolve"
 )
 
@@ -102,6 +106,13 @@ func (e *elementNotFoundError) Error() string {
 	return b.String()
 }
 
+// Is returns true if target is protoregistry.NotFound. This allows resolvers
+// that are backed by a client to be combined with other resolvers, which
+// check for that error to decide whether to consult the next resolver.
+func (e *elementNotFoundError) Is(target error) bool {
+	return target == protoregistry.NotFound
+}
+
 // IsElementNotFoundError determines if the given error indicates that a file
 // name, symbol name, or extension field was could not be found by the server.
 func IsElementNotFoundError(err error) bool {
@@ -129,6 +140,9 @@ type Client struct {
 	allowMissing        bool
 	fallbackResolver    protodesc.Resolver
 	fallbackExtResolver protoregistry.ExtensionTypeResolver
+	fileProcessors      []func(*descriptorpb.FileDescriptorProto) error
+	retryPolicy         *RetryPolicy
+	sources             []DescriptorSource
 
 	connMu      sync.Mutex
 	cancel      context.CancelFunc
@@ -139,6 +153,9 @@ type Client struct {
 	cacheMu      sync.RWMutex
 	protosByName map[string]*descriptorpb.FileDescriptorProto
 	descriptors  protoresolve.Registry
+
+	typesOnce sync.Once
+	types     *protoresolve.CachingResolver
 }
 
 // ClientOption is an option that can be used to configure the behavior of
@@ -246,6 +263,87 @@ func WithFallbackResolver(res interface {
 	return WithFallbackResolvers(res, extRes)
 }
 
+// WithFileProcessor returns an option that configures the client to invoke
+// the given function for each file descriptor proto fetched from the server,
+// before it is cached and linked into a descriptor. The function may modify
+// the given proto, for example to strip source code info, rewrite file
+// options like go_package, or redact internal options. If the option is
+// provided more than once, the functions are invoked in the order given.
+//
+// The function must not change the name, package, or dependencies of the
+// file, or the set of elements it defines. If it returns an error, the query
+// that fetched the file fails with that error. Files that are provided by a
+// fallback resolver (see WithFallbackResolvers) are not processed.
+func WithFileProcessor(fn func(*descriptorpb.FileDescriptorProto) error) ClientOption {
+	return func(c *Client) {
+		c.fileProcessors = append(c.fileProcessors, fn)
+	}
+}
+
+// RetryPolicy configures how a client retries operations when the stream to
+// the server fails with a transient error (a status code of Unavailable). This
+// often happens when servers or proxies close idle streams.
+type RetryPolicy struct {
+	// The maximum number of attempts for a single operation, including the
+	// first. If zero, a default of 3 is used.
+	MaxAttempts int
+	// The delay before the first retry. Each subsequent retry waits longer,
+	// per BackoffMultiplier. If zero, retries happen immediately, without
+	// any delay.
+	InitialBackoff time.Duration
+	// The maximum delay between retries. If zero, there is no maximum.
+	MaxBackoff time.Duration
+	// The factor by which the delay increases after each retry. If less
+	// than one, a default of 2 is used.
+	BackoffMultiplier float64
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the given retry, which is 1 for the
+// first retry, 2 for the second, etc.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	if p == nil || p.InitialBackoff <= 0 {
+		return 0
+	}
+	multiplier := p.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// WithRetryPolicy returns an option that configures how the client retries
+// operations when its stream to the server fails with a transient error. This
+// includes failures to re-establish the stream after it was closed.
+//
+// Without this option, the client makes up to three attempts, without any delay
+// between them, and does not retry failures to establish a new stream.
+//
+// Regardless of this option, when the client was created with NewClientAuto, a
+// failure of the v1 version of the reflection service that indicates it is not
+// supported causes the client to immediately try the v1alpha version instead.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = &policy
+	}
+}
+
 // FileByFilename asks the server for a file descriptor for the proto file with
 // the given name.
 func (cr *Client) FileByFilename(filename string) (protoreflect.FileDescriptor, error) {
@@ -355,6 +453,56 @@ func (cr *Client) FileContainingExtension(extendedMessageName protoreflect.FullN
 	return fd, err
 }
 
+// FilesForSymbol asks the server for the file that declares the given
+// fully-qualified symbol and returns that file along with the transitive
+// closure of its dependencies. This is the minimal set of files needed to
+// make use of the symbol. The returned files are topologically sorted:
+// dependencies always appear before the files that import them, so the
+// file that declares the symbol is always last.
+//
+// If known is not nil, any file that can be found by path in known will be
+// omitted from the results. Its dependencies are also not traversed, since
+// it is assumed that they are also known. This allows callers to only process
+// files that they do not already have. If known also implements
+// protoresolve.DescriptorResolver and can resolve the symbol, the server is
+// not contacted at all and the results are empty. Otherwise, the file that
+// declares the symbol must be downloaded from the server (unless it is already
+// cached by this client) before the results can be filtered, since only then
+// is its path and set of dependencies known.
+func (cr *Client) FilesForSymbol(symbol protoreflect.FullName, known protoresolve.FileResolver) ([]protoreflect.FileDescriptor, error) {
+	if res, ok := known.(protoresolve.DescriptorResolver); ok {
+		if d, err := res.FindDescriptorByName(symbol); err == nil {
+			if _, err := known.FindFileByPath(d.ParentFile().Path()); err == nil {
+				return nil, nil
+			}
+		}
+	}
+	fd, err := cr.FileContainingSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	var results []protoreflect.FileDescriptor
+	addFileAndDeps(fd, known, map[string]struct{}{}, &results)
+	return results, nil
+}
+
+func addFileAndDeps(fd protoreflect.FileDescriptor, known protoresolve.FileResolver, seen map[string]struct{}, results *[]protoreflect.FileDescriptor) {
+	if _, ok := seen[fd.Path()]; ok {
+		return
+	}
+	seen[fd.Path()] = struct{}{}
+	if known != nil {
+		if _, err := known.FindFileByPath(fd.Path()); err == nil {
+			return
+		}
+	}
+	imports := fd.Imports()
+	for i, length := 0, imports.Len(); i < length; i++ {
+		addFileAndDeps(imports.Get(i).FileDescriptor, known, seen, results)
+	}
+	*results = append(*results, fd)
+}
+
 func (cr *Client) getAndCacheFileDescriptors(req *refv1.ServerReflectionRequest, accept func(protoreflect.FileDescriptor) bool) (protoreflect.FileDescriptor, error) {
 	resp, err := cr.send(req)
 	if err != nil {
@@ -380,12 +528,27 @@ func (cr *Client) getAndCacheFileDescriptors(req *refv1.ServerReflectionRequest,
 			return nil, err
 		}
 
+		cr.cacheMu.RLock()
+		existingFd, ok := cr.protosByName[fd.GetName()]
+		cr.cacheMu.RUnlock()
+		if ok {
+			// don't bother processing a file we already have
+			fds = append(fds, existingFd)
+			continue
+		}
+		name := fd.GetName()
+		for _, fn := range cr.fileProcessors {
+			if err := fn(fd); err != nil {
+				return nil, fmt.Errorf("failed to process file %q: %w", name, err)
+			}
+		}
+
 		cr.cacheMu.Lock()
 		// store in cache of raw descriptor protos, but don't overwrite existing protos
-		if existingFd, ok := cr.protosByName[fd.GetName()]; ok {
+		if existingFd, ok := cr.protosByName[name]; ok {
 			fd = existingFd
 		} else {
-			cr.protosByName[fd.GetName()] = fd
+			cr.protosByName[name] = fd
 		}
 		cr.cacheMu.Unlock()
 
@@ -528,6 +691,37 @@ func (cr *Client) AllExtensionNumbersForType(extendedMessageName protoreflect.Fu
 	return nums, nil
 }
 
+// AllExtensionsForType asks the server for all known extensions of the given
+// fully-qualified message name and returns their descriptors, sorted by field
+// number. This combines AllExtensionNumbersForType with FileContainingExtension
+// for each number, so it downloads the files that declare the extensions (and
+// their dependencies) if they are not already cached by this client.
+//
+// The results can be used to decode extensions, including custom options, in
+// messages whose extensions are only known to the server.
+func (cr *Client) AllExtensionsForType(extendedMessageName protoreflect.FullName) ([]protoreflect.ExtensionDescriptor, error) {
+	nums, err := cr.AllExtensionNumbersForType(extendedMessageName)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nums, func(i, j int) bool {
+		return nums[i] < nums[j]
+	})
+	exts := make([]protoreflect.ExtensionDescriptor, 0, len(nums))
+	for _, num := range nums {
+		fd, err := cr.FileContainingExtension(extendedMessageName, num)
+		if err != nil {
+			return nil, err
+		}
+		xd := protoresolve.FindExtensionByNumberInFile(fd, extendedMessageName, num)
+		if xd == nil {
+			return nil, extensionNotFound(extendedMessageName, num, nil)
+		}
+		exts = append(exts, xd)
+	}
+	return exts, nil
+}
+
 // ListServices asks the server for the fully-qualified names of all exposed
 // services.
 func (cr *Client) ListServices() ([]protoreflect.FullName, error) {
@@ -554,21 +748,125 @@ func (cr *Client) ListServices() ([]protoreflect.FullName, error) {
 	return serviceNames, nil
 }
 
-func (cr *Client) send(req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error) {
-	// we allow one immediate retry, in case we have a stale stream
-	// (e.g. closed by server)
-	resp, err := cr.doSend(req)
+// AllFilesAsDescriptorSet asks the server for all exposed services and then
+// downloads the files that declare them, along with the transitive closure of
+// their dependencies. The results are returned as a file descriptor set, in
+// which dependencies always appear before the files that import them. Each
+// file is included exactly once, and only files that are not already cached
+// by this client are downloaded from the server.
+func (cr *Client) AllFilesAsDescriptorSet() (*descriptorpb.FileDescriptorSet, error) {
+	var set descriptorpb.FileDescriptorSet
+	err := cr.rangeAllFiles(func(fd protoreflect.FileDescriptor) error {
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return &set, nil
+}
+
+// WriteAllFilesAsDescriptorSet is like AllFilesAsDescriptorSet except that,
+// instead of returning the set, it writes it to w in the protobuf binary
+// format. Each file is written as soon as it and its dependencies have been
+// downloaded, so large schemas need not be held in memory and callers can
+// monitor progress by observing the writes. The bytes written can be
+// unmarshalled into a descriptorpb.FileDescriptorSet.
+//
+// If an error is returned, some files may have already been written to w.
+func (cr *Client) WriteAllFilesAsDescriptorSet(w io.Writer) error {
+	var buf []byte
+	return cr.rangeAllFiles(func(fd protoreflect.FileDescriptor) error {
+		data, err := proto.Marshal(protodesc.ToFileDescriptorProto(fd))
+		if err != nil {
+			return fmt.Errorf("failed to marshal file %q: %w", fd.Path(), err)
+		}
+		// each file is an element of FileDescriptorSet's repeated file field
+		buf = protowire.AppendTag(buf[:0], internal.FileSetFilesTag, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, data)
+		_, err = w.Write(buf)
+		return err
+	})
+}
+
+// SchemaFingerprint returns a hash of all files exposed by the server: the
+// files that declare its services and all of their transitive dependencies.
+// The hash is deterministic: it does not depend on the order in which the
+// server's services or files are listed, and it ignores source code info
+// (comments and source positions). So it can be used by tools to cheaply
+// detect whether a server's API surface has changed, by comparing it to a
+// previously computed fingerprint.
+//
+// Unlike other methods, this one does not use files cached by this client:
+// all files are downloaded from the server on every call, so that the result
+// reflects the server's current schema.
+//
+// The returned value is a SHA-256 digest. Fingerprints are only comparable
+// when computed by the same version of this package.
+func (cr *Client) SchemaFingerprint() ([]byte, error) {
+	snap, err := cr.fetchServiceSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(snap.files))
+	for name := range snap.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hash := sha256.New()
+	var buf []byte
+	for _, name := range names {
+		fdProto := snap.files[name]
+		fdProto.SourceCodeInfo = nil
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdProto)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal file %q: %w", name, err)
+		}
+		// length-prefix each file so boundaries between them are unambiguous
+		buf = protowire.AppendBytes(buf[:0], data)
+		hash.Write(buf)
+	}
+	return hash.Sum(nil), nil
+}
 
-	// convert error response messages into errors
-	errResp := resp.GetErrorResponse()
-	if errResp != nil {
-		return nil, status.Errorf(codes.Code(errResp.ErrorCode), "%s", errResp.ErrorMessage)
+// rangeAllFiles calls fn for each file that declares one of the server's
+// exposed services and for all of their transitive dependencies. Files are
+// visited in topological order, and no file is visited more than once.
+func (cr *Client) rangeAllFiles(fn func(protoreflect.FileDescriptor) error) error {
+	serviceNames, err := cr.ListServices()
+	if err != nil {
+		return err
 	}
+	sort.Slice(serviceNames, func(i, j int) bool {
+		return serviceNames[i] < serviceNames[j]
+	})
+	seen := map[string]struct{}{}
+	var files []protoreflect.FileDescriptor
+	for _, serviceName := range serviceNames {
+		fd, err := cr.FileContainingSymbol(serviceName)
+		if err != nil {
+			return fmt.Errorf("failed to download file for service %q: %w", serviceName, err)
+		}
+		files = files[:0]
+		addFileAndDeps(fd, nil, seen, &files)
+		for _, file := range files {
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	return resp, nil
+func (cr *Client) send(req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error) {
+	// we allow one immediate retry, in case we have a stale stream
+	// (e.g. closed by server)
+	resp, err := cr.doSend(req)
+	if err == nil {
+		// convert error response messages into errors
+		err = errorFromResponse(resp)
+	}
+	return cr.querySources(req, resp, err)
 }
 
 func isNotFound(err error) bool {
@@ -580,34 +878,47 @@ func isNotFound(err error) bool {
 }
 
 func (cr *Client) doSend(req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error) {
+	var prevErr error
+	var backoff bool
+	for attemptCount := 0; ; attemptCount++ {
+		if attemptCount >= cr.retryPolicy.maxAttempts() && prevErr != nil {
+			return nil, prevErr
+		}
+		if backoff {
+			// We wait without holding connMu so that other callers are not
+			// blocked for the duration of the backoff.
+			if err := cr.sleep(cr.retryPolicy.backoff(attemptCount)); err != nil {
+				return nil, prevErr
+			}
+		}
+		resp, retry, err := cr.doSendOnce(req)
+		if err == nil || !retry {
+			return resp, err
+		}
+		prevErr = err
+		// Only back off when retrying the same version of the service. After
+		// falling back to v1alpha, the next attempt is made right away.
+		switched := cr.fallbackToV1Alpha(err)
+		backoff = !switched && status.Code(err) == codes.Unavailable
+	}
+}
+
+// doSendOnce makes a single attempt to send the given request and receive its
+// response. If it fails, the returned bool indicates whether the request may
+// be retried.
+func (cr *Client) doSendOnce(req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, bool, error) {
 	// TODO: Streams are thread-safe, so we shouldn't need to lock. But without locking, we'll need more machinery
 	// (goroutines and channels) to ensure that responses are correctly correlated with their requests and thus
 	// delivered in correct oder.
 	cr.connMu.Lock()
 	defer cr.connMu.Unlock()
-	return cr.doSendLocked(0, nil, req)
-}
-
-func (cr *Client) doSendLocked(attemptCount int, prevErr error, req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error) {
-	if attemptCount >= 3 && prevErr != nil {
-		return nil, prevErr
-	}
-	if (status.Code(prevErr) == codes.Unimplemented ||
-		status.Code(prevErr) == codes.Unavailable) &&
-		cr.useV1() {
-		// If v1 is unimplemented, fallback to v1alpha.
-		// We also fallback on unavailable because some servers have been
-		// observed to close the connection/cancel the stream, w/out sending
-		// back status or headers, when the service name is not known. When
-		// this happens, the RPC status code is unavailable.
-		// See https://github.com/fullstorydev/grpcurl/issues/434
-		cr.useV1Alpha = true
-		cr.lastTriedV1 = cr.now()
-	}
-	attemptCount++
 
 	if err := cr.initStreamLocked(); err != nil {
-		return nil, err
+		if cr.retryPolicy != nil && status.Code(err) == codes.Unavailable {
+			cr.resetLocked()
+			return nil, true, err
+		}
+		return nil, false, err
 	}
 
 	if err := cr.stream.Send(req); err != nil {
@@ -616,15 +927,56 @@ func (cr *Client) doSendLocked(attemptCount int, prevErr error, req *refv1.Serve
 			_, err = cr.stream.Recv()
 		}
 		cr.resetLocked()
-		return cr.doSendLocked(attemptCount, err, req)
+		return nil, true, err
 	}
 
 	resp, err := cr.stream.Recv()
 	if err != nil {
 		cr.resetLocked()
-		return cr.doSendLocked(attemptCount, err, req)
+		return nil, true, err
+	}
+	return resp, false, nil
+}
+
+// fallbackToV1Alpha switches the client to the v1alpha version of the
+// reflection service if the given error indicates that v1 is not supported.
+// It returns true if the client switched versions, in which case the next
+// attempt should be made right away.
+func (cr *Client) fallbackToV1Alpha(err error) bool {
+	code := status.Code(err)
+	if code != codes.Unimplemented && code != codes.Unavailable {
+		return false
+	}
+	cr.connMu.Lock()
+	defer cr.connMu.Unlock()
+	if cr.stubV1Alpha == nil || !cr.useV1() {
+		return false
+	}
+	// If v1 is unimplemented, fallback to v1alpha.
+	// We also fallback on unavailable because some servers have been
+	// observed to close the connection/cancel the stream, w/out sending
+	// back status or headers, when the service name is not known. When
+	// this happens, the RPC status code is unavailable.
+	// See https://github.com/fullstorydev/grpcurl/issues/434
+	cr.useV1Alpha = true
+	cr.lastTriedV1 = cr.now()
+	return true
+}
+
+// sleep waits for the given duration, returning early with an error if the
+// client's context is done first.
+func (cr *Client) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-cr.ctx.Done():
+		return cr.ctx.Err()
 	}
-	return resp, nil
 }
 
 func (cr *Client) initStreamLocked() error {
@@ -697,6 +1049,14 @@ func (cr *Client) resetLocked() {
 // available to later iterations. That means that calls to NumFiles and
 // NumFilesByPackage are not necessarily authoritative as the actual number
 // could change concurrently.
+//
+// The resolver's AsTypeResolver method returns dynamic types that are cached
+// for the life of the client, so it can be used efficiently when unmarshalling
+// messages that refer to types only known to the server. For example, it can
+// be supplied as the resolver when unmarshalling google.protobuf.Any messages
+// with protojson.UnmarshalOptions or prototext.UnmarshalOptions. Not-found
+// results are also cached, for one minute, so that a name that is unknown to
+// the server does not result in a remote query every time it is resolved.
 func (cr *Client) AsResolver() protoresolve.Resolver {
 	return (*clientResolver)(cr)
 }
@@ -831,7 +1191,11 @@ func (c *clientResolver) RangeExtensionsByMessage(message protoreflect.FullName,
 }
 
 func (c *clientResolver) AsTypeResolver() protoresolve.TypeResolver {
-	return protoresolve.TypesFromResolver(c)
+	cr := (*Client)(c)
+	cr.typesOnce.Do(func() {
+		cr.types = protoresolve.NewCachingResolver(protoresolve.TypesFromResolver(c))
+	})
+	return cr.types
 }
 
 // depResolver is a view of the client's registries as a single resolver. It
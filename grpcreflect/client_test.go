@@ -3,6 +3,7 @@ package grpcreflect
 //lint:file-ignore SA1019 The refv1alpha package is deprecated, but we need it in order to adapt it to new version
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"errors"
@@ -24,12 +25,14 @@ import (
 	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	refv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
 	_ "google.golang.org/protobuf/types/known/apipb"
 	_ "google.golang.org/protobuf/types/known/emptypb"
 	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
@@ -172,6 +175,49 @@ func TestFileContainingSymbol(t *testing.T) {
 	})
 }
 
+func TestFilesForSymbol(t *testing.T) {
+	testVersions(t, func(t *testing.T, client *Client) {
+		files, err := client.FilesForSymbol("testprotos.DummyService", nil)
+		require.NoError(t, err)
+		paths := make([]string, len(files))
+		for i, fd := range files {
+			paths[i] = fd.Path()
+		}
+		require.Equal(t, []string{"desc_test1.proto", "pkg/desc_test_pkg.proto", "grpc/dummy.proto"}, paths)
+
+		// known files are excluded
+		files, err = client.FilesForSymbol("testprotos.DummyService", protoregistry.GlobalFiles)
+		require.NoError(t, err)
+		require.Empty(t, files)
+		var known protoresolve.Registry
+		fd, err := client.FileByFilename("desc_test1.proto")
+		require.NoError(t, err)
+		require.NoError(t, known.RegisterFile(fd))
+		files, err = client.FilesForSymbol("testprotos.DummyService", &known)
+		require.NoError(t, err)
+		paths = make([]string, len(files))
+		for i, fd := range files {
+			paths[i] = fd.Path()
+		}
+		require.Equal(t, []string{"pkg/desc_test_pkg.proto", "grpc/dummy.proto"}, paths)
+
+		// server is not asked about symbols that are already known
+		unknownToServer, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+			Name:        proto.String("not_on_server.proto"),
+			Package:     proto.String("not.on.server"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Foo")}},
+		}, nil)
+		require.NoError(t, err)
+		require.NoError(t, known.RegisterFile(unknownToServer))
+		files, err = client.FilesForSymbol("not.on.server.Foo", &known)
+		require.NoError(t, err)
+		require.Empty(t, files)
+
+		_, err = client.FilesForSymbol("does not exist", nil)
+		require.True(t, IsElementNotFoundError(err))
+	})
+}
+
 func TestFileContainingExtension(t *testing.T) {
 	testVersions(t, func(t *testing.T, client *Client) {
 		fd, err := client.FileContainingExtension("TopLevel", 100)
@@ -223,6 +269,49 @@ func TestAllExtensionNumbersForType(t *testing.T) {
 	})
 }
 
+func TestAllExtensionsForType(t *testing.T) {
+	testVersions(t, func(t *testing.T, client *Client) {
+		exts, err := client.AllExtensionsForType("testprotos.AnotherTestMessage")
+		require.NoError(t, err)
+		nums := make([]protoreflect.FieldNumber, len(exts))
+		for i, xd := range exts {
+			require.Equal(t, protoreflect.FullName("testprotos.AnotherTestMessage"), xd.ContainingMessage().FullName())
+			nums[i] = xd.Number()
+		}
+		require.Equal(t, []protoreflect.FieldNumber{100, 101, 102, 103, 200}, nums)
+		require.Equal(t, protoreflect.FullName("testprotos.xtm"), exts[0].FullName())
+
+		exts, err = client.AllExtensionsForType("does not exist")
+		require.NoError(t, err)
+		require.Empty(t, exts)
+	})
+}
+
+func TestAsResolver_UnmarshalAny(t *testing.T) {
+	testVersions(t, func(t *testing.T, client *Client) {
+		types := client.AsResolver().AsTypeResolver()
+		var msg anypb.Any
+		err := protojson.UnmarshalOptions{Resolver: types}.Unmarshal(
+			[]byte(`{"@type": "type.googleapis.com/testprotos.DummyRequest", "bar": "abc", "flags": {"x": true}}`),
+			&msg)
+		require.NoError(t, err)
+		require.Equal(t, "type.googleapis.com/testprotos.DummyRequest", msg.TypeUrl)
+
+		unpacked, err := anypb.UnmarshalNew(&msg, proto.UnmarshalOptions{Resolver: types})
+		require.NoError(t, err)
+		// message type comes from the server, so it is dynamic
+		require.IsType(t, (*dynamicpb.Message)(nil), unpacked)
+		md := unpacked.ProtoReflect().Descriptor()
+		require.Equal(t, "abc", unpacked.ProtoReflect().Get(md.Fields().ByName("bar")).String())
+
+		// types are cached
+		require.Same(t, types, client.AsResolver().AsTypeResolver())
+
+		_, err = types.FindMessageByName("testprotos.DoesNotExist")
+		require.ErrorIs(t, err, protoregistry.NotFound)
+	})
+}
+
 func TestListServices(t *testing.T) {
 	testVersions(t, func(t *testing.T, client *Client) {
 		s, err := client.ListServices()
@@ -239,6 +328,85 @@ func TestListServices(t *testing.T) {
 	})
 }
 
+func TestAllFilesAsDescriptorSet(t *testing.T) {
+	testVersions(t, func(t *testing.T, client *Client) {
+		set, err := client.AllFilesAsDescriptorSet()
+		require.NoError(t, err)
+		paths := make([]string, len(set.File))
+		for i, fd := range set.File {
+			paths[i] = fd.GetName()
+		}
+		require.Equal(t, []string{
+			"grpc/reflection/v1/reflection.proto",
+			"grpc/reflection/v1alpha/reflection.proto",
+			"desc_test1.proto",
+			"pkg/desc_test_pkg.proto",
+			"grpc/dummy.proto",
+		}, paths)
+		_, err = protodesc.NewFiles(set)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = client.WriteAllFilesAsDescriptorSet(&buf)
+		require.NoError(t, err)
+		var written descriptorpb.FileDescriptorSet
+		require.NoError(t, proto.Unmarshal(buf.Bytes(), &written))
+		require.True(t, proto.Equal(set, &written))
+	})
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	testVersions(t, func(t *testing.T, client *Client) {
+		fingerprint, err := client.SchemaFingerprint()
+		require.NoError(t, err)
+		require.Len(t, fingerprint, 32)
+
+		// stable across calls and after resetting the stream
+		again, err := client.SchemaFingerprint()
+		require.NoError(t, err)
+		require.Equal(t, fingerprint, again)
+		client.Reset()
+		again, err = client.SchemaFingerprint()
+		require.NoError(t, err)
+		require.Equal(t, fingerprint, again)
+	})
+}
+
+func TestSchemaFingerprint_DetectsChanges(t *testing.T) {
+	depProto := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("dep.proto"),
+		Package:     proto.String("watch"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Msg")}},
+	}
+	fooProto := watchTestServiceFile("foo.proto", "Foo")
+	var state watchTestServer
+	state.update(t, []string{"watch.Foo"}, depProto, fooProto)
+	client := state.newClient(t)
+
+	fingerprint, err := client.SchemaFingerprint()
+	require.NoError(t, err)
+	// populate the client's cache, which must not be used for fingerprints
+	_, err = client.FileByFilename("dep.proto")
+	require.NoError(t, err)
+
+	// changing a dependency changes the fingerprint, even though the server
+	// does not re-send dependencies on the same stream
+	depProto = proto.Clone(depProto).(*descriptorpb.FileDescriptorProto)
+	depProto.MessageType = append(depProto.MessageType, &descriptorpb.DescriptorProto{Name: proto.String("Other")})
+	state.update(t, []string{"watch.Foo"}, depProto, fooProto)
+	changed, err := client.SchemaFingerprint()
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, changed)
+
+	// and changing it back restores the original fingerprint
+	depProto = proto.Clone(depProto).(*descriptorpb.FileDescriptorProto)
+	depProto.MessageType = depProto.MessageType[:1]
+	state.update(t, []string{"watch.Foo"}, depProto, fooProto)
+	again, err := client.SchemaFingerprint()
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, again)
+}
+
 func TestReset(t *testing.T) {
 	testVersions(t, func(t *testing.T, client *Client) {
 		_, err := client.ListServices()
@@ -376,6 +544,141 @@ func TestAllowMissingFileDescriptors(t *testing.T) {
 	require.Equal(t, "test/imported.proto", file.Path())
 }
 
+func TestFileProcessor(t *testing.T) {
+	var processed []string
+	client := NewClientV1(context.Background(), clientv1.stubV1,
+		WithFileProcessor(func(fd *descriptorpb.FileDescriptorProto) error {
+			processed = append(processed, fd.GetName())
+			fd.SourceCodeInfo = nil
+			return nil
+		}),
+		WithFileProcessor(func(fd *descriptorpb.FileDescriptorProto) error {
+			if fd.Options != nil {
+				fd.Options.GoPackage = proto.String("example.com/redacted")
+			}
+			return nil
+		}),
+	)
+	defer client.Reset()
+
+	fd, err := client.FileByFilename("desc_test1.proto")
+	require.NoError(t, err)
+	require.Equal(t, []string{"desc_test1.proto"}, processed)
+	require.Equal(t, "example.com/redacted", fd.Options().(*descriptorpb.FileOptions).GetGoPackage())
+	require.Zero(t, fd.SourceLocations().Len())
+
+	// cached files are not processed again
+	_, err = client.FileContainingSymbol("testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, []string{"desc_test1.proto"}, processed)
+
+	client = NewClientV1(context.Background(), clientv1.stubV1,
+		WithFileProcessor(func(fd *descriptorpb.FileDescriptorProto) error {
+			return errors.New("nope")
+		}),
+	)
+	defer client.Reset()
+	_, err = client.FileByFilename("desc_test1.proto")
+	require.ErrorContains(t, err, `failed to process file "desc_test1.proto": nope`)
+}
+
+type flakyStub struct {
+	refv1.ServerReflectionClient
+	failures int32
+	calls    int32
+}
+
+func (s *flakyStub) ServerReflectionInfo(ctx context.Context, opts ...grpc.CallOption) (refv1.ServerReflection_ServerReflectionInfoClient, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "stream closed")
+	}
+	return s.ServerReflectionClient.ServerReflectionInfo(ctx, opts...)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	// without a policy, failures to create the stream are not retried
+	stub := &flakyStub{ServerReflectionClient: clientv1.stubV1, failures: 1}
+	client := NewClientV1(context.Background(), stub)
+	_, err := client.ListServices()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	client.Reset()
+
+	stub = &flakyStub{ServerReflectionClient: clientv1.stubV1, failures: 3}
+	client = NewClientV1(context.Background(), stub, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 10 * time.Millisecond,
+	}))
+	defer client.Reset()
+	start := time.Now()
+	svcs, err := client.ListServices()
+	require.NoError(t, err)
+	require.NotEmpty(t, svcs)
+	require.Equal(t, int32(4), atomic.LoadInt32(&stub.calls))
+	// backoff is 10ms, 20ms, then 40ms
+	require.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+
+	// gives up after max attempts
+	stub = &flakyStub{ServerReflectionClient: clientv1.stubV1, failures: 10}
+	client = NewClientV1(context.Background(), stub, WithRetryPolicy(RetryPolicy{MaxAttempts: 5}))
+	defer client.Reset()
+	_, err = client.ListServices()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, int32(5), atomic.LoadInt32(&stub.calls))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, BackoffMultiplier: 3}
+	require.Equal(t, time.Second, policy.backoff(1))
+	require.Equal(t, 3*time.Second, policy.backoff(2))
+	require.Equal(t, 5*time.Second, policy.backoff(3))
+	require.Equal(t, 5*time.Second, policy.backoff(30))
+	require.Zero(t, (*RetryPolicy)(nil).backoff(2))
+	require.Equal(t, 3, (*RetryPolicy)(nil).maxAttempts())
+}
+
+func TestRetryPolicy_ConcurrentCallersDuringBackoff(t *testing.T) {
+	stub := &flakyStub{ServerReflectionClient: clientv1.stubV1, failures: 1}
+	client := NewClientV1(context.Background(), stub, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: 500 * time.Millisecond,
+	}))
+	defer client.Reset()
+
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := client.ListServices()
+		firstDone <- err
+	}()
+	// wait for the first caller to fail and start its backoff
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&stub.calls) >= 1
+	}, time.Second, time.Millisecond)
+
+	// a second caller is not blocked by the first one's backoff
+	start := time.Now()
+	svcs, err := client.ListServices()
+	require.NoError(t, err)
+	require.NotEmpty(t, svcs)
+	require.Less(t, time.Since(start), 250*time.Millisecond)
+
+	require.NoError(t, <-firstDone)
+}
+
+func TestRetryPolicy_NoBackoffForFallback(t *testing.T) {
+	// v1 is always unavailable, so the client falls back to v1alpha
+	stub := &flakyStub{ServerReflectionClient: clientv1.stubV1, failures: 100}
+	client := newClient(context.Background(), stub, clientv1alpha.stubV1Alpha, []ClientOption{
+		WithRetryPolicy(RetryPolicy{InitialBackoff: time.Second}),
+	})
+	defer client.Reset()
+	start := time.Now()
+	svcs, err := client.ListServices()
+	require.NoError(t, err)
+	require.NotEmpty(t, svcs)
+	require.Equal(t, int32(1), atomic.LoadInt32(&stub.calls))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
 func TestAllowFallbackResolver(t *testing.T) {
 	svr := grpc.NewServer()
 	reflection.RegisterV1(svr)
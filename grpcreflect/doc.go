@@ -8,5 +8,8 @@
 // dynamic client. (See the grpcdynamic package in this same repo for more on
 // that.)
 //
+// The GenerateOpenAPI function can be used to produce REST documentation, in
+// the form of an OpenAPI document, for services discovered this way.
+//
 // [gRPC reflection service]: https://github.com/grpc/grpc/blob/master/src/proto/grpc/reflection/v1/reflection.proto
 package grpcreflect
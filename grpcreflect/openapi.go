@@ -0,0 +1,586 @@
+package grpcreflect
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/internal/register"
+	"github.com/jhump/protoreflect/v2/protomessage"
+)
+
+// GenerateOpenAPI returns an OpenAPI v3 document, in JSON format, that
+// describes the given services. This is the same as
+// OpenAPIOptions{}.Generate(services...).
+func GenerateOpenAPI(services ...protoreflect.ServiceDescriptor) ([]byte, error) {
+	return OpenAPIOptions{}.Generate(services...)
+}
+
+// OpenAPIOptions configures how OpenAPI documents are generated.
+type OpenAPIOptions struct {
+	// The title of the API. If empty, the full names of the services are
+	// used, separated by commas.
+	Title string
+	// The version of the API. If empty, "1.0.0" is used.
+	Version string
+}
+
+// Generate returns an OpenAPI v3 document, in JSON format, that describes the
+// given services. The services are typically those returned by a Client, so
+// REST documentation can be produced for services discovered at runtime.
+//
+// If a method has google.api.http annotations, the HTTP rules therein define
+// the method's operations, including any additional bindings. The annotations
+// are read reflectively, so they need not be linked into the program: they only
+// need to be present in the method's options, and the google/api/http.proto
+// file must be imported (directly or publicly) by the method's file, as it is
+// in files that use the annotations. Methods without annotations are described
+// using the conventions of gRPC-JSON transcoding: a POST to a path of the form
+// "/package.Service/Method" whose body is the request message. Streaming
+// methods are omitted since they cannot be described as simple HTTP requests.
+//
+// HTTP rules with a custom pattern whose kind is an HTTP method that OpenAPI
+// supports, such as HEAD, are described like any other operation. Since
+// OpenAPI does not allow other methods, operations for custom kinds like
+// "LIST" are described using specification extensions in the path item: the
+// operation's key is "x-" followed by the kind in lower case, such as
+// "x-list".
+//
+// Request and response messages are described using schemas that match their
+// JSON format per the protojson package. So path and query parameters are also
+// named using the JSON names of the fields to which they refer: a path
+// variable "{book.page_count}" in an HTTP rule becomes "{book.pageCount}" in
+// the OpenAPI document. Comments in the descriptors' source
+// info, if present, are used as descriptions.
+func (o OpenAPIOptions) Generate(services ...protoreflect.ServiceDescriptor) ([]byte, error) {
+	title := o.Title
+	if title == "" {
+		names := make([]string, len(services))
+		for i, sd := range services {
+			names[i] = string(sd.FullName())
+		}
+		title = strings.Join(names, ", ")
+	}
+	version := o.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+	g := openAPIGenerator{
+		doc: openAPIDocument{
+			OpenAPI: "3.0.3",
+			Info:    openAPIInfo{Title: title, Version: version},
+			Paths:   map[string]map[string]*openAPIOperation{},
+			Components: openAPIComponents{Schemas: map[string]*openAPISchema{
+				statusSchemaName: statusSchema(),
+			}},
+		},
+	}
+	for _, sd := range services {
+		methods := sd.Methods()
+		for i, length := 0, methods.Len(); i < length; i++ {
+			if err := g.addMethod(methods.Get(i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.MarshalIndent(&g.doc, "", "  ")
+}
+
+const statusSchemaName = "google.rpc.Status"
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AllOf                []*openAPISchema          `json:"allOf,omitempty"`
+}
+
+type openAPIGenerator struct {
+	doc openAPIDocument
+}
+
+// httpBinding is a single HTTP method and path from a google.api.HttpRule.
+type httpBinding struct {
+	method, path, body, responseBody string
+}
+
+func (g *openAPIGenerator) addMethod(mtd protoreflect.MethodDescriptor) error {
+	if mtd.IsStreamingClient() || mtd.IsStreamingServer() {
+		return nil
+	}
+	bindings, err := httpBindings(mtd)
+	if err != nil {
+		return fmt.Errorf("method %s: %w", mtd.FullName(), err)
+	}
+	if len(bindings) == 0 {
+		// gRPC-JSON transcoding conventions
+		bindings = []httpBinding{{
+			method: "post",
+			path:   fmt.Sprintf("/%s/%s", mtd.Parent().FullName(), mtd.Name()),
+			body:   "*",
+		}}
+	}
+	for i, binding := range bindings {
+		op, err := g.operation(mtd, binding)
+		if err != nil {
+			return fmt.Errorf("method %s: %w", mtd.FullName(), err)
+		}
+		if i > 0 {
+			op.OperationID = fmt.Sprintf("%s_%d", op.OperationID, i)
+		}
+		path, _, _ := convertPathTemplate(binding.path, mtd.Input())
+		item := g.doc.Paths[path]
+		if item == nil {
+			item = map[string]*openAPIOperation{}
+			g.doc.Paths[path] = item
+		}
+		if _, ok := item[binding.method]; ok {
+			return fmt.Errorf("method %s: %s %s is already bound to another method", mtd.FullName(), strings.ToUpper(binding.method), binding.path)
+		}
+		item[binding.method] = op
+	}
+	return nil
+}
+
+func (g *openAPIGenerator) operation(mtd protoreflect.MethodDescriptor, binding httpBinding) (*openAPIOperation, error) {
+	op := &openAPIOperation{
+		OperationID: string(mtd.FullName()),
+		Tags:        []string{string(mtd.Parent().FullName())},
+		Responses:   map[string]*openAPIResponse{},
+	}
+	if comments := leadingComments(mtd); comments != "" {
+		op.Summary, op.Description, _ = strings.Cut(comments, "\n")
+		op.Description = strings.TrimSpace(op.Description)
+	}
+
+	input := mtd.Input()
+	_, pathParams, err := convertPathTemplate(binding.path, input)
+	if err != nil {
+		return nil, fmt.Errorf("path %q: %w", binding.path, err)
+	}
+	inPath := map[string]bool{}
+	for _, param := range pathParams {
+		inPath[param.fieldPath] = true
+		op.Parameters = append(op.Parameters, &openAPIParameter{
+			Name:        param.name,
+			In:          "path",
+			Description: leadingComments(param.field),
+			Required:    true,
+			Schema:      g.fieldSchema(param.field),
+		})
+	}
+
+	switch binding.body {
+	case "*":
+		op.RequestBody = &openAPIBody{Required: true, Content: jsonContent(g.messageSchema(input))}
+	case "":
+	default:
+		fld := input.Fields().ByName(protoreflect.Name(binding.body))
+		if fld == nil {
+			return nil, fmt.Errorf("body field %q not found in %s", binding.body, input.FullName())
+		}
+		inPath[binding.body] = true
+		op.RequestBody = &openAPIBody{Required: true, Content: jsonContent(g.fieldSchema(fld))}
+	}
+	if binding.body != "*" {
+		// remaining fields can be provided as query parameters
+		fields := input.Fields()
+		for i, length := 0, fields.Len(); i < length; i++ {
+			fld := fields.Get(i)
+			if inPath[string(fld.Name())] || fld.IsMap() || (fld.Message() != nil && !isScalarWellKnownType(fld.Message())) {
+				continue
+			}
+			op.Parameters = append(op.Parameters, &openAPIParameter{
+				Name:        fld.JSONName(),
+				In:          "query",
+				Description: leadingComments(fld),
+				Schema:      g.fieldSchema(fld),
+			})
+		}
+	}
+
+	var respSchema *openAPISchema
+	if binding.responseBody != "" {
+		fld := mtd.Output().Fields().ByName(protoreflect.Name(binding.responseBody))
+		if fld == nil {
+			return nil, fmt.Errorf("response body field %q not found in %s", binding.responseBody, mtd.Output().FullName())
+		}
+		respSchema = g.fieldSchema(fld)
+	} else {
+		respSchema = g.messageSchema(mtd.Output())
+	}
+	op.Responses["200"] = &openAPIResponse{Description: "A successful response.", Content: jsonContent(respSchema)}
+	op.Responses["default"] = &openAPIResponse{Description: "An error response.", Content: jsonContent(schemaRef(statusSchemaName))}
+	return op, nil
+}
+
+// httpBindings returns the HTTP bindings defined by the given method's
+// google.api.http option. It returns nil if the method has no such option.
+func httpBindings(mtd protoreflect.MethodDescriptor) ([]httpBinding, error) {
+	opts := mtd.Options()
+	if opts == nil {
+		return nil, nil
+	}
+	// the annotation may not be known to the runtime, in which case it will be
+	// in unknown fields, so we re-parse using types visible to the file
+	opts = proto.Clone(opts)
+	var reg protoregistry.Types
+	register.RegisterTypesVisibleToFile(mtd.ParentFile(), &reg, true)
+	protomessage.ReparseUnrecognized(opts, &reg)
+	var rule protoreflect.Message
+	opts.ProtoReflect().Range(func(fld protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		if fld.IsExtension() && fld.FullName() == "google.api.http" && fld.Message() != nil {
+			rule = val.Message()
+			return false
+		}
+		return true
+	})
+	if rule == nil {
+		return nil, nil
+	}
+	var bindings []httpBinding
+	if err := addHTTPBindings(rule, &bindings); err != nil {
+		return nil, err
+	}
+	additional := getField(rule, "additional_bindings")
+	if additional.IsValid() {
+		list := additional.List()
+		for i, length := 0, list.Len(); i < length; i++ {
+			if err := addHTTPBindings(list.Get(i).Message(), &bindings); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bindings, nil
+}
+
+func addHTTPBindings(rule protoreflect.Message, bindings *[]httpBinding) error {
+	binding := httpBinding{
+		body:         getString(rule, "body"),
+		responseBody: getString(rule, "response_body"),
+	}
+	for _, method := range []string{"get", "put", "post", "delete", "patch"} {
+		if path := getField(rule, protoreflect.Name(method)); path.IsValid() {
+			binding.method, binding.path = method, path.String()
+			break
+		}
+	}
+	if custom := getField(rule, "custom"); custom.IsValid() {
+		binding.method = strings.ToLower(getString(custom.Message(), "kind"))
+		binding.path = getString(custom.Message(), "path")
+		switch binding.method {
+		case "":
+			return fmt.Errorf("custom pattern for path %q has no kind", binding.path)
+		case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+		default:
+			// not a method that OpenAPI supports, so use an extension
+			binding.method = "x-" + binding.method
+		}
+	}
+	if binding.method == "" {
+		// no pattern
+		return nil
+	}
+	if !strings.HasPrefix(binding.path, "/") {
+		return fmt.Errorf("invalid path %q: must start with '/'", binding.path)
+	}
+	*bindings = append(*bindings, binding)
+	return nil
+}
+
+// getField returns the value of the named field. If the message has no such
+// field, or the field is not set, an invalid value is returned.
+func getField(msg protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+	fld := msg.Descriptor().Fields().ByName(name)
+	if fld == nil || !msg.Has(fld) {
+		return protoreflect.Value{}
+	}
+	return msg.Get(fld)
+}
+
+func getString(msg protoreflect.Message, name protoreflect.Name) string {
+	val := getField(msg, name)
+	if !val.IsValid() {
+		return ""
+	}
+	return val.String()
+}
+
+var pathVariable = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?}`)
+
+// pathParam is a variable in a path template.
+type pathParam struct {
+	// the name of the parameter in the OpenAPI path, which uses JSON names
+	name string
+	// the name of the variable in the path template, which uses field names
+	fieldPath string
+	field     protoreflect.FieldDescriptor
+}
+
+// convertPathTemplate converts the given path template, from a google.api.HttpRule,
+// into an OpenAPI path. It also returns the path's variables, which refer to
+// fields in the given request message.
+func convertPathTemplate(template string, input protoreflect.MessageDescriptor) (string, []pathParam, error) {
+	var params []pathParam
+	var err error
+	path := pathVariable.ReplaceAllStringFunc(template, func(s string) string {
+		fieldPath := pathVariable.FindStringSubmatch(s)[1]
+		name, fld, fldErr := findFieldPath(input, fieldPath)
+		if fldErr != nil {
+			if err == nil {
+				err = fldErr
+			}
+			return s
+		}
+		params = append(params, pathParam{name: name, fieldPath: fieldPath, field: fld})
+		return "{" + name + "}"
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return path, params, nil
+}
+
+// findFieldPath returns the field referred to by the given dot-separated path
+// of field names. It also returns the path using the fields' JSON names.
+func findFieldPath(md protoreflect.MessageDescriptor, path string) (string, protoreflect.FieldDescriptor, error) {
+	var fld protoreflect.FieldDescriptor
+	names := strings.Split(path, ".")
+	jsonNames := make([]string, len(names))
+	for i, name := range names {
+		if md == nil {
+			return "", nil, fmt.Errorf("field %q is not a message", fld.Name())
+		}
+		fld = md.Fields().ByName(protoreflect.Name(name))
+		if fld == nil {
+			return "", nil, fmt.Errorf("field %q not found in %s", name, md.FullName())
+		}
+		if fld.IsList() || fld.IsMap() {
+			return "", nil, fmt.Errorf("field %q is repeated", name)
+		}
+		jsonNames[i] = fld.JSONName()
+		md = fld.Message()
+	}
+	return strings.Join(jsonNames, "."), fld, nil
+}
+
+func jsonContent(schema *openAPISchema) map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{"application/json": {Schema: schema}}
+}
+
+func schemaRef(name protoreflect.FullName) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + string(name)}
+}
+
+func (g *openAPIGenerator) fieldSchema(fld protoreflect.FieldDescriptor) *openAPISchema {
+	if fld.IsMap() {
+		return &openAPISchema{Type: "object", AdditionalProperties: g.singularFieldSchema(fld.MapValue())}
+	}
+	if fld.IsList() {
+		return &openAPISchema{Type: "array", Items: g.singularFieldSchema(fld)}
+	}
+	return g.singularFieldSchema(fld)
+}
+
+func (g *openAPIGenerator) singularFieldSchema(fld protoreflect.FieldDescriptor) *openAPISchema {
+	switch fld.Kind() {
+	case protoreflect.EnumKind:
+		return g.enumSchema(fld.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return g.messageSchema(fld.Message())
+	default:
+		return scalarSchema(fld.Kind())
+	}
+}
+
+func scalarSchema(kind protoreflect.Kind) *openAPISchema {
+	switch kind {
+	case protoreflect.BoolKind:
+		return &openAPISchema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &openAPISchema{Type: "integer", Format: "uint32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// 64-bit integers are strings in JSON
+		return &openAPISchema{Type: "string", Format: "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &openAPISchema{Type: "string", Format: "uint64"}
+	case protoreflect.FloatKind:
+		return &openAPISchema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &openAPISchema{Type: "number", Format: "double"}
+	case protoreflect.BytesKind:
+		return &openAPISchema{Type: "string", Format: "byte"}
+	default:
+		return &openAPISchema{Type: "string"}
+	}
+}
+
+func (g *openAPIGenerator) enumSchema(ed protoreflect.EnumDescriptor) *openAPISchema {
+	if ed.FullName() == "google.protobuf.NullValue" {
+		// always rendered as JSON null
+		return &openAPISchema{}
+	}
+	name := string(ed.FullName())
+	if _, ok := g.doc.Components.Schemas[name]; !ok {
+		schema := &openAPISchema{Type: "string", Description: leadingComments(ed)}
+		values := ed.Values()
+		for i, length := 0, values.Len(); i < length; i++ {
+			schema.Enum = append(schema.Enum, string(values.Get(i).Name()))
+		}
+		g.doc.Components.Schemas[name] = schema
+	}
+	return schemaRef(ed.FullName())
+}
+
+func (g *openAPIGenerator) messageSchema(md protoreflect.MessageDescriptor) *openAPISchema {
+	if schema := wellKnownTypeSchema(md); schema != nil {
+		return schema
+	}
+	name := string(md.FullName())
+	if _, ok := g.doc.Components.Schemas[name]; !ok {
+		schema := &openAPISchema{Type: "object", Description: leadingComments(md)}
+		// store it before computing properties, in case of recursive types
+		g.doc.Components.Schemas[name] = schema
+		fields := md.Fields()
+		if fields.Len() > 0 {
+			schema.Properties = map[string]*openAPISchema{}
+		}
+		for i, length := 0, fields.Len(); i < length; i++ {
+			fld := fields.Get(i)
+			fldSchema := g.fieldSchema(fld)
+			if comments := leadingComments(fld); comments != "" {
+				if fldSchema.Ref != "" {
+					// siblings of $ref are ignored, so wrap it
+					fldSchema = &openAPISchema{AllOf: []*openAPISchema{fldSchema}}
+				}
+				fldSchema.Description = comments
+			}
+			schema.Properties[fld.JSONName()] = fldSchema
+			if fld.Cardinality() == protoreflect.Required {
+				schema.Required = append(schema.Required, fld.JSONName())
+			}
+		}
+	}
+	return schemaRef(md.FullName())
+}
+
+func isScalarWellKnownType(md protoreflect.MessageDescriptor) bool {
+	schema := wellKnownTypeSchema(md)
+	return schema != nil && schema.Type != "object" && schema.Type != "array" && schema.Type != ""
+}
+
+// wellKnownTypeSchema returns the schema for the given well-known type, which
+// have special representations in JSON. It returns nil if the given message is
+// not such a type.
+func wellKnownTypeSchema(md protoreflect.MessageDescriptor) *openAPISchema {
+	if md.ParentFile().Package() != "google.protobuf" {
+		return nil
+	}
+	switch md.Name() {
+	case "Any":
+		return &openAPISchema{
+			Type:                 "object",
+			Properties:           map[string]*openAPISchema{"@type": {Type: "string"}},
+			AdditionalProperties: &openAPISchema{},
+		}
+	case "Timestamp":
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case "Duration", "FieldMask":
+		return &openAPISchema{Type: "string"}
+	case "Empty":
+		return &openAPISchema{Type: "object"}
+	case "Struct":
+		return &openAPISchema{Type: "object", AdditionalProperties: &openAPISchema{}}
+	case "ListValue":
+		return &openAPISchema{Type: "array", Items: &openAPISchema{}}
+	case "Value":
+		// any JSON value
+		return &openAPISchema{}
+	case "DoubleValue", "FloatValue", "Int64Value", "UInt64Value", "Int32Value",
+		"UInt32Value", "BoolValue", "StringValue", "BytesValue":
+		if fld := md.Fields().ByName("value"); fld != nil {
+			return scalarSchema(fld.Kind())
+		}
+	}
+	return nil
+}
+
+func statusSchema() *openAPISchema {
+	return &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"code":    {Type: "integer", Format: "int32"},
+			"message": {Type: "string"},
+			"details": {Type: "array", Items: &openAPISchema{
+				Type:                 "object",
+				Properties:           map[string]*openAPISchema{"@type": {Type: "string"}},
+				AdditionalProperties: &openAPISchema{},
+			}},
+		},
+	}
+}
+
+func leadingComments(d protoreflect.Descriptor) string {
+	return strings.TrimSpace(d.ParentFile().SourceLocations().ByDescriptor(d).LeadingComments)
+}
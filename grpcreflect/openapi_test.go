@@ -0,0 +1,211 @@
+package grpcreflect
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var openAPITestFiles = map[string]string{
+	"google/api/http.proto": `
+		syntax = "proto3";
+		package google.api;
+		message HttpRule {
+		  string selector = 1;
+		  oneof pattern {
+		    string get = 2;
+		    string put = 3;
+		    string post = 4;
+		    string delete = 5;
+		    string patch = 6;
+		    CustomHttpPattern custom = 8;
+		  }
+		  string body = 7;
+		  string response_body = 12;
+		  repeated HttpRule additional_bindings = 11;
+		}
+		message CustomHttpPattern {
+		  string kind = 1;
+		  string path = 2;
+		}`,
+	"google/api/annotations.proto": `
+		syntax = "proto3";
+		package google.api;
+		import public "google/api/http.proto";
+		import "google/protobuf/descriptor.proto";
+		extend google.protobuf.MethodOptions {
+		  HttpRule http = 72295728;
+		}`,
+	"library.proto": `
+		syntax = "proto3";
+		package library;
+		import "google/api/annotations.proto";
+		import "google/protobuf/timestamp.proto";
+
+		service Library {
+		  // Gets a book.
+		  // Returns NOT_FOUND if there is no such book.
+		  rpc GetBook(GetBookRequest) returns (Book) {
+		    option (google.api.http) = {
+		      get: "/v1/{name=shelves/*/books/*}"
+		      additional_bindings { get: "/v1/books/{name}" }
+		    };
+		  }
+		  rpc UpdateBook(UpdateBookRequest) returns (Book) {
+		    option (google.api.http) = { patch: "/v1/{book.name=shelves/*/books/*}" body: "book" };
+		  }
+		  rpc ListBooks(ListBooksRequest) returns (Book) {
+		    option (google.api.http) = {
+		      custom: { kind: "LIST" path: "/v1/{shelf_id}/books" }
+		      additional_bindings { custom: { kind: "HEAD" path: "/v1/{shelf_id}/books" } }
+		    };
+		  }
+		  rpc CheckBook(Book) returns (Book);
+		  rpc WatchBooks(GetBookRequest) returns (stream Book);
+		}
+
+		message GetBookRequest {
+		  string name = 1;
+		  bool include_reviews = 2;
+		  Book template = 3;
+		}
+		message ListBooksRequest {
+		  string shelf_id = 1;
+		  int32 page_size = 2;
+		}
+		message UpdateBookRequest {
+		  Book book = 1;
+		  int64 revision = 2;
+		}
+		// A book in the library.
+		message Book {
+		  string name = 1;
+		  // The book's genre.
+		  Genre genre = 2;
+		  repeated string authors = 3;
+		  map<string, Book> related = 4;
+		  google.protobuf.Timestamp published = 5;
+		  int64 page_count = 6;
+		}
+		enum Genre {
+		  GENRE_UNSPECIFIED = 0;
+		  FICTION = 1;
+		}`,
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(openAPITestFiles),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	files, err := compiler.Compile(context.Background(), "library.proto")
+	require.NoError(t, err)
+	sd := files[0].Services().ByName("Library")
+
+	t.Run("compiled", func(t *testing.T) {
+		checkOpenAPIDocument(t, sd)
+	})
+	t.Run("unrecognized options", func(t *testing.T) {
+		// descriptors created by protodesc, like those created by Client,
+		// have the annotations in unknown fields
+		fileSet := &descriptorpb.FileDescriptorSet{}
+		seen := map[string]bool{}
+		var addFile func(protoreflect.FileDescriptor)
+		addFile = func(fd protoreflect.FileDescriptor) {
+			if seen[fd.Path()] {
+				return
+			}
+			seen[fd.Path()] = true
+			imports := fd.Imports()
+			for i := 0; i < imports.Len(); i++ {
+				addFile(imports.Get(i).FileDescriptor)
+			}
+			fileSet.File = append(fileSet.File, protodesc.ToFileDescriptorProto(fd))
+		}
+		addFile(files[0])
+		reg, err := protodesc.NewFiles(fileSet)
+		require.NoError(t, err)
+		d, err := reg.FindDescriptorByName("library.Library")
+		require.NoError(t, err)
+		checkOpenAPIDocument(t, d.(protoreflect.ServiceDescriptor))
+	})
+}
+
+func checkOpenAPIDocument(t *testing.T, sd protoreflect.ServiceDescriptor) {
+	data, err := OpenAPIOptions{Version: "v1"}.Generate(sd)
+	require.NoError(t, err)
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(data, &doc))
+	get := func(v any, keys ...string) any {
+		for _, k := range keys {
+			m, ok := v.(map[string]any)
+			require.True(t, ok, "not an object at %q in %v", k, keys)
+			v = m[k]
+		}
+		return v
+	}
+
+	require.Equal(t, "3.0.3", doc["openapi"])
+	require.Equal(t, map[string]any{"title": "library.Library", "version": "v1"}, doc["info"])
+
+	paths := get(doc, "paths").(map[string]any)
+	require.Len(t, paths, 5)
+
+	getBook := get(paths, "/v1/{name}", "get")
+	require.Equal(t, "library.Library.GetBook", get(getBook, "operationId"))
+	require.Equal(t, "Gets a book.", get(getBook, "summary"))
+	require.Equal(t, "Returns NOT_FOUND if there is no such book.", get(getBook, "description"))
+	require.Equal(t, []any{
+		map[string]any{"name": "name", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "includeReviews", "in": "query", "schema": map[string]any{"type": "boolean"}},
+	}, get(getBook, "parameters"))
+	require.Nil(t, get(getBook, "requestBody"))
+	require.Equal(t, "#/components/schemas/library.Book", get(getBook, "responses", "200", "content", "application/json", "schema", "$ref"))
+	require.Equal(t, "#/components/schemas/google.rpc.Status", get(getBook, "responses", "default", "content", "application/json", "schema", "$ref"))
+	require.Equal(t, "library.Library.GetBook_1", get(paths, "/v1/books/{name}", "get", "operationId"))
+
+	updateBook := get(paths, "/v1/{book.name}", "patch")
+	require.Equal(t, []any{
+		map[string]any{"name": "book.name", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "revision", "in": "query", "schema": map[string]any{"type": "string", "format": "int64"}},
+	}, get(updateBook, "parameters"))
+	require.Equal(t, "#/components/schemas/library.Book", get(updateBook, "requestBody", "content", "application/json", "schema", "$ref"))
+
+	// custom kinds: parameters use JSON names, like query parameters and schemas
+	listBooksPath := get(paths, "/v1/{shelfId}/books").(map[string]any)
+	require.Len(t, listBooksPath, 2)
+	listBooks := get(listBooksPath, "x-list")
+	require.Equal(t, "library.Library.ListBooks", get(listBooks, "operationId"))
+	require.Equal(t, []any{
+		map[string]any{"name": "shelfId", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "pageSize", "in": "query", "schema": map[string]any{"type": "integer", "format": "int32"}},
+	}, get(listBooks, "parameters"))
+	require.Equal(t, "library.Library.ListBooks_1", get(listBooksPath, "head", "operationId"))
+
+	// no annotations: gRPC-JSON conventions
+	checkBook := get(paths, "/library.Library/CheckBook", "post")
+	require.Equal(t, "#/components/schemas/library.Book", get(checkBook, "requestBody", "content", "application/json", "schema", "$ref"))
+
+	book := get(doc, "components", "schemas", "library.Book")
+	require.Equal(t, "A book in the library.", get(book, "description"))
+	require.Equal(t, map[string]any{
+		"name": map[string]any{"type": "string"},
+		"genre": map[string]any{
+			"allOf":       []any{map[string]any{"$ref": "#/components/schemas/library.Genre"}},
+			"description": "The book's genre.",
+		},
+		"authors":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"related":   map[string]any{"type": "object", "additionalProperties": map[string]any{"$ref": "#/components/schemas/library.Book"}},
+		"published": map[string]any{"type": "string", "format": "date-time"},
+		"pageCount": map[string]any{"type": "string", "format": "int64"},
+	}, get(book, "properties"))
+	require.Equal(t, map[string]any{"type": "string", "enum": []any{"GENRE_UNSPECIFIED", "FICTION"}}, get(doc, "components", "schemas", "library.Genre"))
+}
@@ -0,0 +1,86 @@
+package grpcreflect
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+)
+
+// DescriptorSource is an additional source of descriptors for a Client. It
+// can be used to teach a client other discovery protocols, such as a custom
+// service that a server exposes instead of, or in addition to, the standard
+// reflection service. Code that uses the client, such as via its AsResolver
+// method, need not know which source provided a particular descriptor.
+//
+// A source answers requests using the same messages as the standard
+// reflection service, so an implementation typically translates requests
+// into queries for some other protocol and then translates the results back
+// into responses. See WithDescriptorSources.
+type DescriptorSource interface {
+	// Query handles the given request, returning a response in the same
+	// form that the standard reflection service would. A source that does
+	// not know the requested element should either return an error with
+	// a status code of NotFound or a response whose error_response field
+	// has that code. A source that does not support a kind of request should
+	// similarly indicate a code of Unimplemented.
+	//
+	// The given context is the one with which the client was created.
+	Query(ctx context.Context, req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error)
+}
+
+// DescriptorSourceFunc is a function that implements DescriptorSource.
+type DescriptorSourceFunc func(ctx context.Context, req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error)
+
+var _ DescriptorSource = DescriptorSourceFunc(nil)
+
+// Query implements the DescriptorSource interface.
+func (f DescriptorSourceFunc) Query(ctx context.Context, req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error) {
+	return f(ctx, req)
+}
+
+// WithDescriptorSources returns an option that configures the client to
+// query the given sources when the server's reflection service cannot answer
+// a request, because it does not know the requested element (status code
+// NotFound) or because it is not supported (status code Unimplemented). The
+// sources are queried in the order given, and the first one that answers is
+// used. If the option is provided more than once, the sources are appended.
+//
+// Files provided by a source are cached and processed the same way as files
+// provided by the reflection service, including by any functions configured
+// via WithFileProcessor. Sources are consulted before any fallback resolver
+// configured via WithFallbackResolvers.
+func WithDescriptorSources(sources ...DescriptorSource) ClientOption {
+	return func(c *Client) {
+		c.sources = append(c.sources, sources...)
+	}
+}
+
+// querySources queries the client's additional sources, in order, if the
+// given error from the reflection service indicates that it could not
+// answer the request.
+func (cr *Client) querySources(req *refv1.ServerReflectionRequest, resp *refv1.ServerReflectionResponse, err error) (*refv1.ServerReflectionResponse, error) {
+	for _, src := range cr.sources {
+		if code := status.Code(err); code != codes.NotFound && code != codes.Unimplemented {
+			break
+		}
+		resp, err = src.Query(cr.ctx, req)
+		if err == nil {
+			err = errorFromResponse(resp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// errorFromResponse converts an error response message into an error.
+func errorFromResponse(resp *refv1.ServerReflectionResponse) error {
+	errResp := resp.GetErrorResponse()
+	if errResp == nil {
+		return nil
+	}
+	return status.Errorf(codes.Code(errResp.ErrorCode), "%s", errResp.ErrorMessage)
+}
@@ -0,0 +1,173 @@
+package grpcreflect
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	testprotosgrpc "github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+func TestDescriptorSources_NoReflection(t *testing.T) {
+	// server does not support reflection
+	cconn := startTestServer(t, grpc.NewServer())
+	var files protoresolve.Registry
+	require.NoError(t, registerFileAndDeps(&files, testprotosgrpc.File_grpc_test_proto))
+	var queries atomic.Int32
+	client := NewClientV1(context.Background(), refv1.NewServerReflectionClient(cconn),
+		WithDescriptorSources(registrySource(&files, &queries)))
+	defer client.Reset()
+
+	services, err := client.ListServices()
+	require.NoError(t, err)
+	require.Contains(t, services, protoreflect.FullName("grpc.testing.TestService"))
+	fd, err := client.FileContainingSymbol("grpc.testing.TestService")
+	require.NoError(t, err)
+	require.Equal(t, "grpc/test.proto", fd.Path())
+	require.Equal(t, int32(2), queries.Load())
+
+	// dependency was included in the response, so no more queries
+	_, err = client.FileByFilename("google/protobuf/empty.proto")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), queries.Load())
+
+	_, err = client.FileByFilename("does/not/exist.proto")
+	require.True(t, IsElementNotFoundError(err))
+	// unimplemented by the source
+	_, err = client.AllExtensionNumbersForType("grpc.testing.SimpleRequest")
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestDescriptorSources_Fallback(t *testing.T) {
+	svr := grpc.NewServer()
+	testprotosgrpc.RegisterDummyServiceServer(svr, testService{})
+	reflection.Register(svr)
+	cconn := startTestServer(t, svr)
+
+	// a file that the server does not know about
+	extraProto := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("extra.proto"),
+		Package:     proto.String("extra"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Msg")}},
+	}
+	var files protoresolve.Registry
+	_, err := files.RegisterFileProtos([]*descriptorpb.FileDescriptorProto{extraProto})
+	require.NoError(t, err)
+	var queries atomic.Int32
+	unknown := DescriptorSourceFunc(func(_ context.Context, _ *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error) {
+		queries.Add(1)
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	client := NewClientV1(context.Background(), refv1.NewServerReflectionClient(cconn),
+		WithDescriptorSources(unknown, registrySource(&files, &queries)))
+	defer client.Reset()
+
+	// served by the reflection service, no queries to sources
+	fd, err := client.FileContainingSymbol("testprotos.DummyService")
+	require.NoError(t, err)
+	require.Equal(t, "grpc/dummy.proto", fd.Path())
+	require.Equal(t, int32(0), queries.Load())
+
+	// falls back through both sources
+	md, err := client.AsResolver().FindMessageByName("extra.Msg")
+	require.NoError(t, err)
+	require.Equal(t, "extra.proto", md.ParentFile().Path())
+	require.Equal(t, int32(2), queries.Load())
+}
+
+func registerFileAndDeps(files *protoresolve.Registry, fd protoreflect.FileDescriptor) error {
+	if _, err := files.FindFileByPath(fd.Path()); err == nil {
+		return nil
+	}
+	imports := fd.Imports()
+	for i, length := 0, imports.Len(); i < length; i++ {
+		if err := registerFileAndDeps(files, imports.Get(i).FileDescriptor); err != nil {
+			return err
+		}
+	}
+	return files.RegisterFile(fd)
+}
+
+// registrySource returns a DescriptorSource that answers requests for files
+// and services using the given registry. It increments the given counter for
+// every query.
+func registrySource(files *protoresolve.Registry, queries *atomic.Int32) DescriptorSource {
+	fileResponse := func(fd protoreflect.FileDescriptor) (*refv1.ServerReflectionResponse, error) {
+		var results [][]byte
+		var addFile func(protoreflect.FileDescriptor) error
+		addFile = func(fd protoreflect.FileDescriptor) error {
+			data, err := proto.Marshal(protodesc.ToFileDescriptorProto(fd))
+			if err != nil {
+				return err
+			}
+			results = append(results, data)
+			imports := fd.Imports()
+			for i, length := 0, imports.Len(); i < length; i++ {
+				if err := addFile(imports.Get(i).FileDescriptor); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := addFile(fd); err != nil {
+			return nil, err
+		}
+		return &refv1.ServerReflectionResponse{
+			MessageResponse: &refv1.ServerReflectionResponse_FileDescriptorResponse{
+				FileDescriptorResponse: &refv1.FileDescriptorResponse{FileDescriptorProto: results},
+			},
+		}, nil
+	}
+	return DescriptorSourceFunc(func(_ context.Context, req *refv1.ServerReflectionRequest) (*refv1.ServerReflectionResponse, error) {
+		queries.Add(1)
+		switch req := req.MessageRequest.(type) {
+		case *refv1.ServerReflectionRequest_ListServices:
+			var services []*refv1.ServiceResponse
+			files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+				svcs := fd.Services()
+				for i, length := 0, svcs.Len(); i < length; i++ {
+					services = append(services, &refv1.ServiceResponse{Name: string(svcs.Get(i).FullName())})
+				}
+				return true
+			})
+			return &refv1.ServerReflectionResponse{
+				MessageResponse: &refv1.ServerReflectionResponse_ListServicesResponse{
+					ListServicesResponse: &refv1.ListServiceResponse{Service: services},
+				},
+			}, nil
+		case *refv1.ServerReflectionRequest_FileByFilename:
+			fd, err := files.FindFileByPath(req.FileByFilename)
+			if err != nil {
+				return nil, status.Error(codes.NotFound, err.Error())
+			}
+			return fileResponse(fd)
+		case *refv1.ServerReflectionRequest_FileContainingSymbol:
+			d, err := files.FindDescriptorByName(protoreflect.FullName(req.FileContainingSymbol))
+			if err != nil {
+				return nil, status.Error(codes.NotFound, err.Error())
+			}
+			return fileResponse(d.ParentFile())
+		default:
+			return &refv1.ServerReflectionResponse{
+				MessageResponse: &refv1.ServerReflectionResponse_ErrorResponse{
+					ErrorResponse: &refv1.ErrorResponse{
+						ErrorCode:    int32(codes.Unimplemented),
+						ErrorMessage: "not supported",
+					},
+				},
+			}, nil
+		}
+	})
+}
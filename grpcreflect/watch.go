@@ -0,0 +1,254 @@
+package grpcreflect
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ServiceChanges describes how the set of services exposed by a server has
+// changed. Values are delivered by Client.WatchServices.
+type ServiceChanges struct {
+	// Services that were not present before.
+	Added []protoreflect.FullName
+	// Services that are no longer present.
+	Removed []protoreflect.FullName
+	// Services that are still present but whose definitions have changed.
+	// A service is considered changed if the file that declares it, or any
+	// of that file's transitive dependencies, has changed.
+	Changed []protoreflect.FullName
+	// The files that are new or whose contents have changed, as returned by
+	// the server, sorted by name. Files that have not changed are omitted,
+	// so building descriptors for the services in Added and Changed may
+	// require files from earlier values.
+	Files []*descriptorpb.FileDescriptorProto
+	// If non-nil, the server could not be queried and all other fields are
+	// empty. Watching continues, and the next successful poll is compared
+	// to the last successful one.
+	Err error
+}
+
+// WatchServices polls the server, every interval, for the services it
+// exposes and for the files that define them. The interval must be positive.
+// The returned channel receives a value every time something changes. The
+// first value describes the initial state, with all services in
+// ServiceChanges.Added. Polling stops and the channel is closed when the
+// given context is done. If the channel's receiver is slow, polling is paused
+// until the pending value is received.
+//
+// Since the server is polled, changes are not observed immediately. Also, a
+// change that is reverted before the next poll will not be observed.
+//
+// The files downloaded while watching are not added to the client's cache.
+// Since the client caches descriptors for its lifetime, it can return stale
+// descriptors after a change. So, to resolve elements in changed services,
+// build new descriptors from ServiceChanges.Files or create a new client.
+func (cr *Client) WatchServices(ctx context.Context, interval time.Duration) <-chan ServiceChanges {
+	ch := make(chan ServiceChanges)
+	go func() {
+		defer close(ch)
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		var prev *serviceSnapshot
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			var changes ServiceChanges
+			cur, err := cr.fetchServiceSnapshot()
+			if err != nil {
+				changes.Err = err
+			} else {
+				changes = cur.diff(prev)
+			}
+			if err != nil || prev == nil || len(changes.Added)+len(changes.Removed)+len(changes.Changed) > 0 {
+				select {
+				case ch <- changes:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err == nil {
+				prev = cur
+			}
+			timer.Reset(interval)
+		}
+	}()
+	return ch
+}
+
+// serviceSnapshot is the state of a server's services at a point in time.
+type serviceSnapshot struct {
+	// service name -> path of the file that declares it
+	services map[protoreflect.FullName]string
+	files    map[string]*descriptorpb.FileDescriptorProto
+	raw      map[string][]byte
+}
+
+func (cr *Client) fetchServiceSnapshot() (*serviceSnapshot, error) {
+	serviceNames, err := cr.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	snap := &serviceSnapshot{
+		services: make(map[protoreflect.FullName]string, len(serviceNames)),
+		files:    map[string]*descriptorpb.FileDescriptorProto{},
+		raw:      map[string][]byte{},
+	}
+	var queue []string
+	for _, serviceName := range serviceNames {
+		req := &refv1.ServerReflectionRequest{
+			MessageRequest: &refv1.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: string(serviceName),
+			},
+		}
+		names, err := snap.fetchFiles(cr, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download file for service %q: %w", serviceName, err)
+		}
+		for _, name := range names {
+			if declaresService(snap.files[name], serviceName) {
+				snap.services[serviceName] = name
+				break
+			}
+		}
+		if _, ok := snap.services[serviceName]; !ok {
+			return nil, fmt.Errorf("failed to download file for service %q: response does not include expected file", serviceName)
+		}
+		queue = append(queue, names...)
+	}
+	// The server may omit dependencies that it has already sent on the same
+	// stream. So we must explicitly ask for any that are missing, to make sure
+	// we have the latest version of every file.
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, dep := range snap.files[name].GetDependency() {
+			if _, ok := snap.files[dep]; ok {
+				continue
+			}
+			req := &refv1.ServerReflectionRequest{
+				MessageRequest: &refv1.ServerReflectionRequest_FileByFilename{
+					FileByFilename: dep,
+				},
+			}
+			names, err := snap.fetchFiles(cr, req)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download file %q: %w", dep, err)
+			}
+			if _, ok := snap.files[dep]; !ok {
+				return nil, fmt.Errorf("failed to download file %q: response does not include expected file", dep)
+			}
+			queue = append(queue, names...)
+		}
+	}
+	return snap, nil
+}
+
+// fetchFiles sends the given request and adds the files in the response to
+// the snapshot. It returns the names of the files in the response.
+func (s *serviceSnapshot) fetchFiles(cr *Client, req *refv1.ServerReflectionRequest) ([]string, error) {
+	resp, err := cr.send(req)
+	if err != nil {
+		return nil, err
+	}
+	fdResp := resp.GetFileDescriptorResponse()
+	if fdResp == nil {
+		return nil, &ProtocolError{reflect.TypeOf(fdResp).Elem()}
+	}
+	names := make([]string, 0, len(fdResp.FileDescriptorProto))
+	for _, fdBytes := range fdResp.FileDescriptorProto {
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(fdBytes, fd); err != nil {
+			return nil, err
+		}
+		s.files[fd.GetName()] = fd
+		s.raw[fd.GetName()] = fdBytes
+		names = append(names, fd.GetName())
+	}
+	return names, nil
+}
+
+func declaresService(fd *descriptorpb.FileDescriptorProto, serviceName protoreflect.FullName) bool {
+	if protoreflect.FullName(fd.GetPackage()) != serviceName.Parent() {
+		return false
+	}
+	for _, sd := range fd.GetService() {
+		if protoreflect.Name(sd.GetName()) == serviceName.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// diff computes the changes from prev, which may be nil, to s.
+func (s *serviceSnapshot) diff(prev *serviceSnapshot) ServiceChanges {
+	var changes ServiceChanges
+	changedFiles := map[string]struct{}{}
+	for name, data := range s.raw {
+		if prev == nil || !bytes.Equal(prev.raw[name], data) {
+			changedFiles[name] = struct{}{}
+			changes.Files = append(changes.Files, s.files[name])
+		}
+	}
+	for serviceName, file := range s.services {
+		var prevFile string
+		if prev != nil {
+			prevFile = prev.services[serviceName]
+		}
+		switch {
+		case prevFile == "":
+			changes.Added = append(changes.Added, serviceName)
+		case prevFile != file || s.anyChanged(file, changedFiles, map[string]struct{}{}):
+			changes.Changed = append(changes.Changed, serviceName)
+		}
+	}
+	if prev != nil {
+		for serviceName := range prev.services {
+			if _, ok := s.services[serviceName]; !ok {
+				changes.Removed = append(changes.Removed, serviceName)
+			}
+		}
+	}
+	sortNames(changes.Added)
+	sortNames(changes.Removed)
+	sortNames(changes.Changed)
+	sort.Slice(changes.Files, func(i, j int) bool {
+		return changes.Files[i].GetName() < changes.Files[j].GetName()
+	})
+	return changes
+}
+
+// anyChanged returns true if the given file or any of its transitive
+// dependencies is in changedFiles.
+func (s *serviceSnapshot) anyChanged(file string, changedFiles, seen map[string]struct{}) bool {
+	if _, ok := seen[file]; ok {
+		return false
+	}
+	seen[file] = struct{}{}
+	if _, ok := changedFiles[file]; ok {
+		return true
+	}
+	for _, dep := range s.files[file].GetDependency() {
+		if s.anyChanged(dep, changedFiles, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortNames(names []protoreflect.FullName) {
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+}
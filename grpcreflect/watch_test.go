@@ -0,0 +1,179 @@
+package grpcreflect
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	refv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+func TestWatchServices(t *testing.T) {
+	depProto := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("dep.proto"),
+		Package:     proto.String("watch"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Msg")}},
+	}
+	fooProto := watchTestServiceFile("foo.proto", "Foo")
+	barProto := watchTestServiceFile("bar.proto", "Bar")
+
+	var state watchTestServer
+	state.update(t, []string{"watch.Foo"}, depProto, fooProto)
+	client := state.newClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := client.WatchServices(ctx, 10*time.Millisecond)
+	next := func() ServiceChanges {
+		select {
+		case c := <-changes:
+			require.NoError(t, c.Err)
+			return c
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for changes")
+			return ServiceChanges{}
+		}
+	}
+	fileNames := func(files []*descriptorpb.FileDescriptorProto) []string {
+		names := make([]string, len(files))
+		for i, fd := range files {
+			names[i] = fd.GetName()
+		}
+		return names
+	}
+
+	c := next()
+	require.Equal(t, []protoreflect.FullName{"watch.Foo"}, c.Added)
+	require.Empty(t, c.Removed)
+	require.Empty(t, c.Changed)
+	require.Equal(t, []string{"dep.proto", "foo.proto"}, fileNames(c.Files))
+
+	state.update(t, []string{"watch.Bar", "watch.Foo"}, depProto, fooProto, barProto)
+	c = next()
+	require.Equal(t, []protoreflect.FullName{"watch.Bar"}, c.Added)
+	require.Empty(t, c.Removed)
+	require.Empty(t, c.Changed)
+	require.Equal(t, []string{"bar.proto"}, fileNames(c.Files))
+
+	// changing a dependency changes both services, even though the server
+	// does not re-send dependencies on the same stream
+	depProto = proto.Clone(depProto).(*descriptorpb.FileDescriptorProto)
+	depProto.MessageType = append(depProto.MessageType, &descriptorpb.DescriptorProto{Name: proto.String("Other")})
+	state.update(t, []string{"watch.Bar", "watch.Foo"}, depProto, fooProto, barProto)
+	c = next()
+	require.Empty(t, c.Added)
+	require.Empty(t, c.Removed)
+	require.Equal(t, []protoreflect.FullName{"watch.Bar", "watch.Foo"}, c.Changed)
+	require.Equal(t, []string{"dep.proto"}, fileNames(c.Files))
+	require.Len(t, c.Files[0].MessageType, 2)
+
+	state.update(t, []string{"watch.Foo"}, depProto, fooProto)
+	c = next()
+	require.Empty(t, c.Added)
+	require.Equal(t, []protoreflect.FullName{"watch.Bar"}, c.Removed)
+	require.Empty(t, c.Changed)
+	require.Empty(t, c.Files)
+
+	cancel()
+	for range changes {
+		// drain until closed
+	}
+}
+
+func watchTestServiceFile(name, service string) *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(name),
+		Package:    proto.String("watch"),
+		Dependency: []string{"dep.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String(service),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("Do"),
+						InputType:  proto.String(".watch.Msg"),
+						OutputType: proto.String(".watch.Msg"),
+					},
+				},
+			},
+		},
+	}
+}
+
+// watchTestServer provides the services and files that are exposed by the
+// reflection server in TestWatchServices, which can be changed during the test.
+type watchTestServer struct {
+	mu       sync.Mutex
+	services []string
+	files    *protoresolve.Registry
+}
+
+func (s *watchTestServer) update(t *testing.T, services []string, files ...*descriptorpb.FileDescriptorProto) {
+	var reg protoresolve.Registry
+	_, err := reg.RegisterFileProtos(files)
+	require.NoError(t, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services = services
+	s.files = &reg
+}
+
+// newClient starts a reflection server that serves the state in s and returns
+// a client connected to it. The server and client are stopped when the test
+// finishes.
+func (s *watchTestServer) newClient(t *testing.T) *Client {
+	svr := grpc.NewServer()
+	refv1.RegisterServerReflectionServer(svr, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           s,
+		DescriptorResolver: s,
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	t.Cleanup(svr.Stop)
+	cconn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = cconn.Close()
+	})
+	client := NewClientV1(context.Background(), refv1.NewServerReflectionClient(cconn))
+	t.Cleanup(client.Reset)
+	return client
+}
+
+func (s *watchTestServer) GetServiceInfo() map[string]grpc.ServiceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := make(map[string]grpc.ServiceInfo, len(s.services))
+	for _, svc := range s.services {
+		info[svc] = grpc.ServiceInfo{}
+	}
+	return info
+}
+
+func (s *watchTestServer) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	s.mu.Lock()
+	files := s.files
+	s.mu.Unlock()
+	return files.FindFileByPath(path)
+}
+
+func (s *watchTestServer) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	s.mu.Lock()
+	files := s.files
+	s.mu.Unlock()
+	return files.FindDescriptorByName(name)
+}
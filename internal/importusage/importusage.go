@@ -0,0 +1,181 @@
+// Package importusage computes which imports of a file are used by the
+// elements defined in that file.
+package importusage
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/protomessage"
+)
+
+// Compute returns, for each import of the file that contains the
+// given descriptor, the sorted names of the elements defined in that import
+// (or in a file that it publicly imports) that are referenced by the given
+// descriptor. The descriptor must be a file, message, enum, or service.
+// Imports that are not used will have no entry in the returned map.
+func Compute(dsc protoreflect.Descriptor, reg *protoregistry.Types) map[string][]protoreflect.FullName {
+	fd := dsc.ParentFile()
+	// Map each file that is visible via imports to the import that provides it.
+	// Direct imports take precedence, so we add them all before any files that
+	// are only transitively visible via public imports.
+	providers := map[string]string{}
+	imps := fd.Imports()
+	for i, length := 0, imps.Len(); i < length; i++ {
+		providers[imps.Get(i).Path()] = imps.Get(i).Path()
+	}
+	for i, length := 0, imps.Len(); i < length; i++ {
+		addPublicImportProviders(imps.Get(i).FileDescriptor, imps.Get(i).Path(), providers)
+	}
+
+	usages := map[string]map[protoreflect.FullName]struct{}{}
+	use := func(d protoreflect.Descriptor) {
+		if d == nil {
+			return
+		}
+		provider, ok := providers[d.ParentFile().Path()]
+		if !ok {
+			// defined in this file
+			return
+		}
+		names := usages[provider]
+		if names == nil {
+			names = map[protoreflect.FullName]struct{}{}
+			usages[provider] = names
+		}
+		names[d.FullName()] = struct{}{}
+	}
+	useOptions := func(opts proto.Message) {
+		if opts == nil || !opts.ProtoReflect().IsValid() {
+			return
+		}
+		// clone so that re-parsing unrecognized options has no side effects
+		opts = proto.Clone(opts)
+		protomessage.ReparseUnrecognized(opts, reg)
+		protomessage.Walk(opts.ProtoReflect(), func(_ []any, msg protoreflect.Message) bool {
+			msg.Range(func(fld protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+				if fld.IsExtension() {
+					use(fld)
+				}
+				return true
+			})
+			return true
+		})
+	}
+	useField := func(fld protoreflect.FieldDescriptor) {
+		useOptions(fld.Options())
+		if fld.IsExtension() {
+			use(fld.ContainingMessage())
+		}
+		if fld.IsMap() {
+			// the map entry is defined in this file; its value
+			// field is handled with the entry's other fields
+			return
+		}
+		switch fld.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			use(fld.Message())
+		case protoreflect.EnumKind:
+			use(fld.Enum())
+		}
+	}
+	useExtensions := func(exts protoreflect.ExtensionDescriptors) {
+		for i, length := 0, exts.Len(); i < length; i++ {
+			useField(exts.Get(i))
+		}
+	}
+	useEnum := func(ed protoreflect.EnumDescriptor) {
+		useOptions(ed.Options())
+		vals := ed.Values()
+		for i, length := 0, vals.Len(); i < length; i++ {
+			useOptions(vals.Get(i).Options())
+		}
+	}
+	useEnums := func(enums protoreflect.EnumDescriptors) {
+		for i, length := 0, enums.Len(); i < length; i++ {
+			useEnum(enums.Get(i))
+		}
+	}
+	var useMessage func(md protoreflect.MessageDescriptor)
+	useMessages := func(msgs protoreflect.MessageDescriptors) {
+		for i, length := 0, msgs.Len(); i < length; i++ {
+			useMessage(msgs.Get(i))
+		}
+	}
+	useMessage = func(md protoreflect.MessageDescriptor) {
+		useOptions(md.Options())
+		fields := md.Fields()
+		for i, length := 0, fields.Len(); i < length; i++ {
+			useField(fields.Get(i))
+		}
+		oneofs := md.Oneofs()
+		for i, length := 0, oneofs.Len(); i < length; i++ {
+			useOptions(oneofs.Get(i).Options())
+		}
+		for i, length := 0, md.ExtensionRanges().Len(); i < length; i++ {
+			useOptions(md.ExtensionRangeOptions(i))
+		}
+		useMessages(md.Messages())
+		useEnums(md.Enums())
+		useExtensions(md.Extensions())
+	}
+	useService := func(sd protoreflect.ServiceDescriptor) {
+		useOptions(sd.Options())
+		methods := sd.Methods()
+		for i, length := 0, methods.Len(); i < length; i++ {
+			mtd := methods.Get(i)
+			useOptions(mtd.Options())
+			use(mtd.Input())
+			use(mtd.Output())
+		}
+	}
+
+	switch d := dsc.(type) {
+	case protoreflect.FileDescriptor:
+		useOptions(d.Options())
+		useMessages(d.Messages())
+		useEnums(d.Enums())
+		useExtensions(d.Extensions())
+		svcs := d.Services()
+		for i, length := 0, svcs.Len(); i < length; i++ {
+			useService(svcs.Get(i))
+		}
+	case protoreflect.MessageDescriptor:
+		useMessage(d)
+	case protoreflect.EnumDescriptor:
+		useEnum(d)
+	case protoreflect.ServiceDescriptor:
+		useService(d)
+	}
+
+	results := make(map[string][]protoreflect.FullName, len(usages))
+	for imp, names := range usages {
+		sorted := make([]protoreflect.FullName, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		results[imp] = sorted
+	}
+	return results
+}
+
+func addPublicImportProviders(fd protoreflect.FileDescriptor, provider string, providers map[string]string) {
+	imps := fd.Imports()
+	for i, length := 0, imps.Len(); i < length; i++ {
+		imp := imps.Get(i)
+		if !imp.IsPublic {
+			continue
+		}
+		if _, ok := providers[imp.Path()]; ok {
+			continue
+		}
+		providers[imp.Path()] = provider
+		addPublicImportProviders(imp.FileDescriptor, provider, providers)
+	}
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// FindOption returns the value of the given extension in the given options
+// message. The returned bool is false if the extension is not present. The
+// extension must extend the options message.
+//
+// The options are round-tripped through the binary format so that the option
+// is recognized using exactly the given extension type. This handles the
+// option being unrecognized, such as when the options were built without the
+// extension being known, as well as it being recognized with a different type.
+func FindOption(opts proto.Message, xt protoreflect.ExtensionType) (protoreflect.Value, bool, error) {
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return protoreflect.Value{}, false, nil
+	}
+	data, err := proto.MarshalOptions{AllowPartial: true}.Marshal(opts)
+	if err != nil {
+		return protoreflect.Value{}, false, err
+	}
+	reparsed := opts.ProtoReflect().New()
+	err = proto.UnmarshalOptions{
+		AllowPartial: true,
+		Resolver:     singleExtensionResolver{xt},
+	}.Unmarshal(data, reparsed.Interface())
+	if err != nil {
+		return protoreflect.Value{}, false, err
+	}
+	field := xt.TypeDescriptor()
+	if !reparsed.Has(field) {
+		return protoreflect.Value{}, false, nil
+	}
+	return reparsed.Get(field), true, nil
+}
+
+// singleExtensionResolver is a resolver that recognizes only one extension.
+type singleExtensionResolver struct {
+	xt protoreflect.ExtensionType
+}
+
+func (r singleExtensionResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	if r.xt.TypeDescriptor().FullName() == field {
+		return r.xt, nil
+	}
+	return nil, protoregistry.NotFound
+}
+
+func (r singleExtensionResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	xd := r.xt.TypeDescriptor()
+	if xd.ContainingMessage().FullName() == message && xd.Number() == field {
+		return r.xt, nil
+	}
+	return nil, protoregistry.NotFound
+}
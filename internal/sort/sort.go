@@ -18,17 +18,17 @@ func SortFiles(files []*descriptorpb.FileDescriptorProto) error {
 		}
 		allFiles[file.GetName()] = fileState{file: file}
 	}
-	origLen := len(files)
-	files = files[:0]
+	sorted := make([]*descriptorpb.FileDescriptorProto, 0, len(files))
 	for _, file := range files {
-		if err := addFileSorted(file, allFiles, &files); err != nil {
+		if err := addFileSorted(file, allFiles, &sorted); err != nil {
 			return err
 		}
 	}
-	if origLen != len(files) {
+	if len(sorted) != len(files) {
 		// should not be possible since we've already removed duplicates...
-		return fmt.Errorf("internal: sorted files has length %d, but original had length %d", len(files), origLen)
+		return fmt.Errorf("internal: sorted files has length %d, but original had length %d", len(sorted), len(files))
 	}
+	copy(files, sorted)
 	return nil
 }
 
@@ -32,6 +32,10 @@ const (
 	// anywhere. The only places they appear in generated code are struct tags
 	// on fields of the generated descriptor protos.
 
+	// FileSetFilesTag is the tag number of the files element in a file
+	// descriptor set.
+	FileSetFilesTag = 1
+
 	// FilePackageTag is the tag number of the package element in a file
 	// descriptor proto.
 	FilePackageTag = 2
@@ -53,6 +57,15 @@ const (
 	// FileOptionsTag is the tag number of the options element in a file
 	// descriptor proto.
 	FileOptionsTag = 8
+	// FileSourceCodeInfoTag is the tag number of the source code info element
+	// in a file descriptor proto.
+	FileSourceCodeInfoTag = 9
+	// FilePublicDependencyTag is the tag number of the public dependencies
+	// element in a file descriptor proto.
+	FilePublicDependencyTag = 10
+	// FileWeakDependencyTag is the tag number of the weak dependencies element
+	// in a file descriptor proto.
+	FileWeakDependencyTag = 11
 	// FileSyntaxTag is the tag number of the syntax element in a file
 	// descriptor proto.
 	FileSyntaxTag = 12
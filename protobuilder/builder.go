@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
@@ -104,6 +108,9 @@ type BuilderOptions struct {
 	// be interpreted. That means that if an option is present that is neither
 	// known to the calling program nor recognized by Resolver, trying to build
 	// the descriptor will fail.
+	//
+	// This includes options in builders created from descriptors, such as via
+	// FromFile, whose values were preserved as unknown fields.
 	RequireInterpretedOptions bool
 }
 
@@ -114,6 +121,62 @@ func (opts BuilderOptions) Build(b Builder) (protoreflect.Descriptor, error) {
 	return doBuild(b, opts)
 }
 
+// BuildAll builds all the given file builders into descriptors using these
+// options. The returned descriptors are in the same order as the given
+// builders. Files are built concurrently, using up to GOMAXPROCS goroutines.
+//
+// Unlike building each file individually, dependencies that are shared by
+// the given files are only built once. So if two of the given files import
+// the same file builder, or both refer to elements in it, they will share
+// the same descriptor for that dependency. This also means that all of the
+// files, and all of their dependencies, must have distinct paths.
+//
+// The given builders, and any builders to which they refer, must not be
+// modified while they are being built. If any file cannot be built, an
+// error is returned for the first such file, in the order given.
+func (opts BuilderOptions) BuildAll(files []*FileBuilder) ([]protoreflect.FileDescriptor, error) {
+	detach := attachSyntheticFiles(files)
+	defer detach()
+
+	state := newResolverState(opts)
+	results := make([]protoreflect.FileDescriptor, len(files))
+	errs := make([]error, len(files))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(files) {
+		workers = len(files)
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			res := state.newResolver()
+			for {
+				j := int(next.Add(1) - 1)
+				if j >= len(files) {
+					return
+				}
+				results[j], errs[j] = res.resolveElement(files[j], nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to build file %q: %w", files[i].Path(), err)
+		}
+	}
+	return results, nil
+}
+
+// BuildAll builds all the given file builders into descriptors. This is the
+// same as calling BuildAll on a zero-value BuilderOptions.
+func BuildAll(files []*FileBuilder) ([]protoreflect.FileDescriptor, error) {
+	return BuilderOptions{}.BuildAll(files)
+}
+
 // Comments represents the various comments that might be associated with a
 // descriptor. These are equivalent to the various kinds of comments found in a
 // *dpb.SourceCodeInfo_Location struct that protoc associates with elements in
@@ -159,6 +222,59 @@ func addCommentsTo(sourceInfo *descriptorpb.SourceCodeInfo, path []int32, c *Com
 	})
 }
 
+// cloneOptions returns a copy of the given options message or, if it is nil,
+// a new empty message. Builders modify the returned copy instead of the
+// original, since the original may be shared with other builders or with
+// descriptors.
+func cloneOptions[T any, M interface {
+	*T
+	proto.Message
+}](opts M) M {
+	if opts == nil {
+		return new(T)
+	}
+	return proto.Clone(opts).(M)
+}
+
+// setOption sets the custom option defined by the given extension in *opts.
+// The options message is cloned first (or created if nil) using cloneOptions.
+func setOption[T any, M interface {
+	*T
+	proto.Message
+}](opts *M, ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	md := M(new(T)).ProtoReflect().Descriptor()
+	if ext.ContainingMessage().FullName() != md.FullName() {
+		return fmt.Errorf("extension %s extends %s, not %s", ext.FullName(), ext.ContainingMessage().FullName(), md.FullName())
+	}
+	xt := protoresolve.ExtensionType(ext)
+	if !val.IsValid() || !xt.IsValidValue(val) {
+		return fmt.Errorf("invalid value for extension %s", ext.FullName())
+	}
+	msg := cloneOptions(*opts)
+	ref := msg.ProtoReflect()
+	// The option may already be present as an unrecognized field. That must be
+	// removed so it doesn't conflict with (or even override) the new value.
+	if unk := ref.GetUnknown(); len(unk) > 0 {
+		var newUnk []byte
+		for len(unk) > 0 {
+			num, _, n := protowire.ConsumeField(unk)
+			if n < 0 {
+				// malformed; leave as is
+				newUnk = append(newUnk, unk...)
+				break
+			}
+			if num != ext.Number() {
+				newUnk = append(newUnk, unk[:n]...)
+			}
+			unk = unk[n:]
+		}
+		ref.SetUnknown(newUnk)
+	}
+	ref.Set(xt.TypeDescriptor(), val)
+	*opts = msg
+	return nil
+}
+
 /* NB: There are a few flows that need to maintain strong referential integrity
  * and perform symbol and/or number uniqueness checks. The way these flows are
  * implemented is described below. The actions generally involve two different
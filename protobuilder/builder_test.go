@@ -19,11 +19,12 @@ import (
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/gofeaturespb"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
-	_ "github.com/jhump/protoreflect/v2/internal/testprotos"
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
 	"github.com/jhump/protoreflect/v2/protoresolve"
 )
 
@@ -483,6 +484,182 @@ func TestBuildersFromDescriptors_PreserveComments(t *testing.T) {
 	require.Equal(t, count, descCount)
 }
 
+func TestBuildersFromDescriptors_PreserveCustomOptions(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				"options.proto": `
+					syntax = "proto3";
+					package opts;
+					import "google/protobuf/descriptor.proto";
+					extend google.protobuf.FileOptions { string file_opt = 5000; }
+					extend google.protobuf.ServiceOptions { Info svc_opt = 5000; }
+					extend google.protobuf.MethodOptions { repeated int32 method_opt = 5000; }
+					message Info { string name = 1; }
+				`,
+				"test.proto": `
+					syntax = "proto3";
+					package test;
+					import "options.proto";
+					option (opts.file_opt) = "abc";
+					message Msg {}
+					service Svc {
+						option (opts.svc_opt).name = "xyz";
+						rpc Do(Msg) returns (Msg) {
+							option (opts.method_opt) = 1;
+							option (opts.method_opt) = 2;
+						}
+					}
+				`,
+			}),
+		}),
+	}
+	compiled, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+
+	// Re-create the file from bytes without the custom options' definitions,
+	// as if they were not linked into the program, so they are all unknown
+	// fields. Also add an option that is not defined anywhere.
+	data, err := proto.Marshal(protodesc.ToFileDescriptorProto(compiled[0]))
+	require.NoError(t, err)
+	var fdProto descriptorpb.FileDescriptorProto
+	require.NoError(t, proto.UnmarshalOptions{Resolver: (*protoregistry.Types)(nil)}.Unmarshal(data, &fdProto))
+	require.NotEmpty(t, fdProto.Options.ProtoReflect().GetUnknown())
+	var deps protoregistry.Files
+	require.NoError(t, deps.RegisterFile(descriptorpb.File_google_protobuf_descriptor_proto))
+	require.NoError(t, deps.RegisterFile(compiled[0].Imports().Get(0).FileDescriptor))
+	fd, err := protodesc.NewFile(&fdProto, &deps)
+	require.NoError(t, err)
+
+	var undefined []byte
+	undefined = protowire.AppendTag(undefined, 6000, protowire.BytesType)
+	undefined = protowire.AppendString(undefined, "foo")
+	withUndefined := proto.Clone(&fdProto).(*descriptorpb.FileDescriptorProto)
+	svcOpts := withUndefined.Service[0].Options.ProtoReflect()
+	svcOpts.SetUnknown(append(svcOpts.GetUnknown(), undefined...))
+	fdWithUndefined, err := protodesc.NewFile(withUndefined, &deps)
+	require.NoError(t, err)
+
+	for _, file := range []protoreflect.FileDescriptor{compiled[0], fd, fdWithUndefined} {
+		sb, err := FromService(file.Services().Get(0))
+		require.NoError(t, err)
+		built, err := sb.Build()
+		require.NoError(t, err)
+		checkOptionsEqual(t, file, built.ParentFile())
+	}
+
+	// options that can't be interpreted can instead be reported as errors
+	opts := BuilderOptions{RequireInterpretedOptions: true}
+	fb, err := FromFile(fd)
+	require.NoError(t, err)
+	_, err = opts.Build(fb)
+	require.NoError(t, err)
+	fb, err = FromFile(fdWithUndefined)
+	require.NoError(t, err)
+	_, err = opts.Build(fb)
+	require.ErrorContains(t, err, "could not interpret custom option for google.protobuf.ServiceOptions, tag 6000")
+}
+
+func checkOptionsEqual(t *testing.T, expected, actual protoreflect.FileDescriptor) {
+	t.Helper()
+	marshal := func(m proto.Message) []byte {
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		require.NoError(t, err)
+		return data
+	}
+	require.Equal(t, marshal(expected.Options()), marshal(actual.Options()))
+	expSvc, actSvc := expected.Services().Get(0), actual.Services().Get(0)
+	require.Equal(t, marshal(expSvc.Options()), marshal(actSvc.Options()))
+	require.Equal(t, marshal(expSvc.Methods().Get(0).Options()), marshal(actSvc.Methods().Get(0).Options()))
+}
+
+func TestSetOption(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				"options.proto": `
+					syntax = "proto3";
+					package opts;
+					import "google/protobuf/descriptor.proto";
+					extend google.protobuf.FileOptions { string file_opt = 5000; }
+				`,
+			}),
+		}),
+	}
+	compiled, err := compiler.Compile(context.Background(), "options.proto")
+	require.NoError(t, err)
+	// not linked into the program, so uses a dynamic extension type
+	fileOpt := compiled[0].Extensions().ByName("file_opt")
+
+	// existing options are not mutated, and an unrecognized value for the
+	// option is replaced
+	var unk []byte
+	unk = protowire.AppendTag(unk, 5000, protowire.BytesType)
+	unk = protowire.AppendString(unk, "old")
+	fileOpts := &descriptorpb.FileOptions{GoPackage: proto.String("foo/bar")}
+	fileOpts.ProtoReflect().SetUnknown(unk)
+
+	simpleMsg := &testprotos.ReallySimpleMessage{Id: proto.Uint64(123), Name: proto.String("abc")}
+	extRange := ExtensionRange{FieldRange: FieldRange{100, 200}}
+	extRange.SetOption(testprotos.E_Exfubarb.TypeDescriptor(), protoreflect.ValueOfBytes([]byte("range")))
+	mb := NewMessage("Foo").
+		SetOption(testprotos.E_Mfubar.TypeDescriptor(), protoreflect.ValueOfBool(true)).
+		AddField(NewField("a", FieldTypeString()).
+			SetOption(testprotos.E_Ffubarb.TypeDescriptor(), protoreflect.ValueOfBytes([]byte("field")))).
+		AddOneOf(NewOneof("b").
+			AddChoice(NewField("c", FieldTypeInt32())).
+			SetOption(testprotos.E_Oofubarb.TypeDescriptor(), protoreflect.ValueOfBytes([]byte("oneof")))).
+		SetExtensionRanges([]ExtensionRange{extRange})
+	fb := NewFile("test.proto").
+		SetOptions(fileOpts).
+		SetOption(fileOpt, protoreflect.ValueOfString("new")).
+		AddMessage(mb).
+		AddEnum(NewEnum("Bar").
+			SetOption(testprotos.E_Efubar.TypeDescriptor(), protoreflect.ValueOfInt32(-1)).
+			AddValue(NewEnumValue("ZERO").
+				SetOption(testprotos.E_Evfubar.TypeDescriptor(), protoreflect.ValueOfInt64(-2)))).
+		AddService(NewService("Svc").
+			SetOption(testprotos.E_Sfubar.TypeDescriptor(), protoreflect.ValueOfMessage(simpleMsg.ProtoReflect())).
+			AddMethod(NewMethod("Do", RpcTypeMessage(mb, false), RpcTypeMessage(mb, false)).
+				SetOption(testprotos.E_Mtfubard.TypeDescriptor(), protoreflect.ValueOfFloat64(1.5))))
+	require.NotSame(t, fileOpts, fb.Options)
+	require.Equal(t, unk, []byte(fileOpts.ProtoReflect().GetUnknown()))
+	require.Empty(t, fb.Options.ProtoReflect().GetUnknown())
+
+	fd, err := fb.Build()
+	require.NoError(t, err)
+	// built file depends on the files that define the options
+	imports := make([]string, fd.Imports().Len())
+	for i := range imports {
+		imports[i] = fd.Imports().Get(i).Path()
+	}
+	require.Equal(t, []string{"desc_test_options.proto", "options.proto"}, imports)
+
+	fdOpts := fd.Options()
+	require.Equal(t, "foo/bar", fdOpts.(*descriptorpb.FileOptions).GetGoPackage())
+	require.Equal(t, "new", fdOpts.ProtoReflect().Get(fileOpt).String())
+	md := fd.Messages().Get(0)
+	require.True(t, proto.GetExtension(md.Options(), testprotos.E_Mfubar).(bool))
+	require.Equal(t, []byte("field"), proto.GetExtension(md.Fields().ByName("a").Options(), testprotos.E_Ffubarb))
+	require.Equal(t, []byte("oneof"), proto.GetExtension(md.Oneofs().ByName("b").Options(), testprotos.E_Oofubarb))
+	require.Equal(t, []byte("range"), proto.GetExtension(md.ExtensionRangeOptions(0), testprotos.E_Exfubarb))
+	ed := fd.Enums().Get(0)
+	require.Equal(t, int32(-1), proto.GetExtension(ed.Options(), testprotos.E_Efubar))
+	require.Equal(t, int64(-2), proto.GetExtension(ed.Values().Get(0).Options(), testprotos.E_Evfubar))
+	sd := fd.Services().Get(0)
+	require.True(t, proto.Equal(simpleMsg, proto.GetExtension(sd.Options(), testprotos.E_Sfubar).(proto.Message)))
+	require.Equal(t, 1.5, proto.GetExtension(sd.Methods().Get(0).Options(), testprotos.E_Mtfubard))
+
+	// errors
+	err = NewMessage("Foo").TrySetOption(testprotos.E_Ffubarb.TypeDescriptor(), protoreflect.ValueOfBytes(nil))
+	require.EqualError(t, err, "extension testprotos.ffubarb extends google.protobuf.FieldOptions, not google.protobuf.MessageOptions")
+	err = NewMessage("Foo").TrySetOption(testprotos.E_Mfubar.TypeDescriptor(), protoreflect.ValueOfString("abc"))
+	require.EqualError(t, err, "invalid value for extension testprotos.mfubar")
+	require.Panics(t, func() {
+		NewService("Svc").SetOption(testprotos.E_Sfubar.TypeDescriptor(), protoreflect.ValueOfMessage(md.Options().ProtoReflect()))
+	})
+}
+
 func TestBuilder_PreserveAllCommentsAfterBuild(t *testing.T) {
 	files := map[string]string{"test.proto": `
 syntax = "proto3";
@@ -607,19 +784,19 @@ func roundTripFile(t *testing.T, fd protoreflect.FileDescriptor) {
 	// Builder and back without loss of fidelity.
 	msgs := fd.Messages()
 	for i, length := 0, msgs.Len(); i < length; i++ {
-		roundTripMessage(t, msgs.Get(0))
+		roundTripMessage(t, msgs.Get(i))
 	}
 	enums := fd.Enums()
 	for i, length := 0, enums.Len(); i < length; i++ {
-		roundTripEnum(t, enums.Get(0))
+		roundTripEnum(t, enums.Get(i))
 	}
 	exts := fd.Extensions()
 	for i, length := 0, exts.Len(); i < length; i++ {
-		roundTripField(t, exts.Get(0))
+		roundTripField(t, exts.Get(i))
 	}
 	svcs := fd.Services()
 	for i, length := 0, svcs.Len(); i < length; i++ {
-		roundTripService(t, svcs.Get(0))
+		roundTripService(t, svcs.Get(i))
 	}
 
 	// Finally, we check the whole file itself.
@@ -635,9 +812,11 @@ func roundTripFile(t *testing.T, fd protoreflect.FileDescriptor) {
 	//  1. The builder sorts dependencies. However the original file
 	//     descriptor has dependencies in the order they appear in import
 	//     statements in the source file.
-	//  2. The builder imports the actual source of all elements and never
-	//     uses public imports. The original file, on the other hand, could
-	//     use public imports and "indirectly" import other files that way.
+	//  2. The builder imports the actual source of all elements. The original
+	//     file, on the other hand, could use public imports and "indirectly"
+	//     import other files that way. (Public imports in the original file
+	//     are preserved, but their indexes change since dependencies are
+	//     sorted.)
 	//  3. The builder never emits weak imports.
 	//  4. The builder behaves like protoc in that it emits nil as the file
 	//     package if none is set. However the new protobuf runtime, when
@@ -673,8 +852,12 @@ func roundTripFile(t *testing.T, fd protoreflect.FileDescriptor) {
 		fdp.Dependency = append(fdp.Dependency, "nopkg/desc_test_nopkg_new.proto")
 	}
 
-	// Strip any public and weak imports. (The step above should have "fixed"
-	// files to handle any actual public import encountered.)
+	// Strip any weak imports and remember public ones, so their indexes can
+	// be fixed up after sorting.
+	publicDeps := map[string]struct{}{}
+	for _, idx := range fdp.PublicDependency {
+		publicDeps[fdp.Dependency[idx]] = struct{}{}
+	}
 	fdp.PublicDependency = nil
 	fdp.WeakDependency = nil
 
@@ -693,6 +876,11 @@ func roundTripFile(t *testing.T, fd protoreflect.FileDescriptor) {
 	// Finally, sort the imports. That way they match the built result (which
 	// is always sorted).
 	sort.Strings(fdp.Dependency)
+	for i, dep := range fdp.Dependency {
+		if _, ok := publicDeps[dep]; ok {
+			fdp.PublicDependency = append(fdp.PublicDependency, int32(i))
+		}
+	}
 
 	// Now (after tweaking) the original should match the round-tripped descriptor:
 	diff := cmp.Diff(fdp, roundTrippedProto, protocmp.Transform())
@@ -1603,6 +1791,233 @@ func TestInterleavedEnumNumbers(t *testing.T) {
 	require.Equal(t, protoreflect.EnumNumber(100), evd.Number())
 }
 
+func TestMessageSetWireFormat(t *testing.T) {
+	opts := &descriptorpb.MessageOptions{Deprecated: proto.Bool(true)}
+	msg := NewMessage("Foo").SetOptions(opts)
+	require.False(t, msg.IsMessageSetWireFormat())
+
+	msg.SetMessageSetWireFormat(true)
+	require.True(t, msg.IsMessageSetWireFormat())
+	require.True(t, msg.Options.GetDeprecated())
+	// original options are not mutated
+	require.False(t, opts.GetMessageSetWireFormat())
+
+	msg.SetMessageSetWireFormat(false)
+	require.False(t, msg.IsMessageSetWireFormat())
+	require.Nil(t, msg.Options.MessageSetWireFormat)
+}
+
+func TestMessageSetWireFormat_Build(t *testing.T) {
+	msg := NewMessage("Foo").
+		SetMessageSetWireFormat(true).
+		AddExtensionRange(100, 1000)
+	payload := NewMessage("Payload").
+		AddField(NewField("id", FieldTypeInt64()))
+	file := NewFile("foo.proto").
+		SetPackageName("foo.bar").
+		AddMessage(msg).
+		AddMessage(payload).
+		AddExtension(NewExtension("payload", 100, FieldTypeMessage(payload), msg))
+
+	fdProto, err := file.buildProto(nil, nil)
+	require.NoError(t, err)
+	require.True(t, fdProto.MessageType[0].GetOptions().GetMessageSetWireFormat())
+	require.Equal(t, ".foo.bar.Foo", fdProto.Extension[0].GetExtendee())
+
+	fd, err := file.Build()
+	if !messageSetsSupported() {
+		// the protobuf runtime only supports message sets when built
+		// with the "protolegacy" build tag
+		require.ErrorContains(t, err, "MessageSet")
+		return
+	}
+	require.NoError(t, err)
+	md := fd.Messages().ByName("Foo")
+	require.NotNil(t, md)
+	require.True(t, md.Options().(*descriptorpb.MessageOptions).GetMessageSetWireFormat())
+	require.Equal(t, 1, md.ExtensionRanges().Len())
+	require.Zero(t, md.Fields().Len())
+	xd := fd.Extensions().ByName("payload")
+	require.NotNil(t, xd)
+	require.Equal(t, md, xd.ContainingMessage())
+	require.Equal(t, fd.Messages().ByName("Payload"), xd.Message())
+}
+
+func messageSetsSupported() bool {
+	_, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name: proto.String("message_set.proto"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:           proto.String("MessageSet"),
+			Options:        &descriptorpb.MessageOptions{MessageSetWireFormat: proto.Bool(true)},
+			ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{{Start: proto.Int32(1), End: proto.Int32(100)}},
+		}},
+	}, nil)
+	return err == nil
+}
+
+func TestOptionRetentionAndTargets(t *testing.T) {
+	opts := &descriptorpb.FieldOptions{Deprecated: proto.Bool(true)}
+	ext := NewExtensionImported("foo", 54321, FieldTypeString(), fieldOptionsDesc).
+		SetOptions(opts).
+		SetRetention(descriptorpb.FieldOptions_RETENTION_SOURCE).
+		SetTargets(descriptorpb.FieldOptions_TARGET_TYPE_FIELD)
+	require.Equal(t, descriptorpb.FieldOptions_RETENTION_SOURCE, ext.Retention())
+	require.Equal(t, []descriptorpb.FieldOptions_OptionTargetType{descriptorpb.FieldOptions_TARGET_TYPE_FIELD}, ext.Targets())
+	require.True(t, ext.Options.GetDeprecated())
+	// original options are not mutated
+	require.Nil(t, opts.Retention)
+	require.Nil(t, opts.Targets)
+
+	fld, err := ext.Build()
+	require.NoError(t, err)
+	fldOpts := fld.Options().(*descriptorpb.FieldOptions)
+	require.Equal(t, descriptorpb.FieldOptions_RETENTION_SOURCE, fldOpts.GetRetention())
+	require.Equal(t, []descriptorpb.FieldOptions_OptionTargetType{descriptorpb.FieldOptions_TARGET_TYPE_FIELD}, fldOpts.GetTargets())
+
+	// round-trip
+	fb, err := FromField(fld)
+	require.NoError(t, err)
+	require.Equal(t, descriptorpb.FieldOptions_RETENTION_SOURCE, fb.Retention())
+
+	// fields of messages (not just extensions) can have retention and targets
+	msg := NewMessage("Foo").
+		AddField(NewField("bar", FieldTypeString()).
+			SetRetention(descriptorpb.FieldOptions_RETENTION_RUNTIME).
+			SetTargets(descriptorpb.FieldOptions_TARGET_TYPE_FILE, descriptorpb.FieldOptions_TARGET_TYPE_MESSAGE))
+	_, err = msg.Build()
+	require.NoError(t, err)
+
+	// clearing
+	ext.SetRetention(descriptorpb.FieldOptions_RETENTION_UNKNOWN).SetTargets()
+	require.Nil(t, ext.Options.Retention)
+	require.Empty(t, ext.Options.Targets)
+}
+
+func TestEditionsFeatureResolution(t *testing.T) {
+	// Build a file with the builder and compile the equivalent source; the
+	// resolved features of the two should match.
+	fb := NewFile("test.proto").
+		SetEdition(descriptorpb.Edition_EDITION_2023).
+		SetPackageName("test").
+		SetOptions(&descriptorpb.FileOptions{
+			Features: &descriptorpb.FeatureSet{
+				EnumType:      descriptorpb.FeatureSet_CLOSED.Enum(),
+				FieldPresence: descriptorpb.FeatureSet_IMPLICIT.Enum(),
+			},
+		}).
+		AddEnum(NewEnum("Closed").AddValue(NewEnumValue("ONE").SetNumber(1))).
+		AddEnum(NewEnum("Open").
+			SetOptions(&descriptorpb.EnumOptions{
+				Features: &descriptorpb.FeatureSet{EnumType: descriptorpb.FeatureSet_OPEN.Enum()},
+			}).
+			AddValue(NewEnumValue("ZERO").SetNumber(0))).
+		AddMessage(NewMessage("Foo").
+			AddField(NewField("a", FieldTypeString())).
+			AddField(NewField("b", FieldTypeString()).
+				SetOptions(&descriptorpb.FieldOptions{
+					Features: &descriptorpb.FeatureSet{FieldPresence: descriptorpb.FeatureSet_EXPLICIT.Enum()},
+				})).
+			AddField(NewField("c", FieldTypeInt32()).SetRepeated().
+				SetOptions(&descriptorpb.FieldOptions{
+					Features: &descriptorpb.FeatureSet{RepeatedFieldEncoding: descriptorpb.FeatureSet_EXPANDED.Enum()},
+				})).
+			AddField(NewField("d", FieldTypeInt32()).SetRepeated()))
+	built, err := fb.Build()
+	require.NoError(t, err)
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"test.proto": `
+				edition = "2023";
+				package test;
+				option features.enum_type = CLOSED;
+				option features.field_presence = IMPLICIT;
+				enum Closed { ONE = 1; }
+				enum Open { option features.enum_type = OPEN; ZERO = 0; }
+				message Foo {
+					string a = 1;
+					string b = 2 [features.field_presence = EXPLICIT];
+					repeated int32 c = 3 [features.repeated_field_encoding = EXPANDED];
+					repeated int32 d = 4;
+				}
+			`}),
+		}),
+	}
+	compiled, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+	expected := compiled[0]
+
+	require.Equal(t, protoreflect.Editions, built.Syntax())
+	for i := 0; i < expected.Enums().Len(); i++ {
+		exp, act := expected.Enums().Get(i), built.Enums().Get(i)
+		require.Equal(t, exp.Name(), act.Name())
+		require.Equal(t, exp.IsClosed(), act.IsClosed(), "enum %s", exp.Name())
+	}
+	require.True(t, built.Enums().ByName("Closed").IsClosed())
+	expFields := expected.Messages().ByName("Foo").Fields()
+	actFields := built.Messages().ByName("Foo").Fields()
+	require.Equal(t, expFields.Len(), actFields.Len())
+	for i := 0; i < expFields.Len(); i++ {
+		exp, act := expFields.Get(i), actFields.Get(i)
+		require.Equal(t, exp.Name(), act.Name())
+		require.Equal(t, exp.HasPresence(), act.HasPresence(), "field %s", exp.Name())
+		require.Equal(t, exp.IsPacked(), act.IsPacked(), "field %s", exp.Name())
+	}
+	require.False(t, actFields.ByName("a").HasPresence())
+	require.True(t, actFields.ByName("b").HasPresence())
+	require.False(t, actFields.ByName("c").IsPacked())
+	require.True(t, actFields.ByName("d").IsPacked())
+}
+
+func TestImports(t *testing.T) {
+	dep := NewFile("b/dep.proto").SetPackageName("b").AddMessage(NewMessage("Dep"))
+	pub := NewFile("a/pub.proto").SetPackageName("a").AddMessage(NewMessage("Pub"))
+	fb := NewFile("test.proto").
+		// explicit imports that are also referenced are only imported once
+		AddImportedDependency(timestamppb.File_google_protobuf_timestamp_proto).
+		AddDependency(dep).
+		AddDependency(dep).
+		AddPublicDependency(pub).
+		// adding a non-public dependency does not downgrade a public one
+		AddDependency(pub).
+		AddMessage(NewMessage("Foo").
+			AddField(NewField("ts", FieldTypeImportedMessage(timestamppb.File_google_protobuf_timestamp_proto.Messages().ByName("Timestamp")))).
+			AddField(NewField("ts2", FieldTypeImportedMessage(timestamppb.File_google_protobuf_timestamp_proto.Messages().ByName("Timestamp")))).
+			AddField(NewField("dep", FieldTypeMessage(dep.GetMessage("Dep")))).
+			AddField(NewField("any", FieldTypeImportedMessage((&anypb.Any{}).ProtoReflect().Descriptor()))))
+
+	imps, err := fb.Imports()
+	require.NoError(t, err)
+	type imp struct {
+		path   string
+		public bool
+	}
+	actual := make([]imp, len(imps))
+	for i, fi := range imps {
+		actual[i] = imp{path: fi.Path(), public: fi.IsPublic}
+	}
+	require.Equal(t, []imp{
+		{path: "a/pub.proto", public: true},
+		{path: "b/dep.proto"},
+		{path: "google/protobuf/any.proto"},
+		{path: "google/protobuf/timestamp.proto"},
+	}, actual)
+
+	// public imports survive a round trip through FromFile
+	fd, err := fb.Build()
+	require.NoError(t, err)
+	fb2, err := FromFile(fd)
+	require.NoError(t, err)
+	fd2, err := fb2.Build()
+	require.NoError(t, err)
+	require.True(t, fd2.Imports().Get(0).IsPublic)
+	require.Equal(t, []int32{0}, protodesc.ToFileDescriptorProto(fd2).PublicDependency)
+
+	// errors are reported
+	_, err = NewFile("bad.proto").SetSyntax(protoreflect.Syntax(99)).Imports()
+	require.ErrorContains(t, err, "unknown syntax")
+}
+
 func clone(t *testing.T, fb *FileBuilder) *FileBuilder {
 	fd, err := fb.Build()
 	require.NoError(t, err)
@@ -1746,6 +2161,96 @@ func TestInvalid(t *testing.T) {
 			},
 			expectedError: "must not use reserved name",
 		},
+		{
+			name: "message set in proto3",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					SetSyntax(protoreflect.Proto3).
+					AddMessage(NewMessage("Foo").
+						SetMessageSetWireFormat(true))
+			},
+			expectedError: "messages with proto3 syntax cannot use message set wire format",
+		},
+		{
+			name: "message set with fields",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					AddMessage(NewMessage("Foo").
+						SetMessageSetWireFormat(true).
+						AddField(NewField("foo", FieldTypeBool())).
+						AddExtensionRange(100, 1000))
+			},
+			expectedError: "messages with message set wire format cannot contain non-extension fields",
+		},
+		{
+			name: "message set without extension ranges",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					AddMessage(NewMessage("Foo").
+						SetMessageSetWireFormat(true))
+			},
+			expectedError: "messages with message set wire format must contain at least one extension range",
+		},
+		{
+			name: "repeated message set extension",
+			builder: func() Builder {
+				msg := NewMessage("Foo").
+					SetMessageSetWireFormat(true).
+					AddExtensionRange(100, 1000)
+				return NewFile("foo.proto").
+					AddMessage(msg).
+					AddExtension(NewExtension("foo", 100, FieldTypeMessage(msg), msg).SetRepeated())
+			},
+			expectedError: "extensions of message set Foo must be optional",
+		},
+		{
+			name: "non-message message set extension",
+			builder: func() Builder {
+				msg := NewMessage("Foo").
+					SetMessageSetWireFormat(true).
+					AddExtensionRange(100, 1000)
+				return NewFile("foo.proto").
+					AddMessage(msg).
+					AddExtension(NewExtension("foo", 100, FieldTypeString(), msg))
+			},
+			expectedError: "extensions of message set Foo must be messages",
+		},
+		{
+			name: "option target does not match extendee",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					AddExtension(NewExtensionImported("foo", 54321, FieldTypeString(), fieldOptionsDesc).
+						SetTargets(descriptorpb.FieldOptions_TARGET_TYPE_FIELD, descriptorpb.FieldOptions_TARGET_TYPE_FILE))
+			},
+			expectedError: "target TARGET_TYPE_FILE does not apply to extensions of google.protobuf.FieldOptions",
+		},
+		{
+			name: "duplicate option target",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					AddExtension(NewExtensionImported("foo", 54321, FieldTypeString(), fieldOptionsDesc).
+						SetTargets(descriptorpb.FieldOptions_TARGET_TYPE_FIELD, descriptorpb.FieldOptions_TARGET_TYPE_FIELD))
+			},
+			expectedError: "target TARGET_TYPE_FIELD is specified more than once",
+		},
+		{
+			name: "unknown option target",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					AddExtension(NewExtensionImported("foo", 54321, FieldTypeString(), fieldOptionsDesc).
+						SetTargets(descriptorpb.FieldOptions_TARGET_TYPE_UNKNOWN))
+			},
+			expectedError: "invalid target 0",
+		},
+		{
+			name: "unknown option retention",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					AddExtension(NewExtensionImported("foo", 54321, FieldTypeString(), fieldOptionsDesc).
+						SetRetention(descriptorpb.FieldOptions_OptionRetention(99)))
+			},
+			expectedError: "unknown retention 99",
+		},
 		{
 			name: "ranges overlap",
 			builder: func() Builder {
@@ -1756,6 +2261,57 @@ func TestInvalid(t *testing.T) {
 			},
 			expectedError: "reserved and extension ranges has overlapping ranges",
 		},
+		{
+			name: "features in proto3",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					SetSyntax(protoreflect.Proto3).
+					AddMessage(NewMessage("Foo").
+						SetOptions(&descriptorpb.MessageOptions{
+							Features: &descriptorpb.FeatureSet{MessageEncoding: descriptorpb.FeatureSet_DELIMITED.Enum()},
+						}))
+			},
+			expectedError: "message Foo: features can only be set in files that use editions",
+		},
+		{
+			name: "feature not allowed on message",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					SetEdition(descriptorpb.Edition_EDITION_2023).
+					AddMessage(NewMessage("Foo").
+						SetOptions(&descriptorpb.MessageOptions{
+							Features: &descriptorpb.FeatureSet{FieldPresence: descriptorpb.FeatureSet_IMPLICIT.Enum()},
+						}))
+			},
+			expectedError: "message Foo: feature google.protobuf.FeatureSet.field_presence cannot be set on messages",
+		},
+		{
+			name: "feature not allowed on target",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					SetEdition(descriptorpb.Edition_EDITION_2023).
+					SetPackageName("foo.bar").
+					AddMessage(NewMessage("Foo").
+						AddField(NewField("foo", FieldTypeString()).
+							SetOptions(&descriptorpb.FieldOptions{
+								Features: &descriptorpb.FeatureSet{EnumType: descriptorpb.FeatureSet_OPEN.Enum()},
+							})))
+			},
+			expectedError: "field foo.bar.Foo.foo: feature google.protobuf.FeatureSet.enum_type cannot be set on fields",
+		},
+		{
+			name: "feature not allowed on enum value",
+			builder: func() Builder {
+				return NewFile("foo.proto").
+					SetEdition(descriptorpb.Edition_EDITION_2023).
+					AddEnum(NewEnum("Foo").
+						AddValue(NewEnumValue("ZERO").
+							SetOptions(&descriptorpb.EnumValueOptions{
+								Features: &descriptorpb.FeatureSet{EnumType: descriptorpb.FeatureSet_CLOSED.Enum()},
+							})))
+			},
+			expectedError: "enum value ZERO: feature google.protobuf.FeatureSet.enum_type cannot be set on enum values",
+		},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -1764,3 +2320,147 @@ func TestInvalid(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomOptionDependencies_Nested(t *testing.T) {
+	// an extension inside the file's features
+	features := &descriptorpb.FeatureSet{}
+	proto.SetExtension(features, gofeaturespb.E_Go, &gofeaturespb.GoFeatures{LegacyUnmarshalJsonEnum: proto.Bool(true)})
+	fb := NewFile("test.proto").
+		SetEdition(descriptorpb.Edition_EDITION_2023).
+		SetOptions(&descriptorpb.FileOptions{Features: features}).
+		AddMessage(NewMessage("Foo"))
+	imps, err := fb.Imports()
+	require.NoError(t, err)
+	require.Len(t, imps, 1)
+	require.Equal(t, gofeaturespb.File_google_protobuf_go_features_proto.Path(), imps[0].Path())
+
+	// unrecognized extension, which is resolved with the BuilderOptions
+	data, err := proto.Marshal(features)
+	require.NoError(t, err)
+	var unrecognized descriptorpb.FeatureSet
+	require.NoError(t, proto.UnmarshalOptions{Resolver: (*protoregistry.Types)(nil)}.Unmarshal(data, &unrecognized))
+	require.NotEmpty(t, unrecognized.ProtoReflect().GetUnknown())
+	fb.SetOptions(&descriptorpb.FileOptions{Features: &unrecognized})
+	var reg protoregistry.Types
+	require.NoError(t, reg.RegisterExtension(gofeaturespb.E_Go))
+	opts := BuilderOptions{Resolver: &reg, RequireInterpretedOptions: true}
+	d, err := opts.Build(fb)
+	require.NoError(t, err)
+	fd := d.(protoreflect.FileDescriptor)
+	require.Equal(t, 1, fd.Imports().Len())
+	require.Equal(t, gofeaturespb.File_google_protobuf_go_features_proto.Path(), fd.Imports().Get(0).Path())
+
+	// unrecognized fields in nested messages that aren't in extension ranges
+	// are not custom options
+	var b []byte
+	b = protowire.AppendTag(b, 99, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+	features = &descriptorpb.FeatureSet{}
+	features.ProtoReflect().SetUnknown(b)
+	fb.SetOptions(&descriptorpb.FileOptions{Features: features})
+	d, err = opts.Build(fb)
+	require.NoError(t, err)
+	require.Equal(t, 0, d.(protoreflect.FileDescriptor).Imports().Len())
+}
+
+func TestValidate(t *testing.T) {
+	msg := NewMessage("Foo").
+		AddField(NewField("foo_bar", FieldTypeString()).SetNumber(1)).
+		AddField(NewField("fooBar", FieldTypeString()).SetNumber(2)).
+		AddField(NewField("baz", FieldTypeInt32()).SetNumber(10)).
+		AddField(NewField("old", FieldTypeInt32())).
+		AddReservedRange(5, 15).
+		AddReservedRange(12, 20).
+		AddReservedName("old")
+	en := NewEnum("Bar").
+		AddValue(NewEnumValue("BAR_ONE").SetNumber(1)).
+		AddValue(NewEnumValue("BAR_TWO").SetNumber(1))
+	fb := NewFile("foo.proto").
+		SetSyntax(protoreflect.Proto3).
+		AddMessage(msg).
+		AddEnum(en)
+
+	var errs []string
+	for _, err := range fb.Validate() {
+		errs = append(errs, err.Error())
+	}
+	require.Equal(t, []string{
+		"Foo: reserved range 12 to 19 overlaps reserved range 5 to 14",
+		`Foo.fooBar: JSON name "fooBar" conflicts with JSON name of field foo_bar`,
+		"Foo.baz: tag 10 is in reserved range 5 to 14",
+		`Foo.old: field name "old" is reserved`,
+		"Bar: first value in a proto3 enum must be zero",
+		"BAR_TWO: number 1 is already used by value BAR_ONE; set allow_alias to permit aliases",
+	}, errs)
+	_, err := fb.Build()
+	require.Error(t, err)
+
+	// default JSON names may conflict in proto2; unset numbers are not checked
+	fb.SetSyntax(protoreflect.Proto2)
+	msg.SetReservedRanges(nil).SetReservedNames(nil)
+	en.GetValue("BAR_TWO").SetNumber(2)
+	require.Empty(t, fb.Validate())
+	_, err = fb.Build()
+	require.NoError(t, err)
+}
+
+func TestBuildAll(t *testing.T) {
+	common := NewFile("common.proto").SetPackageName("test")
+	commonMsg := NewMessage("Common")
+	common.AddMessage(commonMsg)
+	// not in any file, so it gets a synthetic file
+	sharedEnum := NewEnum("Shared").AddValue(NewEnumValue("SHARED_ZERO"))
+
+	files := make([]*FileBuilder, 50)
+	for i := range files {
+		files[i] = NewFile(fmt.Sprintf("file%d.proto", i)).SetPackageName("test")
+		msg := NewMessage(protoreflect.Name(fmt.Sprintf("Msg%d", i)))
+		msg.AddField(NewField("common", FieldTypeMessage(commonMsg)))
+		msg.AddField(NewField("shared", FieldTypeEnum(sharedEnum)))
+		files[i].AddMessage(msg)
+	}
+	fds, err := BuildAll(files)
+	require.NoError(t, err)
+	require.Len(t, fds, len(files))
+	// shared dependencies are only built once
+	commonMd := fds[0].Messages().Get(0).Fields().ByName("common").Message()
+	sharedEd := fds[0].Messages().Get(0).Fields().ByName("shared").Enum()
+	for i, fd := range fds {
+		require.Equal(t, fmt.Sprintf("file%d.proto", i), fd.Path())
+		fields := fd.Messages().Get(0).Fields()
+		require.Same(t, commonMd, fields.ByName("common").Message())
+		require.Same(t, sharedEd, fields.ByName("shared").Enum())
+	}
+	require.Equal(t, "common.proto", commonMd.ParentFile().Path())
+	// synthetic file is detached after building
+	require.Nil(t, sharedEnum.Parent())
+
+	// results match building individually
+	for i, fb := range files {
+		fd, err := fb.Build()
+		require.NoError(t, err)
+		// synthetic files will have different generated names
+		expected := protodesc.ToFileDescriptorProto(fd)
+		expected.Dependency = nil
+		actual := protodesc.ToFileDescriptorProto(fds[i])
+		actual.Dependency = nil
+		diff := cmp.Diff(expected, actual, protocmp.Transform())
+		require.Empty(t, diff)
+	}
+}
+
+func TestBuildAll_Cycle(t *testing.T) {
+	// run it a few times since it depends on how the files are scheduled
+	for i := 0; i < 20; i++ {
+		a := NewFile("a.proto")
+		b := NewFile("b.proto")
+		msgA := NewMessage("A")
+		msgB := NewMessage("B")
+		a.AddMessage(msgA)
+		b.AddMessage(msgB)
+		msgA.AddField(NewField("b", FieldTypeMessage(msgB)))
+		msgB.AddField(NewField("a", FieldTypeMessage(msgA)))
+		_, err := BuildAll([]*FileBuilder{a, b})
+		require.ErrorContains(t, err, `failed to build file "a.proto": descriptors have cyclic dependency`)
+	}
+}
@@ -0,0 +1,151 @@
+package protobuilder
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Converter converts many descriptors into builders. The FromFile, FromMessage,
+// etc functions create a new copy of the descriptor's entire file every time
+// they are called. So converting many elements that are defined in the same
+// file, or that refer to one another, results in many duplicate builders. A
+// Converter instead creates at most one builder for each file:
+//
+//   - Converting an element whose file was already converted returns the
+//     existing builder for that element.
+//   - Within files converted by the same Converter, references to messages
+//     and enums in other converted files refer to their builders instead of
+//     to the original descriptors. So changes to a type's builder are seen by
+//     all fields and methods that use it, and the resulting file builders
+//     depend on one another instead of on the original files.
+//
+// This makes it much more efficient to import a large schema into builders.
+//
+// The zero value is ready to use. A Converter is not safe for concurrent use.
+type Converter struct {
+	files         map[string]*convertedFile
+	localMessages map[protoreflect.MessageDescriptor]*MessageBuilder
+	localEnums    map[protoreflect.EnumDescriptor]*EnumBuilder
+}
+
+type convertedFile struct {
+	fd protoreflect.FileDescriptor
+	fb *FileBuilder
+}
+
+// FromFile returns a builder for the given file. If the file was already
+// converted by c, the same builder is returned. An error is returned if c has
+// already converted a different file with the same path.
+func (c *Converter) FromFile(fd protoreflect.FileDescriptor) (*FileBuilder, error) {
+	if existing, ok := c.files[fd.Path()]; ok {
+		if existing.fd != fd {
+			return nil, fmt.Errorf("already converted a different file with path %q", fd.Path())
+		}
+		return existing.fb, nil
+	}
+	fb, localMessages, localEnums, err := fromFile(fd)
+	if err != nil {
+		return nil, err
+	}
+	if c.files == nil {
+		c.files = map[string]*convertedFile{}
+		c.localMessages = map[protoreflect.MessageDescriptor]*MessageBuilder{}
+		c.localEnums = map[protoreflect.EnumDescriptor]*EnumBuilder{}
+	}
+	newFile := &convertedFile{fd: fd, fb: fb}
+
+	// update references from previously converted files to the new one
+	for _, other := range c.files {
+		updateLocalRefsInFile(other.fb, localMessages, localEnums)
+		other.useBuilderDeps(map[string]*convertedFile{fd.Path(): newFile})
+	}
+
+	for md, mb := range localMessages {
+		c.localMessages[md] = mb
+	}
+	for ed, eb := range localEnums {
+		c.localEnums[ed] = eb
+	}
+	c.files[fd.Path()] = newFile
+
+	// and references from the new file to all converted files (including itself)
+	updateLocalRefsInFile(fb, c.localMessages, c.localEnums)
+	newFile.useBuilderDeps(c.files)
+	return fb, nil
+}
+
+// useBuilderDeps replaces explicit imports of files that have been converted
+// with dependencies on their builders. Otherwise, the file would import both
+// the original file and the file built from the builder, which conflict.
+func (f *convertedFile) useBuilderDeps(files map[string]*convertedFile) {
+	for dep, public := range f.fb.explicitImports {
+		converted, ok := files[dep.Path()]
+		if !ok || converted.fd != dep {
+			continue
+		}
+		delete(f.fb.explicitImports, dep)
+		if public {
+			f.fb.AddPublicDependency(converted.fb)
+		} else {
+			f.fb.AddDependency(converted.fb)
+		}
+	}
+}
+
+// FromMessage returns a builder for the given message. It is like the
+// FromMessage function, except that its file is converted using c.FromFile.
+func (c *Converter) FromMessage(md protoreflect.MessageDescriptor) (*MessageBuilder, error) {
+	return convertElement[*MessageBuilder](c, md, "message")
+}
+
+// FromField returns a builder for the given field or extension. It is like
+// the FromField function, except that its file is converted using c.FromFile.
+func (c *Converter) FromField(fld protoreflect.FieldDescriptor) (*FieldBuilder, error) {
+	return convertElement[*FieldBuilder](c, fld, "field")
+}
+
+// FromOneof returns a builder for the given oneof. It is like the FromOneof
+// function, except that its file is converted using c.FromFile.
+func (c *Converter) FromOneof(ood protoreflect.OneofDescriptor) (*OneofBuilder, error) {
+	if ood.IsSynthetic() {
+		return nil, fmt.Errorf("oneof %s is synthetic", ood.FullName())
+	}
+	return convertElement[*OneofBuilder](c, ood, "oneof")
+}
+
+// FromEnum returns a builder for the given enum. It is like the FromEnum
+// function, except that its file is converted using c.FromFile.
+func (c *Converter) FromEnum(ed protoreflect.EnumDescriptor) (*EnumBuilder, error) {
+	return convertElement[*EnumBuilder](c, ed, "enum")
+}
+
+// FromEnumValue returns a builder for the given enum value. It is like the
+// FromEnumValue function, except that its file is converted using c.FromFile.
+func (c *Converter) FromEnumValue(evd protoreflect.EnumValueDescriptor) (*EnumValueBuilder, error) {
+	return convertElement[*EnumValueBuilder](c, evd, "enum value")
+}
+
+// FromService returns a builder for the given service. It is like the
+// FromService function, except that its file is converted using c.FromFile.
+func (c *Converter) FromService(sd protoreflect.ServiceDescriptor) (*ServiceBuilder, error) {
+	return convertElement[*ServiceBuilder](c, sd, "service")
+}
+
+// FromMethod returns a builder for the given method. It is like the
+// FromMethod function, except that its file is converted using c.FromFile.
+func (c *Converter) FromMethod(mtd protoreflect.MethodDescriptor) (*MethodBuilder, error) {
+	return convertElement[*MethodBuilder](c, mtd, "method")
+}
+
+func convertElement[B Builder](c *Converter, d protoreflect.Descriptor, kind string) (B, error) {
+	var zero B
+	fb, err := c.FromFile(d.ParentFile())
+	if err != nil {
+		return zero, err
+	}
+	if b, ok := fb.findFullyQualifiedElement(d.FullName()).(B); ok {
+		return b, nil
+	}
+	return zero, fmt.Errorf("could not find %s %s after converting file %q to builder", kind, d.FullName(), d.ParentFile().Path())
+}
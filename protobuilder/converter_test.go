@@ -0,0 +1,59 @@
+package protobuilder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestConverter(t *testing.T) {
+	frobnitzDesc := (&testprotos.Frobnitz{}).ProtoReflect().Descriptor()
+	testMsgDesc := (&testprotos.TestMessage{}).ProtoReflect().Descriptor()
+	require.NotEqual(t, frobnitzDesc.ParentFile().Path(), testMsgDesc.ParentFile().Path())
+
+	var c Converter
+	frobnitz, err := c.FromMessage(frobnitzDesc)
+	require.NoError(t, err)
+	testMsg, err := c.FromMessage(testMsgDesc)
+	require.NoError(t, err)
+
+	// same builders are returned for the same elements and files
+	again, err := c.FromMessage(testMsgDesc)
+	require.NoError(t, err)
+	require.Same(t, testMsg, again)
+	nestedEnum, err := c.FromEnum(testMsgDesc.Enums().Get(0))
+	require.NoError(t, err)
+	require.Same(t, testMsg.ParentFile(), nestedEnum.ParentFile())
+	fb, err := c.FromFile(frobnitzDesc.ParentFile())
+	require.NoError(t, err)
+	require.Same(t, frobnitz.ParentFile(), fb)
+
+	// references across files refer to the other file's builders
+	fieldA := frobnitz.GetField("a")
+	require.Same(t, testMsg, fieldA.Type().localMsgType)
+	require.Nil(t, fieldA.Type().foreignMsgType)
+	fieldE := frobnitz.GetField("e")
+	require.Same(t, nestedEnum, fieldE.Type().localEnumType)
+
+	// so changes to one builder are seen when building the other
+	testMsg.AddField(NewField("new_field", FieldTypeString()).SetNumber(1000))
+	fd, err := fb.Build()
+	require.NoError(t, err)
+	md := fd.Messages().ByName("Frobnitz")
+	require.NotNil(t, md.Fields().ByName("a").Message().Fields().ByName("new_field"))
+
+	// other elements still match the originals
+	origProto := protodesc.ToDescriptorProto(frobnitzDesc)
+	builtProto := protodesc.ToDescriptorProto(md)
+	require.True(t, proto.Equal(origProto, builtProto))
+
+	// a different file with the same path is an error
+	otherFile, err := NewFile(testMsgDesc.ParentFile().Path()).Build()
+	require.NoError(t, err)
+	_, err = c.FromFile(otherFile)
+	require.EqualError(t, err, `already converted a different file with path "desc_test1.proto"`)
+}
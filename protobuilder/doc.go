@@ -173,6 +173,18 @@
 //  13. Non-extension fields are not allowed to use names that the message has
 //     marked as reserved.
 //  14. Extension ranges and reserved ranges must not overlap.
+//  15. Messages that use the message set wire format cannot have non-extension
+//     fields, must define at least one extension range, and are not allowed in
+//     files with a syntax of proto3.
+//  16. Extensions of messages that use the message set wire format must be
+//     optional fields whose type is a message.
+//  17. Option targets must be valid and must not be repeated. Extensions of
+//     the options messages in "google/protobuf/descriptor.proto" may only use
+//     targets that correspond to the extended options message. Option
+//     retention, if present, must be a known value.
+//  18. Features may only be set in the options of elements in files that use
+//     editions. Each feature may only be set on the kinds of elements that are
+//     allowed by that feature's option targets.
 //
 // Validation rules that are *not* enforced by builders, and thus would be
 // allowed and result in illegal constructs, include the following:
@@ -180,6 +180,25 @@ func (eb *EnumBuilder) SetOptions(options *descriptorpb.EnumOptions) *EnumBuilde
 	return eb
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this enum's options. If an error prevents the option from being
+// set, this method panics. This returns the enum builder, for method chaining.
+func (eb *EnumBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *EnumBuilder {
+	if err := eb.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return eb
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this enum's options, returning any error that prevents the
+// option from being set (such as the extension not extending the enum's
+// options message or the value having the wrong type). If the enum's options
+// are nil, they are first initialized to an empty options message.
+func (eb *EnumBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&eb.Options, ext, val)
+}
+
 // GetValue returns the enum value with the given name. If no such value exists
 // in the enum, nil is returned.
 func (eb *EnumBuilder) GetValue(name protoreflect.Name) *EnumValueBuilder {
@@ -452,6 +471,25 @@ func (evb *EnumValueBuilder) SetOptions(options *descriptorpb.EnumValueOptions)
 	return evb
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this enum value's options. If an error prevents the option from being
+// set, this method panics. This returns the enum value builder, for method chaining.
+func (evb *EnumValueBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *EnumValueBuilder {
+	if err := evb.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return evb
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this enum value's options, returning any error that prevents the
+// option from being set (such as the extension not extending the enum value's
+// options message or the value having the wrong type). If the enum value's options
+// are nil, they are first initialized to an empty options message.
+func (evb *EnumValueBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&evb.Options, ext, val)
+}
+
 // Number returns the enum value's numeric value. If the number has not been
 // set this returns zero.
 func (evb *EnumValueBuilder) Number() protoreflect.EnumNumber {
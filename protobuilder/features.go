@@ -0,0 +1,161 @@
+package protobuilder
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// validateFeatures checks that the features options in the given file are
+// only used in files that use editions and that each feature is only set on
+// the kinds of elements to which it applies, per the feature's targets.
+func validateFeatures(fd *descriptorpb.FileDescriptorProto) error {
+	v := featuresValidator{isEditions: fd.GetSyntax() == "editions"}
+	if err := v.check("file "+fd.GetName(), fd.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_FILE); err != nil {
+		return err
+	}
+	prefix := fd.GetPackage()
+	for _, md := range fd.GetMessageType() {
+		if err := v.checkMessage(prefix, md); err != nil {
+			return err
+		}
+	}
+	for _, ed := range fd.GetEnumType() {
+		if err := v.checkEnum(prefix, ed); err != nil {
+			return err
+		}
+	}
+	for _, exd := range fd.GetExtension() {
+		if err := v.check("extension "+qualify(prefix, exd.GetName()), exd.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_FIELD); err != nil {
+			return err
+		}
+	}
+	for _, sd := range fd.GetService() {
+		name := qualify(prefix, sd.GetName())
+		if err := v.check("service "+name, sd.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_SERVICE); err != nil {
+			return err
+		}
+		for _, mtd := range sd.GetMethod() {
+			if err := v.check("method "+qualify(name, mtd.GetName()), mtd.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_METHOD); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type featuresValidator struct {
+	isEditions bool
+}
+
+func (v featuresValidator) checkMessage(prefix string, md *descriptorpb.DescriptorProto) error {
+	name := qualify(prefix, md.GetName())
+	if err := v.check("message "+name, md.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_MESSAGE); err != nil {
+		return err
+	}
+	for _, fld := range md.GetField() {
+		if err := v.check("field "+qualify(name, fld.GetName()), fld.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_FIELD); err != nil {
+			return err
+		}
+	}
+	for _, ood := range md.GetOneofDecl() {
+		if err := v.check("oneof "+qualify(name, ood.GetName()), ood.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_ONEOF); err != nil {
+			return err
+		}
+	}
+	for _, rng := range md.GetExtensionRange() {
+		elementName := fmt.Sprintf("extension range %d to %d in message %s", rng.GetStart(), rng.GetEnd()-1, name)
+		if err := v.check(elementName, rng.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_EXTENSION_RANGE); err != nil {
+			return err
+		}
+	}
+	for _, nmd := range md.GetNestedType() {
+		if err := v.checkMessage(name, nmd); err != nil {
+			return err
+		}
+	}
+	for _, ed := range md.GetEnumType() {
+		if err := v.checkEnum(name, ed); err != nil {
+			return err
+		}
+	}
+	for _, exd := range md.GetExtension() {
+		if err := v.check("extension "+qualify(name, exd.GetName()), exd.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_FIELD); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v featuresValidator) checkEnum(prefix string, ed *descriptorpb.EnumDescriptorProto) error {
+	name := qualify(prefix, ed.GetName())
+	if err := v.check("enum "+name, ed.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_ENUM); err != nil {
+		return err
+	}
+	for _, evd := range ed.GetValue() {
+		// enum values are siblings of the enum, not children
+		if err := v.check("enum value "+qualify(prefix, evd.GetName()), evd.GetOptions().GetFeatures(), descriptorpb.FieldOptions_TARGET_TYPE_ENUM_ENTRY); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v featuresValidator) check(elementName string, features *descriptorpb.FeatureSet, target descriptorpb.FieldOptions_OptionTargetType) error {
+	if features == nil {
+		return nil
+	}
+	if !v.isEditions {
+		return fmt.Errorf("%s: features can only be set in files that use editions", elementName)
+	}
+	var err error
+	features.ProtoReflect().Range(func(fld protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		opts, _ := fld.Options().(*descriptorpb.FieldOptions)
+		targets := opts.GetTargets()
+		if len(targets) == 0 {
+			// no targets means the feature can be set anywhere
+			return true
+		}
+		for _, t := range targets {
+			if t == target {
+				return true
+			}
+		}
+		err = fmt.Errorf("%s: feature %s cannot be set on %s", elementName, fld.FullName(), targetDescription(target))
+		return false
+	})
+	return err
+}
+
+func targetDescription(target descriptorpb.FieldOptions_OptionTargetType) string {
+	switch target {
+	case descriptorpb.FieldOptions_TARGET_TYPE_FILE:
+		return "files"
+	case descriptorpb.FieldOptions_TARGET_TYPE_EXTENSION_RANGE:
+		return "extension ranges"
+	case descriptorpb.FieldOptions_TARGET_TYPE_MESSAGE:
+		return "messages"
+	case descriptorpb.FieldOptions_TARGET_TYPE_FIELD:
+		return "fields"
+	case descriptorpb.FieldOptions_TARGET_TYPE_ONEOF:
+		return "oneofs"
+	case descriptorpb.FieldOptions_TARGET_TYPE_ENUM:
+		return "enums"
+	case descriptorpb.FieldOptions_TARGET_TYPE_ENUM_ENTRY:
+		return "enum values"
+	case descriptorpb.FieldOptions_TARGET_TYPE_SERVICE:
+		return "services"
+	case descriptorpb.FieldOptions_TARGET_TYPE_METHOD:
+		return "methods"
+	default:
+		return target.String()
+	}
+}
+
+func qualify(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
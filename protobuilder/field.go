@@ -415,6 +415,75 @@ func (flb *FieldBuilder) SetOptions(options *descriptorpb.FieldOptions) *FieldBu
 	return flb
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this field's options. If an error prevents the option from being
+// set, this method panics. This returns the field builder, for method chaining.
+func (flb *FieldBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *FieldBuilder {
+	if err := flb.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return flb
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this field's options, returning any error that prevents the
+// option from being set (such as the extension not extending the field's
+// options message or the value having the wrong type). If the field's options
+// are nil, they are first initialized to an empty options message.
+func (flb *FieldBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&flb.Options, ext, val)
+}
+
+// SetRetention sets the retention for this field and returns the field builder,
+// for method chaining. Retention is typically set on extensions that define
+// custom options (and on fields of messages used as the types of custom options).
+// Options with a retention of descriptorpb.FieldOptions_RETENTION_SOURCE are
+// only present in source and are not retained in descriptors at runtime.
+//
+// Setting retention to descriptorpb.FieldOptions_RETENTION_UNKNOWN clears it.
+// The field's options are cloned before they are changed, so an options
+// message that was previously passed to SetOptions is not modified.
+func (flb *FieldBuilder) SetRetention(retention descriptorpb.FieldOptions_OptionRetention) *FieldBuilder {
+	opts := cloneOptions(flb.Options)
+	if retention == descriptorpb.FieldOptions_RETENTION_UNKNOWN {
+		opts.Retention = nil
+	} else {
+		opts.Retention = retention.Enum()
+	}
+	flb.Options = opts
+	return flb
+}
+
+// Retention returns the retention for this field, as defined in the field's
+// options.
+func (flb *FieldBuilder) Retention() descriptorpb.FieldOptions_OptionRetention {
+	return flb.Options.GetRetention()
+}
+
+// SetTargets sets the targets for this field and returns the field builder, for
+// method chaining. Targets are typically set on extensions that define custom
+// options, and they indicate the kinds of elements to which the option may be
+// applied. If the field is an extension of one of the options messages defined
+// in "google/protobuf/descriptor.proto", all targets must correspond to that
+// options message. For example, an extension of google.protobuf.FieldOptions
+// may only use descriptorpb.FieldOptions_TARGET_TYPE_FIELD as a target.
+//
+// Calling this with no targets clears them. The field's options are cloned
+// before they are changed, so an options message that was previously passed
+// to SetOptions is not modified.
+func (flb *FieldBuilder) SetTargets(targets ...descriptorpb.FieldOptions_OptionTargetType) *FieldBuilder {
+	opts := cloneOptions(flb.Options)
+	opts.Targets = append([]descriptorpb.FieldOptions_OptionTargetType(nil), targets...)
+	flb.Options = opts
+	return flb
+}
+
+// Targets returns the targets for this field, as defined in the field's
+// options.
+func (flb *FieldBuilder) Targets() []descriptorpb.FieldOptions_OptionTargetType {
+	return flb.Options.GetTargets()
+}
+
 // SetCardinality sets the label for this field, which can be optional, repeated, or
 // required. It returns the field builder, for method chaining.
 //
@@ -573,6 +642,19 @@ func (flb *FieldBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sourc
 		proto3Optional = proto.Bool(true)
 	}
 
+	if isMessageSet && flb.IsExtension() {
+		if flb.Cardinality != protoreflect.Optional && flb.Cardinality != 0 {
+			return nil, fmt.Errorf("extension %s: extensions of message set %s must be optional", FullName(flb), flb.ExtendeeTypeName())
+		}
+		if flb.fieldType.fieldType != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			return nil, fmt.Errorf("extension %s: extensions of message set %s must be messages", FullName(flb), flb.ExtendeeTypeName())
+		}
+	}
+
+	if err := flb.validateRetentionAndTargets(); err != nil {
+		return nil, err
+	}
+
 	maxTag := internal.GetMaxTag(isMessageSet)
 	if flb.number > maxTag {
 		return nil, fmt.Errorf("tag for field %s cannot be above max %d", FullName(flb), maxTag)
@@ -593,6 +675,60 @@ func (flb *FieldBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sourc
 	return fd, nil
 }
 
+// optionsTypesByTarget maps option targets to the name of the options message
+// for that kind of element.
+var optionsTypesByTarget = map[descriptorpb.FieldOptions_OptionTargetType]protoreflect.FullName{
+	descriptorpb.FieldOptions_TARGET_TYPE_FILE:            "google.protobuf.FileOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_EXTENSION_RANGE: "google.protobuf.ExtensionRangeOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_MESSAGE:         "google.protobuf.MessageOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_FIELD:           "google.protobuf.FieldOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_ONEOF:           "google.protobuf.OneofOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_ENUM:            "google.protobuf.EnumOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_ENUM_ENTRY:      "google.protobuf.EnumValueOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_SERVICE:         "google.protobuf.ServiceOptions",
+	descriptorpb.FieldOptions_TARGET_TYPE_METHOD:          "google.protobuf.MethodOptions",
+}
+
+func (flb *FieldBuilder) validateRetentionAndTargets() error {
+	if flb.Options == nil {
+		return nil
+	}
+	if flb.Options.Retention != nil {
+		retention := flb.Options.GetRetention()
+		if retention.Descriptor().Values().ByNumber(retention.Number()) == nil {
+			return fmt.Errorf("field %s: unknown retention %d", FullName(flb), retention)
+		}
+	}
+	if len(flb.Options.Targets) == 0 {
+		return nil
+	}
+	var isOptionsExtendee bool
+	extendee := flb.ExtendeeTypeName()
+	if flb.IsExtension() {
+		for _, optionsType := range optionsTypesByTarget {
+			if extendee == optionsType {
+				isOptionsExtendee = true
+				break
+			}
+		}
+	}
+	seen := make(map[descriptorpb.FieldOptions_OptionTargetType]struct{}, len(flb.Options.Targets))
+	for _, target := range flb.Options.Targets {
+		optionsType, ok := optionsTypesByTarget[target]
+		if !ok {
+			return fmt.Errorf("field %s: invalid target %d", FullName(flb), target)
+		}
+		if _, ok := seen[target]; ok {
+			return fmt.Errorf("field %s: target %v is specified more than once", FullName(flb), target)
+		}
+		seen[target] = struct{}{}
+		if isOptionsExtendee && optionsType != extendee {
+			return fmt.Errorf("extension %s: target %v does not apply to extensions of %s", FullName(flb), target, extendee)
+		}
+	}
+	return nil
+}
+
 // Build constructs a field descriptor based on the contents of this field
 // builder. If there are any problems constructing the descriptor, including
 // resolving symbols referenced by the builder or failing to meet certain
@@ -894,6 +1030,25 @@ func (oob *OneofBuilder) SetOptions(options *descriptorpb.OneofOptions) *OneofBu
 	return oob
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this oneof's options. If an error prevents the option from being
+// set, this method panics. This returns the oneof builder, for method chaining.
+func (oob *OneofBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *OneofBuilder {
+	if err := oob.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return oob
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this oneof's options, returning any error that prevents the
+// option from being set (such as the extension not extending the oneof's
+// options message or the value having the wrong type). If the oneof's options
+// are nil, they are first initialized to an empty options message.
+func (oob *OneofBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&oob.Options, ext, val)
+}
+
 func (oob *OneofBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.OneofDescriptorProto, error) {
 	addCommentsTo(sourceInfo, path, &oob.comments)
 
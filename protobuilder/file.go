@@ -68,9 +68,10 @@ type FileBuilder struct {
 	services   []*ServiceBuilder
 	symbols    map[protoreflect.Name]Builder
 
-	origExts        protoregistry.Types
-	explicitDeps    map[*FileBuilder]struct{}
-	explicitImports map[protoreflect.FileDescriptor]struct{}
+	origExts protoregistry.Types
+	// values in these maps indicate whether the import is public
+	explicitDeps    map[*FileBuilder]bool
+	explicitImports map[protoreflect.FileDescriptor]bool
 }
 
 var _ Builder = (*FileBuilder)(nil)
@@ -89,7 +90,28 @@ func NewFile(path string) *FileBuilder {
 // the given descriptor included it. Instead, comments are extracted from the
 // given descriptor's source info (if present) and, when built, the resulting
 // descriptor will have just the comment info (no location information).
+//
+// All options are preserved, including custom options. Custom options whose
+// definitions are not known to the calling program are retained as unknown
+// fields, so they are still present in the descriptor when the builder is
+// built. To instead fail when such options cannot be interpreted, build the
+// result using BuilderOptions with RequireInterpretedOptions set to true.
 func FromFile(fd protoreflect.FileDescriptor) (*FileBuilder, error) {
+	fb, localMessages, localEnums, err := fromFile(fd)
+	if err != nil {
+		return nil, err
+	}
+	// we've converted everything, so now we update all foreign type references
+	// to be local type references if possible
+	updateLocalRefsInFile(fb, localMessages, localEnums)
+	return fb, nil
+}
+
+// fromFile converts the given file into a builder. It also returns the
+// builders for all messages and enums in the file, keyed by their original
+// descriptors. References to these elements in the returned builder have not
+// yet been updated to refer to the builders.
+func fromFile(fd protoreflect.FileDescriptor) (*FileBuilder, map[protoreflect.MessageDescriptor]*MessageBuilder, map[protoreflect.EnumDescriptor]*EnumBuilder, error) {
 	fb := NewFile(fd.Path())
 	fb.Syntax = fd.Syntax()
 	if fb.Syntax == protoreflect.Editions {
@@ -99,7 +121,7 @@ func FromFile(fd protoreflect.FileDescriptor) (*FileBuilder, error) {
 	var err error
 	fb.Options, err = protomessage.As[*descriptorpb.FileOptions](fd.Options())
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	setComments(&fb.comments, fd.SourceLocations().ByPath(protoreflect.SourcePath{}))
 
@@ -112,9 +134,13 @@ func FromFile(fd protoreflect.FileDescriptor) (*FileBuilder, error) {
 	imps := fd.Imports()
 	for i, length := 0, imps.Len(); i < length; i++ {
 		imp := imps.Get(i).FileDescriptor
-		fb.AddImportedDependency(imp)
+		if imps.Get(i).IsPublic {
+			fb.AddPublicImportedDependency(imp)
+		} else {
+			fb.AddImportedDependency(imp)
+		}
 		if err := fb.addExtensionsFromImport(imp); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 
@@ -125,41 +151,43 @@ func FromFile(fd protoreflect.FileDescriptor) (*FileBuilder, error) {
 	for i, length := 0, msgs.Len(); i < length; i++ {
 		msg := msgs.Get(i)
 		if mb, err := fromMessage(msg, localMessages, localEnums); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		} else if err := fb.TryAddMessage(mb); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 	enums := fd.Enums()
 	for i, length := 0, enums.Len(); i < length; i++ {
 		enum := enums.Get(i)
 		if eb, err := fromEnum(enum, localEnums); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		} else if err := fb.TryAddEnum(eb); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 	exts := fd.Extensions()
 	for i, length := 0, exts.Len(); i < length; i++ {
 		ext := exts.Get(i)
 		if exb, err := fromField(ext); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		} else if err := fb.TryAddExtension(exb); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 	svcs := fd.Services()
 	for i, length := 0, svcs.Len(); i < length; i++ {
 		svc := svcs.Get(i)
 		if sb, err := fromService(svc); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		} else if err := fb.TryAddService(sb); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 
-	// we've converted everything, so now we update all foreign type references
-	// to be local type references if possible
+	return fb, localMessages, localEnums, nil
+}
+
+func updateLocalRefsInFile(fb *FileBuilder, localMessages map[protoreflect.MessageDescriptor]*MessageBuilder, localEnums map[protoreflect.EnumDescriptor]*EnumBuilder) {
 	for _, mb := range fb.messages {
 		updateLocalRefsInMessage(mb, localMessages, localEnums)
 	}
@@ -172,8 +200,6 @@ func FromFile(fd protoreflect.FileDescriptor) (*FileBuilder, error) {
 			updateLocalRefsInRpcType(mtb.RespType, localMessages)
 		}
 	}
-
-	return fb, nil
 }
 
 func updateLocalRefsInMessage(mb *MessageBuilder, localMessages map[protoreflect.MessageDescriptor]*MessageBuilder, localEnums map[protoreflect.EnumDescriptor]*EnumBuilder) {
@@ -646,9 +672,23 @@ func (fb *FileBuilder) addExtensionsFromImport(dep protoreflect.FileDescriptor)
 // an ExtensionRegistry, when building the file.
 func (fb *FileBuilder) AddDependency(dep *FileBuilder) *FileBuilder {
 	if fb.explicitDeps == nil {
-		fb.explicitDeps = map[*FileBuilder]struct{}{}
+		fb.explicitDeps = map[*FileBuilder]bool{}
+	}
+	if _, ok := fb.explicitDeps[dep]; !ok {
+		fb.explicitDeps[dep] = false
+	}
+	return fb
+}
+
+// AddPublicDependency adds the given file as an explicit public import. This
+// is like AddDependency except that the import will be public, which means that
+// the elements in the given file are also visible to any other file that
+// imports this one.
+func (fb *FileBuilder) AddPublicDependency(dep *FileBuilder) *FileBuilder {
+	if fb.explicitDeps == nil {
+		fb.explicitDeps = map[*FileBuilder]bool{}
 	}
-	fb.explicitDeps[dep] = struct{}{}
+	fb.explicitDeps[dep] = true
 	return fb
 }
 
@@ -663,12 +703,49 @@ func (fb *FileBuilder) AddDependency(dep *FileBuilder) *FileBuilder {
 // an ExtensionRegistry, when building the file.
 func (fb *FileBuilder) AddImportedDependency(dep protoreflect.FileDescriptor) *FileBuilder {
 	if fb.explicitImports == nil {
-		fb.explicitImports = map[protoreflect.FileDescriptor]struct{}{}
+		fb.explicitImports = map[protoreflect.FileDescriptor]bool{}
+	}
+	if _, ok := fb.explicitImports[dep]; !ok {
+		fb.explicitImports[dep] = false
 	}
-	fb.explicitImports[dep] = struct{}{}
 	return fb
 }
 
+// AddPublicImportedDependency adds the given file as an explicit public import.
+// This is like AddImportedDependency except that the import will be public,
+// which means that the elements in the given file are also visible to any other
+// file that imports this one.
+func (fb *FileBuilder) AddPublicImportedDependency(dep protoreflect.FileDescriptor) *FileBuilder {
+	if fb.explicitImports == nil {
+		fb.explicitImports = map[protoreflect.FileDescriptor]bool{}
+	}
+	fb.explicitImports[dep] = true
+	return fb
+}
+
+// Imports returns the imports that this file will have when it is built. This
+// includes explicit dependencies as well as dependencies that are inferred from
+// the elements that are referenced in the file. The imports are returned in the
+// same order in which they will appear in the built file: sorted by path, with
+// no duplicates.
+//
+// Computing the imports requires building the file, so this returns an error
+// if the file cannot be built. The file is built with a zero-value
+// BuilderOptions, so dependencies that would only be inferred from custom
+// options known to a BuilderOptions.Resolver are not included.
+func (fb *FileBuilder) Imports() ([]protoreflect.FileImport, error) {
+	fd, err := fb.Build()
+	if err != nil {
+		return nil, err
+	}
+	imps := fd.Imports()
+	results := make([]protoreflect.FileImport, imps.Len())
+	for i := range results {
+		results[i] = imps.Get(i)
+	}
+	return results, nil
+}
+
 // PruneUnusedDependencies removes all imports that are not actually used in the
 // file. Note that this undoes any calls to AddDependency or AddImportedDependency
 // which means that custom options may be missing from the resulting built
@@ -697,6 +774,25 @@ func (fb *FileBuilder) SetOptions(options *descriptorpb.FileOptions) *FileBuilde
 	return fb
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this file's options. If an error prevents the option from being
+// set, this method panics. This returns the file builder, for method chaining.
+func (fb *FileBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *FileBuilder {
+	if err := fb.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return fb
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this file's options, returning any error that prevents the
+// option from being set (such as the extension not extending the file's
+// options message or the value having the wrong type). If the file's options
+// are nil, they are first initialized to an empty options message.
+func (fb *FileBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&fb.Options, ext, val)
+}
+
 // SetPackageName sets the name of the package for this file and returns the
 // file, for method chaining.
 func (fb *FileBuilder) SetPackageName(pkg protoreflect.FullName) *FileBuilder {
@@ -720,7 +816,7 @@ func (fb *FileBuilder) SetEdition(edition descriptorpb.Edition) *FileBuilder {
 	return fb
 }
 
-func (fb *FileBuilder) buildProto(deps []protoreflect.FileDescriptor) (*descriptorpb.FileDescriptorProto, error) {
+func (fb *FileBuilder) buildProto(deps []protoreflect.FileDescriptor, publicDeps map[string]struct{}) (*descriptorpb.FileDescriptorProto, error) {
 	filePath := fb.path
 	if filePath == "" {
 		filePath = uniqueFilePath()
@@ -776,6 +872,12 @@ func (fb *FileBuilder) buildProto(deps []protoreflect.FileDescriptor) (*descript
 		imports = append(imports, dep.Path())
 	}
 	sort.Strings(imports)
+	var publicImports []int32
+	for i, imp := range imports {
+		if _, ok := publicDeps[imp]; ok {
+			publicImports = append(publicImports, int32(i))
+		}
+	}
 
 	messages := make([]*descriptorpb.DescriptorProto, 0, len(fb.messages))
 	for _, mb := range fb.messages {
@@ -817,19 +919,24 @@ func (fb *FileBuilder) buildProto(deps []protoreflect.FileDescriptor) (*descript
 		services = append(services, sd)
 	}
 
-	return &descriptorpb.FileDescriptorProto{
-		Name:           proto.String(filePath),
-		Package:        pkg,
-		Dependency:     imports,
-		Options:        fb.Options,
-		Syntax:         syntax,
-		Edition:        edition,
-		MessageType:    messages,
-		EnumType:       enums,
-		Extension:      extensions,
-		Service:        services,
-		SourceCodeInfo: &sourceInfo,
-	}, nil
+	fileProto := &descriptorpb.FileDescriptorProto{
+		Name:             proto.String(filePath),
+		Package:          pkg,
+		Dependency:       imports,
+		PublicDependency: publicImports,
+		Options:          fb.Options,
+		Syntax:           syntax,
+		Edition:          edition,
+		MessageType:      messages,
+		EnumType:         enums,
+		Extension:        extensions,
+		Service:          services,
+		SourceCodeInfo:   &sourceInfo,
+	}
+	if err := validateFeatures(fileProto); err != nil {
+		return nil, err
+	}
+	return fileProto, nil
 }
 
 func isExtendeeMessageSet(flb *FieldBuilder) bool {
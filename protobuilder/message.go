@@ -25,6 +25,26 @@ type ExtensionRange struct {
 	Options *descriptorpb.ExtensionRangeOptions
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this range's options. If an error prevents the option from being
+// set, this method panics. This returns the extension range, for method
+// chaining.
+func (r *ExtensionRange) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *ExtensionRange {
+	if err := r.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this range's options, returning any error that prevents the
+// option from being set (such as the extension not extending the range's
+// options message or the value having the wrong type). If the range's options
+// are nil, they are first initialized to an empty options message.
+func (r *ExtensionRange) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&r.Options, ext, val)
+}
+
 // MessageBuilder is a builder used to construct a protoreflect.MessageDescriptor. A
 // message builder can define nested messages, enums, and extensions in addition
 // to defining the message's fields.
@@ -693,6 +713,58 @@ func (mb *MessageBuilder) SetOptions(options *descriptorpb.MessageOptions) *Mess
 	return mb
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this message's options. If an error prevents the option from being
+// set, this method panics. This returns the message builder, for method chaining.
+func (mb *MessageBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *MessageBuilder {
+	if err := mb.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return mb
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this message's options, returning any error that prevents the
+// option from being set (such as the extension not extending the message's
+// options message or the value having the wrong type). If the message's options
+// are nil, they are first initialized to an empty options message.
+func (mb *MessageBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&mb.Options, ext, val)
+}
+
+// SetMessageSetWireFormat sets whether this message uses the message set wire
+// format and returns the message, for method chaining. This updates the
+// message_set_wire_format field of the message's options.
+//
+// Messages that use the message set wire format are not allowed to have any
+// normal fields; they may only have extension ranges. Furthermore, all
+// extensions of such a message must be optional fields whose type is a
+// message. These rules are validated when the descriptor is built.
+//
+// The message set wire format is a legacy feature. The protobuf runtime only
+// supports creating descriptors for such messages when it is built with the
+// "protolegacy" build tag. Without it, building a file that contains a message
+// set fails.
+func (mb *MessageBuilder) SetMessageSetWireFormat(messageSet bool) *MessageBuilder {
+	if mb.Options.GetMessageSetWireFormat() == messageSet {
+		return mb
+	}
+	opts := cloneOptions(mb.Options)
+	if messageSet {
+		opts.MessageSetWireFormat = proto.Bool(true)
+	} else {
+		opts.MessageSetWireFormat = nil
+	}
+	mb.Options = opts
+	return mb
+}
+
+// IsMessageSetWireFormat returns true if this message uses the message set
+// wire format.
+func (mb *MessageBuilder) IsMessageSetWireFormat() bool {
+	return mb.Options.GetMessageSetWireFormat()
+}
+
 // AddExtensionRange adds the given extension range to this message. The range
 // is inclusive of the start but exclusive of the end. This returns the message,
 // for method chaining.
@@ -752,6 +824,10 @@ func (mb *MessageBuilder) SetReservedNames(names []protoreflect.Name) *MessageBu
 func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.DescriptorProto, error) {
 	addCommentsTo(sourceInfo, path, &mb.comments)
 
+	if err := mb.validateMessageSet(); err != nil {
+		return nil, err
+	}
+
 	var needTagsAssigned []*descriptorpb.FieldDescriptorProto
 	nestedMessages := make([]*descriptorpb.DescriptorProto, 0, len(mb.nestedMessages))
 	oneofCount := 0
@@ -905,6 +981,29 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 	return md, nil
 }
 
+func (mb *MessageBuilder) validateMessageSet() error {
+	if problem := mb.messageSetProblem(); problem != "" {
+		return fmt.Errorf("message %s: %s", FullName(mb), problem)
+	}
+	return nil
+}
+
+func (mb *MessageBuilder) messageSetProblem() string {
+	if !mb.IsMessageSetWireFormat() {
+		return ""
+	}
+	if mb.ParentFile().Syntax == protoreflect.Proto3 {
+		return "messages with proto3 syntax cannot use message set wire format"
+	}
+	if len(mb.fieldsAndOneofs) > 0 {
+		return "messages with message set wire format cannot contain non-extension fields"
+	}
+	if len(mb.ExtensionRanges) == 0 {
+		return "messages with message set wire format must contain at least one extension range"
+	}
+	return ""
+}
+
 // Build constructs a message descriptor based on the contents of this message
 // builder. If there are any problems constructing the descriptor, including
 // resolving symbols referenced by the builder or failing to meet certain
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 
 	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
@@ -41,36 +42,81 @@ func (d *dependencies) add(fd protoreflect.FileDescriptor) {
 // resolves all dependencies (references to builders in other trees as well as
 // references to other already-built descriptors). The result of resolution is a
 // file descriptor (or an error).
+//
+// The state of resolution can be shared by multiple resolvers, each used by a
+// different goroutine, so that files can be built concurrently. (See
+// BuilderOptions.BuildAll.)
 type dependencyResolver struct {
-	registry      protoresolve.Registry
-	resolvedRoots map[Builder]protoreflect.FileDescriptor
-	seen          map[Builder]struct{}
-	opts          BuilderOptions
+	*resolverState
+	task *resolverTask
+}
+
+// resolverState is the state of resolution, which may be shared by multiple
+// resolvers.
+type resolverState struct {
+	registry protoresolve.Registry
+	opts     BuilderOptions
+
+	// mu guards roots and the waitingFor field of all tasks. It also
+	// serializes registering dependencies in registry.
+	mu    sync.Mutex
+	roots map[Builder]*resolution
+}
+
+// resolverTask represents a single goroutine that is resolving roots.
+type resolverTask struct {
+	// if non-nil, the resolution, being done by another task, that this
+	// task is waiting on
+	waitingFor *resolution
+}
+
+// resolution is the result of resolving a root builder.
+type resolution struct {
+	// the task that is resolving the root
+	task *resolverTask
+	// closed when resolution is complete
+	done chan struct{}
+	fd   protoreflect.FileDescriptor
+	err  error
 }
 
 func newResolver(opts BuilderOptions) *dependencyResolver {
-	return &dependencyResolver{
-		resolvedRoots: map[Builder]protoreflect.FileDescriptor{},
-		seen:          map[Builder]struct{}{},
-		opts:          opts,
+	return newResolverState(opts).newResolver()
+}
+
+func newResolverState(opts BuilderOptions) *resolverState {
+	return &resolverState{
+		roots: map[Builder]*resolution{},
+		opts:  opts,
 	}
 }
 
+func (s *resolverState) newResolver() *dependencyResolver {
+	return &dependencyResolver{resolverState: s, task: &resolverTask{}}
+}
+
 func (r *dependencyResolver) resolveElement(b Builder, seen []Builder) (protoreflect.FileDescriptor, error) {
 	b = getRoot(b)
 
-	if fd, ok := r.resolvedRoots[b]; ok {
-		return fd, nil
+	r.mu.Lock()
+	res := r.roots[b]
+	if res != nil && res.task != r.task {
+		// another task is resolving, or has resolved, this root
+		return r.awaitLocked(res, b, seen)
+	}
+	if res != nil && isDone(res) {
+		r.mu.Unlock()
+		return res.fd, res.err
+	}
+	if res == nil {
+		res = &resolution{task: r.task, done: make(chan struct{})}
+		r.roots[b] = res
 	}
+	r.mu.Unlock()
 
 	for _, s := range seen {
 		if s == b {
-			names := make([]string, len(seen)+1)
-			for i, s := range seen {
-				names[i] = string(s.Name())
-			}
-			names[len(seen)] = string(b.Name())
-			return nil, fmt.Errorf("descriptors have cyclic dependency: %s", strings.Join(names, " ->  "))
+			return nil, cycleError(seen, b)
 		}
 	}
 	seen = append(seen, b)
@@ -83,20 +129,64 @@ func (r *dependencyResolver) resolveElement(b Builder, seen []Builder) (protoref
 	default:
 		fd, err = r.resolveSyntheticFile(b, seen)
 	}
-	if err != nil {
-		return nil, err
+
+	r.mu.Lock()
+	res.fd, res.err = fd, err
+	close(res.done)
+	r.mu.Unlock()
+	return fd, err
+}
+
+// awaitLocked waits for the given resolution, which is being done by another
+// task, to complete. It must be called while r.mu is held, and it releases it.
+func (r *dependencyResolver) awaitLocked(res *resolution, b Builder, seen []Builder) (protoreflect.FileDescriptor, error) {
+	if !isDone(res) {
+		// if the other task is (transitively) waiting on this one, waiting would deadlock
+		for t := res.task; t.waitingFor != nil; t = t.waitingFor.task {
+			if t.waitingFor.task == r.task {
+				r.mu.Unlock()
+				return nil, cycleError(seen, b)
+			}
+		}
+		r.task.waitingFor = res
+		r.mu.Unlock()
+		<-res.done
+		r.mu.Lock()
+		r.task.waitingFor = nil
+	}
+	r.mu.Unlock()
+	return res.fd, res.err
+}
+
+func isDone(res *resolution) bool {
+	select {
+	case <-res.done:
+		return true
+	default:
+		return false
 	}
-	r.resolvedRoots[b] = fd
-	return fd, nil
+}
+
+func cycleError(seen []Builder, b Builder) error {
+	names := make([]string, len(seen)+1)
+	for i, s := range seen {
+		names[i] = string(s.Name())
+	}
+	names[len(seen)] = string(b.Name())
+	return fmt.Errorf("descriptors have cyclic dependency: %s", strings.Join(names, " ->  "))
 }
 
 func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []Builder) (protoreflect.FileDescriptor, error) {
 	deps := newDependencies()
+	publicDeps := map[string]struct{}{}
 	// add explicit imports first
-	for fd := range fb.explicitImports {
+	for fd, public := range fb.explicitImports {
 		deps.add(fd)
+		if public {
+			publicDeps[fd.Path()] = struct{}{}
+		}
 	}
-	for dep := range fb.explicitDeps {
+	for dep, public := range fb.explicitDeps {
 		if dep == fb {
 			// ignore erroneous self references
 			continue
@@ -106,6 +196,9 @@ func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []B
 			return nil, err
 		}
 		deps.add(fd)
+		if public {
+			publicDeps[fd.Path()] = struct{}{}
+		}
 	}
 	// now accumulate implicit dependencies based on other types referenced
 	for _, mb := range fb.messages {
@@ -143,7 +236,7 @@ func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []B
 		}
 	}
 
-	fp, err := fb.buildProto(depSlice)
+	fp, err := fb.buildProto(depSlice, publicDeps)
 	if err != nil {
 		return nil, err
 	}
@@ -158,19 +251,28 @@ func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []B
 		fp.Name = proto.String(unique)
 	}
 
-	for _, dep := range depSlice {
+	if err := r.registerDependencies(depSlice); err != nil {
+		return nil, err
+	}
+	return r.registry.RegisterFileProto(fp)
+}
+
+func (r *dependencyResolver) registerDependencies(deps []protoreflect.FileDescriptor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, dep := range deps {
 		isDuplicate, err := isDuplicateDependency(dep, &r.registry)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if isDuplicate {
 			continue
 		}
 		if err := r.registry.RegisterFile(dep); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return r.registry.RegisterFileProto(fp)
+	return nil
 }
 
 type filesByPath map[string]protoreflect.FileDescriptor
@@ -231,6 +333,17 @@ func addFileNames(fd protoreflect.FileDescriptor, files map[string]struct{}) {
 }
 
 func (r *dependencyResolver) resolveSyntheticFile(b Builder, seen []Builder) (protoreflect.FileDescriptor, error) {
+	f, detach := attachToSyntheticFile(b)
+	// don't forget to reset when done
+	defer detach()
+
+	return r.resolveFile(f, b, seen)
+}
+
+// attachToSyntheticFile temporarily attaches the given builder, which must be
+// the root of a builder hierarchy, to a new file, so that it can be resolved
+// into a descriptor. The returned function detaches it.
+func attachToSyntheticFile(b Builder) (*FileBuilder, func()) {
 	// find ancestor to temporarily attach to new file
 	curr := b
 	for curr.Parent() != nil {
@@ -265,13 +378,9 @@ func (r *dependencyResolver) resolveSyntheticFile(b Builder, seen []Builder) (pr
 		panic(fmt.Sprintf("Unrecognized kind of builder: %T", b))
 	}
 	curr.setParent(f)
-
-	// don't forget to reset when done
-	defer func() {
+	return f, func() {
 		curr.setParent(nil)
-	}()
-
-	return r.resolveFile(f, b, seen)
+	}
 }
 
 func (r *dependencyResolver) resolveTypesInMessage(root Builder, seen []Builder, deps *dependencies, mb *MessageBuilder) error {
@@ -459,12 +568,21 @@ func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts protor
 	if rv := reflect.ValueOf(opts); rv.Kind() == reflect.Ptr && rv.IsNil() {
 		return nil
 	}
+	return r.resolveTypesInOptionsMessage(root, fileExts, deps, opts.ProtoReflect(), false)
+}
 
-	ref := opts.ProtoReflect()
+// resolveTypesInOptionsMessage adds dependencies for the extensions used in
+// the given options message. Extensions can also be present in message values
+// nested inside of options, such as language-specific features in a
+// FeatureSet, so this recursively examines all message values. For such
+// nested values, unrecognized fields are only considered to be extensions if
+// they are in one of the message's extension ranges.
+func (r *dependencyResolver) resolveTypesInOptionsMessage(root Builder, fileExts protoresolve.ExtensionTypeResolver, deps *dependencies, ref protoreflect.Message, nested bool) error {
 	tags := map[protoreflect.FieldNumber]protoreflect.ExtensionType{}
-	proto.RangeExtensions(opts, func(xt protoreflect.ExtensionType, _ interface{}) bool {
-		num := xt.TypeDescriptor().Number()
-		tags[num] = xt
+	ref.Range(func(fld protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if xtd, ok := fld.(protoreflect.ExtensionTypeDescriptor); ok {
+			tags[fld.Number()] = xtd.Type()
+		}
 		return true
 	})
 
@@ -477,7 +595,7 @@ func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts protor
 		unk = unk[n:]
 
 		num, t := protowire.DecodeTag(v)
-		if _, ok := tags[num]; !ok {
+		if _, ok := tags[num]; !ok && (!nested || ref.Descriptor().ExtensionRanges().Has(num)) {
 			tags[num] = nil
 		}
 
@@ -501,7 +619,7 @@ func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts protor
 		unk = unk[n:]
 	}
 
-	msgName := proto.MessageName(opts)
+	msgName := ref.Descriptor().FullName()
 	for tag, xt := range tags {
 		// see if known dependencies have this option
 		if _, err := deps.res.FindExtensionByNumber(msgName, tag); err == nil {
@@ -542,7 +660,30 @@ func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts protor
 			return fmt.Errorf("could not interpret custom option for %s, tag %d", msgName, tag)
 		}
 	}
-	return nil
+
+	var err error
+	ref.Range(func(fld protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		switch {
+		case fld.IsMap():
+			if fld.MapValue().Message() == nil {
+				return true
+			}
+			val.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				err = r.resolveTypesInOptionsMessage(root, fileExts, deps, v.Message(), true)
+				return err == nil
+			})
+		case fld.Message() == nil:
+		case fld.IsList():
+			list := val.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = r.resolveTypesInOptionsMessage(root, fileExts, deps, list.Get(i).Message(), true)
+			}
+		default:
+			err = r.resolveTypesInOptionsMessage(root, fileExts, deps, val.Message(), true)
+		}
+		return err == nil
+	})
+	return err
 }
 
 func findExtension(b Builder, messageName protoreflect.FullName, extTag protoreflect.FieldNumber) bool {
@@ -582,3 +723,87 @@ func findExtensionInMessage(mb *MessageBuilder, messageName protoreflect.FullNam
 	}
 	return false
 }
+
+// attachSyntheticFiles finds all root builders that are referenced, directly
+// or transitively, by the given files and that are not file builders. Each
+// such root is attached to a synthetic file, as if by attachToSyntheticFile.
+// The returned function detaches all of them.
+//
+// This allows files to be resolved concurrently, since resolving an element
+// that is not in a file otherwise modifies the element's hierarchy.
+func attachSyntheticFiles(files []*FileBuilder) func() {
+	var detachFns []func()
+	visited := map[*FileBuilder]struct{}{}
+	var visitFile func(fb *FileBuilder)
+	visitRef := func(b Builder) {
+		root := getRoot(b)
+		fb, ok := root.(*FileBuilder)
+		if !ok {
+			var detach func()
+			fb, detach = attachToSyntheticFile(root)
+			detachFns = append(detachFns, detach)
+		}
+		visitFile(fb)
+	}
+	visitField := func(flb *FieldBuilder) {
+		if flb.fieldType.localMsgType != nil {
+			visitRef(flb.fieldType.localMsgType)
+		}
+		if flb.fieldType.localEnumType != nil {
+			visitRef(flb.fieldType.localEnumType)
+		}
+		if flb.localExtendee != nil {
+			visitRef(flb.localExtendee)
+		}
+	}
+	var visitMessage func(mb *MessageBuilder)
+	visitMessage = func(mb *MessageBuilder) {
+		for _, b := range mb.fieldsAndOneofs {
+			if flb, ok := b.(*FieldBuilder); ok {
+				visitField(flb)
+			} else {
+				for _, flb := range b.(*OneofBuilder).choices {
+					visitField(flb)
+				}
+			}
+		}
+		for _, nmb := range mb.nestedMessages {
+			visitMessage(nmb)
+		}
+		for _, exb := range mb.nestedExtensions {
+			visitField(exb)
+		}
+	}
+	visitFile = func(fb *FileBuilder) {
+		if _, ok := visited[fb]; ok {
+			return
+		}
+		visited[fb] = struct{}{}
+		for dep := range fb.explicitDeps {
+			visitFile(dep)
+		}
+		for _, mb := range fb.messages {
+			visitMessage(mb)
+		}
+		for _, exb := range fb.extensions {
+			visitField(exb)
+		}
+		for _, sb := range fb.services {
+			for _, mtb := range sb.methods {
+				for _, t := range []*RpcType{mtb.ReqType, mtb.RespType} {
+					if t.localType != nil {
+						visitRef(t.localType)
+					}
+				}
+			}
+		}
+	}
+	for _, fb := range files {
+		visitFile(fb)
+	}
+	return func() {
+		for _, detach := range detachFns {
+			detach()
+		}
+	}
+}
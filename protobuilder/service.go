@@ -203,6 +203,25 @@ func (sb *ServiceBuilder) SetOptions(options *descriptorpb.ServiceOptions) *Serv
 	return sb
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this service's options. If an error prevents the option from being
+// set, this method panics. This returns the service builder, for method chaining.
+func (sb *ServiceBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *ServiceBuilder {
+	if err := sb.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return sb
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this service's options, returning any error that prevents the
+// option from being set (such as the extension not extending the service's
+// options message or the value having the wrong type). If the service's options
+// are nil, they are first initialized to an empty options message.
+func (sb *ServiceBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&sb.Options, ext, val)
+}
+
 func (sb *ServiceBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.ServiceDescriptorProto, error) {
 	addCommentsTo(sourceInfo, path, &sb.comments)
 
@@ -355,6 +374,25 @@ func (mtb *MethodBuilder) SetOptions(options *descriptorpb.MethodOptions) *Metho
 	return mtb
 }
 
+// SetOption sets the custom option defined by the given extension to the given
+// value in this method's options. If an error prevents the option from being
+// set, this method panics. This returns the method builder, for method chaining.
+func (mtb *MethodBuilder) SetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) *MethodBuilder {
+	if err := mtb.TrySetOption(ext, val); err != nil {
+		panic(err)
+	}
+	return mtb
+}
+
+// TrySetOption sets the custom option defined by the given extension to the
+// given value in this method's options, returning any error that prevents the
+// option from being set (such as the extension not extending the method's
+// options message or the value having the wrong type). If the method's options
+// are nil, they are first initialized to an empty options message.
+func (mtb *MethodBuilder) TrySetOption(ext protoreflect.ExtensionDescriptor, val protoreflect.Value) error {
+	return setOption(&mtb.Options, ext, val)
+}
+
 // SetRequestType changes the request type for the method and then returns the
 // method builder, for method chaining.
 func (mtb *MethodBuilder) SetRequestType(t *RpcType) *MethodBuilder {
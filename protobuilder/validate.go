@@ -0,0 +1,252 @@
+package protobuilder
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protoreflect/v2/internal"
+)
+
+// ValidationError describes a single problem found by FileBuilder.Validate.
+type ValidationError struct {
+	// Element is the builder for the element that has the problem.
+	Element Builder
+	// Message describes the problem.
+	Message string
+}
+
+// Error implements the error interface.
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", FullName(e.Element), e.Message)
+}
+
+// Validate checks the contents of this file builder for problems that would
+// cause Build to fail, like conflicts between field numbers and reserved or
+// extension ranges, reserved names that are used, conflicting JSON names, and
+// proto3 enums whose first value is not zero. Unlike Build, which stops at the
+// first problem, Validate reports all problems found, in the order in which
+// the elements are declared. If the returned slice is empty, no problems were
+// found.
+//
+// Validate does not resolve references to other elements, such as the types
+// of fields or the extendees of extensions declared in other files. So Build
+// may still fail even if no problems are reported. Fields and enum values
+// whose numbers will be auto-assigned are not checked for number conflicts.
+func (fb *FileBuilder) Validate() []ValidationError {
+	v := validator{isProto3: fb.Syntax == protoreflect.Proto3}
+	for _, ch := range fb.Children() {
+		v.validate(ch)
+	}
+	return v.errs
+}
+
+type validator struct {
+	isProto3 bool
+	errs     []ValidationError
+}
+
+func (v *validator) addError(b Builder, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Element: b, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(b Builder) {
+	switch b := b.(type) {
+	case *MessageBuilder:
+		v.validateMessage(b)
+	case *FieldBuilder:
+		v.validateField(b)
+	case *EnumBuilder:
+		v.validateEnum(b)
+	}
+	for _, ch := range b.Children() {
+		v.validate(ch)
+	}
+}
+
+func (v *validator) validateMessage(mb *MessageBuilder) {
+	if problem := mb.messageSetProblem(); problem != "" {
+		v.addError(mb, "%s", problem)
+	}
+	if v.isProto3 && len(mb.ExtensionRanges) > 0 {
+		v.addError(mb, "extension ranges are not allowed in proto3")
+	}
+
+	maxTag := internal.GetMaxTag(mb.IsMessageSetWireFormat())
+	type namedRange struct {
+		kind  string
+		start protoreflect.FieldNumber
+		end   protoreflect.FieldNumber // exclusive
+	}
+	ranges := make([]namedRange, 0, len(mb.ExtensionRanges)+len(mb.ReservedRanges))
+	checkRange := func(kind string, rng FieldRange) {
+		if rng[0] < 1 || rng[0] > maxTag {
+			v.addError(mb, "%s range %d to %d: start must be between 1 and %d", kind, rng[0], rng[1]-1, maxTag)
+			return
+		}
+		if rng[1] <= rng[0] || rng[1] > maxTag+1 {
+			v.addError(mb, "%s range %d to %d: end must be between start and %d", kind, rng[0], rng[1]-1, maxTag)
+			return
+		}
+		ranges = append(ranges, namedRange{kind: kind, start: rng[0], end: rng[1]})
+	}
+	for _, rng := range mb.ExtensionRanges {
+		checkRange("extension", rng.FieldRange)
+	}
+	for _, rng := range mb.ReservedRanges {
+		checkRange("reserved", rng)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	for i := 1; i < len(ranges); i++ {
+		prev, cur := ranges[i-1], ranges[i]
+		if cur.start < prev.end {
+			v.addError(mb, "%s range %d to %d overlaps %s range %d to %d",
+				cur.kind, cur.start, cur.end-1, prev.kind, prev.start, prev.end-1)
+		}
+	}
+
+	reservedNames := make(map[protoreflect.Name]struct{}, len(mb.ReservedNames))
+	for _, name := range mb.ReservedNames {
+		reservedNames[name] = struct{}{}
+	}
+	type jsonNameSource struct {
+		field  *FieldBuilder
+		custom bool
+	}
+	jsonNames := map[string]jsonNameSource{}
+	checkField := func(flb *FieldBuilder) {
+		if _, ok := reservedNames[flb.Name()]; ok {
+			v.addError(flb, "field name %q is reserved", flb.Name())
+		}
+		if tag := flb.number; tag != 0 {
+			if tag > maxTag {
+				v.addError(flb, "tag %d is above max %d", tag, maxTag)
+			}
+			for _, rng := range ranges {
+				if tag >= rng.start && tag < rng.end {
+					v.addError(flb, "tag %d is in %s range %d to %d", tag, rng.kind, rng.start, rng.end-1)
+				}
+			}
+		}
+
+		jsonName, custom := flb.JsonName, flb.JsonName != ""
+		if !custom {
+			jsonName = internal.JsonName(flb.Name())
+		}
+		if existing, ok := jsonNames[jsonName]; ok {
+			// Like protoc, default JSON names only need to be unique in proto3.
+			if v.isProto3 || custom || existing.custom {
+				v.addError(flb, "JSON name %q conflicts with JSON name of field %s", jsonName, existing.field.Name())
+			}
+			return
+		}
+		jsonNames[jsonName] = jsonNameSource{field: flb, custom: custom}
+	}
+	for _, b := range mb.fieldsAndOneofs {
+		switch b := b.(type) {
+		case *FieldBuilder:
+			checkField(b)
+		case *OneofBuilder:
+			for _, flb := range b.choices {
+				checkField(flb)
+			}
+		}
+	}
+}
+
+func (v *validator) validateField(flb *FieldBuilder) {
+	if v.isProto3 {
+		if flb.Cardinality == protoreflect.Required {
+			v.addError(flb, "required fields are not allowed in proto3")
+		}
+		if flb.Default != "" {
+			v.addError(flb, "default values are not allowed in proto3")
+		}
+	}
+	if !flb.IsExtension() {
+		return
+	}
+	tag := flb.number
+	var inRange bool
+	var extendee protoreflect.FullName
+	if flb.localExtendee != nil {
+		extendee = FullName(flb.localExtendee)
+		for _, rng := range flb.localExtendee.ExtensionRanges {
+			if tag >= rng.FieldRange[0] && tag < rng.FieldRange[1] {
+				inRange = true
+				break
+			}
+		}
+	} else if flb.foreignExtendee != nil {
+		extendee = flb.foreignExtendee.FullName()
+		inRange = flb.foreignExtendee.ExtensionRanges().Has(tag)
+	}
+	if extendee != "" && !inRange {
+		v.addError(flb, "tag %d is not in an extension range of %s", tag, extendee)
+	}
+}
+
+func (v *validator) validateEnum(eb *EnumBuilder) {
+	if v.isProto3 && len(eb.values) > 0 {
+		// Values whose numbers are not set are assigned the lowest unused
+		// number, starting at zero.
+		first := eb.values[0]
+		if (first.numberSet && first.number != 0) || (!first.numberSet && eb.hasExplicitValue(0)) {
+			v.addError(eb, "first value in a proto3 enum must be zero")
+		}
+	}
+
+	for _, rng := range eb.ReservedRanges {
+		if rng[1] < rng[0] {
+			v.addError(eb, "reserved range %d to %d: end must not be less than start", rng[0], rng[1])
+		}
+	}
+	ranges := append([]EnumRange(nil), eb.ReservedRanges...)
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i][0] <= ranges[i-1][1] {
+			v.addError(eb, "reserved range %d to %d overlaps reserved range %d to %d",
+				ranges[i][0], ranges[i][1], ranges[i-1][0], ranges[i-1][1])
+		}
+	}
+
+	reservedNames := make(map[protoreflect.Name]struct{}, len(eb.ReservedNames))
+	for _, name := range eb.ReservedNames {
+		reservedNames[name] = struct{}{}
+	}
+	numbers := map[protoreflect.EnumNumber]*EnumValueBuilder{}
+	for _, evb := range eb.values {
+		if _, ok := reservedNames[evb.Name()]; ok {
+			v.addError(evb, "value name %q is reserved", evb.Name())
+		}
+		if !evb.numberSet {
+			continue
+		}
+		for _, rng := range eb.ReservedRanges {
+			if evb.number >= rng[0] && evb.number <= rng[1] {
+				v.addError(evb, "number %d is in reserved range %d to %d", evb.number, rng[0], rng[1])
+			}
+		}
+		if existing, ok := numbers[evb.number]; ok {
+			if !eb.Options.GetAllowAlias() {
+				v.addError(evb, "number %d is already used by value %s; set allow_alias to permit aliases", evb.number, existing.Name())
+			}
+			continue
+		}
+		numbers[evb.number] = evb
+	}
+}
+
+func (eb *EnumBuilder) hasExplicitValue(num protoreflect.EnumNumber) bool {
+	for _, evb := range eb.values {
+		if evb.numberSet && evb.number == num {
+			return true
+		}
+	}
+	return false
+}
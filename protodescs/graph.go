@@ -0,0 +1,167 @@
+package protodescs
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/internal/importusage"
+	"github.com/jhump/protoreflect/v2/internal/register"
+)
+
+// DependencyGraph describes the import relationships among a set of files.
+// It can be used to order files so that each file's dependencies come
+// before it and to query which files depend on which others.
+type DependencyGraph struct {
+	// in topological order
+	files      []protoreflect.FileDescriptor
+	byPath     map[string]protoreflect.FileDescriptor
+	dependents map[string][]protoreflect.FileDescriptor
+}
+
+// NewDependencyGraph computes the dependency graph for the given files. The
+// graph includes the given files and all of their transitive dependencies.
+// It returns an error if the files include more than one file with the same
+// path. (The same descriptor may be given more than once.)
+func NewDependencyGraph(files ...protoreflect.FileDescriptor) (*DependencyGraph, error) {
+	g := &DependencyGraph{
+		byPath:     map[string]protoreflect.FileDescriptor{},
+		dependents: map[string][]protoreflect.FileDescriptor{},
+	}
+	for _, fd := range files {
+		if err := g.add(fd); err != nil {
+			return nil, err
+		}
+	}
+	for _, fd := range g.files {
+		imps := fd.Imports()
+		for i, length := 0, imps.Len(); i < length; i++ {
+			dep := imps.Get(i).Path()
+			g.dependents[dep] = append(g.dependents[dep], fd)
+		}
+	}
+	return g, nil
+}
+
+func (g *DependencyGraph) add(fd protoreflect.FileDescriptor) error {
+	if existing, ok := g.byPath[fd.Path()]; ok {
+		if existing != fd {
+			return fmt.Errorf("duplicate file %q", fd.Path())
+		}
+		return nil
+	}
+	g.byPath[fd.Path()] = fd
+	imps := fd.Imports()
+	for i, length := 0, imps.Len(); i < length; i++ {
+		if err := g.add(imps.Get(i).FileDescriptor); err != nil {
+			return err
+		}
+	}
+	g.files = append(g.files, fd)
+	return nil
+}
+
+// Files returns all files in the graph, in topological order: each file's
+// dependencies come before it. The order is deterministic: files are visited
+// in the order they were given to NewDependencyGraph, and each file's imports
+// in the order they are declared.
+func (g *DependencyGraph) Files() []protoreflect.FileDescriptor {
+	return append([]protoreflect.FileDescriptor(nil), g.files...)
+}
+
+// File returns the file in the graph with the given path, or nil if the
+// graph contains no such file.
+func (g *DependencyGraph) File(path string) protoreflect.FileDescriptor {
+	return g.byPath[path]
+}
+
+// TransitiveDependencies returns all files that the file with the given
+// path imports, directly or indirectly, in topological order. It returns
+// nil if the graph contains no such file.
+func (g *DependencyGraph) TransitiveDependencies(path string) []protoreflect.FileDescriptor {
+	fd := g.byPath[path]
+	if fd == nil {
+		return nil
+	}
+	deps := map[string]struct{}{}
+	var addDeps func(protoreflect.FileDescriptor)
+	addDeps = func(fd protoreflect.FileDescriptor) {
+		imps := fd.Imports()
+		for i, length := 0, imps.Len(); i < length; i++ {
+			dep := imps.Get(i).FileDescriptor
+			if _, ok := deps[dep.Path()]; ok {
+				continue
+			}
+			deps[dep.Path()] = struct{}{}
+			addDeps(dep)
+		}
+	}
+	addDeps(fd)
+	return g.inOrder(deps)
+}
+
+// Dependents returns the files in the graph that directly import the file
+// with the given path, in topological order.
+func (g *DependencyGraph) Dependents(path string) []protoreflect.FileDescriptor {
+	return append([]protoreflect.FileDescriptor(nil), g.dependents[path]...)
+}
+
+// TransitiveDependents returns the files in the graph that import the file
+// with the given path, directly or indirectly, in topological order. These
+// are the files that may be affected by a change to the given file.
+func (g *DependencyGraph) TransitiveDependents(path string) []protoreflect.FileDescriptor {
+	dependents := map[string]struct{}{}
+	var addDependents func(string)
+	addDependents = func(path string) {
+		for _, fd := range g.dependents[path] {
+			if _, ok := dependents[fd.Path()]; ok {
+				continue
+			}
+			dependents[fd.Path()] = struct{}{}
+			addDependents(fd.Path())
+		}
+	}
+	addDependents(path)
+	return g.inOrder(dependents)
+}
+
+func (g *DependencyGraph) inOrder(paths map[string]struct{}) []protoreflect.FileDescriptor {
+	if len(paths) == 0 {
+		return nil
+	}
+	result := make([]protoreflect.FileDescriptor, 0, len(paths))
+	for _, fd := range g.files {
+		if _, ok := paths[fd.Path()]; ok {
+			result = append(result, fd)
+		}
+	}
+	return result
+}
+
+// UnusedImports returns the imports of the given file that are not used.
+// An import is used if the file refers to an element defined in the
+// imported file, or in a file that it publicly imports. This includes
+// references to message and enum types in fields and methods, to extendees,
+// and to extensions used as custom options. Public imports are never
+// reported as unused since they make their contents visible to files that
+// import the given file.
+//
+// The returned imports are in the order they are declared in the file.
+func UnusedImports(fd protoreflect.FileDescriptor) []protoreflect.FileImport {
+	var reg protoregistry.Types
+	register.RegisterTypesVisibleToFile(fd, &reg, true)
+	usages := importusage.Compute(fd, &reg)
+	var unused []protoreflect.FileImport
+	imps := fd.Imports()
+	for i, length := 0, imps.Len(); i < length; i++ {
+		imp := imps.Get(i)
+		if imp.IsPublic {
+			continue
+		}
+		if _, ok := usages[imp.Path()]; !ok {
+			unused = append(unused, imp)
+		}
+	}
+	return unused
+}
@@ -0,0 +1,146 @@
+package protodescs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	files := makeGraphTestFiles(t)
+	g, err := NewDependencyGraph(files["d.proto"], files["b.proto"], files["d.proto"])
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"google/protobuf/descriptor.proto", "a.proto", "b.proto", "c.proto", "d.proto"}, paths(g.Files()))
+	require.Same(t, files["c.proto"], g.File("c.proto"))
+	require.Nil(t, g.File("foo.proto"))
+
+	require.Equal(t, []string{"google/protobuf/descriptor.proto", "a.proto", "b.proto"}, paths(g.TransitiveDependencies("c.proto")))
+	require.Equal(t, []string{"google/protobuf/descriptor.proto"}, paths(g.TransitiveDependencies("a.proto")))
+	require.Empty(t, g.TransitiveDependencies("google/protobuf/descriptor.proto"))
+	require.Nil(t, g.TransitiveDependencies("foo.proto"))
+
+	require.Equal(t, []string{"b.proto", "c.proto"}, paths(g.Dependents("a.proto")))
+	require.Empty(t, g.Dependents("d.proto"))
+	require.Equal(t, []string{"b.proto", "c.proto", "d.proto"}, paths(g.TransitiveDependents("a.proto")))
+	require.Equal(t, []string{"a.proto", "b.proto", "c.proto", "d.proto"}, paths(g.TransitiveDependents("google/protobuf/descriptor.proto")))
+
+	// a different file with the same path
+	otherA, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{Name: proto.String("a.proto")}, nil)
+	require.NoError(t, err)
+	_, err = NewDependencyGraph(files["d.proto"], otherA)
+	require.EqualError(t, err, `duplicate file "a.proto"`)
+}
+
+func TestUnusedImports(t *testing.T) {
+	files := makeGraphTestFiles(t)
+	// b.proto uses a.proto's message and descriptor.proto via a custom option
+	require.Empty(t, UnusedImports(files["b.proto"]))
+	// c.proto only uses b.proto
+	require.Equal(t, []string{"a.proto", "google/protobuf/descriptor.proto"}, importPaths(UnusedImports(files["c.proto"])))
+	// d.proto's only import is public
+	require.Empty(t, UnusedImports(files["d.proto"]))
+}
+
+func makeGraphTestFiles(t *testing.T) map[string]protoreflect.FileDescriptor {
+	t.Helper()
+	msgOpts := &descriptorpb.MessageOptions{}
+	// custom option a.foo = true
+	msgOpts.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 50010, protowire.VarintType), 1))
+	fileProtos := []*descriptorpb.FileDescriptorProto{
+		{
+			Name:       proto.String("a.proto"),
+			Package:    proto.String("a"),
+			Dependency: []string{"google/protobuf/descriptor.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{
+				{Name: proto.String("A")},
+			},
+			Extension: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("foo"),
+					Number:   proto.Int32(50010),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum(),
+					Extendee: proto.String(".google.protobuf.MessageOptions"),
+				},
+			},
+		},
+		{
+			Name:       proto.String("b.proto"),
+			Package:    proto.String("b"),
+			Dependency: []string{"a.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{
+				{
+					Name:    proto.String("B"),
+					Options: msgOpts,
+					Field: []*descriptorpb.FieldDescriptorProto{
+						{
+							Name:     proto.String("a"),
+							Number:   proto.Int32(1),
+							Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+							Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+							TypeName: proto.String(".a.A"),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:       proto.String("c.proto"),
+			Package:    proto.String("c"),
+			Dependency: []string{"a.proto", "b.proto", "google/protobuf/descriptor.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{
+				{
+					Name: proto.String("C"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						{
+							Name:     proto.String("b"),
+							Number:   proto.Int32(1),
+							Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+							Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+							TypeName: proto.String(".b.B"),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:             proto.String("d.proto"),
+			Package:          proto.String("d"),
+			Dependency:       []string{"c.proto"},
+			PublicDependency: []int32{0},
+		},
+	}
+	var reg protoregistry.Files
+	require.NoError(t, reg.RegisterFile(descriptorpb.File_google_protobuf_descriptor_proto))
+	files := map[string]protoreflect.FileDescriptor{}
+	for _, fileProto := range fileProtos {
+		fd, err := protodesc.NewFile(fileProto, &reg)
+		require.NoError(t, err)
+		require.NoError(t, reg.RegisterFile(fd))
+		files[fd.Path()] = fd
+	}
+	return files
+}
+
+func paths(files []protoreflect.FileDescriptor) []string {
+	result := make([]string, len(files))
+	for i, fd := range files {
+		result[i] = fd.Path()
+	}
+	return result
+}
+
+func importPaths(imps []protoreflect.FileImport) []string {
+	result := make([]string, len(imps))
+	for i, imp := range imps {
+		result[i] = imp.Path()
+	}
+	return result
+}
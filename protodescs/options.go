@@ -0,0 +1,46 @@
+package protodescs
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/internal"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// GetOption returns the value of the custom option with the given name for
+// the given descriptor. The option is identified by the fully-qualified name
+// of the extension that defines it. The returned bool is false if the option
+// is not present on the descriptor.
+//
+// The extension is resolved using the given resolver. If the resolver is nil,
+// protoregistry.GlobalTypes is used. The resolver may return dynamic extension
+// types (for example, one created using protoresolve.TypesFromDescriptorPool),
+// which allows tools to read custom options without linking in the generated
+// Go code that defines them. The returned value will be of the type indicated
+// by the resolved extension. So if the resolver returns a dynamic extension
+// type whose field is a message, the returned value will be a dynamic message.
+//
+// The option is found even if the descriptor's options were built without the
+// extension being known, in which case the option is stored in the options
+// message's unknown fields.
+//
+// An error is returned if the extension cannot be resolved or if it does not
+// extend the options message for the given kind of descriptor.
+func GetOption(d protoreflect.Descriptor, extensionName protoreflect.FullName, resolver protoresolve.ExtensionTypeResolver) (protoreflect.Value, bool, error) {
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+	xt, err := resolver.FindExtensionByName(extensionName)
+	if err != nil {
+		return protoreflect.Value{}, false, fmt.Errorf("failed to resolve extension %s: %w", extensionName, err)
+	}
+	opts := d.Options()
+	optsName := opts.ProtoReflect().Descriptor().FullName()
+	if extendee := xt.TypeDescriptor().ContainingMessage().FullName(); extendee != optsName {
+		return protoreflect.Value{}, false, fmt.Errorf("extension %s extends %s, not %s", extensionName, extendee, optsName)
+	}
+	return internal.FindOption(opts, xt)
+}
@@ -0,0 +1,84 @@
+package protodescs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+func TestGetOption(t *testing.T) {
+	msgOpts := &descriptorpb.MessageOptions{}
+	// option is not recognized, so it is stored as unknown field
+	msgOpts.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 10101, protowire.VarintType), 1))
+	fieldOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(fieldOpts, testprotos.E_Ffubar, []string{"abc", "def"})
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("foo"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:    proto.String("Foo"),
+				Options: msgOpts,
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:    proto.String("bar"),
+						Number:  proto.Int32(1),
+						Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:    descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						Options: fieldOpts,
+					},
+					{
+						Name:   proto.String("baz"),
+						Number: proto.Int32(2),
+						Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+			},
+		},
+	}, nil)
+	require.NoError(t, err)
+	md := fd.Messages().Get(0)
+
+	// dynamic extension types
+	var types protoregistry.Types
+	for _, xt := range []protoreflect.ExtensionType{testprotos.E_Mfubar, testprotos.E_Ffubar} {
+		err := types.RegisterExtension(dynamicpb.NewExtensionType(xt.TypeDescriptor().Descriptor()))
+		require.NoError(t, err)
+	}
+
+	for _, resolver := range []protoresolve.ExtensionTypeResolver{nil, &types} {
+		val, ok, err := GetOption(md, "testprotos.mfubar", resolver)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.True(t, val.Bool())
+
+		val, ok, err = GetOption(md.Fields().Get(0), "testprotos.ffubar", resolver)
+		require.NoError(t, err)
+		require.True(t, ok)
+		list := val.List()
+		require.Equal(t, 2, list.Len())
+		require.Equal(t, "abc", list.Get(0).String())
+		require.Equal(t, "def", list.Get(1).String())
+
+		_, ok, err = GetOption(md.Fields().Get(1), "testprotos.ffubar", resolver)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		_, _, err = GetOption(md, "testprotos.ffubar", resolver)
+		require.EqualError(t, err, "extension testprotos.ffubar extends google.protobuf.FieldOptions, not google.protobuf.MessageOptions")
+	}
+
+	_, _, err = GetOption(md, "foo.bar", nil)
+	require.ErrorIs(t, err, protoregistry.NotFound)
+}
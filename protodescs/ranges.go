@@ -0,0 +1,93 @@
+package protodescs
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Checking whether a particular name or number is reserved does not need any
+// helpers: use the Has method of the descriptor's ReservedNames or
+// ReservedRanges. The functions below provide views of a descriptor's ranges
+// that are not directly available from the protoreflect API.
+
+// ExtensionRange describes a range of extension numbers in a message.
+type ExtensionRange struct {
+	// The first number in the range, inclusive.
+	Start protoreflect.FieldNumber
+	// The last number in the range, exclusive.
+	End protoreflect.FieldNumber
+	// The options declared for the range. This is never nil, but it will
+	// be empty if the range has no options.
+	Options *descriptorpb.ExtensionRangeOptions
+}
+
+// ExtensionRanges returns the extension ranges of the given message, along
+// with their options. The ranges are returned in the order they are declared.
+func ExtensionRanges(md protoreflect.MessageDescriptor) []ExtensionRange {
+	ranges := md.ExtensionRanges()
+	if ranges.Len() == 0 {
+		return nil
+	}
+	results := make([]ExtensionRange, ranges.Len())
+	for i := range results {
+		rng := ranges.Get(i)
+		opts, _ := md.ExtensionRangeOptions(i).(*descriptorpb.ExtensionRangeOptions)
+		if opts == nil {
+			opts = &descriptorpb.ExtensionRangeOptions{}
+		}
+		results[i] = ExtensionRange{Start: rng[0], End: rng[1], Options: opts}
+	}
+	return results
+}
+
+// MergedReservedRanges returns the reserved ranges of the given message in a
+// normalized form: sorted by start number, with overlapping and adjacent
+// ranges merged. Like protoreflect.FieldRanges, the end of each range is
+// exclusive.
+func MergedReservedRanges(md protoreflect.MessageDescriptor) [][2]protoreflect.FieldNumber {
+	ranges := md.ReservedRanges()
+	results := make([][2]protoreflect.FieldNumber, ranges.Len())
+	for i := range results {
+		results[i] = ranges.Get(i)
+	}
+	return mergeRanges(results, 0)
+}
+
+// MergedEnumReservedRanges returns the reserved ranges of the given enum in a
+// normalized form: sorted by start number, with overlapping and adjacent
+// ranges merged. Like protoreflect.EnumRanges, the end of each range is
+// inclusive.
+func MergedEnumReservedRanges(ed protoreflect.EnumDescriptor) [][2]protoreflect.EnumNumber {
+	ranges := ed.ReservedRanges()
+	results := make([][2]protoreflect.EnumNumber, ranges.Len())
+	for i := range results {
+		results[i] = ranges.Get(i)
+	}
+	return mergeRanges(results, 1)
+}
+
+// mergeRanges sorts and merges the given ranges in place. The endAdjust is
+// one if range ends are inclusive and zero if exclusive.
+func mergeRanges[T protoreflect.FieldNumber | protoreflect.EnumNumber](ranges [][2]T, endAdjust int64) [][2]T {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+	merged := ranges[:1]
+	for _, rng := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		// use int64 so inclusive ends at max int32 don't overflow
+		if int64(rng[0]) <= int64(last[1])+endAdjust {
+			if rng[1] > last[1] {
+				last[1] = rng[1]
+			}
+			continue
+		}
+		merged = append(merged, rng)
+	}
+	return merged
+}
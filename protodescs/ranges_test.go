@@ -0,0 +1,71 @@
+package protodescs
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestRanges(t *testing.T) {
+	fileProto := &descriptorpb.FileDescriptorProto{
+		Name:   proto.String("test.proto"),
+		Syntax: proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Foo"),
+				ReservedRange: []*descriptorpb.DescriptorProto_ReservedRange{
+					{Start: proto.Int32(20), End: proto.Int32(30)},
+					{Start: proto.Int32(1), End: proto.Int32(5)},
+					{Start: proto.Int32(5), End: proto.Int32(10)},
+					{Start: proto.Int32(30), End: proto.Int32(31)},
+				},
+				ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{
+					{Start: proto.Int32(100), End: proto.Int32(200)},
+					{
+						Start:   proto.Int32(50),
+						End:     proto.Int32(60),
+						Options: &descriptorpb.ExtensionRangeOptions{Verification: descriptorpb.ExtensionRangeOptions_UNVERIFIED.Enum()},
+					},
+				},
+			},
+			{Name: proto.String("Bar")},
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{
+			{
+				Name:  proto.String("Baz"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("ZERO"), Number: proto.Int32(0)}},
+				ReservedRange: []*descriptorpb.EnumDescriptorProto_EnumReservedRange{
+					{Start: proto.Int32(100), End: proto.Int32(math.MaxInt32)},
+					{Start: proto.Int32(10), End: proto.Int32(12)},
+					{Start: proto.Int32(1), End: proto.Int32(3)},
+					{Start: proto.Int32(4), End: proto.Int32(5)},
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fileProto, nil)
+	require.NoError(t, err)
+
+	foo := fd.Messages().ByName("Foo")
+	require.Equal(t, [][2]protoreflect.FieldNumber{{1, 10}, {20, 31}}, MergedReservedRanges(foo))
+	exts := ExtensionRanges(foo)
+	require.Len(t, exts, 2)
+	require.Equal(t, protoreflect.FieldNumber(100), exts[0].Start)
+	require.Equal(t, protoreflect.FieldNumber(200), exts[0].End)
+	require.NotNil(t, exts[0].Options)
+	require.Nil(t, exts[0].Options.Verification)
+	require.Equal(t, protoreflect.FieldNumber(50), exts[1].Start)
+	require.Equal(t, descriptorpb.ExtensionRangeOptions_UNVERIFIED, exts[1].Options.GetVerification())
+
+	bar := fd.Messages().ByName("Bar")
+	require.Empty(t, MergedReservedRanges(bar))
+	require.Empty(t, ExtensionRanges(bar))
+
+	baz := fd.Enums().ByName("Baz")
+	require.Equal(t, [][2]protoreflect.EnumNumber{{1, 5}, {10, 12}, {100, math.MaxInt32}}, MergedEnumReservedRanges(baz))
+}
@@ -0,0 +1,82 @@
+package protodescs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadFileDescriptorSet reads the file at the given path and returns the
+// google.protobuf.FileDescriptorSet therein. See ReadFileDescriptorSet for
+// the supported formats.
+func LoadFileDescriptorSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	set, err := ReadFileDescriptorSet(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return set, nil
+}
+
+// ReadFileDescriptorSet reads a google.protobuf.FileDescriptorSet from the
+// given reader. This is the format produced by "protoc --descriptor_set_out"
+// and by WriteFileDescriptorSet. The data may be in the binary format or in
+// the JSON format, and it may be compressed with gzip.
+//
+// This can also read images produced by "buf build", which are compatible
+// with file descriptor sets. Buf-specific metadata in the image is ignored.
+//
+// The files in the returned set may not be in topological order. Use
+// protoresolve.FromFileDescriptorSet or protoresolve.Registry.RegisterFileProtos
+// to create descriptors from them, which do not require any particular order.
+func ReadFileDescriptorSet(r io.Reader) (*descriptorpb.FileDescriptorSet, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		r = gzr
+	} else {
+		r = br
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		// buf images in JSON format have fields not in FileDescriptorProto
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, &set); err != nil {
+			return nil, err
+		}
+		return &set, nil
+	}
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	for _, file := range set.File {
+		// remove buf's metadata, which is not part of the file descriptor
+		if unk := file.ProtoReflect().GetUnknown(); len(unk) > 0 {
+			file.ProtoReflect().SetUnknown(stripField(unk, bufImageExtensionTag))
+		}
+	}
+	return &set, nil
+}
+
+// bufImageExtensionTag is the tag number of the field that buf images use to
+// store metadata about each file.
+const bufImageExtensionTag = 8042
@@ -0,0 +1,75 @@
+package protodescs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+)
+
+func TestReadFileDescriptorSet(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteFileDescriptorSet(&buf, grpc.File_grpc_dummy_proto))
+	var expected descriptorpb.FileDescriptorSet
+	require.NoError(t, proto.Unmarshal(buf.Bytes(), &expected))
+	require.NotEmpty(t, expected.File)
+
+	var gzipped bytes.Buffer
+	gzw := gzip.NewWriter(&gzipped)
+	_, err := gzw.Write(buf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	jsonData, err := protojson.Marshal(&expected)
+	require.NoError(t, err)
+	// add a field, like those in buf images, that is not in FileDescriptorProto
+	jsonData = append([]byte(`{"bufExtension": {}, `), jsonData[1:]...)
+
+	// buf images have metadata in a field that is not in FileDescriptorProto
+	var image []byte
+	for _, file := range expected.File {
+		data, err := proto.Marshal(file)
+		require.NoError(t, err)
+		data = protowire.AppendTag(data, bufImageExtensionTag, protowire.BytesType)
+		data = protowire.AppendBytes(data, []byte{0x8, 0x1})
+		image = protowire.AppendTag(image, 1, protowire.BytesType)
+		image = protowire.AppendBytes(image, data)
+	}
+
+	testCases := map[string][]byte{
+		"binary":  buf.Bytes(),
+		"gzipped": gzipped.Bytes(),
+		"json":    jsonData,
+		"image":   image,
+	}
+	dir := t.TempDir()
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			set, err := ReadFileDescriptorSet(bytes.NewReader(data))
+			require.NoError(t, err)
+			require.Empty(t, cmp.Diff(&expected, set, protocmp.Transform()))
+
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, data, 0666))
+			set, err = LoadFileDescriptorSet(path)
+			require.NoError(t, err)
+			require.Empty(t, cmp.Diff(&expected, set, protocmp.Transform()))
+		})
+	}
+
+	_, err = LoadFileDescriptorSet(filepath.Join(dir, "does-not-exist"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = ReadFileDescriptorSet(bytes.NewReader([]byte{0xff, 0xff}))
+	require.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package protodescs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestSortFiles(t *testing.T) {
+	newFile := func(name string, deps ...string) *descriptorpb.FileDescriptorProto {
+		return &descriptorpb.FileDescriptorProto{Name: proto.String(name), Dependency: deps}
+	}
+	files := []*descriptorpb.FileDescriptorProto{
+		newFile("d.proto", "b.proto", "c.proto"),
+		newFile("c.proto", "a.proto"),
+		newFile("b.proto", "a.proto"),
+		newFile("a.proto"),
+		newFile("e.proto"),
+	}
+	require.NoError(t, SortFiles(files))
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.GetName()
+	}
+	// dependencies come first; otherwise the original order is retained
+	require.Equal(t, []string{"a.proto", "b.proto", "c.proto", "d.proto", "e.proto"}, names)
+
+	err := SortFiles([]*descriptorpb.FileDescriptorProto{newFile("a.proto"), newFile("a.proto")})
+	require.EqualError(t, err, `duplicate file "a.proto"`)
+	err = SortFiles([]*descriptorpb.FileDescriptorProto{newFile("a.proto", "b.proto")})
+	require.EqualError(t, err, `file "a.proto" imports "b.proto", but "b.proto" is not present`)
+	require.NoError(t, SortFiles(nil))
+}
@@ -0,0 +1,129 @@
+package protodescs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/internal"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// WriteFileDescriptorSet writes a serialized google.protobuf.FileDescriptorSet
+// to the given writer that contains the given files and all of their transitive
+// dependencies. This is the same as WriteOptions{}.Write(w, files...).
+func WriteFileDescriptorSet(w io.Writer, files ...protoreflect.FileDescriptor) error {
+	return WriteOptions{}.Write(w, files...)
+}
+
+// WriteOptions configures how a file descriptor set is written.
+type WriteOptions struct {
+	// If true, source code info will be omitted from all written files.
+	ExcludeSourceInfo bool
+	// If true, only the files given to Write will be written and not
+	// their transitive dependencies. The resulting set may not be
+	// self-contained.
+	ExcludeImports bool
+	// If non-nil, this is used to recover the descriptor proto for each
+	// file. Otherwise, the [protodesc] package is used to convert each
+	// file to a descriptor proto.
+	Protos protoresolve.ProtoFileOracle
+}
+
+// Write writes a serialized google.protobuf.FileDescriptorSet to the given
+// writer. Files are written in topological order, so each file's dependencies
+// are written before it. Each file is written at most once, even if it is
+// given more than once or is a dependency of multiple given files.
+//
+// The set is streamed to the writer one file at a time, so the entire set
+// never needs to be materialized in memory.
+func (o WriteOptions) Write(w io.Writer, files ...protoreflect.FileDescriptor) error {
+	bw := bufio.NewWriter(w)
+	seen := map[string]struct{}{}
+	var buf []byte
+	for _, file := range files {
+		var err error
+		buf, err = o.writeFile(bw, file, seen, buf)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (o WriteOptions) writeFile(w *bufio.Writer, file protoreflect.FileDescriptor, seen map[string]struct{}, buf []byte) ([]byte, error) {
+	if imp, ok := file.(protoreflect.FileImport); ok {
+		file = imp.FileDescriptor
+	}
+	if _, ok := seen[file.Path()]; ok {
+		return buf, nil
+	}
+	seen[file.Path()] = struct{}{}
+	if !o.ExcludeImports {
+		imports := file.Imports()
+		for i, length := 0, imports.Len(); i < length; i++ {
+			var err error
+			buf, err = o.writeFile(w, imports.Get(i).FileDescriptor, seen, buf)
+			if err != nil {
+				return buf, err
+			}
+		}
+	}
+
+	var fileProto *descriptorpb.FileDescriptorProto
+	if o.Protos != nil {
+		var err error
+		fileProto, err = o.Protos.ProtoFromFileDescriptor(file)
+		if err != nil {
+			return buf, fmt.Errorf("failed to recover descriptor proto for %q: %w", file.Path(), err)
+		}
+	} else {
+		fileProto = protodesc.ToFileDescriptorProto(file)
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.MarshalAppend(buf[:0], fileProto)
+	if err != nil {
+		return buf, fmt.Errorf("failed to marshal %q: %w", file.Path(), err)
+	}
+	if o.ExcludeSourceInfo && fileProto.SourceCodeInfo != nil {
+		data = stripField(data, internal.FileSourceCodeInfoTag)
+	}
+
+	var header []byte
+	header = protowire.AppendTag(header, internal.FileSetFilesTag, protowire.BytesType)
+	header = protowire.AppendVarint(header, uint64(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return data, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// stripField removes all occurrences of the given field from the given
+// serialized message, in place, and returns the updated slice.
+func stripField(data []byte, field protowire.Number) []byte {
+	result := data[:0]
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			// malformed; should not be possible since we just marshaled it
+			return append(result, data...)
+		}
+		m := protowire.ConsumeFieldValue(num, typ, data[n:])
+		if m < 0 {
+			return append(result, data...)
+		}
+		if num != field {
+			result = append(result, data[:n+m]...)
+		}
+		data = data[n+m:]
+	}
+	return result
+}
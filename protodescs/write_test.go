@@ -0,0 +1,76 @@
+package protodescs
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+	"github.com/jhump/protoreflect/v2/internal/testprotos/grpc"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+func TestWriteFileDescriptorSet(t *testing.T) {
+	var buf bytes.Buffer
+	// dummy.proto imports desc_test1.proto, so the latter is only written once
+	err := WriteFileDescriptorSet(&buf, grpc.File_grpc_dummy_proto, testprotos.File_desc_test1_proto)
+	require.NoError(t, err)
+	var fds descriptorpb.FileDescriptorSet
+	require.NoError(t, proto.Unmarshal(buf.Bytes(), &fds))
+	names := make([]string, len(fds.File))
+	for i, fd := range fds.File {
+		names[i] = fd.GetName()
+	}
+	require.Equal(t, []string{"desc_test1.proto", "pkg/desc_test_pkg.proto", "grpc/dummy.proto"}, names)
+	// must be self-contained
+	_, err = protodesc.NewFiles(&fds)
+	require.NoError(t, err)
+
+	buf.Reset()
+	err = WriteOptions{ExcludeImports: true}.Write(&buf, grpc.File_grpc_dummy_proto)
+	require.NoError(t, err)
+	fds.Reset()
+	require.NoError(t, proto.Unmarshal(buf.Bytes(), &fds))
+	require.Len(t, fds.File, 1)
+	require.Equal(t, "grpc/dummy.proto", fds.File[0].GetName())
+}
+
+func TestWriteFileDescriptorSet_SourceInfo(t *testing.T) {
+	data, err := os.ReadFile("../internal/testprotos/desc_test_complex_source_info.protoset")
+	require.NoError(t, err)
+	var input descriptorpb.FileDescriptorSet
+	require.NoError(t, proto.Unmarshal(data, &input))
+	reg, err := protoresolve.FromFileDescriptorSet(&input)
+	require.NoError(t, err)
+	file, err := reg.FindFileByPath(input.File[len(input.File)-1].GetName())
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = WriteOptions{Protos: reg}.Write(&buf, file)
+	require.NoError(t, err)
+	var fds descriptorpb.FileDescriptorSet
+	require.NoError(t, proto.Unmarshal(buf.Bytes(), &fds))
+	require.Len(t, fds.File, len(input.File))
+	require.NotNil(t, fds.File[len(fds.File)-1].SourceCodeInfo)
+
+	buf.Reset()
+	err = WriteOptions{Protos: reg, ExcludeSourceInfo: true}.Write(&buf, file)
+	require.NoError(t, err)
+	fds.Reset()
+	require.NoError(t, proto.Unmarshal(buf.Bytes(), &fds))
+	require.Len(t, fds.File, len(input.File))
+	for _, fd := range fds.File {
+		require.Nil(t, fd.SourceCodeInfo)
+	}
+	// original is unchanged
+	require.NotNil(t, input.File[len(input.File)-1].SourceCodeInfo)
+	// and otherwise identical
+	expected := proto.Clone(input.File[len(input.File)-1]).(*descriptorpb.FileDescriptorProto)
+	expected.SourceCodeInfo = nil
+	require.True(t, proto.Equal(expected, fds.File[len(fds.File)-1]))
+}
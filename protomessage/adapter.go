@@ -0,0 +1,180 @@
+package protomessage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// Format identifies a serialization format for messages.
+type Format int
+
+const (
+	// FormatBinary is the protobuf binary format.
+	FormatBinary = Format(iota)
+	// FormatJSON is the protobuf JSON format.
+	FormatJSON
+	// FormatText is the protobuf text format.
+	FormatText
+)
+
+// String returns a human-readable name for the format.
+func (f Format) String() string {
+	switch f {
+	case FormatBinary:
+		return "binary"
+	case FormatJSON:
+		return "JSON"
+	case FormatText:
+		return "text"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Adapter wraps a message so that it implements several common Go interfaces
+// for encoding and decoding values. This allows messages, including dynamic
+// messages, to be used directly with packages like database/sql and
+// encoding/json.
+//
+// The Format field controls the representation used for database values and
+// for text marshaling. JSON marshaling always uses the protobuf JSON format.
+type Adapter struct {
+	// The wrapped message. When unmarshaling, this message is reset and then
+	// populated with the unmarshaled data. So it must not be nil.
+	Message proto.Message
+	// The format used to serialize the message. For database values, the
+	// binary format results in a []byte value; the others result in a string
+	// value. For text marshaling, the binary format is base64-encoded.
+	Format Format
+	// The resolver used to resolve extensions and the contents of
+	// google.protobuf.Any messages. If nil, protoregistry.GlobalTypes is used.
+	Resolver protoresolve.SerializationResolver
+}
+
+var _ driver.Valuer = (*Adapter)(nil)
+var _ sql.Scanner = (*Adapter)(nil)
+var _ encoding.TextMarshaler = (*Adapter)(nil)
+var _ encoding.TextUnmarshaler = (*Adapter)(nil)
+var _ json.Marshaler = (*Adapter)(nil)
+var _ json.Unmarshaler = (*Adapter)(nil)
+
+// Adapt returns an adapter for the given message that uses the given format.
+func Adapt(msg proto.Message, format Format) *Adapter {
+	return &Adapter{Message: msg, Format: format}
+}
+
+// Value implements the driver.Valuer interface, for using the message as
+// a parameter in a database query.
+func (a *Adapter) Value() (driver.Value, error) {
+	data, err := a.marshal()
+	if err != nil {
+		return nil, err
+	}
+	if a.Format == FormatBinary {
+		return data, nil
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface, for reading the message from
+// a database result. The source must be a []byte or string value, which
+// is unmarshaled using the adapter's format. A nil source resets the message.
+func (a *Adapter) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		proto.Reset(a.Message)
+		return nil
+	case []byte:
+		return a.unmarshal(src)
+	case string:
+		return a.unmarshal([]byte(src))
+	default:
+		return fmt.Errorf("cannot scan %T into message %s", src, a.Message.ProtoReflect().Descriptor().FullName())
+	}
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. If the
+// adapter's format is FormatBinary, the result is the base64-encoding of
+// the binary format.
+func (a *Adapter) MarshalText() ([]byte, error) {
+	data, err := a.marshal()
+	if err != nil {
+		return nil, err
+	}
+	if a.Format == FormatBinary {
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+		base64.StdEncoding.Encode(encoded, data)
+		return encoded, nil
+	}
+	return data, nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. It is
+// the inverse of MarshalText.
+func (a *Adapter) UnmarshalText(text []byte) error {
+	if a.Format == FormatBinary {
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+		n, err := base64.StdEncoding.Decode(decoded, text)
+		if err != nil {
+			return err
+		}
+		text = decoded[:n]
+	}
+	return a.unmarshal(text)
+}
+
+// MarshalJSON implements the json.Marshaler interface. This always uses
+// the protobuf JSON format, regardless of the adapter's format.
+func (a *Adapter) MarshalJSON() ([]byte, error) {
+	return protojson.MarshalOptions{Resolver: a.resolver()}.Marshal(a.Message)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. This always uses
+// the protobuf JSON format, regardless of the adapter's format.
+func (a *Adapter) UnmarshalJSON(data []byte) error {
+	return protojson.UnmarshalOptions{Resolver: a.resolver()}.Unmarshal(data, a.Message)
+}
+
+func (a *Adapter) marshal() ([]byte, error) {
+	switch a.Format {
+	case FormatBinary:
+		return proto.MarshalOptions{Deterministic: true}.Marshal(a.Message)
+	case FormatJSON:
+		return protojson.MarshalOptions{Resolver: a.resolver()}.Marshal(a.Message)
+	case FormatText:
+		return prototext.MarshalOptions{Resolver: a.resolver()}.Marshal(a.Message)
+	default:
+		return nil, fmt.Errorf("unknown format: %v", a.Format)
+	}
+}
+
+func (a *Adapter) unmarshal(data []byte) error {
+	switch a.Format {
+	case FormatBinary:
+		return proto.UnmarshalOptions{Resolver: a.resolver()}.Unmarshal(data, a.Message)
+	case FormatJSON:
+		return protojson.UnmarshalOptions{Resolver: a.resolver()}.Unmarshal(data, a.Message)
+	case FormatText:
+		return prototext.UnmarshalOptions{Resolver: a.resolver()}.Unmarshal(data, a.Message)
+	default:
+		return fmt.Errorf("unknown format: %v", a.Format)
+	}
+}
+
+func (a *Adapter) resolver() protoresolve.SerializationResolver {
+	if a.Resolver == nil {
+		return protoregistry.GlobalTypes
+	}
+	return a.Resolver
+}
@@ -0,0 +1,56 @@
+package protomessage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestAdapter(t *testing.T) {
+	msg := wrapperspb.String("foo")
+	for _, format := range []Format{FormatBinary, FormatJSON, FormatText} {
+		t.Run(format.String(), func(t *testing.T) {
+			// database values
+			val, err := Adapt(msg, format).Value()
+			require.NoError(t, err)
+			if format == FormatBinary {
+				require.IsType(t, []byte(nil), val)
+			} else {
+				require.IsType(t, "", val)
+			}
+			dynMsg := dynamicpb.NewMessage(msg.ProtoReflect().Descriptor())
+			require.NoError(t, Adapt(dynMsg, format).Scan(val))
+			require.True(t, proto.Equal(msg, dynMsg))
+			require.NoError(t, Adapt(dynMsg, format).Scan(nil))
+			require.Zero(t, proto.Size(dynMsg))
+			err = Adapt(dynMsg, format).Scan(123)
+			require.ErrorContains(t, err, "cannot scan int into message google.protobuf.StringValue")
+
+			// text
+			text, err := Adapt(msg, format).MarshalText()
+			require.NoError(t, err)
+			dynMsg = dynamicpb.NewMessage(msg.ProtoReflect().Descriptor())
+			require.NoError(t, Adapt(dynMsg, format).UnmarshalText(text))
+			require.True(t, proto.Equal(msg, dynMsg))
+
+			// JSON is always JSON, regardless of format
+			data, err := json.Marshal(map[string]any{"msg": Adapt(msg, format)})
+			require.NoError(t, err)
+			require.JSONEq(t, `{"msg":"foo"}`, string(data))
+		})
+	}
+}
+
+func TestAdapter_JSONUnmarshal(t *testing.T) {
+	var s struct {
+		Msg *Adapter `json:"msg"`
+	}
+	msg := &wrapperspb.StringValue{}
+	s.Msg = Adapt(msg, FormatJSON)
+	require.NoError(t, json.Unmarshal([]byte(`{"msg":"bar"}`), &s))
+	require.Equal(t, "bar", msg.GetValue())
+}
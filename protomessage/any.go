@@ -0,0 +1,27 @@
+package protomessage
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// UnpackAny returns the message contained in the given google.protobuf.Any
+// message. The given message does not need to be an *anypb.Any: it may be
+// a dynamic message, as long as its type is google.protobuf.Any.
+//
+// The given resolver is used to resolve the Any's type URL and to recognize
+// any extensions in the contained message. If it is nil,
+// [protoregistry.GlobalTypes] is used.
+func UnpackAny(msg proto.Message, res protoresolve.SerializationResolver) (proto.Message, error) {
+	anyMsg, err := As[*anypb.Any](msg)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		res = protoregistry.GlobalTypes
+	}
+	return anypb.UnmarshalNew(anyMsg, proto.UnmarshalOptions{Resolver: res})
+}
@@ -0,0 +1,37 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnpackAny(t *testing.T) {
+	anyMsg, err := anypb.New(wrapperspb.String("foo"))
+	require.NoError(t, err)
+
+	unpacked, err := UnpackAny(anyMsg, nil)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(wrapperspb.String("foo"), unpacked))
+
+	// dynamic Any message
+	dynAny := dynamicpb.NewMessage(anyMsg.ProtoReflect().Descriptor())
+	proto.Merge(dynAny, anyMsg)
+	unpacked, err = UnpackAny(dynAny, nil)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(wrapperspb.String("foo"), unpacked))
+
+	// not an Any
+	_, err = UnpackAny(wrapperspb.String("foo"), nil)
+	require.ErrorContains(t, err, `cannot return type "google.protobuf.Any": given message is "google.protobuf.StringValue"`)
+
+	// unknown type
+	anyMsg.TypeUrl = "type.googleapis.com/foo.bar.Baz"
+	_, err = UnpackAny(anyMsg, nil)
+	require.ErrorIs(t, err, protoregistry.NotFound)
+}
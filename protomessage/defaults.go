@@ -0,0 +1,105 @@
+package protomessage
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protoreflect/v2/internal"
+)
+
+// PopulateDefaults sets all unset fields of the given message to their
+// default values. This is the same as PopulateDefaultsOptions{}.Populate(msg).
+func PopulateDefaults(msg proto.Message) {
+	PopulateDefaultsOptions{}.Populate(msg)
+}
+
+// PopulateDefaultsOptions configures how defaults are populated in a message.
+type PopulateDefaultsOptions struct {
+	// If true, unset fields whose type is a message will be set to an empty
+	// message, which will then have its own defaults populated. If false,
+	// unset message fields are left unset.
+	//
+	// Messages with recursive types are only populated up to the point of
+	// recursion: a message field will not be populated if its type is the
+	// same as the type of an enclosing message that is also being populated.
+	IncludeNestedMessages bool
+}
+
+// Populate sets all unset fields of the given message to their default
+// values. The default value is the value declared via a "default" option
+// in the field definition or, for fields that declare no default, the
+// zero value for the field's type.
+//
+// This is useful when exporting messages to systems that have no notion
+// of field presence and would otherwise not see the default values of
+// fields that are absent.
+//
+// Repeated fields, map fields, extensions, and fields that are in a
+// oneof are never populated, since there is no default value for these
+// fields. (Fields in synthetic oneofs, created for proto3 optional fields,
+// are populated.) Fields that are already set are left unchanged, but
+// messages already present in fields (including repeated and map fields)
+// will have their defaults populated, too.
+//
+// Note that for fields that do not track presence (such as proto3 fields
+// that are not marked optional), setting the field to its zero value is
+// a no-op. So such fields will still be reported as absent even after
+// their defaults are populated.
+func (o PopulateDefaultsOptions) Populate(msg proto.Message) {
+	o.populate(msg.ProtoReflect(), nil)
+}
+
+func (o PopulateDefaultsOptions) populate(msg protoreflect.Message, enclosing []protoreflect.FullName) {
+	md := msg.Descriptor()
+	enclosing = append(enclosing, md.FullName())
+	fields := md.Fields()
+	for i, length := 0, fields.Len(); i < length; i++ {
+		field := fields.Get(i)
+		if field.IsList() || field.IsMap() {
+			if msg.Has(field) {
+				o.populateContained(field, msg.Get(field), enclosing)
+			}
+			continue
+		}
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			if msg.Has(field) && internal.IsMessageKind(field.Kind()) {
+				o.populate(msg.Mutable(field).Message(), enclosing)
+			}
+			continue
+		}
+		if !internal.IsMessageKind(field.Kind()) {
+			if !msg.Has(field) {
+				msg.Set(field, field.Default())
+			}
+			continue
+		}
+		if !msg.Has(field) && (!o.IncludeNestedMessages || isEnclosing(field.Message().FullName(), enclosing)) {
+			continue
+		}
+		o.populate(msg.Mutable(field).Message(), enclosing)
+	}
+}
+
+func (o PopulateDefaultsOptions) populateContained(field protoreflect.FieldDescriptor, val protoreflect.Value, enclosing []protoreflect.FullName) {
+	switch {
+	case field.IsList() && internal.IsMessageKind(field.Kind()):
+		list := val.List()
+		for i, length := 0, list.Len(); i < length; i++ {
+			o.populate(list.Get(i).Message(), enclosing)
+		}
+	case field.IsMap() && internal.IsMessageKind(field.MapValue().Kind()):
+		val.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+			o.populate(v.Message(), enclosing)
+			return true
+		})
+	}
+}
+
+func isEnclosing(name protoreflect.FullName, enclosing []protoreflect.FullName) bool {
+	for _, n := range enclosing {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
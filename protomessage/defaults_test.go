@@ -0,0 +1,91 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestPopulateDefaults(t *testing.T) {
+	msg := &testprotos.PrimitiveDefaults{}
+	PopulateDefaults(msg)
+	fields := msg.ProtoReflect().Descriptor().Fields()
+	for i, length := 0, fields.Len(); i < length; i++ {
+		field := fields.Get(i)
+		require.True(t, msg.ProtoReflect().Has(field), "field %s should be set", field.Name())
+	}
+	require.Equal(t, float32(3.14159), msg.GetFl32())
+	require.Equal(t, int32(-10101), msg.GetI32N())
+	require.True(t, msg.Fl32 != nil && *msg.Fl32 == float32(3.14159))
+	require.True(t, msg.I32N != nil && *msg.I32N == -10101)
+
+	// dynamic messages work, too
+	dynMsg := dynamicpb.NewMessage(msg.ProtoReflect().Descriptor())
+	PopulateDefaults(dynMsg)
+	require.True(t, proto.Equal(msg, dynMsg))
+
+	// existing values are not overwritten
+	msg = &testprotos.PrimitiveDefaults{I32: proto.Int32(123)}
+	PopulateDefaults(msg)
+	require.Equal(t, int32(123), msg.GetI32())
+}
+
+func TestPopulateDefaults_NestedMessages(t *testing.T) {
+	msg := &testprotos.TestMessage{
+		Nm: &testprotos.TestMessage_NestedMessage{
+			Anm: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage{
+				Yanm: []*testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage{{}},
+			},
+		},
+	}
+	PopulateDefaults(msg)
+	// Unset message fields are left alone.
+	require.Nil(t, msg.Anm)
+	require.Nil(t, msg.Yanm)
+	require.Nil(t, msg.Nm.Yanm)
+	// But existing messages, including those in lists, are populated.
+	yanm := msg.Nm.Anm.Yanm[0]
+	require.NotNil(t, yanm.Foo)
+	require.NotNil(t, yanm.Bar)
+	require.NotNil(t, yanm.Baz)
+	require.Equal(t, testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage_VALUE1, yanm.GetDne())
+	require.NotNil(t, yanm.Dne)
+	require.Nil(t, yanm.Anm)
+
+	msg = &testprotos.TestMessage{}
+	PopulateDefaultsOptions{IncludeNestedMessages: true}.Populate(msg)
+	require.NotNil(t, msg.Nm)
+	require.NotNil(t, msg.Nm.Anm)
+	require.Empty(t, msg.Nm.Anm.Yanm)
+	require.NotNil(t, msg.Nm.Yanm)
+	require.NotNil(t, msg.Nm.Yanm.Foo)
+	require.NotNil(t, msg.Nm.Yanm.Anm)
+	// Recursive types are not populated.
+	require.Nil(t, msg.Nm.Yanm.Nm)
+	require.Nil(t, msg.Nm.Yanm.Tm)
+	require.NotNil(t, msg.Yanm)
+	require.NotNil(t, msg.Yanm.Nm)
+	require.NotNil(t, msg.Yanm.Nm.Anm)
+	require.Nil(t, msg.Yanm.Nm.Yanm)
+	require.Nil(t, msg.Yanm.Tm)
+	// Repeated fields remain empty.
+	require.Empty(t, msg.Ne)
+}
+
+func TestPopulateDefaults_Oneofs(t *testing.T) {
+	msg := &testprotos.OneOfMessage{}
+	PopulateDefaults(msg)
+	// no field in a oneof gets set
+	oneofs := msg.ProtoReflect().Descriptor().Oneofs()
+	for i, length := 0, oneofs.Len(); i < length; i++ {
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() {
+			continue
+		}
+		require.Nil(t, msg.ProtoReflect().WhichOneof(oneof))
+	}
+}
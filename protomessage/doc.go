@@ -0,0 +1,8 @@
+// Package protomessage provides helpers for working with protobuf messages
+// via reflection, such as walking, transforming, and merging them, and
+// accessing fields by path.
+//
+// Unless otherwise documented, the messages given to functions in this
+// package need not be generated types: dynamic messages, like those created
+// with the dynamicpb package, are supported, too.
+package protomessage
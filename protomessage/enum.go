@@ -0,0 +1,70 @@
+package protomessage
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// GetEnumValue returns the descriptor for the value of the given field. The
+// given field must be a singular field in msg whose type is an enum. If the
+// field is not set, the descriptor for its default value is returned.
+//
+// Open enums may have values whose numbers do not correspond to any value
+// declared in the enum. In that case, nil is returned, and the caller can use
+// msg.ProtoReflect().Get(field).Enum() to access the number.
+//
+// An error is returned if the field is the wrong type.
+func GetEnumValue(msg proto.Message, field protoreflect.FieldDescriptor) (protoreflect.EnumValueDescriptor, error) {
+	m := msg.ProtoReflect()
+	if err := checkEnumField(m, field); err != nil {
+		return nil, err
+	}
+	return field.Enum().Values().ByNumber(m.Get(field).Enum()), nil
+}
+
+// GetEnumValueName returns the name of the value of the given field. The given
+// field must be a singular field in msg whose type is an enum. If the field is
+// not set, the name of its default value is returned.
+//
+// The returned bool is false if the field's number does not correspond to any
+// value declared in the enum, which is possible with open enums. In that case,
+// the returned name is empty.
+//
+// An error is returned if the field is the wrong type.
+func GetEnumValueName(msg proto.Message, field protoreflect.FieldDescriptor) (protoreflect.Name, bool, error) {
+	val, err := GetEnumValue(msg, field)
+	if err != nil || val == nil {
+		return "", false, err
+	}
+	return val.Name(), true, nil
+}
+
+// SetEnumValueByName sets the given field to the enum value with the given
+// name. The given field must be a singular field in msg whose type is an enum.
+//
+// An error is returned if the field is the wrong type or if its enum has no
+// value with the given name.
+func SetEnumValueByName(msg proto.Message, field protoreflect.FieldDescriptor, name protoreflect.Name) error {
+	m := msg.ProtoReflect()
+	if err := checkEnumField(m, field); err != nil {
+		return err
+	}
+	val := field.Enum().Values().ByName(name)
+	if val == nil {
+		return fmt.Errorf("field %s: enum %s has no value named %q", field.FullName(), field.Enum().FullName(), name)
+	}
+	m.Set(field, protoreflect.ValueOfEnum(val.Number()))
+	return nil
+}
+
+func checkEnumField(msg protoreflect.Message, field protoreflect.FieldDescriptor) error {
+	if field.ContainingMessage().FullName() != msg.Descriptor().FullName() {
+		return fmt.Errorf("field %s does not belong to message %s", field.FullName(), msg.Descriptor().FullName())
+	}
+	if field.IsList() || field.IsMap() || field.Kind() != protoreflect.EnumKind {
+		return fmt.Errorf("field %s is not a singular enum field", field.FullName())
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestEnumValues(t *testing.T) {
+	md := (&testprotos.UnaryFields{}).ProtoReflect().Descriptor()
+	field := md.Fields().ByName("z")
+
+	for _, dynamic := range []bool{false, true} {
+		var msg proto.Message = &testprotos.UnaryFields{}
+		if dynamic {
+			msg = dynamicpb.NewMessage(md)
+		}
+
+		// unset field reports default value
+		val, err := GetEnumValue(msg, field)
+		require.NoError(t, err)
+		require.Equal(t, field.Default().Enum(), val.Number())
+
+		require.NoError(t, SetEnumValueByName(msg, field, "SECOND"))
+		val, err = GetEnumValue(msg, field)
+		require.NoError(t, err)
+		require.Equal(t, protoreflect.Name("SECOND"), val.Name())
+		name, ok, err := GetEnumValueName(msg, field)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, protoreflect.Name("SECOND"), name)
+
+		err = SetEnumValueByName(msg, field, "BOGUS")
+		require.ErrorContains(t, err, `enum testprotos.TestEnum has no value named "BOGUS"`)
+		_, err = GetEnumValue(msg, md.Fields().ByName("i"))
+		require.ErrorContains(t, err, "field testprotos.UnaryFields.i is not a singular enum field")
+		_, err = GetEnumValue(msg, (&testprotos.TestRequest{}).ProtoReflect().Descriptor().Fields().ByName("foo"))
+		require.ErrorContains(t, err, "does not belong to message testprotos.UnaryFields")
+	}
+}
+
+func TestEnumValues_Open(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("open_enum.proto"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"desc_test_proto3.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Foo"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("e"),
+						Number:   proto.Int32(1),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(),
+						TypeName: proto.String(".testprotos.Proto3Enum"),
+					},
+				},
+			},
+		},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	md := fd.Messages().Get(0)
+	field := md.Fields().Get(0)
+	msg := dynamicpb.NewMessage(md)
+
+	msg.Set(field, protoreflect.ValueOfEnum(123))
+	val, err := GetEnumValue(msg, field)
+	require.NoError(t, err)
+	require.Nil(t, val)
+	name, ok, err := GetEnumValueName(msg, field)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Empty(t, name)
+
+	require.NoError(t, SetEnumValueByName(msg, field, "VALUE_NEG1"))
+	require.Equal(t, protoreflect.EnumNumber(-1), msg.Get(field).Enum())
+}
@@ -0,0 +1,236 @@
+package protomessage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FlattenOptions configures how messages are flattened into a single map.
+type FlattenOptions struct {
+	// The separator placed between field names in keys. If empty, "." is
+	// used.
+	Separator string
+	// By default, elements of repeated fields are identified by an index in
+	// brackets, like "items[2]", and entries in map fields are identified by
+	// a key in brackets, like `attrs["color"]`. (With the default separator,
+	// keys are then valid paths for GetByPath.) If this option is true, the
+	// index or key is instead added after a separator, like "items.2" and
+	// "attrs.color".
+	IndexWithSeparator bool
+	// If true, certain well-known types are flattened into a single value,
+	// instead of into their constituent fields:
+	//   - google.protobuf.Timestamp becomes a string, in RFC 3339 format.
+	//   - google.protobuf.Duration becomes a float64, the number of seconds.
+	//   - Wrapper types, like google.protobuf.StringValue, become the wrapped
+	//     value.
+	ScalarizeWellKnownTypes bool
+	// If true, fields that are not set are included in the result. Scalar
+	// fields have their default value. A message field that is not set has a
+	// single key, the path to the field itself, with a nil value. The fields
+	// of its message type are not included, since message types can be
+	// recursive. Like with protojson.MarshalOptions.EmitUnpopulated, this does
+	// not apply to fields in a oneof, to extensions, or to repeated and map
+	// fields.
+	//
+	// So messages of the same type produce the same keys for their scalar
+	// fields, but the keys for a message field depend on whether it is set.
+	EmitUnpopulated bool
+}
+
+// Flatten flattens the given message into a map, using default options.
+// See FlattenOptions.Flatten.
+func Flatten(msg proto.Message) map[string]any {
+	return FlattenOptions{}.Flatten(msg)
+}
+
+// Flatten flattens the given message into a map, whose keys are the paths to
+// each scalar value in the message, including values in nested messages.
+// Fields are identified by name, and extensions by their fully-qualified name
+// in parentheses, like "(foo.bar.ext)". This is useful for exporting messages,
+// including dynamic messages, to tabular formats used for analytics. Also see
+// CSVRecord.
+//
+// Values in the map are of the following types, based on the field's kind:
+//   - bool for bool fields
+//   - int32 for int32, sint32, and sfixed32 fields
+//   - int64 for int64, sint64, and sfixed64 fields
+//   - uint32 for uint32 and fixed32 fields
+//   - uint64 for uint64 and fixed64 fields
+//   - float32 for float fields
+//   - float64 for double fields
+//   - string for string fields, and for enum fields whose value is defined by
+//     the enum, in which case the value is the enum value's name
+//   - int32 for enum fields whose value is not defined by the enum
+//   - []byte for bytes fields
+//
+// When well-known types are scalarized, they are also represented with one of
+// the types above. See FlattenOptions.ScalarizeWellKnownTypes.
+func (opts FlattenOptions) Flatten(msg proto.Message) map[string]any {
+	result := map[string]any{}
+	opts.flatten(msg.ProtoReflect(), "", result)
+	return result
+}
+
+func (opts FlattenOptions) flatten(msg protoreflect.Message, prefix string, result map[string]any) {
+	if opts.EmitUnpopulated {
+		fields := msg.Descriptor().Fields()
+		for i, length := 0, fields.Len(); i < length; i++ {
+			field := fields.Get(i)
+			if field.ContainingOneof() != nil || field.IsList() || field.IsMap() || msg.Has(field) {
+				continue
+			}
+			key := opts.fieldKey(prefix, field)
+			if field.Message() != nil {
+				result[key] = nil
+			} else {
+				result[key] = flattenScalar(field, field.Default())
+			}
+		}
+	}
+	msg.Range(func(field protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		key := opts.fieldKey(prefix, field)
+		switch {
+		case field.IsList():
+			list := val.List()
+			for i, length := 0, list.Len(); i < length; i++ {
+				opts.flattenValue(field, list.Get(i), opts.subscriptKey(key, strconv.Itoa(i), strconv.Itoa(i)), result)
+			}
+		case field.IsMap():
+			val.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				opts.flattenValue(field.MapValue(), v, opts.subscriptKey(key, k.String(), mapKeyString(k)), result)
+				return true
+			})
+		default:
+			opts.flattenValue(field, val, key, result)
+		}
+		return true
+	})
+}
+
+func (opts FlattenOptions) flattenValue(field protoreflect.FieldDescriptor, val protoreflect.Value, key string, result map[string]any) {
+	if field.Message() == nil {
+		result[key] = flattenScalar(field, val)
+		return
+	}
+	if opts.ScalarizeWellKnownTypes {
+		if v, ok := scalarizeWellKnownType(val.Message()); ok {
+			result[key] = v
+			return
+		}
+	}
+	opts.flatten(val.Message(), key, result)
+}
+
+func (opts FlattenOptions) fieldKey(prefix string, field protoreflect.FieldDescriptor) string {
+	name := string(field.Name())
+	if field.IsExtension() {
+		name = "(" + string(field.FullName()) + ")"
+	}
+	if prefix == "" {
+		return name
+	}
+	return prefix + opts.separator() + name
+}
+
+func (opts FlattenOptions) subscriptKey(key, plain, bracketed string) string {
+	if opts.IndexWithSeparator {
+		return key + opts.separator() + plain
+	}
+	return key + "[" + bracketed + "]"
+}
+
+func (opts FlattenOptions) separator() string {
+	if opts.Separator == "" {
+		return "."
+	}
+	return opts.Separator
+}
+
+func flattenScalar(field protoreflect.FieldDescriptor, val protoreflect.Value) any {
+	switch field.Kind() {
+	case protoreflect.EnumKind:
+		if ev := field.Enum().Values().ByNumber(val.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(val.Enum())
+	case protoreflect.BytesKind:
+		return bytes.Clone(val.Bytes())
+	default:
+		return val.Interface()
+	}
+}
+
+func scalarizeWellKnownType(msg protoreflect.Message) (any, bool) {
+	md := msg.Descriptor()
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		seconds, nanos := getSecondsAndNanos(msg)
+		return time.Unix(seconds, int64(nanos)).UTC().Format(time.RFC3339Nano), true
+	case "google.protobuf.Duration":
+		seconds, nanos := getSecondsAndNanos(msg)
+		return float64(seconds) + float64(nanos)/1e9, true
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		field := md.Fields().ByName("value")
+		if field == nil {
+			return nil, false
+		}
+		return flattenScalar(field, msg.Get(field)), true
+	default:
+		return nil, false
+	}
+}
+
+// CSVRecord returns the values in flat, which is typically the result of
+// flattening a message, for the given columns. The values are formatted as
+// strings, so the result can be written using a csv.Writer. Values that are
+// missing from flat, or that are nil, are formatted as empty strings. Bytes
+// are formatted using standard base64 encoding. Other values are formatted
+// using the strconv package or, for other types, using fmt.Sprint.
+//
+// To produce consistent records for messages of the same type, flatten them
+// with FlattenOptions.EmitUnpopulated set, and use the same columns for every
+// record. The columns can be determined from the union of the keys of the
+// flattened messages (for example, sorted alphabetically) and written as a
+// header. The keys of one message are not enough when message fields are set
+// in some messages but not in others, or when messages have repeated fields,
+// map fields, or extensions.
+func CSVRecord(flat map[string]any, columns []string) []string {
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		switch v := flat[col].(type) {
+		case nil:
+			// leave empty
+		case string:
+			record[i] = v
+		case bool:
+			record[i] = strconv.FormatBool(v)
+		case int32:
+			record[i] = strconv.FormatInt(int64(v), 10)
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case uint32:
+			record[i] = strconv.FormatUint(uint64(v), 10)
+		case uint64:
+			record[i] = strconv.FormatUint(v, 10)
+		case float32:
+			record[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case []byte:
+			record[i] = base64.StdEncoding.EncodeToString(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return record
+}
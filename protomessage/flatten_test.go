@@ -0,0 +1,124 @@
+package protomessage
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestFlatten(t *testing.T) {
+	req := &testprotos.TestRequest{
+		Foo:   []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1, 99},
+		Bar:   "abc",
+		Flags: map[string]bool{"x": true},
+		Others: map[string]*testprotos.TestMessage{
+			"y": {Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1}},
+		},
+	}
+	for _, msg := range []proto.Message{req, toDynamic(t, req)} {
+		flat := Flatten(msg)
+		require.Equal(t, map[string]any{
+			"foo[0]":            "VALUE1",
+			"foo[1]":            int32(99),
+			"bar":               "abc",
+			`flags["x"]`:        true,
+			`others["y"].ne[0]`: "VALUE1",
+		}, flat)
+		// keys are valid paths
+		for key := range flat {
+			_, err := GetByPath(msg, key)
+			require.NoError(t, err)
+		}
+
+		flat = FlattenOptions{Separator: "/", IndexWithSeparator: true}.Flatten(msg)
+		require.Equal(t, map[string]any{
+			"foo/0":         "VALUE1",
+			"foo/1":         int32(99),
+			"bar":           "abc",
+			"flags/x":       true,
+			"others/y/ne/0": "VALUE1",
+		}, flat)
+
+		flat = FlattenOptions{EmitUnpopulated: true}.Flatten(msg)
+		require.Nil(t, flat["baz"])
+		require.Contains(t, flat, "baz")
+		require.Contains(t, flat, "snafu")
+		require.Contains(t, flat, `others["y"].nm`)
+		require.Len(t, flat, 10)
+	}
+
+	// Fields of an unset message field are not included, so the keys for a
+	// message field depend on whether it is set.
+	withBaz := proto.Clone(req).(*testprotos.TestRequest)
+	withBaz.Baz = &testprotos.TestMessage{}
+	flat := FlattenOptions{EmitUnpopulated: true}.Flatten(withBaz)
+	require.NotContains(t, flat, "baz")
+	require.Contains(t, flat, "baz.nm")
+}
+
+func TestFlatten_WellKnownTypes(t *testing.T) {
+	msg := &testprotos.TestWellKnownTypes{
+		StartTime: timestamppb.New(time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)),
+		Elapsed:   durationpb.New(1500 * time.Millisecond),
+		Str:       wrapperspb.String("abc"),
+		Byt:       wrapperspb.Bytes([]byte{1, 2, 3}),
+	}
+	require.Equal(t, map[string]any{
+		"start_time.seconds": int64(1704164645),
+		"start_time.nanos":   int32(600000000),
+		"elapsed.seconds":    int64(1),
+		"elapsed.nanos":      int32(500000000),
+		"str.value":          "abc",
+		"byt.value":          []byte{1, 2, 3},
+	}, Flatten(msg))
+
+	opts := FlattenOptions{ScalarizeWellKnownTypes: true, EmitUnpopulated: true}
+	flat := opts.Flatten(toDynamic(t, msg))
+	require.Equal(t, map[string]any{
+		"start_time": "2024-01-02T03:04:05.6Z",
+		"elapsed":    1.5,
+		"str":        "abc",
+		"byt":        []byte{1, 2, 3},
+		"dbl":        nil,
+		"flt":        nil,
+		"bl":         nil,
+		"i32":        nil,
+		"i64":        nil,
+		"u32":        nil,
+		"u64":        nil,
+	}, flat)
+
+	columns := make([]string, 0, len(flat))
+	for key := range flat {
+		columns = append(columns, key)
+	}
+	sort.Strings(columns)
+	columns = append(columns, "missing")
+	require.Equal(t, []string{"", "AQID", "", "1.5", "", "", "", "2024-01-02T03:04:05.6Z", "abc", "", "", ""}, CSVRecord(flat, columns))
+}
+
+func TestCSVRecord(t *testing.T) {
+	flat := map[string]any{
+		"b": true,
+		"i": int32(-1),
+		"l": int64(1 << 40),
+		"u": uint32(7),
+		"v": uint64(1 << 63),
+		"f": float32(0.1),
+		"d": 2.5,
+		"s": "hello, world",
+		"x": []byte("hi"),
+		"n": nil,
+	}
+	require.Equal(t,
+		[]string{"true", "-1", "1099511627776", "7", "9223372036854775808", "0.1", "2.5", "hello, world", "aGk=", "", ""},
+		CSVRecord(flat, []string{"b", "i", "l", "u", "v", "f", "d", "s", "x", "n", "missing"}))
+}
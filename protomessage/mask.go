@@ -0,0 +1,229 @@
+package protomessage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/jhump/protoreflect/v2/internal"
+)
+
+// MergeWithMask merges the fields of src that are named in the given mask
+// into dst. This is the same as MergeWithMaskOptions{}.Merge(dst, src, mask).
+func MergeWithMask(dst, src proto.Message, mask *fieldmaskpb.FieldMask) error {
+	return MergeWithMaskOptions{}.Merge(dst, src, mask)
+}
+
+// MergeWithMaskOptions configures how fields are merged by MergeWithMask.
+//
+// The zero value uses the semantics described in the documentation for
+// google.protobuf.FieldMask: repeated fields are appended and message fields
+// are merged. To instead use the semantics of AIP-134 (https://aip.dev/134),
+// where every field named in the mask is replaced, set both
+// ReplaceMessageFields and ReplaceRepeatedFields to true.
+type MergeWithMaskOptions struct {
+	// If true, a message field at the end of a path replaces the value in
+	// the destination. If false, it is merged into the destination's value.
+	ReplaceMessageFields bool
+	// If true, a repeated or map field at the end of a path replaces the
+	// value in the destination. If false, its elements are appended to the
+	// destination's list or, for maps, its entries are added to the
+	// destination's map.
+	ReplaceRepeatedFields bool
+}
+
+// Merge merges the fields of src that are named in the given mask into dst.
+// This implements the update semantics of a field mask: each path in the mask
+// is a dot-separated sequence of field names, and every field that is not
+// last in a path must be a singular message field. This is typically used
+// to implement "Update" RPCs for dynamic messages.
+//
+// If a field named in the mask is not set in src, it is cleared in dst. This
+// is how an update can reset a field to its default value. The exception is a
+// message field when ReplaceMessageFields is false: such fields are merged, so
+// if the field is not set in src, there is nothing to merge and dst's value is
+// left unchanged. If the mask is nil or has no paths, it is treated as if it
+// named all fields that are set in src, like the implied mask described in
+// AIP-134.
+//
+// The messages must have the same full name, but they need not have the same
+// concrete type or descriptor instance. For example, src may be a dynamic
+// message while dst is a generated message. In that case, src is first
+// converted to the type of dst, by marshaling and unmarshaling it. An error is
+// returned if dst and src do not have the same full name, if src cannot be
+// converted, or if any path in the mask is invalid for the type. If an error
+// is returned, dst is not modified.
+func (o MergeWithMaskOptions) Merge(dst, src proto.Message, mask *fieldmaskpb.FieldMask) error {
+	dstMsg, srcMsg := dst.ProtoReflect(), src.ProtoReflect()
+	md := dstMsg.Descriptor()
+	if srcMsg.Descriptor().FullName() != md.FullName() {
+		return fmt.Errorf("cannot merge %s into %s", srcMsg.Descriptor().FullName(), md.FullName())
+	}
+	if srcMsg.Descriptor() != md || reflect.TypeOf(src) != reflect.TypeOf(dst) {
+		converted := dstMsg.New()
+		data, err := proto.Marshal(src)
+		if err != nil {
+			return fmt.Errorf("cannot convert %s for merging: %w", md.FullName(), err)
+		}
+		if err := proto.Unmarshal(data, converted.Interface()); err != nil {
+			return fmt.Errorf("cannot convert %s for merging: %w", md.FullName(), err)
+		}
+		srcMsg = converted
+	}
+	var tree maskTree
+	if len(mask.GetPaths()) == 0 {
+		srcMsg.Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if !field.IsExtension() {
+				tree.add([]protoreflect.FieldDescriptor{field})
+			}
+			return true
+		})
+	}
+	for _, path := range mask.GetPaths() {
+		fields, err := resolveMaskPath(md, path)
+		if err != nil {
+			return err
+		}
+		tree.add(fields)
+	}
+	o.merge(dstMsg, srcMsg, tree)
+	return nil
+}
+
+func (o MergeWithMaskOptions) merge(dst, src protoreflect.Message, tree maskTree) {
+	for _, node := range tree {
+		field := node.field
+		if node.children != nil {
+			if !src.Has(field) && !dst.Has(field) {
+				// nothing to merge and nothing to clear
+				continue
+			}
+			o.merge(dst.Mutable(field).Message(), src.Get(field).Message(), node.children)
+			continue
+		}
+		if !src.Has(field) {
+			if field.IsList() || field.IsMap() || !internal.IsMessageKind(field.Kind()) || o.ReplaceMessageFields {
+				dst.Clear(field)
+			}
+			continue
+		}
+		switch {
+		case field.IsList():
+			if o.ReplaceRepeatedFields {
+				dst.Clear(field)
+			}
+			srcList, dstList := src.Get(field).List(), dst.Mutable(field).List()
+			for i, length := 0, srcList.Len(); i < length; i++ {
+				dstList.Append(cloneValue(srcList.Get(i)))
+			}
+		case field.IsMap():
+			if o.ReplaceRepeatedFields {
+				dst.Clear(field)
+			}
+			dstMap := dst.Mutable(field).Map()
+			src.Get(field).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				dstMap.Set(k, cloneValue(v))
+				return true
+			})
+		case internal.IsMessageKind(field.Kind()):
+			if o.ReplaceMessageFields {
+				dst.Clear(field)
+			}
+			proto.Merge(dst.Mutable(field).Message().Interface(), src.Get(field).Message().Interface())
+		default:
+			dst.Set(field, cloneValue(src.Get(field)))
+		}
+	}
+}
+
+// cloneValue returns a copy of the given value if it is a message or bytes,
+// so that the source and destination of a merge do not share mutable state.
+func cloneValue(val protoreflect.Value) protoreflect.Value {
+	switch v := val.Interface().(type) {
+	case protoreflect.Message:
+		return protoreflect.ValueOfMessage(proto.Clone(v.Interface()).ProtoReflect())
+	case []byte:
+		return protoreflect.ValueOfBytes(append([]byte(nil), v...))
+	default:
+		return val
+	}
+}
+
+// maskTree is a normalized form of a field mask. If a path and another path
+// that it contains are both present, like "a" and "a.b", only the former is
+// retained since it subsumes the latter.
+type maskTree []*maskNode
+
+type maskNode struct {
+	field protoreflect.FieldDescriptor
+	// nil if this field is the end of a path
+	children maskTree
+}
+
+func (t *maskTree) add(fields []protoreflect.FieldDescriptor) {
+	var node *maskNode
+	for _, n := range *t {
+		if n.field.Number() == fields[0].Number() {
+			node = n
+			break
+		}
+	}
+	switch {
+	case node == nil:
+		node = &maskNode{field: fields[0]}
+		*t = append(*t, node)
+		if len(fields) == 1 {
+			return
+		}
+	case node.children == nil:
+		// already have a path that ends at this field
+		return
+	case len(fields) == 1:
+		// this path subsumes the ones already added
+		node.children = nil
+		return
+	}
+	node.children.add(fields[1:])
+}
+
+func resolveMaskPath(md protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	return resolvePath(md, path, false)
+}
+
+// resolvePath resolves the given dot-separated path of field names. If
+// throughRepeated is true, the path may traverse repeated and map fields
+// whose elements are messages. Otherwise, every field that is not last in
+// the path must be a singular message field.
+func resolvePath(md protoreflect.MessageDescriptor, path string, throughRepeated bool) ([]protoreflect.FieldDescriptor, error) {
+	names := strings.Split(path, ".")
+	fields := make([]protoreflect.FieldDescriptor, len(names))
+	for i, name := range names {
+		if md == nil {
+			if throughRepeated {
+				return nil, fmt.Errorf("path %q: %s is not a message field", path, names[i-1])
+			}
+			return nil, fmt.Errorf("path %q: %s is not a singular message field", path, names[i-1])
+		}
+		field := md.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			return nil, fmt.Errorf("path %q: message %s has no field named %q", path, md.FullName(), name)
+		}
+		fields[i] = field
+		switch {
+		case field.IsMap():
+			md = nil
+			if throughRepeated {
+				md = field.MapValue().Message()
+			}
+		case field.IsList() && !throughRepeated, !internal.IsMessageKind(field.Kind()):
+			md = nil
+		default:
+			md = field.Message()
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,234 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestMergeWithMask(t *testing.T) {
+	dst := &testprotos.AnotherTestMessage{
+		Dne:       testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage_VALUE1.Enum(),
+		MapField1: map[int32]string{1: "a", 2: "b"},
+		Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Beatles: proto.String("x"), Stones: proto.String("y")},
+		Atmoo:     &testprotos.AnotherTestMessage_Str{Str: "s"},
+	}
+	src := &testprotos.AnotherTestMessage{
+		MapField1: map[int32]string{2: "B", 3: "c"},
+		Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Doors: proto.String("z")},
+		Atmoo:     &testprotos.AnotherTestMessage_Int{Int: 5},
+	}
+	testCases := []struct {
+		name     string
+		opts     MergeWithMaskOptions
+		paths    []string
+		expected *testprotos.AnotherTestMessage
+	}{
+		{
+			name:  "nested paths",
+			paths: []string{"dne", "map_field1", "rocknroll.beatles", "rocknroll.doors", "int"},
+			expected: &testprotos.AnotherTestMessage{
+				MapField1: map[int32]string{1: "a", 2: "B", 3: "c"},
+				Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Stones: proto.String("y"), Doors: proto.String("z")},
+				Atmoo:     &testprotos.AnotherTestMessage_Int{Int: 5},
+			},
+		},
+		{
+			name:  "merge message",
+			paths: []string{"rocknroll"},
+			expected: &testprotos.AnotherTestMessage{
+				Dne:       dst.Dne,
+				MapField1: dst.MapField1,
+				Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Beatles: proto.String("x"), Stones: proto.String("y"), Doors: proto.String("z")},
+				Atmoo:     dst.Atmoo,
+			},
+		},
+		{
+			name:  "replace",
+			opts:  MergeWithMaskOptions{ReplaceMessageFields: true, ReplaceRepeatedFields: true},
+			paths: []string{"map_field1", "rocknroll.stones", "rocknroll"},
+			expected: &testprotos.AnotherTestMessage{
+				Dne:       dst.Dne,
+				MapField1: src.MapField1,
+				Rocknroll: src.Rocknroll,
+				Atmoo:     dst.Atmoo,
+			},
+		},
+		{
+			name: "implied mask",
+			opts: MergeWithMaskOptions{ReplaceMessageFields: true, ReplaceRepeatedFields: true},
+			expected: &testprotos.AnotherTestMessage{
+				Dne:       dst.Dne,
+				MapField1: src.MapField1,
+				Rocknroll: src.Rocknroll,
+				Atmoo:     src.Atmoo,
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for _, dynamic := range []bool{false, true} {
+				dstMsg, srcMsg := proto.Clone(dst), proto.Clone(src)
+				if dynamic {
+					dstMsg, srcMsg = toDynamic(t, dstMsg), toDynamic(t, srcMsg)
+				}
+				var mask *fieldmaskpb.FieldMask
+				if testCase.paths != nil {
+					mask = &fieldmaskpb.FieldMask{Paths: testCase.paths}
+				}
+				err := testCase.opts.Merge(dstMsg, srcMsg, mask)
+				require.NoError(t, err)
+				actual, err := As[*testprotos.AnotherTestMessage](dstMsg)
+				require.NoError(t, err)
+				require.True(t, proto.Equal(testCase.expected, actual), "dynamic=%v: %v", dynamic, actual)
+				// src is unchanged
+				srcActual, err := As[*testprotos.AnotherTestMessage](srcMsg)
+				require.NoError(t, err)
+				require.True(t, proto.Equal(src, srcActual))
+			}
+		})
+	}
+}
+
+func TestMergeWithMask_RepeatedFields(t *testing.T) {
+	dst := &testprotos.TestMessage{
+		Ne:  []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1},
+		Anm: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage{},
+	}
+	src := &testprotos.TestMessage{
+		Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE2},
+		Nm: &testprotos.TestMessage_NestedMessage{
+			Anm: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage{
+				Yanm: []*testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage{
+					{Foo: proto.String("foo")},
+				},
+			},
+		},
+	}
+	paths := []string{"ne", "nm.anm.yanm", "anm.yanm"}
+
+	actual := proto.Clone(dst).(*testprotos.TestMessage)
+	require.NoError(t, MergeWithMask(actual, src, &fieldmaskpb.FieldMask{Paths: paths}))
+	expected := &testprotos.TestMessage{
+		Ne:  []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1, testprotos.TestMessage_VALUE2},
+		Nm:  src.Nm,
+		Anm: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage{},
+	}
+	require.True(t, proto.Equal(expected, actual), "%v", actual)
+	// values are copied, not shared
+	actual.Nm.Anm.Yanm[0].Foo = proto.String("bar")
+	require.Equal(t, "foo", src.Nm.Anm.Yanm[0].GetFoo())
+
+	actual = proto.Clone(dst).(*testprotos.TestMessage)
+	opts := MergeWithMaskOptions{ReplaceRepeatedFields: true}
+	require.NoError(t, opts.Merge(actual, src, &fieldmaskpb.FieldMask{Paths: paths}))
+	expected.Ne = src.Ne
+	require.True(t, proto.Equal(expected, actual), "%v", actual)
+}
+
+func TestMergeWithMask_UnsetMessageField(t *testing.T) {
+	dst := &testprotos.AnotherTestMessage{
+		Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Beatles: proto.String("x")},
+	}
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"rocknroll"}}
+
+	// merging leaves the field alone since there is nothing to merge
+	actual := proto.Clone(dst)
+	require.NoError(t, MergeWithMask(actual, &testprotos.AnotherTestMessage{}, mask))
+	require.True(t, proto.Equal(dst, actual), "%v", actual)
+
+	// replacing clears it
+	opts := MergeWithMaskOptions{ReplaceMessageFields: true}
+	require.NoError(t, opts.Merge(actual, &testprotos.AnotherTestMessage{}, mask))
+	require.True(t, proto.Equal(&testprotos.AnotherTestMessage{}, actual), "%v", actual)
+}
+
+func TestMergeWithMask_MixedGeneratedAndDynamic(t *testing.T) {
+	// a copy of descriptor.proto, so that descriptors are not the same
+	// instances as those used by the generated types
+	file, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto), nil)
+	require.NoError(t, err)
+	src := dynamicpb.NewMessage(file.Messages().ByName("FileDescriptorProto"))
+	require.NoError(t, SetByPath(src, "name", protoreflect.ValueOfString("foo.proto")))
+	require.NoError(t, SetByPath(src, "message_type[0].name", protoreflect.ValueOfString("Foo")))
+	require.NoError(t, SetByPath(src, "options.go_package", protoreflect.ValueOfString("foo/bar")))
+
+	dst := &descriptorpb.FileDescriptorProto{
+		Package:     proto.String("foo"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Bar")}},
+		Options:     &descriptorpb.FileOptions{JavaPackage: proto.String("com.foo")},
+	}
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"message_type", "options.go_package"}}
+	require.NoError(t, MergeWithMask(dst, src, mask))
+	require.True(t, proto.Equal(&descriptorpb.FileDescriptorProto{
+		Package:     proto.String("foo"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Bar")}, {Name: proto.String("Foo")}},
+		Options:     &descriptorpb.FileOptions{JavaPackage: proto.String("com.foo"), GoPackage: proto.String("foo/bar")},
+	}, dst), "%v", dst)
+
+	// and the other way around
+	dynDst := dynamicpb.NewMessage(file.Messages().ByName("FileDescriptorProto"))
+	require.NoError(t, MergeWithMask(dynDst, dst, &fieldmaskpb.FieldMask{Paths: []string{"package", "options"}}))
+	actual, err := As[*descriptorpb.FileDescriptorProto](dynDst)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(&descriptorpb.FileDescriptorProto{
+		Package: proto.String("foo"),
+		Options: dst.Options,
+	}, actual), "%v", actual)
+}
+
+func TestMergeWithMask_Errors(t *testing.T) {
+	dst := &testprotos.AnotherTestMessage{Dne: testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage_VALUE1.Enum()}
+	testCases := []struct {
+		path        string
+		expectedErr string
+	}{
+		{
+			path:        "foo",
+			expectedErr: `path "foo": message testprotos.AnotherTestMessage has no field named "foo"`,
+		},
+		{
+			path:        "rocknroll.foo",
+			expectedErr: `path "rocknroll.foo": message testprotos.AnotherTestMessage.RockNRoll has no field named "foo"`,
+		},
+		{
+			path:        "map_field4.str",
+			expectedErr: `path "map_field4.str": map_field4 is not a singular message field`,
+		},
+		{
+			path:        "rocknroll.beatles.foo",
+			expectedErr: `path "rocknroll.beatles.foo": beatles is not a singular message field`,
+		},
+		{
+			path:        "",
+			expectedErr: `path "": message testprotos.AnotherTestMessage has no field named ""`,
+		},
+	}
+	for _, testCase := range testCases {
+		actual := proto.Clone(dst)
+		err := MergeWithMask(actual, &testprotos.AnotherTestMessage{}, &fieldmaskpb.FieldMask{Paths: []string{"dne", testCase.path}})
+		require.EqualError(t, err, testCase.expectedErr)
+		// not modified
+		require.True(t, proto.Equal(dst, actual))
+	}
+
+	err := MergeWithMask(dst, &testprotos.TestMessage{}, nil)
+	require.EqualError(t, err, "cannot merge testprotos.TestMessage into testprotos.AnotherTestMessage")
+}
+
+func toDynamic(t *testing.T, msg proto.Message) proto.Message {
+	t.Helper()
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+	dyn := dynamicpb.NewMessage(msg.ProtoReflect().Descriptor())
+	require.NoError(t, proto.Unmarshal(data, dyn))
+	return dyn
+}
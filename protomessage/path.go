@@ -0,0 +1,491 @@
+package protomessage
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/internal"
+)
+
+// GetByPath returns the value at the given path in msg. The path is a
+// sequence of field names separated by dots, like "a.b.c". Each field name
+// may be followed by a subscript in brackets: an index for a repeated field,
+// like "items[2]", or a key for a map field, like `attrs["color"]` or
+// "counts[42]". Map keys that are strings may be quoted or unquoted. Fields
+// may also be identified by their JSON names. Extensions are identified by
+// their fully-qualified name in parentheses, like "(foo.bar.ext)".
+//
+// Paths may go through a mix of generated and dynamic messages.
+//
+// If the path goes through a message field that is not set, the value
+// returned is the field's default value, as if the message were present but
+// empty. An error is returned if the path is invalid for the message's type,
+// if a list index is out of range, or if a map does not contain the given key.
+func GetByPath(msg proto.Message, path string) (protoreflect.Value, error) {
+	elements, err := parsePath(path)
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	m := msg.ProtoReflect()
+	for i, el := range elements {
+		field, err := el.findField(m)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("path %q: %w", path, err)
+		}
+		val := m.Get(field)
+		if el.subscript != nil {
+			val, err = getSubscript(field, val, *el.subscript)
+			if err != nil {
+				return protoreflect.Value{}, fmt.Errorf("path %q: %w", path, err)
+			}
+		}
+		if i == len(elements)-1 {
+			return val, nil
+		}
+		if !isMessageValue(field, el.subscript != nil) {
+			return protoreflect.Value{}, fmt.Errorf("path %q: %s is not a message", path, el)
+		}
+		m = val.Message()
+	}
+	panic("unreachable")
+}
+
+// SetByPath sets the value at the given path in msg. See GetByPath for the
+// syntax of the path. Any unset message fields in the path are set to empty
+// messages, and any missing map entries in the path are added. An index equal
+// to the length of a list appends to the list.
+//
+// If the given value is a message, or a list or map of messages, whose concrete
+// type differs from the one msg uses for the field, it is converted. This is the
+// case, for example, when the value is a dynamic message and the field is in a
+// generated message. Lists and maps are always copied, since they cannot be
+// shared with another message.
+//
+// An error is returned if the path is invalid for the message's type, if a
+// list index is out of range, or if the given value is not the right type for
+// the element at the end of the path.
+func SetByPath(msg proto.Message, path string, val protoreflect.Value) error {
+	elements, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	m := msg.ProtoReflect()
+	for i, el := range elements {
+		field, err := el.findField(m)
+		if err != nil {
+			return fmt.Errorf("path %q: %w", path, err)
+		}
+		last := i == len(elements)-1
+		if last {
+			if err := checkValueType(field, val, el.subscript != nil); err != nil {
+				return fmt.Errorf("path %q: %w", path, err)
+			}
+			if val, err = convertValue(m, field, val, el.subscript != nil); err != nil {
+				return fmt.Errorf("path %q: %w", path, err)
+			}
+		} else if !isMessageValue(field, el.subscript != nil) {
+			return fmt.Errorf("path %q: %s is not a message", path, el)
+		}
+
+		if el.subscript == nil {
+			if last {
+				m.Set(field, val)
+				return nil
+			}
+			m = m.Mutable(field).Message()
+			continue
+		}
+
+		switch {
+		case field.IsList():
+			list := m.Mutable(field).List()
+			index, err := parseListIndex(*el.subscript, list.Len()+1)
+			if err != nil {
+				return fmt.Errorf("path %q: %w", path, err)
+			}
+			if index == list.Len() {
+				if !last {
+					list.Append(list.NewElement())
+				} else {
+					list.Append(val)
+					return nil
+				}
+			} else if last {
+				list.Set(index, val)
+				return nil
+			}
+			m = list.Get(index).Message()
+		case field.IsMap():
+			key, err := parseMapKey(field.MapKey(), *el.subscript)
+			if err != nil {
+				return fmt.Errorf("path %q: %w", path, err)
+			}
+			mp := m.Mutable(field).Map()
+			if last {
+				mp.Set(key, val)
+				return nil
+			}
+			m = mp.Mutable(key).Message()
+		}
+	}
+	panic("unreachable")
+}
+
+type pathElement struct {
+	name        string
+	isExtension bool
+	// nil if there is no subscript
+	subscript *string
+}
+
+func (el pathElement) String() string {
+	name := el.name
+	if el.isExtension {
+		name = "(" + name + ")"
+	}
+	if el.subscript != nil {
+		name += "[" + *el.subscript + "]"
+	}
+	return name
+}
+
+func (el pathElement) findField(m protoreflect.Message) (protoreflect.FieldDescriptor, error) {
+	md := m.Descriptor()
+	var field protoreflect.FieldDescriptor
+	if el.isExtension {
+		name := protoreflect.FullName(el.name)
+		// check extensions already present in the message first, so that
+		// dynamic extensions can be found
+		m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.IsExtension() && fd.FullName() == name {
+				field = fd
+				return false
+			}
+			return true
+		})
+		if field == nil {
+			xt, err := protoregistry.GlobalTypes.FindExtensionByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("unknown extension %s: %w", name, err)
+			}
+			field = xt.TypeDescriptor()
+		}
+		if field.ContainingMessage().FullName() != md.FullName() {
+			return nil, fmt.Errorf("extension %s does not extend %s", name, md.FullName())
+		}
+	} else {
+		fields := md.Fields()
+		field = fields.ByName(protoreflect.Name(el.name))
+		if field == nil {
+			field = fields.ByJSONName(el.name)
+		}
+		if field == nil {
+			return nil, fmt.Errorf("message %s has no field named %q", md.FullName(), el.name)
+		}
+	}
+	if el.subscript != nil && !field.IsList() && !field.IsMap() {
+		return nil, fmt.Errorf("%s cannot be subscripted: field is neither repeated nor a map", el)
+	}
+	return field, nil
+}
+
+func parsePath(path string) ([]pathElement, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+	var elements []pathElement
+	remaining := path
+	for {
+		var el pathElement
+		if strings.HasPrefix(remaining, "(") {
+			end := strings.IndexByte(remaining, ')')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: missing ')'", path)
+			}
+			el.name, el.isExtension = remaining[1:end], true
+			remaining = remaining[end+1:]
+		} else {
+			end := strings.IndexAny(remaining, ".[")
+			if end < 0 {
+				end = len(remaining)
+			}
+			el.name = remaining[:end]
+			remaining = remaining[end:]
+		}
+		if el.name == "" {
+			return nil, fmt.Errorf("path %q: missing field name", path)
+		}
+		if strings.HasPrefix(remaining, "[") {
+			var subscript string
+			if strings.HasPrefix(remaining, `["`) {
+				quoted, err := strconv.QuotedPrefix(remaining[1:])
+				if err != nil {
+					return nil, fmt.Errorf("path %q: invalid quoted map key: %w", path, err)
+				}
+				subscript = quoted
+			} else {
+				end := strings.IndexByte(remaining, ']')
+				if end < 0 {
+					return nil, fmt.Errorf("path %q: missing ']'", path)
+				}
+				subscript = remaining[1:end]
+			}
+			remaining = remaining[len(subscript)+1:]
+			if !strings.HasPrefix(remaining, "]") {
+				return nil, fmt.Errorf("path %q: missing ']'", path)
+			}
+			remaining = remaining[1:]
+			el.subscript = &subscript
+		}
+		elements = append(elements, el)
+		if remaining == "" {
+			return elements, nil
+		}
+		if remaining[0] != '.' {
+			return nil, fmt.Errorf("path %q: expecting '.' but got %q", path, remaining[0])
+		}
+		remaining = remaining[1:]
+	}
+}
+
+func isMessageValue(field protoreflect.FieldDescriptor, subscripted bool) bool {
+	switch {
+	case field.IsMap():
+		return subscripted && internal.IsMessageKind(field.MapValue().Kind())
+	case field.IsList():
+		return subscripted && internal.IsMessageKind(field.Kind())
+	default:
+		return internal.IsMessageKind(field.Kind())
+	}
+}
+
+func getSubscript(field protoreflect.FieldDescriptor, val protoreflect.Value, subscript string) (protoreflect.Value, error) {
+	if field.IsList() {
+		list := val.List()
+		index, err := parseListIndex(subscript, list.Len())
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return list.Get(index), nil
+	}
+	key, err := parseMapKey(field.MapKey(), subscript)
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	mapVal := val.Map().Get(key)
+	if !mapVal.IsValid() {
+		return protoreflect.Value{}, fmt.Errorf("map %s has no entry for key %s", field.Name(), subscript)
+	}
+	return mapVal, nil
+}
+
+func parseListIndex(subscript string, limit int) (int, error) {
+	index, err := strconv.Atoi(subscript)
+	if err != nil {
+		return 0, fmt.Errorf("invalid list index %q", subscript)
+	}
+	if index < 0 || index >= limit {
+		return 0, fmt.Errorf("list index %d is out of range", index)
+	}
+	return index, nil
+}
+
+func parseMapKey(keyField protoreflect.FieldDescriptor, subscript string) (protoreflect.MapKey, error) {
+	var key protoreflect.Value
+	switch keyField.Kind() {
+	case protoreflect.StringKind:
+		if strings.HasPrefix(subscript, `"`) {
+			str, err := strconv.Unquote(subscript)
+			if err != nil {
+				return protoreflect.MapKey{}, fmt.Errorf("invalid map key %s: %w", subscript, err)
+			}
+			subscript = str
+		}
+		key = protoreflect.ValueOfString(subscript)
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(subscript)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("invalid bool map key %q", subscript)
+		}
+		key = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(subscript, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("invalid int32 map key %q", subscript)
+		}
+		key = protoreflect.ValueOfInt32(int32(i))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(subscript, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("invalid int64 map key %q", subscript)
+		}
+		key = protoreflect.ValueOfInt64(i)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		u, err := strconv.ParseUint(subscript, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("invalid uint32 map key %q", subscript)
+		}
+		key = protoreflect.ValueOfUint32(uint32(u))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		u, err := strconv.ParseUint(subscript, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("invalid uint64 map key %q", subscript)
+		}
+		key = protoreflect.ValueOfUint64(u)
+	default:
+		return protoreflect.MapKey{}, fmt.Errorf("unsupported map key kind %v", keyField.Kind())
+	}
+	return key.MapKey(), nil
+}
+
+// checkValueType returns an error if the given value cannot be stored in the
+// given field. If element is true, the value is for an element of a list or
+// a value in a map instead of for the whole field.
+func checkValueType(field protoreflect.FieldDescriptor, val protoreflect.Value, element bool) error {
+	if !val.IsValid() {
+		return fmt.Errorf("invalid value for field %s", field.FullName())
+	}
+	switch {
+	case field.IsList() && !element:
+		list, ok := val.Interface().(protoreflect.List)
+		if !ok {
+			return fmt.Errorf("field %s requires a list value, got %T", field.FullName(), val.Interface())
+		}
+		for i, length := 0, list.Len(); i < length; i++ {
+			if err := checkElementType(field, list.Get(i)); err != nil {
+				return fmt.Errorf("list element %d: %w", i, err)
+			}
+		}
+		return nil
+	case field.IsMap() && !element:
+		mp, ok := val.Interface().(protoreflect.Map)
+		if !ok {
+			return fmt.Errorf("field %s requires a map value, got %T", field.FullName(), val.Interface())
+		}
+		var err error
+		mp.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			if err = checkElementType(field.MapKey(), k.Value()); err != nil {
+				err = fmt.Errorf("map key %v: %w", k.Interface(), err)
+				return false
+			}
+			if err = checkElementType(field.MapValue(), v); err != nil {
+				err = fmt.Errorf("map value for key %v: %w", k.Interface(), err)
+				return false
+			}
+			return true
+		})
+		return err
+	case field.IsMap():
+		return checkElementType(field.MapValue(), val)
+	default:
+		return checkElementType(field, val)
+	}
+}
+
+// checkElementType returns an error if the given value is not the right type
+// for the kind of the given field. For a repeated field, the value is one
+// element of the list.
+func checkElementType(field protoreflect.FieldDescriptor, val protoreflect.Value) error {
+	if !val.IsValid() {
+		return fmt.Errorf("invalid value for field %s", field.FullName())
+	}
+	var ok bool
+	switch v := val.Interface().(type) {
+	case bool:
+		ok = field.Kind() == protoreflect.BoolKind
+	case int32:
+		ok = field.Kind() == protoreflect.Int32Kind || field.Kind() == protoreflect.Sint32Kind || field.Kind() == protoreflect.Sfixed32Kind
+	case int64:
+		ok = field.Kind() == protoreflect.Int64Kind || field.Kind() == protoreflect.Sint64Kind || field.Kind() == protoreflect.Sfixed64Kind
+	case uint32:
+		ok = field.Kind() == protoreflect.Uint32Kind || field.Kind() == protoreflect.Fixed32Kind
+	case uint64:
+		ok = field.Kind() == protoreflect.Uint64Kind || field.Kind() == protoreflect.Fixed64Kind
+	case float32:
+		ok = field.Kind() == protoreflect.FloatKind
+	case float64:
+		ok = field.Kind() == protoreflect.DoubleKind
+	case string:
+		ok = field.Kind() == protoreflect.StringKind
+	case []byte:
+		ok = field.Kind() == protoreflect.BytesKind
+	case protoreflect.EnumNumber:
+		ok = field.Kind() == protoreflect.EnumKind
+	case protoreflect.Message:
+		ok = internal.IsMessageKind(field.Kind()) && v.Descriptor().FullName() == field.Message().FullName()
+	}
+	if !ok {
+		if msg, isMsg := val.Interface().(protoreflect.Message); isMsg {
+			return fmt.Errorf("message of type %s cannot be stored in field %s of kind %v", msg.Descriptor().FullName(), field.FullName(), field.Kind())
+		}
+		return fmt.Errorf("value of type %T cannot be stored in field %s of kind %v", val.Interface(), field.FullName(), field.Kind())
+	}
+	return nil
+}
+
+// convertValue returns the given value in a form that can be stored in the
+// given field of m. The value must have already been checked by
+// checkValueType. If element is true, the value is for an element of a list
+// or a value in a map instead of for the whole field.
+func convertValue(m protoreflect.Message, field protoreflect.FieldDescriptor, val protoreflect.Value, element bool) (protoreflect.Value, error) {
+	switch {
+	case field.IsList() && !element:
+		src, dst := val.List(), m.NewField(field).List()
+		for i, length := 0, src.Len(); i < length; i++ {
+			elem, err := convertElement(dst.NewElement(), src.Get(i))
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			dst.Append(elem)
+		}
+		return protoreflect.ValueOfList(dst), nil
+	case field.IsMap() && !element:
+		src, dst := val.Map(), m.NewField(field).Map()
+		var err error
+		src.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			v, err = convertElement(dst.NewValue(), v)
+			if err != nil {
+				return false
+			}
+			dst.Set(k, v)
+			return true
+		})
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfMap(dst), nil
+	case field.IsList():
+		return convertElement(m.NewField(field).List().NewElement(), val)
+	case field.IsMap():
+		return convertElement(m.NewField(field).Map().NewValue(), val)
+	default:
+		return convertElement(m.NewField(field), val)
+	}
+}
+
+// convertElement converts val, if it is a message, to the same concrete type
+// as zero, a new value for the field in which val is to be stored.
+func convertElement(zero, val protoreflect.Value) (protoreflect.Value, error) {
+	target, ok := zero.Interface().(protoreflect.Message)
+	if !ok {
+		return val, nil
+	}
+	src := val.Message()
+	if src.Descriptor() == target.Descriptor() && reflect.TypeOf(src.Interface()) == reflect.TypeOf(target.Interface()) {
+		return val, nil
+	}
+	data, err := proto.Marshal(src.Interface())
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	if err := proto.Unmarshal(data, target.Interface()); err != nil {
+		return protoreflect.Value{}, err
+	}
+	return protoreflect.ValueOfMessage(target), nil
+}
@@ -0,0 +1,190 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestGetAndSetByPath(t *testing.T) {
+	md := (&testprotos.AnotherTestMessage{}).ProtoReflect().Descriptor()
+	for _, dynamic := range []bool{false, true} {
+		var msg proto.Message = &testprotos.AnotherTestMessage{}
+		if dynamic {
+			msg = dynamicpb.NewMessage(md)
+		}
+
+		// unset intermediate messages produce default values
+		val, err := GetByPath(msg, "rocknroll.beatles")
+		require.NoError(t, err)
+		require.Equal(t, "", val.String())
+
+		require.NoError(t, SetByPath(msg, "rocknroll.beatles", protoreflect.ValueOfString("abbey road")))
+		require.NoError(t, SetByPath(msg, `map_field4["a b"].mapField1[3]`, protoreflect.ValueOfString("three")))
+		require.NoError(t, SetByPath(msg, "map_field4[c].map_field3[7]", protoreflect.ValueOfBool(true)))
+		require.NoError(t, SetByPath(msg, "(testprotos.xtm).anm.yanm[0].foo", protoreflect.ValueOfString("foo")))
+		require.NoError(t, SetByPath(msg, "(testprotos.xtm).anm.yanm[1].tm.ne[0]", protoreflect.ValueOfEnum(2)))
+		require.NoError(t, SetByPath(msg, "(testprotos.xtm).anm.yanm[0].bar", protoreflect.ValueOfInt32(42)))
+
+		expected := &testprotos.AnotherTestMessage{
+			Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Beatles: proto.String("abbey road")},
+			MapField4: map[string]*testprotos.AnotherTestMessage{
+				"a b": {MapField1: map[int32]string{3: "three"}},
+				"c":   {MapField3: map[uint32]bool{7: true}},
+			},
+		}
+		proto.SetExtension(expected, testprotos.E_Xtm, &testprotos.TestMessage{
+			Anm: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage{
+				Yanm: []*testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage{
+					{Foo: proto.String("foo"), Bar: proto.Int32(42)},
+					{Tm: &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE2}}},
+				},
+			},
+		})
+		actual, err := As[*testprotos.AnotherTestMessage](msg)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(expected, actual))
+
+		val, err = GetByPath(msg, `map_field4["a b"].map_field1[3]`)
+		require.NoError(t, err)
+		require.Equal(t, "three", val.String())
+		val, err = GetByPath(msg, "(testprotos.xtm).anm.yanm[1].tm.ne[0]")
+		require.NoError(t, err)
+		require.Equal(t, protoreflect.EnumNumber(2), val.Enum())
+		val, err = GetByPath(msg, "(testprotos.xtm).anm.yanm")
+		require.NoError(t, err)
+		require.Equal(t, 2, val.List().Len())
+
+		// errors
+		_, err = GetByPath(msg, "(testprotos.xtm).anm.yanm[2]")
+		require.ErrorContains(t, err, "list index 2 is out of range")
+		_, err = GetByPath(msg, "map_field4[d]")
+		require.ErrorContains(t, err, "map map_field4 has no entry for key d")
+		_, err = GetByPath(msg, "map_field1[abc]")
+		require.ErrorContains(t, err, `invalid int32 map key "abc"`)
+		_, err = GetByPath(msg, "rocknroll.beatles.foo")
+		require.ErrorContains(t, err, "beatles is not a message")
+		_, err = GetByPath(msg, "map_field4.str")
+		require.ErrorContains(t, err, "map_field4 is not a message")
+		_, err = GetByPath(msg, "rocknroll[0]")
+		require.ErrorContains(t, err, "field is neither repeated nor a map")
+		_, err = GetByPath(msg, "foo")
+		require.ErrorContains(t, err, `message testprotos.AnotherTestMessage has no field named "foo"`)
+		_, err = GetByPath(msg, "(testprotos.xs).foo")
+		require.ErrorContains(t, err, "(testprotos.xs) is not a message")
+		_, err = GetByPath(msg, "rocknroll.(testprotos.xtm)")
+		require.ErrorContains(t, err, "extension testprotos.xtm does not extend testprotos.AnotherTestMessage.RockNRoll")
+		_, err = GetByPath(msg, "rocknroll..beatles")
+		require.ErrorContains(t, err, "missing field name")
+		_, err = GetByPath(msg, "map_field1[1")
+		require.ErrorContains(t, err, "missing ']'")
+		err = SetByPath(msg, "rocknroll.beatles", protoreflect.ValueOfInt32(1))
+		require.ErrorContains(t, err, "value of type int32 cannot be stored in field testprotos.AnotherTestMessage.RockNRoll.beatles of kind string")
+		err = SetByPath(msg, "(testprotos.xtm).anm.yanm[3].foo", protoreflect.ValueOfString("foo"))
+		require.ErrorContains(t, err, "list index 3 is out of range")
+		err = SetByPath(msg, "map_field1", protoreflect.ValueOfString("foo"))
+		require.ErrorContains(t, err, "requires a map value")
+		err = SetByPath(msg, "(testprotos.xs)[0]", protoreflect.ValueOfString("foo"))
+		require.ErrorContains(t, err, "(testprotos.xs)[0] cannot be subscripted: field is neither repeated nor a map")
+
+		// whole maps must have the right key and value types
+		wrongKeys := (&testprotos.AnotherTestMessage{MapField3: map[uint32]bool{1: true}}).ProtoReflect().Get(md.Fields().ByName("map_field3"))
+		err = SetByPath(msg, "map_field1", wrongKeys)
+		require.ErrorContains(t, err, "map key 1: value of type uint32 cannot be stored in field testprotos.AnotherTestMessage.MapField1Entry.key of kind int32")
+		err = SetByPath(msg, "map_field1", protoreflect.ValueOfMap(intToIntMap(t, 1, 2)))
+		require.ErrorContains(t, err, "map value for key 1: value of type int32 cannot be stored in field testprotos.AnotherTestMessage.MapField1Entry.value of kind string")
+	}
+}
+
+func TestSetByPath_WrongListElementType(t *testing.T) {
+	strs := (&descriptorpb.FileDescriptorProto{Dependency: []string{"a.proto"}}).ProtoReflect()
+	strList := strs.Get(strs.Descriptor().Fields().ByName("dependency"))
+	fd := &descriptorpb.FileDescriptorProto{}
+	err := SetByPath(fd, "public_dependency", strList)
+	require.ErrorContains(t, err, "list element 0: value of type string cannot be stored in field google.protobuf.FileDescriptorProto.public_dependency of kind int32")
+	require.Empty(t, fd.PublicDependency)
+
+	msgs := (&descriptorpb.FileDescriptorProto{MessageType: []*descriptorpb.DescriptorProto{{}}}).ProtoReflect()
+	msgList := msgs.Get(msgs.Descriptor().Fields().ByName("message_type"))
+	err = SetByPath(fd, "enum_type", msgList)
+	require.ErrorContains(t, err, "list element 0: message of type google.protobuf.DescriptorProto cannot be stored in field google.protobuf.FileDescriptorProto.enum_type of kind message")
+}
+
+func TestSetByPath_MixedGeneratedAndDynamic(t *testing.T) {
+	// a copy of descriptor.proto, so that descriptors are not the same
+	// instances as those used by the generated types
+	file, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto), nil)
+	require.NoError(t, err)
+	dynOpts := dynamicpb.NewMessage(file.Messages().ByName("FileOptions"))
+	require.NoError(t, SetByPath(dynOpts, "go_package", protoreflect.ValueOfString("foo/bar")))
+	dynMsg := dynamicpb.NewMessage(file.Messages().ByName("DescriptorProto"))
+	require.NoError(t, SetByPath(dynMsg, "name", protoreflect.ValueOfString("Foo")))
+
+	// dynamic messages stored in a generated message
+	fd := &descriptorpb.FileDescriptorProto{}
+	require.NoError(t, SetByPath(fd, "options", protoreflect.ValueOfMessage(dynOpts)))
+	require.NoError(t, SetByPath(fd, "message_type[0]", protoreflect.ValueOfMessage(dynMsg)))
+	dynFile := dynamicpb.NewMessage(file.Messages().ByName("FileDescriptorProto"))
+	require.NoError(t, SetByPath(dynFile, "message_type[0]", protoreflect.ValueOfMessage(dynMsg)))
+	require.NoError(t, SetByPath(fd, "enum_type[0].name", protoreflect.ValueOfString("Bar")))
+	require.NoError(t, SetByPath(fd, "message_type[1]", protoreflect.ValueOfMessage(dynMsg)))
+	// whole list from a dynamic message
+	val, err := GetByPath(dynFile, "message_type")
+	require.NoError(t, err)
+	other := &descriptorpb.FileDescriptorProto{}
+	require.NoError(t, SetByPath(other, "message_type", val))
+	require.True(t, proto.Equal(&descriptorpb.FileDescriptorProto{
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Foo")}},
+	}, other))
+
+	require.True(t, proto.Equal(&descriptorpb.FileDescriptorProto{
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("foo/bar")},
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Foo")}, {Name: proto.String("Foo")}},
+		EnumType:    []*descriptorpb.EnumDescriptorProto{{Name: proto.String("Bar")}},
+	}, fd))
+
+	// generated message stored in a dynamic message
+	require.NoError(t, SetByPath(dynFile, "options", protoreflect.ValueOfMessage(fd.Options.ProtoReflect())))
+	val, err = GetByPath(dynFile, "options.go_package")
+	require.NoError(t, err)
+	require.Equal(t, "foo/bar", val.String())
+}
+
+// intToIntMap returns a map<int32, int32> with the given key and value.
+func intToIntMap(t *testing.T, key, val int32) protoreflect.Map {
+	entry := &descriptorpb.DescriptorProto{
+		Name: proto.String("MEntry"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			{Name: proto.String("key"), Number: proto.Int32(1), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()},
+			{Name: proto.String("value"), Number: proto.Int32(2), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()},
+		},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("int_map.proto"),
+		Package: proto.String("test"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:       proto.String("IntMap"),
+			NestedType: []*descriptorpb.DescriptorProto{entry},
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("m"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".test.IntMap.MEntry"),
+			}},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	md := file.Messages().ByName("IntMap")
+	mp := dynamicpb.NewMessage(md).NewField(md.Fields().ByName("m")).Map()
+	mp.Set(protoreflect.ValueOfInt32(key).MapKey(), protoreflect.ValueOfInt32(val))
+	return mp
+}
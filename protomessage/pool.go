@@ -0,0 +1,74 @@
+package protomessage
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Pool is a pool of messages that can be reused, to reduce allocations and
+// garbage collection pressure in programs that create many short-lived
+// messages. It is typically used with dynamic messages, in servers and
+// proxies that decode a large volume of messages whose types are only known
+// at runtime.
+//
+// Messages are pooled by type. To get a dynamic message for a descriptor,
+// use dynamicpb.NewMessageType(md) as the type: dynamic message types for the
+// same descriptor share the same pool.
+//
+// The zero value is ready to use. A Pool is safe for concurrent use. Like a
+// sync.Pool, it may discard pooled messages at any time.
+type Pool struct {
+	pools sync.Map // protoreflect.MessageType -> *sync.Pool
+}
+
+// Get returns an empty message of the given type. It is either a message
+// that was previously put into the pool or, if there are none, a newly
+// created one.
+func (p *Pool) Get(mt protoreflect.MessageType) proto.Message {
+	if msg, ok := p.pool(mt).Get().(proto.Message); ok {
+		return msg
+	}
+	return mt.New().Interface()
+}
+
+// Put clears the given message and returns it to the pool. All fields,
+// including extensions and unknown fields, are cleared. Clearing keeps the
+// message's own storage, so it can be reused without allocating again.
+//
+// The caller must not use the message after putting it into the pool. This
+// includes any other messages, lists, or maps that were referenced by the
+// message's fields.
+func (p *Pool) Put(msg proto.Message) {
+	m := msg.ProtoReflect()
+	if !m.IsValid() {
+		// read-only message can't be reused
+		return
+	}
+	Reset(m)
+	p.pool(m.Type()).Put(msg)
+}
+
+func (p *Pool) pool(mt protoreflect.MessageType) *sync.Pool {
+	if pool, ok := p.pools.Load(mt); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := p.pools.LoadOrStore(mt, &sync.Pool{})
+	return pool.(*sync.Pool)
+}
+
+// Reset clears all fields of the given message, including extensions and
+// unknown fields. Unlike proto.Reset, this clears the fields individually,
+// which allows implementations, like dynamic messages, to keep the storage
+// they have already allocated instead of replacing it.
+func Reset(msg protoreflect.Message) {
+	msg.Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		// mutating the current field is allowed during iteration
+		msg.Clear(field)
+		return true
+	})
+	if len(msg.GetUnknown()) > 0 {
+		msg.SetUnknown(nil)
+	}
+}
@@ -0,0 +1,52 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestPool(t *testing.T) {
+	populated := &testprotos.AnotherTestMessage{
+		Dne:       testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage_VALUE1.Enum(),
+		MapField1: map[int32]string{1: "a", 2: "b"},
+		Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Beatles: proto.String("x")},
+		Atmoo:     &testprotos.AnotherTestMessage_Str{Str: "s"},
+	}
+	proto.SetExtension(populated, testprotos.E_Xtm, &testprotos.TestMessage{})
+	populated.ProtoReflect().SetUnknown([]byte{0xa8, 0x1f, 0x01}) // tag 501, varint 1
+	md := populated.ProtoReflect().Descriptor()
+
+	var pool Pool
+	for _, dynamic := range []bool{false, true} {
+		msg := proto.Clone(populated)
+		if dynamic {
+			msg = toDynamic(t, msg)
+		}
+		require.NotZero(t, proto.Size(msg))
+		pool.Put(msg)
+		// message is cleared when returned to the pool
+		require.Zero(t, proto.Size(msg))
+
+		var got proto.Message
+		if dynamic {
+			got = pool.Get(dynamicpb.NewMessageType(md))
+			require.IsType(t, (*dynamicpb.Message)(nil), got)
+		} else {
+			got = pool.Get(populated.ProtoReflect().Type())
+			require.IsType(t, (*testprotos.AnotherTestMessage)(nil), got)
+		}
+		require.Zero(t, proto.Size(got))
+		// can be reused
+		data, err := proto.Marshal(populated)
+		require.NoError(t, err)
+		require.NoError(t, proto.Unmarshal(data, got))
+		actual, err := As[*testprotos.AnotherTestMessage](got)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(populated, actual))
+	}
+}
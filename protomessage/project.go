@@ -0,0 +1,81 @@
+package protomessage
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Project returns a new message, of the same type as msg, that contains only
+// the fields of msg named by the given paths. This is useful for producing
+// trimmed responses or copies of a message with sensitive fields removed,
+// without having to clear every other field. The given message is not
+// modified, and the returned message does not share any mutable state with it.
+//
+// Each path is a dot-separated sequence of field names, like in a field mask.
+// Unlike field masks, a path may traverse repeated and map fields whose
+// elements are messages, in which case the rest of the path is applied to
+// every element. For example, "items.name" keeps only the name field of every
+// element in the items field. Fields that are not set in msg are not set in
+// the result. If no paths are given, the result is an empty message.
+//
+// An error is returned if any path is invalid for the type of msg.
+func Project[T proto.Message](msg T, paths ...string) (T, error) {
+	src := msg.ProtoReflect()
+	var tree maskTree
+	for _, path := range paths {
+		fields, err := resolvePath(src.Descriptor(), path, true)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		tree.add(fields)
+	}
+	dst := src.New()
+	project(dst, src, tree)
+	return dst.Interface().(T), nil
+}
+
+// ProjectWithMask is like Project, except that the paths are provided by
+// the given field mask.
+func ProjectWithMask[T proto.Message](msg T, mask *fieldmaskpb.FieldMask) (T, error) {
+	return Project(msg, mask.GetPaths()...)
+}
+
+func project(dst, src protoreflect.Message, tree maskTree) {
+	for _, node := range tree {
+		field := node.field
+		if !src.Has(field) {
+			continue
+		}
+		switch {
+		case field.IsList():
+			srcList, dstList := src.Get(field).List(), dst.Mutable(field).List()
+			for i, length := 0, srcList.Len(); i < length; i++ {
+				if node.children == nil {
+					dstList.Append(cloneValue(srcList.Get(i)))
+					continue
+				}
+				elem := dstList.NewElement()
+				project(elem.Message(), srcList.Get(i).Message(), node.children)
+				dstList.Append(elem)
+			}
+		case field.IsMap():
+			dstMap := dst.Mutable(field).Map()
+			src.Get(field).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				if node.children == nil {
+					dstMap.Set(k, cloneValue(v))
+					return true
+				}
+				val := dstMap.NewValue()
+				project(val.Message(), v.Message(), node.children)
+				dstMap.Set(k, val)
+				return true
+			})
+		case node.children != nil:
+			project(dst.Mutable(field).Message(), src.Get(field).Message(), node.children)
+		default:
+			dst.Set(field, cloneValue(src.Get(field)))
+		}
+	}
+}
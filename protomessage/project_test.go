@@ -0,0 +1,89 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestProject(t *testing.T) {
+	req := &testprotos.TestRequest{
+		Foo: []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1},
+		Bar: "abc",
+		Baz: &testprotos.TestMessage{
+			Nm: &testprotos.TestMessage_NestedMessage{},
+			Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1},
+		},
+		Snafu: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage{
+			Yanm: []*testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage{
+				{Foo: proto.String("a"), Bar: proto.Int32(1)},
+				{Foo: proto.String("b"), Baz: []byte{1, 2, 3}},
+			},
+		},
+		Flags: map[string]bool{"x": true},
+		Others: map[string]*testprotos.TestMessage{
+			"y": {
+				Nm: &testprotos.TestMessage_NestedMessage{},
+				Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1},
+			},
+		},
+	}
+	for _, msg := range []proto.Message{req, toDynamic(t, req)} {
+		orig := proto.Clone(msg)
+		result, err := Project(msg, "bar", "baz.ne", "snafu.yanm.foo", "others.nm", "flags", "baz.anm")
+		require.NoError(t, err)
+		requireProjection(t, result, &testprotos.TestRequest{
+			Bar: "abc",
+			Baz: &testprotos.TestMessage{
+				Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1},
+			},
+			Snafu: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage{
+				Yanm: []*testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage{
+					{Foo: proto.String("a")},
+					{Foo: proto.String("b")},
+				},
+			},
+			Flags: map[string]bool{"x": true},
+			Others: map[string]*testprotos.TestMessage{
+				"y": {Nm: &testprotos.TestMessage_NestedMessage{}},
+			},
+		})
+		// source is unchanged
+		require.True(t, proto.Equal(orig, msg))
+
+		// a path subsumes longer paths that it contains
+		result, err = ProjectWithMask(msg, &fieldmaskpb.FieldMask{Paths: []string{"snafu.yanm.bar", "snafu"}})
+		require.NoError(t, err)
+		requireProjection(t, result, &testprotos.TestRequest{Snafu: req.Snafu})
+
+		result, err = Project(msg)
+		require.NoError(t, err)
+		requireProjection(t, result, &testprotos.TestRequest{})
+
+		_, err = Project(msg, "baz.foo")
+		require.ErrorContains(t, err, `message testprotos.TestMessage has no field named "foo"`)
+		_, err = Project(msg, "bar.foo")
+		require.ErrorContains(t, err, "bar is not a message field")
+		_, err = Project(msg, "flags.key")
+		require.ErrorContains(t, err, "flags is not a message field")
+	}
+}
+
+func TestProject_PreservesType(t *testing.T) {
+	req := &testprotos.TestRequest{Bar: "abc", Flags: map[string]bool{"x": true}}
+	result, err := Project(req, "bar")
+	require.NoError(t, err)
+	require.Equal(t, "abc", result.Bar)
+	require.Empty(t, result.Flags)
+}
+
+func requireProjection(t *testing.T, actual proto.Message, expected *testprotos.TestRequest) {
+	t.Helper()
+	actualReq, err := As[*testprotos.TestRequest](actual)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(expected, actualReq), "%v", actualReq)
+}
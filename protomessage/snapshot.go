@@ -0,0 +1,222 @@
+package protomessage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Snapshot is a compact, read-only view of a message's fields. It holds the
+// message's serialized bytes along with an index from field number to the
+// location of each of the field's values in those bytes. It does not retain
+// the message itself or any of its descriptors, so it uses much less memory
+// than a dynamic message. That makes it suitable for environments where
+// memory is tightly constrained but where some fields of a message must be
+// queried.
+//
+// Querying a snapshot does not allocate memory. Values are returned in their
+// raw wire format: varint, fixed32, and fixed64 values are returned as
+// integers, and length-delimited values are returned as sub-slices of the
+// snapshot's bytes. Callers must interpret these values according to the
+// field's type, such as by using math.Float64frombits for a double field or
+// protowire.DecodeZigZag for a sint64 field. Length-delimited values include
+// strings, bytes, messages, and packed repeated fields. A length-delimited
+// value for a message field can itself be indexed with NewSnapshotFromBytes.
+//
+// Snapshots are immutable and safe for concurrent use.
+type Snapshot struct {
+	data  []byte
+	index []snapshotEntry
+}
+
+type snapshotEntry struct {
+	number protowire.Number
+	typ    protowire.Type
+	// the bounds of the value, not including the tag
+	start, end uint32
+}
+
+// NewSnapshot marshals the given message and returns a snapshot of it. The
+// message is marshaled deterministically. The snapshot does not refer to the
+// given message, so the message may be discarded or modified after this
+// returns.
+func NewSnapshot(msg proto.Message) (*Snapshot, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return NewSnapshotFromBytes(data)
+}
+
+// NewSnapshotFromBytes returns a snapshot of the message whose serialized
+// form is the given bytes. The snapshot refers to the given slice, which must
+// not be modified while the snapshot is in use.
+//
+// An error is returned if the given bytes are not valid wire format. Only the
+// structure of the top-level fields is verified: the bytes of fields whose
+// values are length-delimited, like message fields, are not examined.
+func NewSnapshotFromBytes(data []byte) (*Snapshot, error) {
+	if uint64(len(data)) > math.MaxUint32 {
+		return nil, fmt.Errorf("message is too large for a snapshot: %d bytes", len(data))
+	}
+	var index []snapshotEntry
+	for offset := 0; offset < len(data); {
+		num, typ, n := protowire.ConsumeTag(data[offset:])
+		if n < 0 {
+			return nil, fmt.Errorf("invalid tag at offset %d: %w", offset, protowire.ParseError(n))
+		}
+		offset += n
+		n = protowire.ConsumeFieldValue(num, typ, data[offset:])
+		if n < 0 {
+			return nil, fmt.Errorf("invalid value for field %d at offset %d: %w", num, offset, protowire.ParseError(n))
+		}
+		entry := snapshotEntry{number: num, typ: typ, start: uint32(offset), end: uint32(offset + n)}
+		switch typ {
+		case protowire.BytesType:
+			// skip the length prefix
+			_, prefix := protowire.ConsumeVarint(data[offset:])
+			entry.start += uint32(prefix)
+		case protowire.StartGroupType:
+			// skip the end group tag
+			entry.end -= uint32(protowire.SizeTag(num))
+		}
+		index = append(index, entry)
+		offset += n
+	}
+	// Stable sort keeps values for the same field in the order they appear,
+	// which is significant for repeated fields and for "last one wins"
+	// semantics of non-repeated fields.
+	sort.SliceStable(index, func(i, j int) bool {
+		return index[i].number < index[j].number
+	})
+	return &Snapshot{data: data, index: index}, nil
+}
+
+// Bytes returns the serialized form of the message. The returned slice must
+// not be modified.
+func (s *Snapshot) Bytes() []byte {
+	return s.data
+}
+
+// Unmarshal unmarshals the snapshot's bytes into the given message, to
+// convert the snapshot back into a full message.
+func (s *Snapshot) Unmarshal(msg proto.Message) error {
+	return proto.Unmarshal(s.data, msg)
+}
+
+// Has returns true if the message has at least one value for the given field
+// number.
+func (s *Snapshot) Has(num protowire.Number) bool {
+	return s.Len(num) > 0
+}
+
+// Len returns the number of values present for the given field number. For
+// non-repeated fields, this is usually zero or one. For repeated fields, this
+// is the number of elements, except for packed repeated fields, where each
+// value is a packed sequence of elements.
+func (s *Snapshot) Len(num protowire.Number) int {
+	start, end := s.find(num)
+	return end - start
+}
+
+// Raw returns the i-th value for the given field number, along with its wire
+// type. For length-delimited values, the returned bytes exclude the length
+// prefix. For groups, the returned bytes exclude the end group tag. For other
+// wire types, the returned bytes are the encoded value. This panics if i is
+// not less than Len(num).
+func (s *Snapshot) Raw(num protowire.Number, i int) (protowire.Type, []byte) {
+	start, end := s.find(num)
+	if i < 0 || i >= end-start {
+		panic(fmt.Sprintf("index %d out of range for field %d with %d values", i, num, end-start))
+	}
+	entry := s.index[start+i]
+	return entry.typ, s.data[entry.start:entry.end:entry.end]
+}
+
+// Varint returns the value for the given field number, which must have a
+// varint wire type. If the field has more than one value, the last one is
+// returned, which matches how non-repeated fields are unmarshaled. It returns
+// false if the field has no values or if the last value has a different wire
+// type.
+func (s *Snapshot) Varint(num protowire.Number) (uint64, bool) {
+	typ, raw, ok := s.last(num)
+	if !ok || typ != protowire.VarintType {
+		return 0, false
+	}
+	v, _ := protowire.ConsumeVarint(raw)
+	return v, true
+}
+
+// Fixed32 returns the value for the given field number, which must have a
+// fixed32 wire type. It follows the same rules as Varint.
+func (s *Snapshot) Fixed32(num protowire.Number) (uint32, bool) {
+	typ, raw, ok := s.last(num)
+	if !ok || typ != protowire.Fixed32Type {
+		return 0, false
+	}
+	v, _ := protowire.ConsumeFixed32(raw)
+	return v, true
+}
+
+// Fixed64 returns the value for the given field number, which must have a
+// fixed64 wire type. It follows the same rules as Varint.
+func (s *Snapshot) Fixed64(num protowire.Number) (uint64, bool) {
+	typ, raw, ok := s.last(num)
+	if !ok || typ != protowire.Fixed64Type {
+		return 0, false
+	}
+	v, _ := protowire.ConsumeFixed64(raw)
+	return v, true
+}
+
+// LengthDelimited returns the value for the given field number, which must
+// have a length-delimited wire type, such as a string, bytes, or message
+// field. It follows the same rules as Varint. The returned slice must not be
+// modified.
+//
+// Note that if a message field has more than one value, the unmarshaled
+// message is the result of merging all of them, not just the last one. So
+// for message fields, use Len and Raw to examine all values.
+func (s *Snapshot) LengthDelimited(num protowire.Number) ([]byte, bool) {
+	typ, raw, ok := s.last(num)
+	if !ok || typ != protowire.BytesType {
+		return nil, false
+	}
+	return raw, true
+}
+
+func (s *Snapshot) last(num protowire.Number) (protowire.Type, []byte, bool) {
+	start, end := s.find(num)
+	if start == end {
+		return 0, nil, false
+	}
+	entry := s.index[end-1]
+	return entry.typ, s.data[entry.start:entry.end:entry.end], true
+}
+
+// find returns the range of entries in the index for the given field number.
+// This does not use sort.Search because that may allocate a closure.
+func (s *Snapshot) find(num protowire.Number) (start, end int) {
+	lo, hi := 0, len(s.index)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if s.index[mid].number < num {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	start = lo
+	for hi = len(s.index); lo < hi; {
+		mid := int(uint(lo+hi) >> 1)
+		if s.index[mid].number <= num {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return start, lo
+}
@@ -0,0 +1,119 @@
+package protomessage
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestSnapshot(t *testing.T) {
+	orig := &descriptorpb.FileDescriptorProto{
+		Name:             proto.String("foo.proto"),
+		Dependency:       []string{"a.proto", "b.proto"},
+		PublicDependency: []int32{1},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Foo")},
+		},
+	}
+	for _, msg := range []proto.Message{orig, toDynamic(t, orig)} {
+		snap, err := NewSnapshot(msg)
+		require.NoError(t, err)
+
+		name, ok := snap.LengthDelimited(1)
+		require.True(t, ok)
+		require.Equal(t, "foo.proto", string(name))
+		require.False(t, snap.Has(2))
+		_, ok = snap.LengthDelimited(2)
+		require.False(t, ok)
+		// wrong wire type
+		_, ok = snap.Varint(1)
+		require.False(t, ok)
+
+		require.Equal(t, 2, snap.Len(3))
+		typ, raw := snap.Raw(3, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		require.Equal(t, "a.proto", string(raw))
+		_, raw = snap.Raw(3, 1)
+		require.Equal(t, "b.proto", string(raw))
+		require.Panics(t, func() { snap.Raw(3, 2) })
+
+		dep, ok := snap.Varint(10)
+		require.True(t, ok)
+		require.Equal(t, uint64(1), dep)
+
+		msgBytes, ok := snap.LengthDelimited(4)
+		require.True(t, ok)
+		nested, err := NewSnapshotFromBytes(msgBytes)
+		require.NoError(t, err)
+		nestedName, ok := nested.LengthDelimited(1)
+		require.True(t, ok)
+		require.Equal(t, "Foo", string(nestedName))
+
+		// round-trip
+		roundTripped := msg.ProtoReflect().New().Interface()
+		require.NoError(t, snap.Unmarshal(roundTripped))
+		require.True(t, proto.Equal(msg, roundTripped))
+	}
+
+	snap, err := NewSnapshot(wrapperspb.Double(1.5))
+	require.NoError(t, err)
+	bits, ok := snap.Fixed64(1)
+	require.True(t, ok)
+	require.Equal(t, 1.5, math.Float64frombits(bits))
+
+	snap, err = NewSnapshot(wrapperspb.Float(2.5))
+	require.NoError(t, err)
+	bits32, ok := snap.Fixed32(1)
+	require.True(t, ok)
+	require.Equal(t, float32(2.5), math.Float32frombits(bits32))
+}
+
+func TestSnapshot_LastValueWinsAndGroups(t *testing.T) {
+	var data []byte
+	data = protowire.AppendTag(data, 5, protowire.VarintType)
+	data = protowire.AppendVarint(data, 1)
+	data = protowire.AppendTag(data, 2, protowire.StartGroupType)
+	data = protowire.AppendTag(data, 1, protowire.VarintType)
+	data = protowire.AppendVarint(data, 99)
+	data = protowire.AppendTag(data, 2, protowire.EndGroupType)
+	data = protowire.AppendTag(data, 5, protowire.VarintType)
+	data = protowire.AppendVarint(data, 2)
+
+	snap, err := NewSnapshotFromBytes(data)
+	require.NoError(t, err)
+	require.Equal(t, 2, snap.Len(5))
+	v, ok := snap.Varint(5)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), v)
+
+	typ, raw := snap.Raw(2, 0)
+	require.Equal(t, protowire.StartGroupType, typ)
+	group, err := NewSnapshotFromBytes(raw)
+	require.NoError(t, err)
+	v, ok = group.Varint(1)
+	require.True(t, ok)
+	require.Equal(t, uint64(99), v)
+
+	_, err = NewSnapshotFromBytes(data[:len(data)-1])
+	require.ErrorContains(t, err, "invalid value for field 5")
+}
+
+func TestSnapshot_NoAllocations(t *testing.T) {
+	snap, err := NewSnapshot(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("foo.proto"),
+		Dependency: []string{"a.proto", "b.proto"},
+	})
+	require.NoError(t, err)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = snap.LengthDelimited(1)
+		_, _ = snap.Raw(3, 1)
+		_, _ = snap.Varint(10)
+		_ = snap.Has(4)
+	})
+	require.Zero(t, allocs)
+}
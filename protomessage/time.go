@@ -0,0 +1,149 @@
+package protomessage
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	timestampTypeName = (&timestamppb.Timestamp{}).ProtoReflect().Descriptor().FullName()
+	durationTypeName  = (&durationpb.Duration{}).ProtoReflect().Descriptor().FullName()
+)
+
+const (
+	// field numbers for seconds and nanos are the same in
+	// both google.protobuf.Timestamp and google.protobuf.Duration
+	secondsTag = 1
+	nanosTag   = 2
+)
+
+// GetTime returns the value of the given field as a time.Time. The given
+// field must be a singular field in msg whose type is google.protobuf.Timestamp.
+// If the field is not set, the zero time.Time is returned.
+//
+// An error is returned if the field is the wrong type or if the timestamp is
+// invalid, such as being outside the range supported by google.protobuf.Timestamp.
+func GetTime(msg proto.Message, field protoreflect.FieldDescriptor) (time.Time, error) {
+	m := msg.ProtoReflect()
+	if err := checkWellKnownField(m, field, timestampTypeName); err != nil {
+		return time.Time{}, err
+	}
+	if !m.Has(field) {
+		return time.Time{}, nil
+	}
+	seconds, nanos := getSecondsAndNanos(m.Get(field).Message())
+	ts := &timestamppb.Timestamp{Seconds: seconds, Nanos: nanos}
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, fmt.Errorf("field %s: %w", field.FullName(), err)
+	}
+	return ts.AsTime(), nil
+}
+
+// SetTime sets the given field to the given time. The given field must be a
+// singular field in msg whose type is google.protobuf.Timestamp. If the given
+// time is the zero time.Time, the field is cleared.
+//
+// An error is returned if the field is the wrong type or if the given time is
+// outside the range supported by google.protobuf.Timestamp.
+func SetTime(msg proto.Message, field protoreflect.FieldDescriptor, t time.Time) error {
+	m := msg.ProtoReflect()
+	if err := checkWellKnownField(m, field, timestampTypeName); err != nil {
+		return err
+	}
+	if t.IsZero() {
+		m.Clear(field)
+		return nil
+	}
+	ts := timestamppb.New(t)
+	if err := ts.CheckValid(); err != nil {
+		return fmt.Errorf("field %s: %w", field.FullName(), err)
+	}
+	setSecondsAndNanos(m, field, ts.GetSeconds(), ts.GetNanos())
+	return nil
+}
+
+// GetDuration returns the value of the given field as a time.Duration. The
+// given field must be a singular field in msg whose type is
+// google.protobuf.Duration. If the field is not set, zero is returned.
+//
+// An error is returned if the field is the wrong type, if the duration is invalid,
+// or if the duration is too large to be represented by a time.Duration (which is
+// limited to approximately 290 years).
+func GetDuration(msg proto.Message, field protoreflect.FieldDescriptor) (time.Duration, error) {
+	m := msg.ProtoReflect()
+	if err := checkWellKnownField(m, field, durationTypeName); err != nil {
+		return 0, err
+	}
+	if !m.Has(field) {
+		return 0, nil
+	}
+	seconds, nanos := getSecondsAndNanos(m.Get(field).Message())
+	dur := &durationpb.Duration{Seconds: seconds, Nanos: nanos}
+	if err := dur.CheckValid(); err != nil {
+		return 0, fmt.Errorf("field %s: %w", field.FullName(), err)
+	}
+	d := dur.AsDuration()
+	if durationpb.New(d).GetSeconds() != seconds {
+		// AsDuration saturates on overflow instead of failing
+		return 0, fmt.Errorf("field %s: duration (%ds) out of range for time.Duration", field.FullName(), seconds)
+	}
+	return d, nil
+}
+
+// SetDuration sets the given field to the given duration. The given field must
+// be a singular field in msg whose type is google.protobuf.Duration. Unlike
+// SetTime, a zero value does not clear the field; use the message's Clear
+// method for that.
+//
+// An error is returned if the field is the wrong type.
+func SetDuration(msg proto.Message, field protoreflect.FieldDescriptor, d time.Duration) error {
+	m := msg.ProtoReflect()
+	if err := checkWellKnownField(m, field, durationTypeName); err != nil {
+		return err
+	}
+	// all time.Duration values are in range for google.protobuf.Duration
+	dur := durationpb.New(d)
+	setSecondsAndNanos(m, field, dur.GetSeconds(), dur.GetNanos())
+	return nil
+}
+
+func checkWellKnownField(msg protoreflect.Message, field protoreflect.FieldDescriptor, typeName protoreflect.FullName) error {
+	if field.ContainingMessage().FullName() != msg.Descriptor().FullName() {
+		return fmt.Errorf("field %s does not belong to message %s", field.FullName(), msg.Descriptor().FullName())
+	}
+	if field.IsList() || field.IsMap() || field.Message() == nil || field.Message().FullName() != typeName {
+		return fmt.Errorf("field %s is not a singular field of type %s", field.FullName(), typeName)
+	}
+	return nil
+}
+
+func getSecondsAndNanos(msg protoreflect.Message) (int64, int32) {
+	fields := msg.Descriptor().Fields()
+	var seconds int64
+	var nanos int32
+	if fld := fields.ByNumber(secondsTag); fld != nil {
+		seconds = msg.Get(fld).Int()
+	}
+	if fld := fields.ByNumber(nanosTag); fld != nil {
+		nanos = int32(msg.Get(fld).Int())
+	}
+	return seconds, nanos
+}
+
+func setSecondsAndNanos(msg protoreflect.Message, field protoreflect.FieldDescriptor, seconds int64, nanos int32) {
+	val := msg.NewField(field)
+	fieldMsg := val.Message()
+	fields := fieldMsg.Descriptor().Fields()
+	if fld := fields.ByNumber(secondsTag); fld != nil {
+		fieldMsg.Set(fld, protoreflect.ValueOfInt64(seconds))
+	}
+	if fld := fields.ByNumber(nanosTag); fld != nil {
+		fieldMsg.Set(fld, protoreflect.ValueOfInt32(nanos))
+	}
+	msg.Set(field, val)
+}
@@ -0,0 +1,79 @@
+package protomessage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestTimeAndDuration(t *testing.T) {
+	md := (&testprotos.TestWellKnownTypes{}).ProtoReflect().Descriptor()
+	timeFld := md.Fields().ByName("start_time")
+	durFld := md.Fields().ByName("elapsed")
+	now := time.Date(2023, 4, 5, 6, 7, 8, 9, time.UTC)
+
+	for _, dynamic := range []bool{false, true} {
+		var msg proto.Message = &testprotos.TestWellKnownTypes{}
+		if dynamic {
+			msg = dynamicpb.NewMessage(md)
+		}
+
+		// unset fields
+		tm, err := GetTime(msg, timeFld)
+		require.NoError(t, err)
+		require.True(t, tm.IsZero())
+		d, err := GetDuration(msg, durFld)
+		require.NoError(t, err)
+		require.Zero(t, d)
+
+		require.NoError(t, SetTime(msg, timeFld, now))
+		tm, err = GetTime(msg, timeFld)
+		require.NoError(t, err)
+		require.True(t, now.Equal(tm))
+		require.NoError(t, SetDuration(msg, durFld, -3*time.Second-5))
+		d, err = GetDuration(msg, durFld)
+		require.NoError(t, err)
+		require.Equal(t, -3*time.Second-5, d)
+
+		// zero time clears the field, zero duration does not
+		require.NoError(t, SetTime(msg, timeFld, time.Time{}))
+		require.False(t, msg.ProtoReflect().Has(timeFld))
+		require.NoError(t, SetDuration(msg, durFld, 0))
+		require.True(t, msg.ProtoReflect().Has(durFld))
+
+		// out of range
+		require.ErrorContains(t, SetTime(msg, timeFld, time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)), "start_time")
+		require.False(t, msg.ProtoReflect().Has(timeFld))
+
+		// wrong field types
+		require.ErrorContains(t, SetTime(msg, durFld, now), "is not a singular field of type google.protobuf.Timestamp")
+		_, err = GetDuration(msg, timeFld)
+		require.ErrorContains(t, err, "is not a singular field of type google.protobuf.Duration")
+		_, err = GetTime(msg, md.Fields().ByName("dbl"))
+		require.Error(t, err)
+		_, err = GetTime(&timestamppb.Timestamp{}, timeFld)
+		require.ErrorContains(t, err, "does not belong to message google.protobuf.Timestamp")
+	}
+
+	// invalid values
+	msg := &testprotos.TestWellKnownTypes{
+		StartTime: &timestamppb.Timestamp{Nanos: -1},
+		Elapsed:   &durationpb.Duration{Seconds: math.MaxInt64},
+	}
+	_, err := GetTime(msg, timeFld)
+	require.ErrorContains(t, err, "testprotos.TestWellKnownTypes.start_time")
+	_, err = GetDuration(msg, durFld)
+	require.ErrorContains(t, err, "testprotos.TestWellKnownTypes.elapsed")
+	// valid protobuf duration, but too large for time.Duration
+	msg.Elapsed = &durationpb.Duration{Seconds: 300 * 365 * 24 * 60 * 60}
+	_, err = GetDuration(msg, durFld)
+	require.ErrorContains(t, err, "out of range for time.Duration")
+}
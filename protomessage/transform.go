@@ -0,0 +1,197 @@
+package protomessage
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protoreflect/v2/internal"
+)
+
+// TransformFunc transforms a value of the given field. For repeated fields,
+// it is called for each element; for map fields, it is called for each value
+// in the map. The returned value must be a valid value for the field (or
+// element or map value). For example, a function that encrypts a string
+// field must return a string, such as the base64-encoding of the ciphertext.
+type TransformFunc func(field protoreflect.FieldDescriptor, val protoreflect.Value) (protoreflect.Value, error)
+
+// TransformFields calls fn for every value of every field in msg, including
+// fields in nested messages, for which match returns true, and replaces the
+// value with the one that fn returns. This can be used to centrally enforce
+// schema-driven data protection, like encrypting or tokenizing sensitive
+// fields. The fields to transform are typically selected via a custom option
+// (see FieldsWithOption).
+//
+// When a field whose type is a message is matched, fn is given the whole
+// message and the fields of that message are not visited. Fields that are
+// not matched are searched for nested messages that may contain matching
+// fields. Extension fields are visited like any other field.
+//
+// The message is modified in place. If fn returns an error, TransformFields
+// stops and returns an error that wraps it. In that case, some fields may
+// have already been transformed.
+func TransformFields(msg proto.Message, match func(protoreflect.FieldDescriptor) bool, fn TransformFunc) error {
+	return transformFields(msg.ProtoReflect(), match, fn)
+}
+
+func transformFields(msg protoreflect.Message, match func(protoreflect.FieldDescriptor) bool, fn TransformFunc) error {
+	var err error
+	msg.Range(func(field protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		if match(field) {
+			err = transformValue(msg, field, val, fn)
+		} else {
+			err = transformContained(field, val, match, fn)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func transformValue(msg protoreflect.Message, field protoreflect.FieldDescriptor, val protoreflect.Value, fn TransformFunc) error {
+	transform := func(v protoreflect.Value) (protoreflect.Value, error) {
+		newVal, err := fn(field, v)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("failed to transform field %s: %w", field.FullName(), err)
+		}
+		return newVal, nil
+	}
+	switch {
+	case field.IsList():
+		list := val.List()
+		for i, length := 0, list.Len(); i < length; i++ {
+			newVal, err := transform(list.Get(i))
+			if err != nil {
+				return err
+			}
+			list.Set(i, newVal)
+		}
+	case field.IsMap():
+		var err error
+		mapVal := val.Map()
+		mapVal.Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+			var newVal protoreflect.Value
+			newVal, err = transform(v)
+			if err != nil {
+				return false
+			}
+			// mutating the current entry is allowed during iteration
+			mapVal.Set(key, newVal)
+			return true
+		})
+		return err
+	default:
+		newVal, err := transform(val)
+		if err != nil {
+			return err
+		}
+		// mutating the current field is allowed during iteration
+		msg.Set(field, newVal)
+	}
+	return nil
+}
+
+func transformContained(field protoreflect.FieldDescriptor, val protoreflect.Value, match func(protoreflect.FieldDescriptor) bool, fn TransformFunc) error {
+	switch {
+	case field.IsList() && internal.IsMessageKind(field.Kind()):
+		list := val.List()
+		for i, length := 0, list.Len(); i < length; i++ {
+			if err := transformFields(list.Get(i).Message(), match, fn); err != nil {
+				return err
+			}
+		}
+	case field.IsMap() && internal.IsMessageKind(field.MapValue().Kind()):
+		var err error
+		val.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+			err = transformFields(v.Message(), match, fn)
+			return err == nil
+		})
+		return err
+	case !field.IsList() && !field.IsMap() && internal.IsMessageKind(field.Kind()):
+		return transformFields(val.Message(), match, fn)
+	}
+	return nil
+}
+
+// TransformOptions marshals and unmarshals messages, transforming the values
+// of selected fields in the process. For example, Encode can encrypt the
+// values of sensitive fields so that they are never serialized in plaintext,
+// and Decode can decrypt them.
+type TransformOptions struct {
+	// Selects the fields to transform. If nil, no fields are transformed.
+	Match func(protoreflect.FieldDescriptor) bool
+	// Transforms the values of matching fields when a message is marshaled.
+	// If nil, values are not transformed when marshaling.
+	Encode TransformFunc
+	// Transforms the values of matching fields when a message is unmarshaled.
+	// If nil, values are not transformed when unmarshaling.
+	Decode TransformFunc
+	// The options used to marshal messages.
+	MarshalOptions proto.MarshalOptions
+	// The options used to unmarshal messages.
+	UnmarshalOptions proto.UnmarshalOptions
+}
+
+// Marshal returns the binary format of the given message, after its matching
+// fields have been transformed using o.Encode. The given message is not
+// modified: the fields are transformed in a copy of the message.
+func (o TransformOptions) Marshal(msg proto.Message) ([]byte, error) {
+	if o.Match != nil && o.Encode != nil {
+		msg = proto.Clone(msg)
+		if err := TransformFields(msg, o.Match, o.Encode); err != nil {
+			return nil, err
+		}
+	}
+	return o.MarshalOptions.Marshal(msg)
+}
+
+// Unmarshal parses the binary format in data into the given message and then
+// transforms its matching fields using o.Decode.
+func (o TransformOptions) Unmarshal(data []byte, msg proto.Message) error {
+	if err := o.UnmarshalOptions.Unmarshal(data, msg); err != nil {
+		return err
+	}
+	if o.Match == nil || o.Decode == nil {
+		return nil
+	}
+	return TransformFields(msg, o.Match, o.Decode)
+}
+
+// FieldsWithOption returns a function, suitable for use with TransformFields
+// and TransformOptions.Match, that matches fields whose options have the given
+// custom option set. If the option is a bool, the field only matches if the
+// option's value is true.
+//
+// Fields match even if their options were built without the extension being
+// known, such as fields in descriptors that are downloaded via server
+// reflection, in which case the option is stored in the options message's
+// unknown fields. The returned function is safe for concurrent use. It
+// remembers the result for each field, so it is cheap to call repeatedly.
+func FieldsWithOption(xt protoreflect.ExtensionType) func(protoreflect.FieldDescriptor) bool {
+	var cache sync.Map // protoreflect.FieldDescriptor -> bool
+	return func(field protoreflect.FieldDescriptor) bool {
+		if matched, ok := cache.Load(field); ok {
+			return matched.(bool)
+		}
+		matched := hasOption(field, xt)
+		cache.Store(field, matched)
+		return matched
+	}
+}
+
+func hasOption(field protoreflect.FieldDescriptor, xt protoreflect.ExtensionType) bool {
+	opts := field.Options()
+	xd := xt.TypeDescriptor()
+	if opts == nil || xd.ContainingMessage().FullName() != opts.ProtoReflect().Descriptor().FullName() {
+		return false
+	}
+	val, ok, err := internal.FindOption(opts, xt)
+	if err != nil || !ok {
+		return false
+	}
+	if xd.Kind() == protoreflect.BoolKind && !xd.IsList() {
+		return val.Bool()
+	}
+	return true
+}
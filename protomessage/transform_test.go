@@ -0,0 +1,82 @@
+package protomessage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestFieldsWithOption(t *testing.T) {
+	md := (*testprotos.Request)(nil).ProtoReflect().Descriptor()
+	dynExt := dynamicpb.NewExtensionType(testprotos.E_Ffubar.TypeDescriptor().Descriptor())
+	for _, xt := range []protoreflect.ExtensionType{testprotos.E_Ffubar, dynExt} {
+		match := FieldsWithOption(xt)
+		require.True(t, match(md.Fields().ByName("ids")))
+		require.False(t, match(md.Fields().ByName("name")))
+		// repeated calls use cached result
+		require.True(t, match(md.Fields().ByName("ids")))
+	}
+	// extension for a different options message never matches
+	require.False(t, FieldsWithOption(testprotos.E_Mfubar)(md.Fields().ByName("ids")))
+}
+
+func TestTransformOptions(t *testing.T) {
+	withOption := FieldsWithOption(testprotos.E_Ffubar)
+	opts := TransformOptions{
+		Match: func(fd protoreflect.FieldDescriptor) bool {
+			return withOption(fd) || fd.Name() == "str"
+		},
+		Encode: func(fd protoreflect.FieldDescriptor, val protoreflect.Value) (protoreflect.Value, error) {
+			if fd.Kind() == protoreflect.StringKind {
+				return protoreflect.ValueOfString("enc:" + val.String()), nil
+			}
+			return protoreflect.ValueOfInt32(int32(val.Int()) + 1000), nil
+		},
+		Decode: func(fd protoreflect.FieldDescriptor, val protoreflect.Value) (protoreflect.Value, error) {
+			if fd.Kind() == protoreflect.StringKind {
+				str, ok := strings.CutPrefix(val.String(), "enc:")
+				if !ok {
+					return protoreflect.Value{}, errors.New("not encoded")
+				}
+				return protoreflect.ValueOfString(str), nil
+			}
+			return protoreflect.ValueOfInt32(int32(val.Int()) - 1000), nil
+		},
+	}
+	orig := &testprotos.Request{
+		Ids:    []int32{1, 2, 3},
+		Name:   proto.String("foo"),
+		Extras: &testprotos.Request_Extras{Str: proto.String("bar")},
+	}
+	for _, msg := range []proto.Message{orig, toDynamic(t, orig)} {
+		clone := proto.Clone(msg)
+		data, err := opts.Marshal(msg)
+		require.NoError(t, err)
+		// original message is unchanged
+		require.True(t, proto.Equal(clone, msg))
+
+		var encoded testprotos.Request
+		require.NoError(t, proto.Unmarshal(data, &encoded))
+		require.Equal(t, []int32{1001, 1002, 1003}, encoded.Ids)
+		require.Equal(t, "foo", encoded.GetName())
+		require.Equal(t, "enc:bar", encoded.GetExtras().GetStr())
+
+		decoded := msg.ProtoReflect().New().Interface()
+		require.NoError(t, opts.Unmarshal(data, decoded))
+		require.True(t, proto.Equal(msg, decoded))
+
+		// errors from the transform are returned
+		decoded = msg.ProtoReflect().New().Interface()
+		plain, err := proto.Marshal(msg)
+		require.NoError(t, err)
+		err = opts.Unmarshal(plain, decoded)
+		require.EqualError(t, err, "failed to transform field foo.bar.Request.Extras.str: not encoded")
+	}
+}
@@ -0,0 +1,72 @@
+package protomessage
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// UnknownExtension is an extension that is stored in a message's unknown
+// fields, as found by FindUnknownExtensions.
+type UnknownExtension struct {
+	// The path to the message whose unknown fields contain the extension.
+	// The path is in the same format as the path provided to the callback
+	// given to Walk.
+	Path []any
+	// The extension's type.
+	Extension protoreflect.ExtensionType
+	// The extension's value.
+	Value protoreflect.Value
+}
+
+// FindUnknownExtensions searches the unknown fields of the given message, and
+// of all messages nested inside it, for extensions that can be resolved using
+// the given resolver. This is useful for debugging, to turn mystery unknown
+// bytes into named extension values, like when a message was unmarshaled
+// without knowledge of the extensions it contains. A suitable resolver can be
+// created from the files that define the extensions, using
+// protoresolve.ExtensionsFromFiles.
+//
+// The given message is not modified. To instead update the message so that
+// the extensions are no longer stored as unknown fields, use
+// ReparseUnrecognized.
+//
+// The returned extensions are ordered by path, in the order that Walk visits
+// messages, and then by field number.
+func FindUnknownExtensions(msg proto.Message, resolver protoresolve.ExtensionTypeResolver) []UnknownExtension {
+	var results []UnknownExtension
+	Walk(msg.ProtoReflect(), func(path []any, m protoreflect.Message) bool {
+		unk := m.GetUnknown()
+		if len(unk) == 0 {
+			return true
+		}
+		parsed := m.New()
+		err := proto.UnmarshalOptions{
+			AllowPartial: true,
+			Resolver:     resolver,
+		}.Unmarshal(unk, parsed.Interface())
+		if err != nil {
+			return true
+		}
+		start := len(results)
+		parsed.Range(func(field protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+			if xtd, ok := field.(protoreflect.ExtensionTypeDescriptor); ok {
+				results = append(results, UnknownExtension{
+					Path:      append([]any(nil), path...),
+					Extension: xtd.Type(),
+					Value:     val,
+				})
+			}
+			return true
+		})
+		found := results[start:]
+		sort.Slice(found, func(i, j int) bool {
+			return found[i].Extension.TypeDescriptor().Number() < found[j].Extension.TypeDescriptor().Number()
+		})
+		return true
+	})
+	return results
+}
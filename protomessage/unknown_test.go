@@ -0,0 +1,57 @@
+package protomessage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+func TestFindUnknownExtensions(t *testing.T) {
+	msgOpts := &descriptorpb.MessageOptions{Deprecated: proto.Bool(true)}
+	var unk []byte
+	// foo.bar.Test.Nested.fooblez = 123
+	unk = protowire.AppendTag(unk, 20003, protowire.VarintType)
+	unk = protowire.AppendVarint(unk, 123)
+	// foo.bar.Test.Nested._NestedNested._garblez is not a MessageOptions extension, so stays unknown
+	unk = protowire.AppendTag(unk, 100, protowire.BytesType)
+	unk = protowire.AppendString(unk, "abc")
+	// testprotos.mfubar = true
+	unk = protowire.AppendTag(unk, 10101, protowire.VarintType)
+	unk = protowire.AppendVarint(unk, 1)
+	msgOpts.ProtoReflect().SetUnknown(unk)
+	file := &descriptorpb.FileDescriptorProto{
+		Name: proto.String("test.proto"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Foo")},
+			{Name: proto.String("Bar"), Options: msgOpts},
+		},
+	}
+	clone := proto.Clone(file)
+
+	reg, err := protoresolve.ExtensionsFromFiles(testprotos.File_desc_test_complex_proto, testprotos.File_desc_test_options_proto)
+	require.NoError(t, err)
+	exts := FindUnknownExtensions(file, reg)
+	require.Len(t, exts, 2)
+	msgPath := []any{protoreflect.FieldNumber(4), 1, protoreflect.FieldNumber(7)}
+	require.Equal(t, msgPath, exts[0].Path)
+	require.Equal(t, protoreflect.FullName("testprotos.mfubar"), exts[0].Extension.TypeDescriptor().FullName())
+	require.True(t, exts[0].Value.Bool())
+	require.Equal(t, msgPath, exts[1].Path)
+	require.Equal(t, protoreflect.FullName("foo.bar.Test.Nested.fooblez"), exts[1].Extension.TypeDescriptor().FullName())
+	require.Equal(t, int64(123), exts[1].Value.Int())
+
+	// message is not modified
+	require.True(t, proto.Equal(clone, file))
+
+	// nothing found without the extensions
+	reg, err = protoresolve.ExtensionsFromFiles(testprotos.File_desc_test1_proto)
+	require.NoError(t, err)
+	require.Empty(t, FindUnknownExtensions(file, reg))
+}
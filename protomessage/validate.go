@@ -0,0 +1,148 @@
+package protomessage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FieldError describes a problem with a field value, found by Validate.
+type FieldError struct {
+	// The path to the field, in the format accepted by GetByPath. For
+	// elements of repeated fields and values in map fields, the path
+	// includes the index or key.
+	Path string
+	// The field that has the problem.
+	Field protoreflect.FieldDescriptor
+	// A description of the problem.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// Validate checks that the given message, and all messages nested inside it,
+// can be marshaled without error and has only valid values. It checks that:
+//   - All required fields are set.
+//   - Fields whose type is a closed enum only contain values that are
+//     defined by the enum. (Unmarshaling never produces unknown values for
+//     closed enums, but they can be set programmatically.)
+//   - String fields that require validation of UTF-8 (which is the default
+//     for files that use proto3 syntax or editions) contain valid UTF-8.
+//
+// If the message is valid, Validate returns nil. Otherwise, it returns an
+// error that joins a *FieldError for every problem found, sorted by path.
+// Use errors.As to examine the first one, or use the Unwrap() []error method
+// of the returned error to examine all of them.
+//
+// This is useful to report all the problems with a message that is
+// constructed at runtime, like a dynamic message, with a clear description
+// of where each problem is. Otherwise, invalid messages only fail when they
+// are marshaled, which reports only one problem.
+func Validate(msg proto.Message) error {
+	var errs []*FieldError
+	validate(msg.ProtoReflect(), "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Path < errs[j].Path
+	})
+	joined := make([]error, len(errs))
+	for i, err := range errs {
+		joined[i] = err
+	}
+	return errors.Join(joined...)
+}
+
+func validate(msg protoreflect.Message, path string, errs *[]*FieldError) {
+	fields := msg.Descriptor().Fields()
+	for i, length := 0, fields.Len(); i < length; i++ {
+		field := fields.Get(i)
+		if field.Cardinality() == protoreflect.Required && !msg.Has(field) {
+			*errs = append(*errs, &FieldError{
+				Path:   fieldPath(path, field),
+				Field:  field,
+				Reason: "required field is not set",
+			})
+		}
+	}
+	msg.Range(func(field protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		path := fieldPath(path, field)
+		switch {
+		case field.IsList():
+			list := val.List()
+			for i, length := 0, list.Len(); i < length; i++ {
+				validateValue(field, list.Get(i), fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		case field.IsMap():
+			val.Map().Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+				entryPath := path + "[" + mapKeyString(key) + "]"
+				validateValue(field.MapKey(), key.Value(), entryPath, errs)
+				validateValue(field.MapValue(), v, entryPath, errs)
+				return true
+			})
+		default:
+			validateValue(field, val, path, errs)
+		}
+		return true
+	})
+}
+
+func validateValue(field protoreflect.FieldDescriptor, val protoreflect.Value, path string, errs *[]*FieldError) {
+	switch field.Kind() {
+	case protoreflect.EnumKind:
+		ed := field.Enum()
+		if ed.IsClosed() && ed.Values().ByNumber(val.Enum()) == nil {
+			*errs = append(*errs, &FieldError{
+				Path:   path,
+				Field:  field,
+				Reason: fmt.Sprintf("%d is not a valid value for closed enum %s", val.Enum(), ed.FullName()),
+			})
+		}
+	case protoreflect.StringKind:
+		if enforceUTF8(field) && !utf8.ValidString(val.String()) {
+			*errs = append(*errs, &FieldError{
+				Path:   path,
+				Field:  field,
+				Reason: "string value is not valid UTF-8",
+			})
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		validate(val.Message(), path, errs)
+	}
+}
+
+func enforceUTF8(field protoreflect.FieldDescriptor) bool {
+	// Descriptors from the protobuf runtime expose this, since it depends
+	// on features that are not otherwise accessible.
+	if enforcer, ok := field.(interface{ EnforceUTF8() bool }); ok {
+		return enforcer.EnforceUTF8()
+	}
+	return field.ParentFile().Syntax() != protoreflect.Proto2
+}
+
+func fieldPath(prefix string, field protoreflect.FieldDescriptor) string {
+	name := string(field.Name())
+	if field.IsExtension() {
+		name = "(" + string(field.FullName()) + ")"
+	}
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func mapKeyString(key protoreflect.MapKey) string {
+	if s, ok := key.Interface().(string); ok {
+		return strconv.Quote(s)
+	}
+	return key.String()
+}
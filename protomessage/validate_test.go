@@ -0,0 +1,122 @@
+package protomessage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+)
+
+func TestValidate(t *testing.T) {
+	fileProto := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("validate.proto"),
+		Package: proto.String("val"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{
+			{
+				Name: proto.String("Color"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{
+					{Name: proto.String("RED"), Number: proto.Int32(0)},
+					{Name: proto.String("GREEN"), Number: proto.Int32(1)},
+				},
+			},
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Item"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					validateTestField("id", 1, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					validateTestField("color", 2, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".val.Color"),
+				},
+			},
+			{
+				Name: proto.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					validateTestField("name", 1, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					validateTestField("items", 2, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".val.Item"),
+					validateTestField("by_key", 3, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".val.Order.ByKeyEntry"),
+					validateTestField("main", 4, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".val.Item"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{
+					{
+						Name:    proto.String("ByKeyEntry"),
+						Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+						Field: []*descriptorpb.FieldDescriptorProto{
+							validateTestField("key", 1, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+							validateTestField("value", 2, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".val.Item"),
+						},
+					},
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fileProto, nil)
+	require.NoError(t, err)
+	orderMd := fd.Messages().ByName("Order")
+	itemMd := fd.Messages().ByName("Item")
+
+	newItem := func(id string, color protoreflect.EnumNumber) protoreflect.Message {
+		item := dynamicpb.NewMessage(itemMd)
+		if id != "" {
+			item.Set(itemMd.Fields().ByName("id"), protoreflect.ValueOfString(id))
+		}
+		item.Set(itemMd.Fields().ByName("color"), protoreflect.ValueOfEnum(color))
+		return item
+	}
+	order := dynamicpb.NewMessage(orderMd)
+	order.Set(orderMd.Fields().ByName("name"), protoreflect.ValueOfString("abc"))
+	items := order.Mutable(orderMd.Fields().ByName("items")).List()
+	items.Append(protoreflect.ValueOfMessage(newItem("a", 1)))
+	order.Set(orderMd.Fields().ByName("main"), protoreflect.ValueOfMessage(newItem("b", 0)))
+	byKey := order.Mutable(orderMd.Fields().ByName("by_key")).Map()
+	byKey.Set(protoreflect.ValueOfString("k").MapKey(), protoreflect.ValueOfMessage(newItem("c", 0)))
+	require.NoError(t, Validate(order))
+
+	// now make it invalid
+	order.Clear(orderMd.Fields().ByName("name"))
+	items.Append(protoreflect.ValueOfMessage(newItem("", 0)))
+	items.Append(protoreflect.ValueOfMessage(newItem("d", 5)))
+	byKey.Set(protoreflect.ValueOfString("k").MapKey(), protoreflect.ValueOfMessage(newItem("", 0)))
+	err = Validate(order)
+	require.EqualError(t, err,
+		`by_key["k"].id: required field is not set`+"\n"+
+			`items[1].id: required field is not set`+"\n"+
+			`items[2].color: 5 is not a valid value for closed enum val.Color`+"\n"+
+			`name: required field is not set`)
+	var fieldErr *FieldError
+	require.True(t, errors.As(err, &fieldErr))
+	require.Equal(t, `by_key["k"].id`, fieldErr.Path)
+	require.Equal(t, itemMd.Fields().ByName("id"), fieldErr.Field)
+	require.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 4)
+
+	// proto3 strings must be valid UTF-8
+	req := &testprotos.TestRequest{
+		Bar:   "\xff",
+		Flags: map[string]bool{"\xfe": true, "ok": false},
+	}
+	require.EqualError(t, Validate(req),
+		`bar: string value is not valid UTF-8`+"\n"+
+			`flags["\xfe"]: string value is not valid UTF-8`)
+	req.Bar = "abc"
+	delete(req.Flags, "\xfe")
+	require.NoError(t, Validate(req))
+}
+
+func validateTestField(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	fld := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  label.Enum(),
+		Type:   typ.Enum(),
+	}
+	if typeName != "" {
+		fld.TypeName = proto.String(typeName)
+	}
+	return fld
+}
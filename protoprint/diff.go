@@ -0,0 +1,253 @@
+package protoprint
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protoreflect/v2/internal"
+)
+
+// PrintProtoDiff prints the given new file, just like PrintProtoFile, but with
+// comments that describe how it differs from the given old file. This can be
+// used to produce a human-readable summary of schema changes, such as for
+// review or for a change log.
+//
+// Each element that is not present in the old file is preceded by a comment
+// "DIFF: added". Each element that is present in both files but whose
+// definition has changed is preceded by a comment "DIFF: changed". For fields
+// and enum values, this comment also shows the old definition. Changes to an
+// element's nested elements (like fields in a message) are not considered
+// changes to the element itself. Changes to comments are ignored.
+//
+// Elements that were removed cannot be printed, so they are described by a
+// "DIFF: removed" comment on the element that contained them. Elements that
+// were removed from the top-level of the file are described by comments on
+// the syntax or edition declaration.
+//
+// Elements are matched by their fully-qualified name, so an element that is
+// renamed is reported as being removed and added.
+func (p *Printer) PrintProtoDiff(oldFile, newFile protoreflect.FileDescriptor, out io.Writer) error {
+	oldElements := map[protoreflect.FullName]protoreflect.Descriptor{}
+	var oldOrder []protoreflect.Descriptor
+	walkDiffElements(oldFile, func(d protoreflect.Descriptor) {
+		oldElements[d.FullName()] = d
+		oldOrder = append(oldOrder, d)
+	})
+	newElements := map[protoreflect.FullName]protoreflect.Descriptor{}
+	annotations := map[string][]string{}
+	walkDiffElements(newFile, func(d protoreflect.Descriptor) {
+		newElements[d.FullName()] = d
+		key := internal.PathKey(findElement(d))
+		oldD := oldElements[d.FullName()]
+		switch {
+		case oldD == nil || diffElementKind(oldD) != diffElementKind(d):
+			annotations[key] = append(annotations[key], "added")
+		case !proto.Equal(shallowProto(oldD), shallowProto(d)):
+			if def := p.diffDefinition(oldD); def != "" {
+				annotations[key] = append(annotations[key], "changed; was: "+def)
+			} else {
+				annotations[key] = append(annotations[key], "changed")
+			}
+		}
+	})
+	for _, d := range oldOrder {
+		if newD := newElements[d.FullName()]; newD != nil && diffElementKind(newD) == diffElementKind(d) {
+			continue
+		}
+		var key string
+		if _, isFile := d.Parent().(protoreflect.FileDescriptor); isFile {
+			key = internal.PathKey(protoreflect.SourcePath{internal.FileSyntaxTag})
+		} else {
+			parent := newElements[d.Parent().FullName()]
+			if parent == nil || diffElementKind(parent) != diffElementKind(d.Parent()) {
+				// parent was also removed, so it alone is reported
+				continue
+			}
+			key = internal.PathKey(findElement(parent))
+		}
+		desc := p.diffDefinition(d)
+		if desc == "" {
+			desc = fmt.Sprintf("%s %s", diffElementKind(d), d.Name())
+		}
+		annotations[key] = append(annotations[key], "removed: "+desc)
+	}
+
+	comments := make(map[string]string, len(annotations))
+	for key, lines := range annotations {
+		var buf strings.Builder
+		for _, line := range lines {
+			buf.WriteString(" DIFF: ")
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+		comments[key] = buf.String()
+	}
+	return p.printAnnotatedProto(newFile, out, comments, false)
+}
+
+// walkDiffElements calls fn for all elements in the given file that can be
+// annotated in a diff. Map entry messages and synthetic oneofs are skipped
+// since they are not printed as elements.
+func walkDiffElements(fd protoreflect.FileDescriptor, fn func(protoreflect.Descriptor)) {
+	var walkMessages func(protoreflect.MessageDescriptors)
+	walkEnums := func(enums protoreflect.EnumDescriptors) {
+		for i, length := 0, enums.Len(); i < length; i++ {
+			ed := enums.Get(i)
+			fn(ed)
+			vals := ed.Values()
+			for j, length := 0, vals.Len(); j < length; j++ {
+				fn(vals.Get(j))
+			}
+		}
+	}
+	walkExtensions := func(exts protoreflect.ExtensionDescriptors) {
+		for i, length := 0, exts.Len(); i < length; i++ {
+			fn(exts.Get(i))
+		}
+	}
+	walkMessages = func(msgs protoreflect.MessageDescriptors) {
+		for i, length := 0, msgs.Len(); i < length; i++ {
+			md := msgs.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			fn(md)
+			fields := md.Fields()
+			for j, length := 0, fields.Len(); j < length; j++ {
+				fn(fields.Get(j))
+			}
+			oneofs := md.Oneofs()
+			for j, length := 0, oneofs.Len(); j < length; j++ {
+				if !oneofs.Get(j).IsSynthetic() {
+					fn(oneofs.Get(j))
+				}
+			}
+			walkMessages(md.Messages())
+			walkEnums(md.Enums())
+			walkExtensions(md.Extensions())
+		}
+	}
+	walkMessages(fd.Messages())
+	walkEnums(fd.Enums())
+	walkExtensions(fd.Extensions())
+	svcs := fd.Services()
+	for i, length := 0, svcs.Len(); i < length; i++ {
+		sd := svcs.Get(i)
+		fn(sd)
+		methods := sd.Methods()
+		for j, length := 0, methods.Len(); j < length; j++ {
+			fn(methods.Get(j))
+		}
+	}
+}
+
+func diffElementKind(d protoreflect.Descriptor) string {
+	switch d := d.(type) {
+	case protoreflect.MessageDescriptor:
+		return "message"
+	case protoreflect.FieldDescriptor:
+		if d.IsExtension() {
+			return "extension"
+		}
+		return "field"
+	case protoreflect.OneofDescriptor:
+		return "oneof"
+	case protoreflect.EnumDescriptor:
+		return "enum"
+	case protoreflect.EnumValueDescriptor:
+		return "enum value"
+	case protoreflect.ServiceDescriptor:
+		return "service"
+	case protoreflect.MethodDescriptor:
+		return "method"
+	default:
+		return "element"
+	}
+}
+
+// shallowProto returns the descriptor proto for the given element, without
+// any of its nested elements. So comparing the results for two elements only
+// compares the elements themselves.
+func shallowProto(d protoreflect.Descriptor) proto.Message {
+	switch d := d.(type) {
+	case protoreflect.MessageDescriptor:
+		msg := protodesc.ToDescriptorProto(d)
+		msg.Field, msg.NestedType, msg.EnumType, msg.Extension, msg.OneofDecl = nil, nil, nil, nil, nil
+		return msg
+	case protoreflect.FieldDescriptor:
+		fld := protodesc.ToFieldDescriptorProto(d)
+		// compare the oneof by name instead of by index
+		fld.OneofIndex = nil
+		if ood := d.ContainingOneof(); ood != nil && !ood.IsSynthetic() {
+			fld.Name = proto.String(fmt.Sprintf("%s.%s", ood.Name(), d.Name()))
+		}
+		if d.IsMap() {
+			// map entries are not compared, so include their types here
+			fld.TypeName = proto.String(fmt.Sprintf("map<%s, %s>", mapTypeName(d.MapKey()), mapTypeName(d.MapValue())))
+		}
+		return fld
+	case protoreflect.OneofDescriptor:
+		return protodesc.ToOneofDescriptorProto(d)
+	case protoreflect.EnumDescriptor:
+		enum := protodesc.ToEnumDescriptorProto(d)
+		enum.Value = nil
+		return enum
+	case protoreflect.EnumValueDescriptor:
+		return protodesc.ToEnumValueDescriptorProto(d)
+	case protoreflect.ServiceDescriptor:
+		svc := protodesc.ToServiceDescriptorProto(d)
+		svc.Method = nil
+		return svc
+	case protoreflect.MethodDescriptor:
+		return protodesc.ToMethodDescriptorProto(d)
+	default:
+		return nil
+	}
+}
+
+func mapTypeName(fld protoreflect.FieldDescriptor) string {
+	switch fld.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fld.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(fld.Enum().FullName())
+	default:
+		return fld.Kind().String()
+	}
+}
+
+// diffDefinition returns the definition of the given element as a single
+// line of source, for elements that have short definitions: fields (other
+// than groups) and enum values. For other elements, it returns the empty
+// string.
+func (p *Printer) diffDefinition(d protoreflect.Descriptor) string {
+	switch d := d.(type) {
+	case protoreflect.FieldDescriptor:
+		if d.IsExtension() || isGroup(d) {
+			return ""
+		}
+	case protoreflect.EnumValueDescriptor:
+	default:
+		return ""
+	}
+	printer := *p
+	printer.OmitComments = CommentsAll
+	printer.Compact = true
+	printer.MaxLineLength = 0
+	printer.ShortOptionsExpansionThresholdCount = 1 << 30
+	printer.ShortOptionsExpansionThresholdLength = 1 << 30
+	str, err := printer.PrintProtoToString(d)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(str), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, " ")
+}
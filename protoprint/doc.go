@@ -5,4 +5,11 @@
 // protoc or buf) back into proto IDL code. Combined with the
 // [github.com/jhump/protoreflect/v2/protobuilder] package, it can also be used
 // to perform code generation of proto source code.
+//
+// Files that use editions are printed with an edition declaration instead of a
+// syntax declaration, and fields that use the delimited message encoding are
+// printed as normal message fields, not as groups. Features are printed as a
+// single message literal option, unless Printer.SeparateFeatureOptions is set,
+// in which case they are printed as individual options, such as
+// "option features.field_presence = IMPLICIT;".
 package protoprint
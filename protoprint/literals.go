@@ -0,0 +1,117 @@
+package protoprint
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// originalOptionValue returns the text of the given option's value, exactly as
+// it appears in the given source. It returns false if the value cannot be
+// reproduced from source, which is the case if there is no source or source
+// location, if the value is a message literal, or if the text at the given
+// location does not look like an assignment of a compatible value to the
+// named option.
+func originalOptionValue(src []byte, si protoreflect.SourceLocation, name string, optVal interface{}) (string, bool) {
+	if src == nil || si.Path == nil {
+		return "", false
+	}
+	start := sourceOffset(src, si.StartLine, si.StartColumn)
+	end := sourceOffset(src, si.EndLine, si.EndColumn)
+	if start < 0 || end < start {
+		return "", false
+	}
+	text := strings.TrimSpace(string(src[start:end]))
+	text = strings.TrimSpace(strings.TrimSuffix(text, ";"))
+	// locations for options declared with "option" statements include the keyword
+	if rest := strings.TrimPrefix(text, "option"); rest != text && rest != "" && isSpace(rest[0]) {
+		text = rest
+	}
+	eq := strings.IndexByte(text, '=')
+	if eq < 0 || stripSpaces(text[:eq]) != stripSpaces(name) {
+		return "", false
+	}
+	value := strings.TrimSpace(text[eq+1:])
+	if value == "" || !literalMatches(value, optVal) {
+		return "", false
+	}
+	return value, true
+}
+
+// literalMatches returns true if the given literal text could represent the
+// given option value. This is a sanity check to guard against source info that
+// doesn't correspond to the given source text. It also excludes list literals,
+// which are used in source for repeated options but are printed as a separate
+// option per element.
+func literalMatches(text string, optVal interface{}) bool {
+	c := text[0]
+	switch optVal.(type) {
+	case string, []byte:
+		return c == '"' || c == '\''
+	case int32, uint32, int64, uint64:
+		return c == '-' || c == '+' || (c >= '0' && c <= '9')
+	case float32, float64:
+		return c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') || isIdentifier(text)
+	case bool, ident:
+		return isIdentifier(text)
+	default:
+		// message literals are always formatted by the printer
+		return false
+	}
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func stripSpaces(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && isSpace(byte(r)) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// sourceOffset converts the given zero-based line and column into an offset
+// into src. Like the compiler that produces source info, it counts each rune
+// as one column and advances tabs to the next multiple of eight. It returns
+// -1 if the position is not in src.
+func sourceOffset(src []byte, line, col int) int {
+	offset := 0
+	for ; line > 0; line-- {
+		nl := bytes.IndexByte(src[offset:], '\n')
+		if nl < 0 {
+			return -1
+		}
+		offset += nl + 1
+	}
+	for c := 0; c < col; {
+		if offset >= len(src) || src[offset] == '\n' {
+			return -1
+		}
+		if src[offset] == '\t' {
+			c += 8 - c%8
+			offset++
+		} else {
+			_, sz := utf8.DecodeRune(src[offset:])
+			c++
+			offset += sz
+		}
+	}
+	return offset
+}
@@ -0,0 +1,70 @@
+package protoprint
+
+import (
+	"bytes"
+	"io"
+)
+
+// normalizingWriter is an io.Writer that normalizes whitespace in the text
+// written to it. It removes trailing whitespace from every line, collapses
+// consecutive blank lines into a single blank line, and removes blank lines
+// at the start and end of the output. When flushed, it makes sure that any
+// non-empty output ends with exactly one newline.
+type normalizingWriter struct {
+	w            io.Writer
+	line         []byte
+	wroteAny     bool
+	pendingBlank bool
+}
+
+func newNormalizingWriter(w io.Writer) *normalizingWriter {
+	return &normalizingWriter{w: w}
+}
+
+func (n *normalizingWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		pos := bytes.IndexByte(p, '\n')
+		if pos < 0 {
+			n.line = append(n.line, p...)
+			break
+		}
+		n.line = append(n.line, p[:pos]...)
+		p = p[pos+1:]
+		if err := n.endLine(); err != nil {
+			return total - len(p), err
+		}
+	}
+	return total, nil
+}
+
+func (n *normalizingWriter) endLine() error {
+	line := bytes.TrimRight(n.line, " \t\r")
+	n.line = n.line[:0]
+	if len(line) == 0 {
+		// defer blank lines until we see a subsequent non-blank line; this
+		// collapses runs of them and drops them from the end of output
+		n.pendingBlank = n.wroteAny
+		return nil
+	}
+	if n.pendingBlank {
+		if _, err := n.w.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+		n.pendingBlank = false
+	}
+	if _, err := n.w.Write(line); err != nil {
+		return err
+	}
+	n.wroteAny = true
+	_, err := n.w.Write([]byte{'\n'})
+	return err
+}
+
+// Flush writes any buffered partial line, terminating it with a newline.
+func (n *normalizingWriter) Flush() error {
+	if len(n.line) == 0 {
+		return nil
+	}
+	return n.endLine()
+}
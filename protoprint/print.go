@@ -2,14 +2,17 @@ package protoprint
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -20,6 +23,7 @@ import (
 	"google.golang.org/protobuf/types/dynamicpb"
 
 	"github.com/jhump/protoreflect/v2/internal"
+	"github.com/jhump/protoreflect/v2/internal/importusage"
 	"github.com/jhump/protoreflect/v2/internal/register"
 	"github.com/jhump/protoreflect/v2/protodescs"
 	"github.com/jhump/protoreflect/v2/protomessage"
@@ -77,6 +81,19 @@ type Printer struct {
 	// order elements.
 	CustomSortFunction func(a, b Element) bool
 
+	// If true, the output is canonical: it depends only on the contents of
+	// the descriptors being printed and not on the order in which elements
+	// were declared or on any source code info. This is useful for producing
+	// golden files, where re-ordering elements in a source file should not
+	// result in a different output.
+	//
+	// This implies SortElements and NormalizeWhitespace, and it causes
+	// CustomSortFunction and OriginalSource to be ignored. Source code info is
+	// not used, so comments are not printed. And all extensions in a scope
+	// that extend the same message are printed in a single "extend" block,
+	// instead of being grouped into blocks like they were in the source file.
+	Canonical bool
+
 	// The indentation used. Any characters other than spaces or tabs will be
 	// replaced with spaces. If unset/empty, two spaces will be used.
 	Indent string
@@ -170,8 +187,127 @@ type Printer struct {
 	//
 	// If unset (e.g. if zero), a default threshold of 50 is used.
 	MessageLiteralExpansionThresholdLength int
+
+	// The style used to render message literals in option values. If unset,
+	// MessageLiteralStyleAuto is used, which decides whether to expand each
+	// message literal based on MessageLiteralExpansionThresholdLength.
+	MessageLiteralStyle MessageLiteralStyle
+
+	// The maximum desired length of a line of output. If non-zero, short
+	// options expressions (see ShortOptionsExpansionThresholdCount) that would
+	// cause a line to exceed this length are rendered using multiple lines,
+	// even if they would otherwise fit within the count and length thresholds.
+	//
+	// This is a best-effort limit: lines that contain long names, long string
+	// literals, or trailing comments can still exceed it. Each character in the
+	// indentation, including tabs, is counted as a single column.
+	//
+	// If unset (e.g. if zero), line length is not considered.
+	MaxLineLength int
+
+	// The maximum desired length of a line of a comment. If non-zero, the text
+	// of comments is re-wrapped so that lines, including indentation and the
+	// comment markers, do not exceed this length. Consecutive lines of text are
+	// joined into paragraphs before being wrapped. Blank lines, lines that are
+	// indented further than the first line (such as code samples), and lines
+	// that start a list item (with "-", "*", or a number followed by a period)
+	// are preserved.
+	//
+	// This is a best-effort limit: words that are longer than the limit are
+	// not broken up, and trailing comments that are printed on the same line
+	// as an element may still exceed it. Each character in the indentation,
+	// including tabs, is counted as a single column.
+	//
+	// If unset (e.g. if zero), comments are printed as they appear in the
+	// source code info.
+	CommentWrapLength int
+
+	// If non-nil, this function is called for each file that is printed. If
+	// it returns a non-empty string, that text is printed as a comment at the
+	// very start of the file, before the syntax or edition declaration. This
+	// is typically used to add a license banner or a notice that the file is
+	// generated. The text should not include comment markers; they are added
+	// by the printer, in the style indicated by PreferMultiLineStyleComments.
+	//
+	// If the file already starts with a comment with the same text, such as
+	// when printing a file that was compiled from a source file that already
+	// has the header, the header is not printed again.
+	FileHeader func(fd protoreflect.FileDescriptor) string
+
+	// If true, each import statement is followed by a comment that lists the
+	// elements defined in the imported file (or in files it publicly imports)
+	// that are used by the file being printed. Imports that are not used are
+	// annotated as such. This can be useful for auditing and cleaning up the
+	// dependencies of large files.
+	//
+	// So, with this set, you'll get output like so:
+	//
+	//    import "google/protobuf/descriptor.proto"; // uses: google.protobuf.FieldOptions
+	//    import "google/protobuf/empty.proto"; // unused
+	AnnotateImports bool
+
+	// If true, whitespace in the printed output is normalized in order to make
+	// the output stable and friendly to line-based diffs. Trailing whitespace
+	// is removed from every line, there is never more than one consecutive
+	// blank line, there are no blank lines at the start or end of the output,
+	// and the output always ends with exactly one newline.
+	//
+	// Unless Compact is also set, this means that there is exactly one blank
+	// line between top-level elements in a file. Printing a file, compiling
+	// the result, and then printing the compiled file again produces identical
+	// output.
+	NormalizeWhitespace bool
+
+	// If non-nil, this function is used to load the original source text of
+	// the file being printed, given the file's path. When the file descriptor
+	// includes source code info, the source text is used to reproduce option
+	// values exactly as they were written (such as hex and octal integers,
+	// single-quoted strings, escape sequences, and concatenated string
+	// literals) instead of printing them in a normalized form. This improves
+	// the fidelity of round-trips from source to descriptor and back.
+	//
+	// Only scalar option values are reproduced this way; message literals are
+	// always formatted by the printer. If the source info does not agree with
+	// the source text for a given option, its value is printed normally.
+	OriginalSource func(path string) ([]byte, error)
+
+	// If true, the features of elements in files that use editions are
+	// printed as one option per feature, like so:
+	//
+	//    option features.field_presence = IMPLICIT;
+	//    option features.enum_type = CLOSED;
+	//
+	// Otherwise, all of an element's features are printed as a single option
+	// whose value is a message literal:
+	//
+	//    option features = { field_presence: IMPLICIT, enum_type: CLOSED };
+	//
+	// If features were defined in source using a message literal, the
+	// comments for the literal are kept when the features are split: leading
+	// comments are printed before the first feature and trailing comments
+	// after the last.
+	SeparateFeatureOptions bool
 }
 
+// MessageLiteralStyle controls how message literals in option values are
+// rendered.
+type MessageLiteralStyle int
+
+const (
+	// MessageLiteralStyleAuto renders a message literal on a single line
+	// unless its length exceeds the printer's MessageLiteralExpansionThresholdLength,
+	// in which case it is expanded to multiple lines.
+	MessageLiteralStyleAuto = MessageLiteralStyle(iota)
+	// MessageLiteralStyleCompact always renders message literals on a single
+	// line, regardless of their length.
+	MessageLiteralStyleCompact
+	// MessageLiteralStyleExpanded always renders message literals using
+	// multiple lines, one field per line. Message literals that have only a
+	// single field whose value is not itself a message are still rendered on
+	// a single line.
+	MessageLiteralStyleExpanded
+)
+
 // CommentType is a kind of comments in a proto source file. This can be used
 // as a bitmask.
 type CommentType int
@@ -231,6 +367,55 @@ func (p *Printer) PrintProtoFiles(fds []protoreflect.FileDescriptor, open func(n
 	return nil
 }
 
+// PrintProtoFilesConcurrently is like PrintProtoFiles except that it prints
+// up to maxParallelism files at the same time. If maxParallelism is zero or
+// negative, runtime.GOMAXPROCS(0) is used. Since the given open function may
+// be called from multiple goroutines, it must be safe for concurrent use.
+//
+// Unlike PrintProtoFiles, this does not stop at the first error. Every file is
+// attempted, and the returned error joins all failures (see errors.Join) in
+// the same order as the given files, so the result does not depend on how the
+// work happened to be scheduled.
+func (p *Printer) PrintProtoFilesConcurrently(fds []protoreflect.FileDescriptor, open func(name string) (io.WriteCloser, error), maxParallelism int) error {
+	if maxParallelism <= 0 {
+		maxParallelism = runtime.GOMAXPROCS(0)
+	}
+	errs := make([]error, len(fds))
+	sem := make(chan struct{}, maxParallelism)
+	var wg sync.WaitGroup
+	for i, fd := range fds {
+		// printing may update the printer's fields, so each file gets a copy
+		pr := *p
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, fd protoreflect.FileDescriptor) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = pr.printProtoFileTo(fd, open)
+		}(i, fd)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (p *Printer) printProtoFileTo(fd protoreflect.FileDescriptor, open func(name string) (io.WriteCloser, error)) error {
+	w, err := open(fd.Path())
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", fd.Path(), err)
+	}
+	err = p.PrintProtoFile(fd, w)
+	closeErr := w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", fd.Path(), err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close %s: %w", fd.Path(), closeErr)
+	}
+	return nil
+}
+
 // PrintProtosToFileSystem prints all of the given file descriptors to files in
 // the given directory. If file names in the given descriptors include path
 // information, they will be relative to the given root.
@@ -263,6 +448,10 @@ type messageVal struct {
 type option struct {
 	name string
 	val  interface{}
+	// For options that are fields of a message-typed option, printed as
+	// separate options (like "features.field_presence"), the number of the
+	// enclosing option and of the field. These are used to find source info.
+	parent, tag protoreflect.FieldNumber
 }
 
 // reservedRange represents a reserved range from a message or enum
@@ -294,7 +483,54 @@ func (p *Printer) PrintProtoToString(dsc protoreflect.Descriptor) (string, error
 	return buf.String(), nil
 }
 
+// PrintElement prints the given message, enum, or service as a standalone
+// snippet. Unlike PrintProtoToString, which prints only the element itself,
+// the output starts with the syntax (or edition) and package of the file that
+// contains the element followed by imports for just the files that the
+// element references. This is useful for embedding the definition of a single
+// type in documentation.
+//
+// If AnnotateImports is set, the imports are annotated with the names of the
+// referenced elements that they provide. An error is returned if the given
+// descriptor is not a message, enum, or service.
+func (p *Printer) PrintElement(dsc protoreflect.Descriptor, out io.Writer) error {
+	switch dsc.(type) {
+	case protoreflect.MessageDescriptor, protoreflect.EnumDescriptor, protoreflect.ServiceDescriptor:
+	default:
+		return fmt.Errorf("cannot print %q as a standalone element: must be a message, enum, or service", dsc.FullName())
+	}
+	return p.printAnnotatedProto(dsc, out, nil, true)
+}
+
 func (p *Printer) printProto(dsc protoreflect.Descriptor, out io.Writer) error {
+	return p.printAnnotatedProto(dsc, out, nil, false)
+}
+
+// printAnnotatedProto prints the given descriptor. The given annotations, if
+// non-nil, are extra leading comments for elements, keyed by the path key
+// (see internal.PathKey) of each element's source path. If standalone is
+// true, the element is preceded by the syntax, package, and imports that
+// it needs (see PrintElement).
+func (p *Printer) printAnnotatedProto(dsc protoreflect.Descriptor, out io.Writer, annotations map[string]string, standalone bool) error {
+	if p.Canonical {
+		canonical := *p
+		canonical.SortElements = true
+		canonical.CustomSortFunction = nil
+		canonical.NormalizeWhitespace = true
+		canonical.OriginalSource = nil
+		p = &canonical
+	}
+	if p.NormalizeWhitespace {
+		nw := newNormalizingWriter(out)
+		if err := p.printProtoTo(dsc, nw, annotations, standalone); err != nil {
+			return err
+		}
+		return nw.Flush()
+	}
+	return p.printProtoTo(dsc, out, annotations, standalone)
+}
+
+func (p *Printer) printProtoTo(dsc protoreflect.Descriptor, out io.Writer, annotations map[string]string, standalone bool) error {
 	w := newWriter(out)
 
 	if p.Indent == "" {
@@ -314,12 +550,30 @@ func (p *Printer) printProto(dsc protoreflect.Descriptor, out io.Writer) error {
 	}
 
 	fd := dsc.ParentFile()
-	sourceInfo := extendOptionLocations(fd)
+	var sourceInfo protoreflect.SourceLocations
+	if p.Canonical {
+		sourceInfo = noSourceLocations{fd.SourceLocations()}
+	} else {
+		sourceInfo = extendOptionLocations(fd)
+	}
+	if annotations != nil {
+		sourceInfo = &annotatedLocations{SourceLocations: sourceInfo, annotations: annotations}
+	}
+	if p.OriginalSource != nil && fd.SourceLocations().Len() > 0 {
+		src, err := p.OriginalSource(fd.Path())
+		if err != nil {
+			return fmt.Errorf("failed to load source for %q: %w", fd.Path(), err)
+		}
+		w.src = src
+	}
 
 	var reg protoregistry.Types
 	register.RegisterTypesVisibleToFile(fd, &reg, true)
 
 	path := findElement(dsc)
+	if standalone {
+		p.printStandaloneHeader(dsc, &reg, w, sourceInfo)
+	}
 	switch d := dsc.(type) {
 	case protoreflect.FileDescriptor:
 		p.printFile(d, &reg, w, sourceInfo)
@@ -443,15 +697,13 @@ func (p *Printer) printFile(
 
 	path[0] = internal.FileSyntaxTag
 	si := sourceInfo.ByPath(path)
-	p.printElement(false, si, w, 0, func(w *writer) {
-		syn := fd.Syntax()
-		if syn != protoreflect.Editions {
-			_, _ = fmt.Fprintf(w, "syntax = %q;", syn.String())
-			return
+	if p.FileHeader != nil {
+		if header := p.FileHeader(fd); header != "" && !p.hasLeadingComment(si, header) {
+			p.printComment(header, w, 0, true)
+			p.newLine(w)
 		}
-		_, _ = fmt.Fprintf(w, "edition = %q;", strings.TrimPrefix(protodescs.GetEdition(fd, nil).String(), "EDITION_"))
-	})
-	p.newLine(w)
+	}
+	p.printSyntax(fd, si, w)
 
 	skip := map[interface{}]bool{}
 
@@ -492,6 +744,11 @@ func (p *Printer) printFile(
 
 	pkgName := fd.Package()
 
+	var importUsages map[string][]protoreflect.FullName
+	if p.AnnotateImports {
+		importUsages = importusage.Compute(fd, reg)
+	}
+
 	for i, el := range elements.addrs {
 		d := elements.at(el)
 
@@ -525,6 +782,9 @@ func (p *Printer) printFile(
 			}
 			p.printElement(false, si, w, 0, func(w *writer) {
 				_, _ = fmt.Fprintf(w, "import %s%q;", modifier, d.Path())
+				if p.AnnotateImports {
+					p.printImportUsage(importUsages[d.Path()], w)
+				}
 			})
 		case []option:
 			p.printOptionsLong(d, reg, w, sourceInfo, path, 0)
@@ -545,6 +805,77 @@ func (p *Printer) printFile(
 	}
 }
 
+func (p *Printer) printStandaloneHeader(
+	dsc protoreflect.Descriptor,
+	reg *protoregistry.Types,
+	w *writer,
+	sourceInfo protoreflect.SourceLocations,
+) {
+	fd := dsc.ParentFile()
+	si := sourceInfo.ByPath(protoreflect.SourcePath{internal.FileSyntaxTag})
+	p.printSyntax(fd, si, w)
+
+	if fd.Package() != "" {
+		_, _ = fmt.Fprintf(w, "package %s;", fd.Package())
+		_, _ = fmt.Fprintln(w)
+		p.newLine(w)
+	}
+
+	importUsages := importusage.Compute(dsc, reg)
+	imps := fd.Imports()
+	var printedImports bool
+	for i, length := 0, imps.Len(); i < length; i++ {
+		names, ok := importUsages[imps.Get(i).Path()]
+		if !ok {
+			// not used by this element
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "import %q;", imps.Get(i).Path())
+		if p.AnnotateImports {
+			p.printImportUsage(names, w)
+		}
+		_, _ = fmt.Fprintln(w)
+		printedImports = true
+	}
+	if printedImports {
+		p.newLine(w)
+	}
+}
+
+// printSyntax prints the syntax or, for files that use editions, the edition
+// declaration of the given file, followed by a blank line.
+func (p *Printer) printSyntax(fd protoreflect.FileDescriptor, si protoreflect.SourceLocation, w *writer) {
+	p.printElement(false, si, w, 0, func(w *writer) {
+		syn := fd.Syntax()
+		if syn != protoreflect.Editions {
+			_, _ = fmt.Fprintf(w, "syntax = %q;", syn.String())
+			return
+		}
+		_, _ = fmt.Fprintf(w, "edition = %q;", strings.TrimPrefix(protodescs.GetEdition(fd, nil).String(), "EDITION_"))
+	})
+	p.newLine(w)
+}
+
+func (p *Printer) printImportUsage(names []protoreflect.FullName, w *writer) {
+	var buf strings.Builder
+	if len(names) == 0 {
+		buf.WriteString("unused")
+	} else {
+		buf.WriteString("uses: ")
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(string(name))
+		}
+	}
+	if p.PreferMultiLineStyleComments {
+		_, _ = fmt.Fprintf(w, " /* %s */", buf.String())
+	} else {
+		_, _ = fmt.Fprintf(w, " // %s", buf.String())
+	}
+}
+
 func findExtSi(locs protoreflect.SourceLocations, fieldSi, extSi protoreflect.SourceLocation) protoreflect.SourceLocation {
 	if sourceloc.IsZero(fieldSi) {
 		return protoreflect.SourceLocation{}
@@ -1547,10 +1878,10 @@ func (p *Printer) printOptionsLong(
 		func(i int32) protoreflect.SourceLocation {
 			return sourceInfo.ByPath(append(path, i))
 		},
-		func(w *writer, indent int, opt option, _ bool) {
+		func(w *writer, indent int, opt option, si protoreflect.SourceLocation, _ bool) {
 			p.indent(w, indent)
 			_, _ = fmt.Fprint(w, "option ")
-			p.printOption(reg, opt.name, opt.val, w, indent)
+			p.printOption(reg, opt.name, opt.val, si, w, indent)
 			_, _ = fmt.Fprint(w, ";")
 		},
 		false)
@@ -1620,7 +1951,7 @@ func (p *Printer) printOptionsShort(
 			threshold = 50
 		}
 		// we subtract 3 so we don't consider the leading " [" and trailing "]"
-		if tmp.Len()-3 > threshold {
+		if tmp.Len()-3 > threshold || p.exceedsMaxLineLength(tmpW.col+1) {
 			p.printOptionElementsShort(elements, reg, w, sourceInfo, path, indent, true)
 		} else {
 			// not too long: commit what we rendered
@@ -1632,6 +1963,7 @@ func (p *Printer) printOptionsShort(
 			_, _ = w.Write(b)
 			w.newline = tmpW.newline
 			w.space = tmpW.space
+			w.col = tmpW.col
 		}
 	}
 }
@@ -1672,11 +2004,11 @@ func (p *Printer) printOptionElementsShort(
 				}
 				return sourceInfo.ByPath(p)
 			},
-			func(w *writer, indent int, opt option, more bool) {
+			func(w *writer, indent int, opt option, si protoreflect.SourceLocation, more bool) {
 				if expand {
 					p.indent(w, indent)
 				}
-				p.printOption(reg, opt.name, opt.val, w, indent)
+				p.printOption(reg, opt.name, opt.val, si, w, indent)
 				if more {
 					if expand {
 						_, _ = fmt.Fprintln(w, ",")
@@ -1698,7 +2030,7 @@ func (p *Printer) printOptions(
 	w *writer,
 	indent int,
 	siFetch func(i int32) protoreflect.SourceLocation,
-	fn func(w *writer, indent int, opt option, more bool),
+	fn func(w *writer, indent int, opt option, si protoreflect.SourceLocation, more bool),
 	haveMore bool,
 ) {
 	for i, opt := range opts {
@@ -1706,13 +2038,40 @@ func (p *Printer) printOptions(
 		if !more {
 			more = i < len(opts)-1
 		}
-		si := siFetch(int32(i))
+		idx := int32(i)
+		if opt.tag != 0 {
+			idx = int32(opt.tag)
+		}
+		si := siFetch(idx)
+		if opt.tag != 0 && si.Path == nil {
+			// the fields may have been defined all at once, using a message
+			// literal, in which case the enclosing option has the source info
+			if loc := siFetch(0); len(loc.Path) > 0 && loc.Path[len(loc.Path)-1] == int32(opt.parent) {
+				si = splitOptionComments(loc, i == 0, i == len(opts)-1)
+			}
+		}
 		p.printElement(false, si, w, indent, func(w *writer) {
-			fn(w, indent, opt, more)
+			fn(w, indent, opt, si, more)
 		})
 	}
 }
 
+// splitOptionComments returns the comments from loc, the location of a message
+// literal that is printed as several options, that belong to one of those
+// options. Leading comments belong to the first option and trailing comments
+// to the last, so that none are lost or repeated.
+func splitOptionComments(loc protoreflect.SourceLocation, first, last bool) protoreflect.SourceLocation {
+	var si protoreflect.SourceLocation
+	if first {
+		si.LeadingDetachedComments = loc.LeadingDetachedComments
+		si.LeadingComments = loc.LeadingComments
+	}
+	if last {
+		si.TrailingComments = loc.TrailingComments
+	}
+	return si
+}
+
 func inline(indent int) int {
 	if indent < 0 {
 		// already inlined
@@ -1751,9 +2110,14 @@ func sortKeys(m protoreflect.Map) []protoreflect.MapKey {
 	return res
 }
 
-func (p *Printer) printOption(reg *protoregistry.Types, name string, optVal interface{}, w *writer, indent int) {
+func (p *Printer) printOption(reg *protoregistry.Types, name string, optVal interface{}, si protoreflect.SourceLocation, w *writer, indent int) {
 	_, _ = fmt.Fprintf(w, "%s = ", name)
 
+	if text, ok := originalOptionValue(w.src, si, name, optVal); ok {
+		_, _ = fmt.Fprint(w, text)
+		return
+	}
+
 	switch optVal := optVal.(type) {
 	case int32, uint32, int64, uint64:
 		_, _ = fmt.Fprintf(w, "%d", optVal)
@@ -1768,12 +2132,20 @@ func (p *Printer) printOption(reg *protoregistry.Types, name string, optVal inte
 	case ident:
 		_, _ = fmt.Fprintf(w, "%s", optVal)
 	case messageVal:
-		threshold := p.MessageLiteralExpansionThresholdLength
-		if threshold == 0 {
-			threshold = 50
-		}
 		var buf bytes.Buffer
-		p.printMessageLiteralToBufferMaybeCompact(&buf, optVal.msg.ProtoReflect(), reg, optVal.pkg, optVal.scope, threshold, indent)
+		switch p.MessageLiteralStyle {
+		case MessageLiteralStyleCompact:
+			buf.WriteString(p.printMessageLiteralCompact(optVal.msg.ProtoReflect(), reg, optVal.pkg, optVal.scope))
+		case MessageLiteralStyleExpanded:
+			// negative threshold means every literal that can be expanded is expanded
+			p.printMessageLiteralToBufferMaybeCompact(&buf, optVal.msg.ProtoReflect(), reg, optVal.pkg, optVal.scope, -1, indent)
+		default:
+			threshold := p.MessageLiteralExpansionThresholdLength
+			if threshold == 0 {
+				threshold = 50
+			}
+			p.printMessageLiteralToBufferMaybeCompact(&buf, optVal.msg.ProtoReflect(), reg, optVal.pkg, optVal.scope, threshold, indent)
+		}
 		_, _ = w.Write(buf.Bytes())
 
 	default:
@@ -1937,7 +2309,12 @@ func (p *Printer) extractOptions(dsc protoreflect.Descriptor, reg *protoregistry
 		} else {
 			name = string(fld.Name())
 		}
-		opts := valueToOptions(fld, name, val.Interface())
+		var opts []option
+		if p.SeparateFeatureOptions && isFeatureSet(fld) {
+			opts = p.featureOptions(fld, name, val.Message(), pkg, scope)
+		} else {
+			opts = valueToOptions(fld, name, val.Interface())
+		}
 		if len(opts) > 0 {
 			for i := range opts {
 				if msg, ok := opts[i].val.(proto.Message); ok {
@@ -1951,6 +2328,37 @@ func (p *Printer) extractOptions(dsc protoreflect.Descriptor, reg *protoregistry
 	return options, nil
 }
 
+func isFeatureSet(fld protoreflect.FieldDescriptor) bool {
+	return !fld.IsExtension() && fld.Name() == "features" &&
+		fld.Message() != nil && fld.Message().FullName() == "google.protobuf.FeatureSet"
+}
+
+// featureOptions returns the fields of the given features message as separate
+// options, like "features.field_presence = IMPLICIT", which is how features
+// are idiomatically written in files that use editions.
+func (p *Printer) featureOptions(fld protoreflect.FieldDescriptor, name string, features protoreflect.Message, pkg, scope protoreflect.FullName) []option {
+	var fields []protoreflect.FieldDescriptor
+	features.Range(func(f protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, f)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Number() < fields[j].Number()
+	})
+	var opts []option
+	for _, f := range fields {
+		fieldName := string(f.Name())
+		if f.IsExtension() {
+			fieldName = fmt.Sprintf("(%s)", p.qualifyName(pkg, scope, f.FullName()))
+		}
+		for _, opt := range valueToOptions(f, name+"."+fieldName, features.Get(f).Interface()) {
+			opt.parent, opt.tag = fld.Number(), f.Number()
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
 func valueToOptions(fld protoreflect.FieldDescriptor, name string, val interface{}) []option {
 	switch val := val.(type) {
 	case protoreflect.List:
@@ -2400,13 +2808,15 @@ func (a elementSrcOrder) Less(i, j int) bool {
 		sj = a.sourceInfo.ByPath(append(a.prefix, tj, int32(ej)))
 	}
 
-	if sourceloc.IsZero(si) != sourceloc.IsZero(sj) {
+	// Locations without a path have no span, even if they have comments (which
+	// can be the case for annotations added when printing a diff).
+	if (si.Path == nil) != (sj.Path == nil) {
 		// generally, we put unknown elements after known ones;
 		// except package, imports, and option elements go first
 
 		// i will be unknown and j will be known
 		swapped := false
-		if !sourceloc.IsZero(si) {
+		if si.Path != nil {
 			ti, tj = tj, ti
 			swapped = true
 		}
@@ -2463,7 +2873,7 @@ func (a elementSrcOrder) Less(i, j int) bool {
 		}
 		return swapped
 
-	} else if sourceloc.IsZero(si) || sourceloc.IsZero(sj) {
+	} else if si.Path == nil || sj.Path == nil {
 		// let stable sort keep unknown elements in same relative order
 		return false
 	}
@@ -2693,6 +3103,10 @@ func (p *Printer) printComment(comments string, w *writer, indent int, forceNext
 		return false
 	}
 
+	if p.CommentWrapLength > 0 {
+		lines = p.wrapComment(lines, indent)
+	}
+
 	if indent >= 0 && !w.newline {
 		// last element did not have trailing newline, so we
 		// either need to tack on newline or, if comment is
@@ -2762,6 +3176,84 @@ func (p *Printer) printComment(comments string, w *writer, indent int, forceNext
 	return !multiLine || indent >= 0
 }
 
+// wrapComment re-wraps the given lines of comment text so that, when printed
+// at the given indentation level, they fit within p.CommentWrapLength.
+func (p *Printer) wrapComment(lines []string, indent int) []string {
+	if indent < 0 {
+		indent = -indent
+	}
+	// each line is preceded by indentation and a two-character comment
+	// marker ("//" or " *"); the line itself includes the leading space
+	width := p.CommentWrapLength - indent*len(p.Indent) - 2
+
+	var result []string
+	var words []string
+	flush := func() {
+		var line string
+		for _, word := range words {
+			if line != "" && len(line)+1+len(word) > width {
+				result = append(result, line)
+				line = ""
+			}
+			line += " " + word
+		}
+		if line != "" {
+			result = append(result, line)
+		}
+		words = words[:0]
+	}
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		switch {
+		case trimmed == "":
+			flush()
+			result = append(result, "")
+		case strings.HasPrefix(l, "  ") || strings.HasPrefix(l, "\t") || strings.HasPrefix(l, " \t"):
+			// preformatted text, like a code sample or continuation of a list item
+			flush()
+			result = append(result, l)
+		default:
+			if startsListItem(trimmed) {
+				flush()
+			}
+			words = append(words, strings.Fields(trimmed)...)
+		}
+	}
+	flush()
+	return result
+}
+
+func startsListItem(line string) bool {
+	if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") {
+		return true
+	}
+	digits := strings.TrimLeft(line, "0123456789")
+	return len(digits) < len(line) && strings.HasPrefix(digits, ". ")
+}
+
+// hasLeadingComment returns true if the given location has a leading or
+// detached comment, that would be printed, with the given text. Differences
+// in whitespace, such as from the comment having been wrapped, are ignored.
+func (p *Printer) hasLeadingComment(si protoreflect.SourceLocation, text string) bool {
+	text = normalizeCommentText(text)
+	if p.includeCommentType(CommentsDetached) {
+		for _, c := range si.LeadingDetachedComments {
+			if normalizeCommentText(c) == text {
+				return true
+			}
+		}
+	}
+	return p.includeCommentType(CommentsLeading) && si.LeadingComments != "" &&
+		normalizeCommentText(si.LeadingComments) == text
+}
+
+// normalizeCommentText returns the words of the given comment text, separated
+// by single spaces, so that comments can be compared without regard to how
+// they are wrapped or indented.
+func normalizeCommentText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
 func (p *Printer) indent(w io.Writer, indent int) {
 	for i := 0; i < indent; i++ {
 		_, _ = fmt.Fprint(w, p.Indent)
@@ -2776,11 +3268,21 @@ func (p *Printer) maybeIndent(w io.Writer, indent int, requireIndent bool) {
 	}
 }
 
+// exceedsMaxLineLength returns true if a line of the given length is too long
+// per the printer's MaxLineLength.
+func (p *Printer) exceedsMaxLineLength(length int) bool {
+	return p.MaxLineLength > 0 && length > p.MaxLineLength
+}
+
 type writer struct {
 	io.Writer
 	err     error
 	space   bool
 	newline bool
+	// the column at which the next character written will appear
+	col int
+	// the original source text of the file being printed, if available
+	src []byte
 }
 
 func newWriter(w io.Writer) *writer {
@@ -2803,6 +3305,7 @@ func (w *writer) Write(p []byte) (int, error) {
 				w.err = err
 				return 0, err
 			}
+			w.col++
 		}
 		w.space = false
 	}
@@ -2815,6 +3318,12 @@ func (w *writer) Write(p []byte) (int, error) {
 		w.newline = true
 	}
 
+	if pos := bytes.LastIndexByte(p, '\n'); pos >= 0 {
+		w.col = len(p) - pos - 1
+	} else {
+		w.col += len(p)
+	}
+
 	num, err := w.Writer.Write(p)
 	if err != nil {
 		w.err = err
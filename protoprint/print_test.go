@@ -3,11 +3,13 @@ package protoprint
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/bufbuild/protocompile"
@@ -316,6 +318,99 @@ func checkContents(t *testing.T, actualContents string, goldenFileName string) {
 	require.Equal(t, string(b), actualContents, "wrong file contents for %s", goldenFileName)
 }
 
+func TestPrintNormalizeWhitespace(t *testing.T) {
+	files := []string{
+		"../internal/testprotos/desc_test_comments.protoset",
+		"../internal/testprotos/desc_test_complex_source_info.protoset",
+		"../internal/testprotos/desc_test_proto3.protoset",
+		"../internal/testprotos/desc_test1.protoset",
+	}
+	printers := map[string]*Printer{
+		"default":                  {NormalizeWhitespace: true},
+		"trailing-on-next-line":    {NormalizeWhitespace: true, TrailingCommentsOnSeparateLine: true},
+		"multiline-style-comments": {NormalizeWhitespace: true, Indent: "\t", PreferMultiLineStyleComments: true},
+		"sorted":                   {NormalizeWhitespace: true, SortElements: true},
+	}
+	for _, file := range files {
+		fd, err := prototesting.LoadProtoset(file)
+		require.NoError(t, err)
+		for name, pr := range printers {
+			t.Run(fmt.Sprintf("%s/%s", filepath.Base(fd.Path()), name), func(t *testing.T) {
+				printed, err := pr.PrintProtoToString(fd)
+				require.NoError(t, err)
+				checkNormalized(t, printed)
+
+				// Compile the printed output and print it again. The first round
+				// may differ from the original since comments for some elements
+				// (like extend blocks) are not attributed the same way by the
+				// compiler as in the protoset. But after that, printing must be
+				// a fixed point.
+				reprinted := compileAndPrint(t, pr, fd.Path(), printed)
+				checkNormalized(t, reprinted)
+				require.Equal(t, reprinted, compileAndPrint(t, pr, fd.Path(), reprinted))
+			})
+		}
+	}
+}
+
+func compileAndPrint(t *testing.T, pr *Printer, path, source string) string {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: func(p string) (io.ReadCloser, error) {
+				if p == path {
+					return io.NopCloser(strings.NewReader(source)), nil
+				}
+				return os.Open(filepath.Join("../internal/testprotos", p))
+			},
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	compiled, err := compiler.Compile(context.Background(), path)
+	require.NoError(t, err)
+	printed, err := pr.PrintProtoToString(compiled[0])
+	require.NoError(t, err)
+	return printed
+}
+
+func checkNormalized(t *testing.T, printed string) {
+	require.True(t, strings.HasSuffix(printed, "\n"), "output should end with newline")
+	require.False(t, strings.HasSuffix(printed, "\n\n"), "output should not end with blank line")
+	require.False(t, strings.HasPrefix(printed, "\n"), "output should not start with blank line")
+	require.NotContains(t, printed, "\n\n\n", "output should not contain consecutive blank lines")
+	for i, line := range strings.Split(printed, "\n") {
+		require.Equal(t, strings.TrimRight(line, " \t"), line, "line %d should not have trailing whitespace", i+1)
+	}
+}
+
+func TestNormalizingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	nw := newNormalizingWriter(&buf)
+	_, err := io.WriteString(nw, "\n\n  \nfoo  \n\n\n\t\nbar")
+	require.NoError(t, err)
+	_, err = io.WriteString(nw, " baz\t\n\n")
+	require.NoError(t, err)
+	_, err = io.WriteString(nw, "  \n")
+	require.NoError(t, err)
+	require.NoError(t, nw.Flush())
+	require.Equal(t, "foo\n\nbar baz\n", buf.String())
+
+	// partial last line gets a newline
+	buf.Reset()
+	nw = newNormalizingWriter(&buf)
+	_, err = io.WriteString(nw, "foo\nbar ")
+	require.NoError(t, err)
+	require.NoError(t, nw.Flush())
+	require.Equal(t, "foo\nbar\n", buf.String())
+
+	// empty output stays empty
+	buf.Reset()
+	nw = newNormalizingWriter(&buf)
+	_, err = io.WriteString(nw, "\n \n")
+	require.NoError(t, err)
+	require.NoError(t, nw.Flush())
+	require.Empty(t, buf.String())
+}
+
 func TestQuoteString(t *testing.T) {
 	// other tests have examples of encountering invalid UTF8 and printable unicode
 	// so this is just for testing how unprintable valid unicode characters are rendered
@@ -328,3 +423,721 @@ func TestQuoteString(t *testing.T) {
 	s = quotedString("\U0010FFFF")
 	require.Equal(t, "\"\\U0010FFFF\"", s)
 }
+
+func TestPrintImportAnnotations(t *testing.T) {
+	files := map[string]string{
+		"test.proto": `
+syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/descriptor.proto";
+import "google/protobuf/empty.proto";
+import "google/protobuf/duration.proto";
+import "other.proto";
+
+message Foo {
+  option (opt) = true;
+  google.protobuf.Duration dur = 1;
+  map<string, baz.Bar> bars = 2;
+  baz.Enum en = 3;
+}
+
+extend google.protobuf.MessageOptions {
+  bool opt = 10101;
+}
+
+service FooService {
+  rpc Get (Foo) returns (baz.Bar);
+}
+`,
+		"other.proto": `
+syntax = "proto3";
+
+package baz;
+
+import public "public.proto";
+
+message Bar {}
+`,
+		"public.proto": `
+syntax = "proto3";
+
+package baz;
+
+enum Enum {
+  ZERO = 0;
+}
+`,
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+
+	checkFile(t, &Printer{AnnotateImports: true}, fds[0], "test-import-annotations.proto")
+}
+
+func TestPrintFormattingOptions(t *testing.T) {
+	files := map[string]string{"test.proto": `
+syntax = "proto3";
+
+import "google/protobuf/descriptor.proto";
+
+message Foo {
+  string name = 1;
+  int32 id = 2;
+  bool enabled = 3;
+}
+
+extend google.protobuf.MessageOptions {
+  Foo foo = 54321;
+}
+
+message Test {
+  option (foo) = { name: "abc" id: 123 enabled: true };
+  string a_field_with_a_rather_long_name = 1 [deprecated = true, json_name = "aField"];
+}
+`}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+	md := fds[0].Messages().ByName("Test")
+
+	printed, err := (&Printer{}).PrintProtoToString(md)
+	require.NoError(t, err)
+	require.Contains(t, printed, `option (foo) = { name: "abc", id: 123, enabled: true };`)
+	require.Contains(t, printed, `string a_field_with_a_rather_long_name = 1 [deprecated = true, json_name = "aField"];`)
+
+	printed, err = (&Printer{MessageLiteralStyle: MessageLiteralStyleExpanded, MaxLineLength: 80}).PrintProtoToString(md)
+	require.NoError(t, err)
+	require.Contains(t, printed, "option (foo) = {\n    name: \"abc\",\n    id: 123,\n    enabled: true\n  };")
+	require.Contains(t, printed, "string a_field_with_a_rather_long_name = 1 [\n    deprecated = true,\n    json_name = \"aField\"\n  ];")
+	for _, line := range strings.Split(printed, "\n") {
+		require.LessOrEqual(t, len(line), 80)
+	}
+
+	printed, err = (&Printer{MessageLiteralStyle: MessageLiteralStyleCompact, MessageLiteralExpansionThresholdLength: 5, Indent: "\t"}).PrintProtoToString(md)
+	require.NoError(t, err)
+	require.Contains(t, printed, "\toption (foo) = { name: \"abc\", id: 123, enabled: true };")
+}
+
+func TestPrintOriginalLiterals(t *testing.T) {
+	files := map[string]string{"test.proto": `
+syntax = "proto2";
+
+import "google/protobuf/descriptor.proto";
+
+option java_package = 'foo.' "bar";
+
+extend google.protobuf.MessageOptions {
+  optional uint32 mask = 54321;
+  repeated int64 ids = 54322;
+  optional double ratio = 54323;
+}
+
+message Test {
+	option (mask) = 0xff00;
+  option (ids) = 0x1;
+  option (ids) = 020;
+  option (ratio) = 1.50e2;
+  optional string name = 1 [default = "\x41é", deprecated = true];
+}
+`}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+
+	printed, err := (&Printer{}).PrintProtoToString(fds[0])
+	require.NoError(t, err)
+	require.Contains(t, printed, `option java_package = "foo.bar";`)
+	require.Contains(t, printed, `option (mask) = 65280;`)
+
+	pr := &Printer{
+		OriginalSource: func(path string) ([]byte, error) {
+			return []byte(files[path]), nil
+		},
+	}
+	printed, err = pr.PrintProtoToString(fds[0])
+	require.NoError(t, err)
+	require.Contains(t, printed, `option java_package = 'foo.' "bar";`)
+	require.Contains(t, printed, `option (mask) = 0xff00;`)
+	require.Contains(t, printed, `option (ratio) = 1.50e2;`)
+	require.Contains(t, printed, `[default = "\x41é", deprecated = true]`)
+	require.Contains(t, printed, "option (ids) = 0x1;\n  option (ids) = 020;")
+
+	// source that doesn't match the source info is ignored
+	pr.OriginalSource = func(string) ([]byte, error) {
+		return []byte("// nothing to see here\n"), nil
+	}
+	printed, err = pr.PrintProtoToString(fds[0])
+	require.NoError(t, err)
+	require.Contains(t, printed, `option (mask) = 65280;`)
+
+	pr.OriginalSource = func(path string) ([]byte, error) {
+		return nil, errors.New("no source")
+	}
+	_, err = pr.PrintProtoToString(fds[0])
+	require.ErrorContains(t, err, `failed to load source for "test.proto": no source`)
+}
+
+func TestPrintEditions_SeparateFeatureOptions(t *testing.T) {
+	files := map[string]string{"test.proto": `edition = "2023";
+
+package foo;
+
+// a literal
+option features = { field_presence: IMPLICIT, enum_type: CLOSED }; // trailing
+
+message Foo {
+  // message features
+  option features.json_format = LEGACY_BEST_EFFORT;
+
+  string name = 1 [features.field_presence = EXPLICIT];
+
+  Foo child = 2 [features.message_encoding = DELIMITED];
+
+  int32 req = 3 [features.field_presence = LEGACY_REQUIRED];
+}
+
+enum Bar {
+  option features.enum_type = OPEN;
+
+  BAR_ZERO = 0;
+}
+`}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+	printer := &Printer{SeparateFeatureOptions: true}
+	printed, err := printer.PrintProtoToString(fds[0])
+	require.NoError(t, err)
+	require.Equal(t, `edition = "2023";
+
+package foo;
+
+// a literal
+option features.field_presence = IMPLICIT;
+option features.enum_type = CLOSED; // trailing
+
+message Foo {
+  // message features
+  option features.json_format = LEGACY_BEST_EFFORT;
+
+  string name = 1 [features.field_presence = EXPLICIT];
+
+  Foo child = 2 [features.message_encoding = DELIMITED];
+
+  int32 req = 3 [features.field_presence = LEGACY_REQUIRED];
+}
+
+enum Bar {
+  option features.enum_type = OPEN;
+
+  BAR_ZERO = 0;
+}
+`, printed)
+
+	// printing without source info and then compiling the result
+	// produces the same descriptor
+	files["test2.proto"] = strings.Replace(printed, "package foo;", "package foo2;", 1)
+	compiler.SourceInfoMode = protocompile.SourceInfoNone
+	fds, err = compiler.Compile(context.Background(), "test.proto", "test2.proto")
+	require.NoError(t, err)
+	printed, err = printer.PrintProtoToString(fds[0])
+	require.NoError(t, err)
+	reprinted, err := printer.PrintProtoToString(fds[1])
+	require.NoError(t, err)
+	require.Equal(t, printed, strings.Replace(reprinted, "package foo2;", "package foo;", 1))
+
+	// by default, features are printed as a single message literal
+	printed, err = (&Printer{}).PrintProtoToString(fds[0])
+	require.NoError(t, err)
+	require.Contains(t, printed, "option features = { field_presence: IMPLICIT, enum_type: CLOSED };")
+	require.Contains(t, printed, "option features = { json_format: LEGACY_BEST_EFFORT };")
+}
+
+func TestPrintProtoDiff(t *testing.T) {
+	files := map[string]string{
+		"old/test.proto": `
+syntax = "proto3";
+package test;
+message Book {
+  string name = 1;
+  int32 pages = 2;
+  string isbn = 3;
+  map<string, int32> counts = 4;
+  message Chapter {
+    string title = 1;
+  }
+}
+message Shelf {
+  repeated Book books = 1;
+}
+enum Genre {
+  GENRE_UNSPECIFIED = 0;
+  FICTION = 1;
+  POETRY = 2;
+}
+service Library {
+  rpc GetBook(Book) returns (Book);
+  rpc ListBooks(Shelf) returns (Shelf);
+}
+`,
+		"new/test.proto": `
+syntax = "proto3";
+package test;
+// A book.
+message Book {
+  string name = 1;
+  int64 pages = 2;
+  map<string, int64> counts = 4;
+  repeated string authors = 5;
+}
+enum Genre {
+  GENRE_UNSPECIFIED = 0;
+  FICTION = 1 [deprecated = true];
+  POETRY = 2;
+  DRAMA = 3;
+}
+service Library {
+  rpc GetBook(Book) returns (Book);
+  rpc ListBooks(Book) returns (stream Book);
+}
+`,
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	oldFds, err := compiler.Compile(context.Background(), "old/test.proto")
+	require.NoError(t, err)
+	newFds, err := compiler.Compile(context.Background(), "new/test.proto")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = (&Printer{NormalizeWhitespace: true}).PrintProtoDiff(oldFds[0], newFds[0], &buf)
+	require.NoError(t, err)
+	require.Equal(t, `// DIFF: removed: message Shelf
+syntax = "proto3";
+
+package test;
+
+// DIFF: removed: string isbn = 3;
+// DIFF: removed: message Chapter
+// A book.
+message Book {
+  string name = 1;
+
+  // DIFF: changed; was: int32 pages = 2;
+  int64 pages = 2;
+
+  // DIFF: changed; was: map<string, int32> counts = 4;
+  map<string, int64> counts = 4;
+
+  // DIFF: added
+  repeated string authors = 5;
+}
+
+enum Genre {
+  GENRE_UNSPECIFIED = 0;
+
+  // DIFF: changed; was: FICTION = 1;
+  FICTION = 1 [deprecated = true];
+
+  POETRY = 2;
+
+  // DIFF: added
+  DRAMA = 3;
+}
+
+service Library {
+  rpc GetBook ( Book ) returns ( Book );
+
+  // DIFF: changed
+  rpc ListBooks ( Book ) returns ( stream Book );
+}
+`, buf.String())
+
+	// without source info, elements are still printed in declaration order
+	oldFile, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(oldFds[0]), nil)
+	require.NoError(t, err)
+	newProto := protodesc.ToFileDescriptorProto(newFds[0])
+	newProto.SourceCodeInfo = nil
+	newFile, err := protodesc.NewFile(newProto, nil)
+	require.NoError(t, err)
+	buf.Reset()
+	err = (&Printer{Compact: true}).PrintProtoDiff(oldFile, newFile, &buf)
+	require.NoError(t, err)
+	require.Regexp(t, `(?s)message Book \{.*enum Genre \{.*// DIFF: added\n  DRAMA = 3;.*service Library`, buf.String())
+}
+
+func TestPrintCanonical(t *testing.T) {
+	// The same schema, but with elements, options, and extend blocks declared
+	// in different orders and with different comments.
+	srcA := `syntax = "proto2";
+package test;
+import "google/protobuf/descriptor.proto";
+import "google/protobuf/empty.proto";
+option java_package = "foo";
+option go_package = "bar";
+extend google.protobuf.FieldOptions { optional string xyz = 10101; optional int32 abc = 10102; }
+message Foo {
+  option deprecated = true;
+  option no_standard_descriptor_accessor = true;
+  optional string name = 2 [deprecated = true, json_name = "N", (abc) = 1, (xyz) = "x"];
+  optional int32 id = 1;
+  reserved 10, 5 to 7;
+  reserved "b", "a";
+  extensions 100 to 200, 50 to 60;
+  oneof thing { string s = 4; int32 i = 3; }
+  map<string, int32> m = 8;
+  optional group G = 9 { optional int32 x = 2; optional int32 y = 1; }
+  enum E { Z = 0; B = 2; A = 1; }
+}
+enum Kind { UNKNOWN = 0; TWO = 2; ONE = 1; }
+service Svc { rpc B(google.protobuf.Empty) returns (Foo); rpc A(Foo) returns (Foo) { option deprecated = true; option idempotency_level = NO_SIDE_EFFECTS; } }
+`
+	srcB := `syntax = "proto2";
+package test;
+import "google/protobuf/empty.proto";
+import "google/protobuf/descriptor.proto";
+option go_package = "bar";
+option java_package = "foo";
+service Svc { rpc A(Foo) returns (Foo) { option idempotency_level = NO_SIDE_EFFECTS; option deprecated = true; }
+  rpc B(google.protobuf.Empty) returns (Foo); }
+enum Kind { UNKNOWN = 0; ONE = 1; TWO = 2; }
+// Foo is a message.
+message Foo {
+  enum E { Z = 0; A = 1; B = 2; }
+  optional group G = 9 { optional int32 y = 1; optional int32 x = 2; }
+  map<string, int32> m = 8;
+  oneof thing { int32 i = 3; string s = 4; }
+  extensions 50 to 60, 100 to 200;
+  reserved "a", "b";
+  reserved 5 to 7;
+  reserved 10;
+  optional int32 id = 1;
+  optional string name = 2 [(xyz) = "x", (abc) = 1, json_name = "N", deprecated = true];
+  option no_standard_descriptor_accessor = true;
+  option deprecated = true;
+}
+extend google.protobuf.FieldOptions { optional int32 abc = 10102; }
+// comment
+extend google.protobuf.FieldOptions { optional string xyz = 10101; }
+`
+	compile := func(src string) protoreflect.FileDescriptor {
+		compiler := protocompile.Compiler{
+			Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+				Accessor: protocompile.SourceAccessorFromMap(map[string]string{"test.proto": src}),
+			}),
+			SourceInfoMode: protocompile.SourceInfoStandard,
+		}
+		fds, err := compiler.Compile(context.Background(), "test.proto")
+		require.NoError(t, err)
+		return fds[0]
+	}
+	fdA, fdB := compile(srcA), compile(srcB)
+
+	// Sorting alone is not enough since source info is still used.
+	sortedA, err := (&Printer{SortElements: true}).PrintProtoToString(fdA)
+	require.NoError(t, err)
+	sortedB, err := (&Printer{SortElements: true}).PrintProtoToString(fdB)
+	require.NoError(t, err)
+	require.NotEqual(t, sortedA, sortedB)
+
+	pr := &Printer{Canonical: true, CustomSortFunction: reverseByName}
+	canonicalA, err := pr.PrintProtoToString(fdA)
+	require.NoError(t, err)
+	canonicalB, err := pr.PrintProtoToString(fdB)
+	require.NoError(t, err)
+	require.Equal(t, canonicalA, canonicalB)
+	require.NotContains(t, canonicalA, "//")
+	require.Equal(t, 1, strings.Count(canonicalA, "extend google.protobuf.FieldOptions {"))
+	require.Contains(t, canonicalA, `
+message Foo {
+  option deprecated = true;
+
+  option no_standard_descriptor_accessor = true;
+
+  optional int32 id = 1;
+
+  optional string name = 2 [
+    deprecated = true,
+    json_name = "N",
+    (abc) = 1,
+    (xyz) = "x"
+  ];
+
+  oneof thing {
+    int32 i = 3;
+
+    string s = 4;
+  }
+`)
+
+	// Output is the same regardless of whether the file has source info.
+	fdpA := protodesc.ToFileDescriptorProto(fdA)
+	fdpA.SourceCodeInfo = nil
+	noSourceInfo, err := protodesc.NewFile(fdpA, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	canonical, err := pr.PrintProtoToString(noSourceInfo)
+	require.NoError(t, err)
+	require.Equal(t, canonicalA, canonical)
+}
+
+func TestPrintProtoFilesConcurrently(t *testing.T) {
+	var fds []protoreflect.FileDescriptor
+	for _, file := range []string{
+		"../internal/testprotos/desc_test_comments.protoset",
+		"../internal/testprotos/desc_test_complex_source_info.protoset",
+		"../internal/testprotos/desc_test_editions.protoset",
+		"../internal/testprotos/desc_test_proto3.protoset",
+		"../internal/testprotos/desc_test1.protoset",
+	} {
+		fd, err := prototesting.LoadProtoset(file)
+		require.NoError(t, err)
+		fds = append(fds, fd)
+	}
+	pr := &Printer{Indent: "\t", SortElements: true}
+
+	var mu sync.Mutex
+	outputs := map[string]*bytes.Buffer{}
+	err := pr.PrintProtoFilesConcurrently(fds, func(name string) (io.WriteCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		var buf bytes.Buffer
+		outputs[name] = &buf
+		return nopWriteCloser{&buf}, nil
+	}, 2)
+	require.NoError(t, err)
+	require.Len(t, outputs, len(fds))
+	for _, fd := range fds {
+		expected, err := pr.PrintProtoToString(fd)
+		require.NoError(t, err)
+		require.Equal(t, expected, outputs[fd.Path()].String(), fd.Path())
+	}
+
+	// all errors are reported, in the order of the given files
+	errFailed := errors.New("failed")
+	err = pr.PrintProtoFilesConcurrently(fds, func(name string) (io.WriteCloser, error) {
+		if name == fds[1].Path() || name == fds[3].Path() {
+			return nil, errFailed
+		}
+		return nopWriteCloser{io.Discard}, nil
+	}, 0)
+	require.ErrorIs(t, err, errFailed)
+	require.EqualError(t, err, fmt.Sprintf("failed to open %s: failed\nfailed to open %s: failed", fds[1].Path(), fds[3].Path()))
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestPrintElement(t *testing.T) {
+	files := map[string]string{
+		"test.proto": `
+syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/descriptor.proto";
+import "google/protobuf/duration.proto";
+import "other.proto";
+
+// Foo is a message.
+message Foo {
+  option (opt) = true;
+  google.protobuf.Duration dur = 1;
+  baz.Bar bar = 2;
+}
+
+extend google.protobuf.MessageOptions {
+  bool opt = 10101;
+}
+
+enum Kind {
+  KIND_UNSPECIFIED = 0;
+}
+
+service FooService {
+  rpc Get (Foo) returns (baz.Bar);
+}
+`,
+		"other.proto": `
+syntax = "proto3";
+
+package baz;
+
+message Bar {}
+`,
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+	fd := fds[0]
+
+	testCases := []struct {
+		name     string
+		printer  *Printer
+		element  protoreflect.Descriptor
+		expected string
+	}{
+		{
+			name:    "message",
+			printer: &Printer{AnnotateImports: true},
+			element: fd.Messages().ByName("Foo"),
+			expected: `syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/duration.proto"; // uses: google.protobuf.Duration
+import "other.proto"; // uses: baz.Bar
+
+// Foo is a message.
+message Foo {
+  option (opt) = true;
+
+  google.protobuf.Duration dur = 1;
+
+  baz.Bar bar = 2;
+}
+`,
+		},
+		{
+			name:    "enum",
+			printer: &Printer{},
+			element: fd.Enums().ByName("Kind"),
+			expected: `syntax = "proto3";
+
+package foo.bar;
+
+enum Kind {
+  KIND_UNSPECIFIED = 0;
+}
+`,
+		},
+		{
+			name:    "service",
+			printer: &Printer{Compact: true},
+			element: fd.Services().ByName("FooService"),
+			expected: `syntax = "proto3";
+package foo.bar;
+import "other.proto";
+service FooService {
+  rpc Get ( Foo ) returns ( baz.Bar );
+}
+`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := testCase.printer.PrintElement(testCase.element, &buf)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, buf.String())
+		})
+	}
+
+	err = (&Printer{}).PrintElement(fd, io.Discard)
+	require.EqualError(t, err, `cannot print "foo.bar" as a standalone element: must be a message, enum, or service`)
+}
+
+func TestPrintFileHeaderAndCommentWrapping(t *testing.T) {
+	source := `syntax = "proto3";
+
+package foo;
+
+// This is a long comment for the message, which goes on and on for quite a while, so that it needs wrapping.
+//
+// Some items:
+// - first item, which is also fairly long and will need to be wrapped onto another line
+// - second item
+//
+//     code sample that is preformatted and must stay exactly as it is, even though it is long
+message Foo {
+  // short comment
+  string name = 1;
+}
+`
+	header := func(protoreflect.FileDescriptor) string {
+		return "Copyright 2024 Example Corp.\n\nLicensed under the Apache License, Version 2.0."
+	}
+	pr := &Printer{FileHeader: header, CommentWrapLength: 40}
+	printed := compileAndPrint(t, pr, "test.proto", source)
+	expected := `// Copyright 2024 Example Corp.
+//
+// Licensed under the Apache License,
+// Version 2.0.
+
+syntax = "proto3";
+
+package foo;
+
+// This is a long comment for the
+// message, which goes on and on for
+// quite a while, so that it needs
+// wrapping.
+//
+// Some items:
+// - first item, which is also fairly
+// long and will need to be wrapped onto
+// another line
+// - second item
+//
+//     code sample that is preformatted and must stay exactly as it is, even though it is long
+message Foo {
+  // short comment
+  string name = 1;
+}
+`
+	require.Equal(t, expected, printed)
+
+	// header is not repeated when printing a file that already has it
+	reprinted := compileAndPrint(t, pr, "test.proto", printed)
+	require.Equal(t, expected, reprinted)
+
+	// header uses the preferred comment style
+	pr = &Printer{FileHeader: header, PreferMultiLineStyleComments: true, OmitComments: CommentsAll}
+	printed = compileAndPrint(t, pr, "test.proto", source)
+	require.True(t, strings.HasPrefix(printed, `/*
+ * Copyright 2024 Example Corp.
+ *
+ * Licensed under the Apache License, Version 2.0.
+ */
+
+syntax = "proto3";
+`), printed)
+}
@@ -1,6 +1,8 @@
 package protoprint
 
 import (
+	"fmt"
+
 	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"github.com/jhump/protoreflect/v2/internal"
@@ -47,3 +49,40 @@ func (s *sourceLocations) putIfAbsent(path protoreflect.SourcePath, loc protoref
 		s.extrasByPath[k] = &s.extras[len(s.extras)-1]
 	}
 }
+
+// annotatedLocations adds extra leading comments to the locations of some
+// elements. The annotations are keyed by path key (see internal.PathKey).
+type annotatedLocations struct {
+	protoreflect.SourceLocations
+	annotations map[string]string
+}
+
+func (a *annotatedLocations) ByPath(path protoreflect.SourcePath) protoreflect.SourceLocation {
+	loc := a.SourceLocations.ByPath(path)
+	if annotation, ok := a.annotations[internal.PathKey(path)]; ok {
+		loc.LeadingComments = annotation + loc.LeadingComments
+	}
+	return loc
+}
+
+// noSourceLocations hides all source locations, so that the printed output
+// does not depend on source code info.
+type noSourceLocations struct {
+	protoreflect.SourceLocations
+}
+
+func (noSourceLocations) Len() int {
+	return 0
+}
+
+func (noSourceLocations) Get(i int) protoreflect.SourceLocation {
+	panic(fmt.Sprintf("index out of range: %d", i))
+}
+
+func (noSourceLocations) ByPath(protoreflect.SourcePath) protoreflect.SourceLocation {
+	return protoreflect.SourceLocation{}
+}
+
+func (noSourceLocations) ByDescriptor(protoreflect.Descriptor) protoreflect.SourceLocation {
+	return protoreflect.SourceLocation{}
+}
@@ -0,0 +1,223 @@
+// Package synthsource computes source code info for file descriptors that
+// have none, by printing them with a protoprint.Printer and then compiling
+// the printed source. This is in its own package, instead of in protoprint,
+// so that programs that only print files do not depend on the compiler.
+package synthsource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/internal"
+	"github.com/jhump/protoreflect/v2/protoprint"
+)
+
+// Synthesize returns a copy of the given file descriptor that includes source
+// code info. This is useful for descriptors that have no source code info,
+// like those downloaded via server reflection or those embedded in generated
+// code, since many tools (for example, ones that attach comments to elements
+// or that provide navigation in an IDE) need source locations.
+//
+// The locations describe the file as the given printer would format it. If
+// the printer is nil, a zero-value protoprint.Printer is used. The printed
+// source is written to the given writer, so that tools can present it
+// alongside the returned descriptor. If out is nil, the source is discarded.
+// If the given file already has source code info, its comments are included
+// in the printed source, and the returned descriptor's source code info
+// replaces the original.
+//
+// The returned descriptor has the same elements, in the same order, as the
+// given one, even if the printer emits them in a different order (such as
+// when SortElements is set). Only the source code info differs.
+func Synthesize(printer *protoprint.Printer, fd protoreflect.FileDescriptor, out io.Writer) (protoreflect.FileDescriptor, error) {
+	if printer == nil {
+		printer = &protoprint.Printer{}
+	}
+	var buf bytes.Buffer
+	if err := printer.PrintProtoFile(fd, &buf); err != nil {
+		return nil, err
+	}
+	source := buf.Bytes()
+
+	deps := map[string]protoreflect.FileDescriptor{}
+	var depFiles protoregistry.Files
+	if err := addDeps(fd, deps, &depFiles); err != nil {
+		return nil, err
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.ResolverFunc(func(path string) (protocompile.SearchResult, error) {
+			if path == fd.Path() {
+				return protocompile.SearchResult{Source: bytes.NewReader(source)}, nil
+			}
+			if dep, ok := deps[path]; ok {
+				return protocompile.SearchResult{Desc: dep}, nil
+			}
+			return protocompile.SearchResult{}, protoregistry.NotFound
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	files, err := compiler.Compile(context.Background(), fd.Path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute source info for %q: %w", fd.Path(), err)
+	}
+	printed := protodesc.ToFileDescriptorProto(files[0])
+
+	fdProto := protodesc.ToFileDescriptorProto(fd)
+	fdProto.SourceCodeInfo = translateSourceInfo(printed, fdProto)
+	result, err := protodesc.NewFile(fdProto, &depFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add source info to %q: %w", fd.Path(), err)
+	}
+	if out != nil {
+		if _, err := out.Write(source); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func addDeps(fd protoreflect.FileDescriptor, deps map[string]protoreflect.FileDescriptor, files *protoregistry.Files) error {
+	imps := fd.Imports()
+	for i, length := 0, imps.Len(); i < length; i++ {
+		dep := imps.Get(i).FileDescriptor
+		if _, ok := deps[dep.Path()]; ok {
+			continue
+		}
+		deps[dep.Path()] = dep
+		if err := addDeps(dep, deps, files); err != nil {
+			return err
+		}
+		if err := files.RegisterFile(dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// translateSourceInfo returns the source code info of from, but with the
+// paths changed to refer to the corresponding elements in to. Elements are
+// matched by name, so the two files may declare elements in different orders.
+// Locations for elements in from that have no counterpart in to are dropped.
+func translateSourceInfo(from, to *descriptorpb.FileDescriptorProto) *descriptorpb.SourceCodeInfo {
+	fromElements := map[string]string{}
+	walkElementPaths(from, func(key string, path []int32) {
+		fromElements[internal.PathKey(path)] = key
+	})
+	toElements := map[string][]int32{}
+	walkElementPaths(to, func(key string, path []int32) {
+		toElements[key] = append([]int32(nil), path...)
+	})
+
+	var result descriptorpb.SourceCodeInfo
+	for _, loc := range from.GetSourceCodeInfo().GetLocation() {
+		path := loc.Path
+		for n := len(path); n > 0; n-- {
+			key, ok := fromElements[internal.PathKey(path[:n])]
+			if !ok {
+				continue
+			}
+			toPath, ok := toElements[key]
+			if !ok {
+				path = nil
+				break
+			}
+			path = append(append([]int32(nil), toPath...), path[n:]...)
+			break
+		}
+		if path == nil {
+			continue
+		}
+		loc.Path = path
+		result.Location = append(result.Location, loc)
+	}
+	return &result
+}
+
+// walkElementPaths calls fn for every element in the given file that can
+// have a source location, with a key that identifies the element and the
+// element's path.
+func walkElementPaths(fd *descriptorpb.FileDescriptorProto, fn func(key string, path []int32)) {
+	path := make([]int32, 0, 16)
+	prefix := fd.GetPackage()
+	if prefix != "" {
+		prefix += "."
+	}
+	for i, dep := range fd.GetDependency() {
+		fn("import:"+dep, append(path, internal.FileDependencyTag, int32(i)))
+	}
+	for i, dep := range fd.GetPublicDependency() {
+		fn("public:"+fd.GetDependency()[dep], append(path, internal.FilePublicDependencyTag, int32(i)))
+	}
+	for i, dep := range fd.GetWeakDependency() {
+		fn("weak:"+fd.GetDependency()[dep], append(path, internal.FileWeakDependencyTag, int32(i)))
+	}
+	for i, md := range fd.GetMessageType() {
+		walkMessagePaths(md, prefix, append(path, internal.FileMessagesTag, int32(i)), fn)
+	}
+	for i, ed := range fd.GetEnumType() {
+		walkEnumPaths(ed, prefix, append(path, internal.FileEnumsTag, int32(i)), fn)
+	}
+	for i, xd := range fd.GetExtension() {
+		fn("field:"+prefix+xd.GetName(), append(path, internal.FileExtensionsTag, int32(i)))
+	}
+	for i, sd := range fd.GetService() {
+		svcName := prefix + sd.GetName()
+		svcPath := append(path, internal.FileServicesTag, int32(i))
+		fn("service:"+svcName, svcPath)
+		for j, mtd := range sd.GetMethod() {
+			fn("method:"+svcName+"."+mtd.GetName(), append(svcPath, internal.ServiceMethodsTag, int32(j)))
+		}
+	}
+}
+
+func walkMessagePaths(md *descriptorpb.DescriptorProto, prefix string, path []int32, fn func(key string, path []int32)) {
+	name := prefix + md.GetName()
+	fn("message:"+name, path)
+	prefix = name + "."
+	for i, fld := range md.GetField() {
+		fn("field:"+prefix+fld.GetName(), append(path, internal.MessageFieldsTag, int32(i)))
+	}
+	for i, ood := range md.GetOneofDecl() {
+		fn("oneof:"+prefix+ood.GetName(), append(path, internal.MessageOneofsTag, int32(i)))
+	}
+	for i, nmd := range md.GetNestedType() {
+		walkMessagePaths(nmd, prefix, append(path, internal.MessageNestedMessagesTag, int32(i)), fn)
+	}
+	for i, ed := range md.GetEnumType() {
+		walkEnumPaths(ed, prefix, append(path, internal.MessageEnumsTag, int32(i)), fn)
+	}
+	for i, xd := range md.GetExtension() {
+		fn("field:"+prefix+xd.GetName(), append(path, internal.MessageExtensionsTag, int32(i)))
+	}
+	for i, rng := range md.GetExtensionRange() {
+		fn(fmt.Sprintf("extensions:%s:%d", name, rng.GetStart()), append(path, internal.MessageExtensionRangeTag, int32(i)))
+	}
+	for i, rng := range md.GetReservedRange() {
+		fn(fmt.Sprintf("reserved:%s:%d", name, rng.GetStart()), append(path, internal.MessageReservedRangeTag, int32(i)))
+	}
+	for i, n := range md.GetReservedName() {
+		fn(fmt.Sprintf("reserved:%s:%q", name, n), append(path, internal.MessageReservedNameTag, int32(i)))
+	}
+}
+
+func walkEnumPaths(ed *descriptorpb.EnumDescriptorProto, prefix string, path []int32, fn func(key string, path []int32)) {
+	name := prefix + ed.GetName()
+	fn("enum:"+name, path)
+	for i, evd := range ed.GetValue() {
+		fn("value:"+name+"."+evd.GetName(), append(path, internal.EnumValuesTag, int32(i)))
+	}
+	for i, rng := range ed.GetReservedRange() {
+		fn(fmt.Sprintf("reserved:%s:%d", name, rng.GetStart()), append(path, internal.EnumReservedRangeTag, int32(i)))
+	}
+	for i, n := range ed.GetReservedName() {
+		fn(fmt.Sprintf("reserved:%s:%q", name, n), append(path, internal.EnumReservedNameTag, int32(i)))
+	}
+}
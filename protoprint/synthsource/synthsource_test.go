@@ -0,0 +1,91 @@
+package synthsource_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	_ "github.com/jhump/protoreflect/v2/internal/testprotos"
+	"github.com/jhump/protoreflect/v2/protoprint"
+	. "github.com/jhump/protoreflect/v2/protoprint/synthsource"
+)
+
+func TestSynthesize(t *testing.T) {
+	// the global registry has no source info
+	fd, err := protoregistry.GlobalFiles.FindFileByPath("desc_test_complex.proto")
+	require.NoError(t, err)
+	require.Zero(t, fd.SourceLocations().Len())
+
+	for _, pr := range []*protoprint.Printer{nil, {SortElements: true, Compact: true}} {
+		var buf bytes.Buffer
+		result, err := Synthesize(pr, fd, &buf)
+		require.NoError(t, err)
+		if pr == nil {
+			pr = &protoprint.Printer{}
+		}
+		expected, err := pr.PrintProtoToString(fd)
+		require.NoError(t, err)
+		require.Equal(t, expected, buf.String())
+
+		// same elements, in same order; only source info differs
+		resultProto := protodesc.ToFileDescriptorProto(result)
+		require.NotEmpty(t, resultProto.SourceCodeInfo.GetLocation())
+		resultProto.SourceCodeInfo = nil
+		require.True(t, proto.Equal(protodesc.ToFileDescriptorProto(fd), resultProto))
+
+		// locations refer to the printed source
+		lines := strings.Split(buf.String(), "\n")
+		checkSynthesizedLocations(t, result, lines)
+	}
+}
+
+func checkSynthesizedLocations(t *testing.T, d interface {
+	protoreflect.Descriptor
+	Messages() protoreflect.MessageDescriptors
+	Enums() protoreflect.EnumDescriptors
+	Extensions() protoreflect.ExtensionDescriptors
+}, lines []string) {
+	checkLoc := func(d protoreflect.Descriptor) {
+		loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+		require.NotNil(t, loc.Path, "no location for %s", d.FullName())
+		name := d.Name()
+		if fld, ok := d.(protoreflect.FieldDescriptor); ok && fld.Kind() == protoreflect.GroupKind {
+			// group fields are declared using the name of the group's message
+			name = fld.Message().Name()
+		}
+		line := lines[loc.StartLine]
+		require.Contains(t, line[loc.StartColumn:], string(name), "wrong location for %s", d.FullName())
+	}
+	msgs := d.Messages()
+	for i, length := 0, msgs.Len(); i < length; i++ {
+		md := msgs.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		checkLoc(md)
+		fields := md.Fields()
+		for j, length := 0, fields.Len(); j < length; j++ {
+			checkLoc(fields.Get(j))
+		}
+		checkSynthesizedLocations(t, md, lines)
+	}
+	enums := d.Enums()
+	for i, length := 0, enums.Len(); i < length; i++ {
+		ed := enums.Get(i)
+		checkLoc(ed)
+		vals := ed.Values()
+		for j, length := 0, vals.Len(); j < length; j++ {
+			checkLoc(vals.Get(j))
+		}
+	}
+	exts := d.Extensions()
+	for i, length := 0, exts.Len(); i < length; i++ {
+		checkLoc(exts.Get(i))
+	}
+}
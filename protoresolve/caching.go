@@ -0,0 +1,338 @@
+package protoresolve
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// defaultNotFoundTTL is how long not-found results are cached by default.
+const defaultNotFoundTTL = time.Minute
+
+// NewCachingResolver returns a TypeResolver that consults the given resolvers,
+// in order, and caches the results. This is the same as
+// CachingOptions{}.NewResolver(primary, fallbacks...).
+func NewCachingResolver(primary TypeResolver, fallbacks ...TypeResolver) *CachingResolver {
+	return CachingOptions{}.NewResolver(primary, fallbacks...)
+}
+
+// CachingOptions configures how a CachingResolver caches results.
+type CachingOptions struct {
+	// How long successful results are cached. If zero or negative, they are
+	// cached indefinitely.
+	TTL time.Duration
+	// How long not-found results are cached. If zero, a default of one minute
+	// is used. If negative, not-found results are not cached.
+	NotFoundTTL time.Duration
+	// The maximum number of results to cache. When the cache is full, the least
+	// recently used result is evicted to make room for a new one. If zero or
+	// negative, the number of results is not limited.
+	//
+	// Processes that resolve a very large number of distinct names, such as
+	// multi-tenant services that load many dynamic schemas, should set this
+	// or MaxBytes to bound the memory used by the cache.
+	MaxEntries int
+	// The maximum total size, in bytes, of cached results. When the cache
+	// exceeds this size, the least recently used results are evicted until
+	// it no longer does. If zero or negative, the size is not limited. This
+	// may be used together with MaxEntries, in which case both limits apply.
+	//
+	// The size of a result is an estimate: it is the size of the name or URL
+	// that was queried plus the size of the result's descriptor in the binary
+	// format (as a DescriptorProto, EnumDescriptorProto, or
+	// FieldDescriptorProto). This does not include the rest of the file that
+	// contains the descriptor, since a file is typically shared by many
+	// results. So the actual memory used may be larger than this limit.
+	MaxBytes int64
+}
+
+// NewResolver returns a TypeResolver that consults the given resolvers and
+// caches the results according to these options. The primary resolver is
+// checked first. When that returns a protoregistry.NotFound error, the next
+// resolver is checked, and so on, like Combine.
+//
+// Both successful and not-found results are cached. This is useful when a
+// resolver is expensive to query, such as one that must contact a remote
+// server, and the same names are resolved repeatedly, which commonly happens
+// when unmarshalling messages that contain many google.protobuf.Any messages
+// or extensions. Other errors are not cached.
+func (o CachingOptions) NewResolver(primary TypeResolver, fallbacks ...TypeResolver) *CachingResolver {
+	resolvers := make([]TypeResolver, 0, len(fallbacks)+1)
+	resolvers = append(resolvers, primary)
+	resolvers = append(resolvers, fallbacks...)
+	notFoundTTL := o.NotFoundTTL
+	if notFoundTTL == 0 {
+		notFoundTTL = defaultNotFoundTTL
+	}
+	return &CachingResolver{
+		resolvers:   resolvers,
+		ttl:         o.TTL,
+		notFoundTTL: notFoundTTL,
+		maxEntries:  o.MaxEntries,
+		maxBytes:    o.MaxBytes,
+		cache:       map[cacheKey]*list.Element{},
+	}
+}
+
+// CachingResolver is a TypeResolver that caches the results of other resolvers.
+// It is safe for concurrent use. Use NewCachingResolver or CachingOptions to
+// create one.
+type CachingResolver struct {
+	resolvers   []TypeResolver
+	ttl         time.Duration
+	notFoundTTL time.Duration
+	maxEntries  int
+	maxBytes    int64
+
+	mu    sync.Mutex
+	cache map[cacheKey]*list.Element
+	// most recently used entries are at the front
+	lru   list.List
+	bytes int64
+	stats CachingStats
+}
+
+// CachingStats is a snapshot of the state of a CachingResolver's cache.
+type CachingStats struct {
+	// The number of results currently in the cache, including not-found
+	// results.
+	Entries int
+	// The estimated size, in bytes, of the results currently in the cache.
+	// See CachingOptions.MaxBytes for how sizes are estimated. Sizes are
+	// only estimated when CachingOptions.MaxBytes is set, so this is always
+	// zero if it is not.
+	Bytes int64
+	// The number of queries that were answered from the cache.
+	Hits int64
+	// The number of queries that had to consult the underlying resolvers.
+	Misses int64
+	// The number of results that were removed from the cache to make room
+	// for others, due to CachingOptions.MaxEntries or CachingOptions.MaxBytes.
+	Evictions int64
+}
+
+var _ TypeResolver = (*CachingResolver)(nil)
+
+type cacheKind int
+
+const (
+	cacheKindMessageByName = cacheKind(iota)
+	cacheKindMessageByURL
+	cacheKindEnumByName
+	cacheKindExtensionByName
+	cacheKindExtensionByNumber
+)
+
+type cacheKey struct {
+	kind   cacheKind
+	name   string
+	number protoreflect.FieldNumber
+}
+
+type cacheEntry struct {
+	key cacheKey
+	// nil if not found
+	val     any
+	expires time.Time
+	size    int64
+}
+
+// estimateSize returns the size of the given entry, as described in the docs
+// for CachingOptions.MaxBytes.
+func estimateSize(key cacheKey, val any) int64 {
+	size := int64(len(key.name))
+	var d proto.Message
+	switch val := val.(type) {
+	case protoreflect.MessageType:
+		d = protodesc.ToDescriptorProto(val.Descriptor())
+	case protoreflect.EnumType:
+		d = protodesc.ToEnumDescriptorProto(val.Descriptor())
+	case protoreflect.ExtensionType:
+		d = protodesc.ToFieldDescriptorProto(val.TypeDescriptor())
+	}
+	if d != nil {
+		size += int64(proto.Size(d))
+	}
+	return size
+}
+
+// FindMessageByName implements the MessageTypeResolver interface.
+func (c *CachingResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	return find(c, cacheKey{kind: cacheKindMessageByName, name: string(name)}, func(res TypeResolver) (protoreflect.MessageType, error) {
+		return res.FindMessageByName(name)
+	})
+}
+
+// FindMessageByURL implements the MessageTypeResolver interface.
+func (c *CachingResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	return find(c, cacheKey{kind: cacheKindMessageByURL, name: url}, func(res TypeResolver) (protoreflect.MessageType, error) {
+		return res.FindMessageByURL(url)
+	})
+}
+
+// FindEnumByName implements the EnumTypeResolver interface.
+func (c *CachingResolver) FindEnumByName(name protoreflect.FullName) (protoreflect.EnumType, error) {
+	return find(c, cacheKey{kind: cacheKindEnumByName, name: string(name)}, func(res TypeResolver) (protoreflect.EnumType, error) {
+		return res.FindEnumByName(name)
+	})
+}
+
+// FindExtensionByName implements the ExtensionTypeResolver interface.
+func (c *CachingResolver) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return find(c, cacheKey{kind: cacheKindExtensionByName, name: string(name)}, func(res TypeResolver) (protoreflect.ExtensionType, error) {
+		return res.FindExtensionByName(name)
+	})
+}
+
+// FindExtensionByNumber implements the ExtensionTypeResolver interface.
+func (c *CachingResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return find(c, cacheKey{kind: cacheKindExtensionByNumber, name: string(message), number: field}, func(res TypeResolver) (protoreflect.ExtensionType, error) {
+		return res.FindExtensionByNumber(message, field)
+	})
+}
+
+// Clear removes all entries from the cache, so subsequent queries will consult
+// the underlying resolvers again.
+func (c *CachingResolver) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache = map[cacheKey]*list.Element{}
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// ClearNotFound removes all not-found entries from the cache. This can be used
+// when types are known to have been added to the underlying resolvers.
+func (c *CachingResolver) ClearNotFound() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, elem := range c.cache {
+		if elem.Value.(*cacheEntry).val == nil {
+			c.removeLocked(elem)
+		}
+	}
+}
+
+// Snapshot returns a new CachingResolver that uses the same resolvers and
+// options as c and whose cache starts out as a copy of c's cache. Changes to
+// either cache after that, including clearing it, are not visible in the
+// other. This can be used to capture the cache's contents before calling
+// Clear, or to give a new tenant a cache that is already warm. The new
+// resolver's stats only include the number and size of the entries.
+func (c *CachingResolver) Snapshot() *CachingResolver {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := &CachingResolver{
+		resolvers:   c.resolvers,
+		ttl:         c.ttl,
+		notFoundTTL: c.notFoundTTL,
+		maxEntries:  c.maxEntries,
+		maxBytes:    c.maxBytes,
+		cache:       make(map[cacheKey]*list.Element, len(c.cache)),
+		bytes:       c.bytes,
+	}
+	// entries are immutable, so they can be shared
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*cacheEntry)
+		snapshot.cache[entry.key] = snapshot.lru.PushBack(entry)
+	}
+	return snapshot
+}
+
+// Stats returns a snapshot of the cache's size and effectiveness.
+func (c *CachingResolver) Stats() CachingStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.cache)
+	stats.Bytes = c.bytes
+	return stats
+}
+
+func find[T any](c *CachingResolver, key cacheKey, query func(TypeResolver) (T, error)) (T, error) {
+	var zero T
+	now := time.Now()
+	c.mu.Lock()
+	var entry *cacheEntry
+	elem, ok := c.cache[key]
+	if ok {
+		entry = elem.Value.(*cacheEntry)
+		if !entry.expires.IsZero() && !now.Before(entry.expires) {
+			c.removeLocked(elem)
+			ok = false
+		} else {
+			c.lru.MoveToFront(elem)
+		}
+	}
+	if ok {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	c.mu.Unlock()
+	if ok {
+		if entry.val == nil {
+			return zero, protoregistry.NotFound
+		}
+		return entry.val.(T), nil
+	}
+
+	for _, res := range c.resolvers {
+		result, err := query(res)
+		if errors.Is(err, protoregistry.NotFound) {
+			continue
+		}
+		if err != nil {
+			return zero, err
+		}
+		c.store(key, result, c.ttl, now)
+		return result, nil
+	}
+	if c.notFoundTTL > 0 {
+		c.store(key, nil, c.notFoundTTL, now)
+	}
+	return zero, protoregistry.NotFound
+}
+
+func (c *CachingResolver) store(key cacheKey, val any, ttl time.Duration, now time.Time) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = now.Add(ttl)
+	}
+	var size int64
+	if c.maxBytes > 0 {
+		// Estimating the size requires serializing the descriptor, so
+		// it is skipped when there is no byte limit.
+		size = estimateSize(key, val)
+	}
+	entry := &cacheEntry{key: key, val: val, expires: expires, size: size}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.cache[key]; ok {
+		// another goroutine stored this key concurrently
+		c.bytes += size - elem.Value.(*cacheEntry).size
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+	} else {
+		c.cache[key] = c.lru.PushFront(entry)
+		c.bytes += size
+	}
+	for len(c.cache) > 0 &&
+		((c.maxEntries > 0 && len(c.cache) > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.removeLocked(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *CachingResolver) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.cache, entry.key)
+	c.bytes -= entry.size
+}
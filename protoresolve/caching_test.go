@@ -0,0 +1,262 @@
+package protoresolve_test
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+type countingResolver struct {
+	protoresolve.TypeResolver
+	count atomic.Int32
+	err   error
+}
+
+func (r *countingResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	r.count.Add(1)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.TypeResolver.FindMessageByName(name)
+}
+
+func (r *countingResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	r.count.Add(1)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.TypeResolver.FindMessageByURL(url)
+}
+
+func (r *countingResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	r.count.Add(1)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.TypeResolver.FindExtensionByNumber(message, field)
+}
+
+func TestCachingResolver(t *testing.T) {
+	var primaryTypes, fallbackTypes protoregistry.Types
+	require.NoError(t, protoresolve.RegisterTypesInFile(testprotos.File_desc_test1_proto, &primaryTypes, protoresolve.TypeKindsAll))
+	require.NoError(t, protoresolve.RegisterTypesInFile(testprotos.File_desc_test_proto3_proto, &fallbackTypes, protoresolve.TypeKindsAll))
+	primary := &countingResolver{TypeResolver: &primaryTypes}
+	fallback := &countingResolver{TypeResolver: &fallbackTypes}
+	res := protoresolve.NewCachingResolver(primary, fallback)
+
+	for i := 0; i < 3; i++ {
+		mt, err := res.FindMessageByName("testprotos.TestMessage")
+		require.NoError(t, err)
+		require.Equal(t, protoreflect.FullName("testprotos.TestMessage"), mt.Descriptor().FullName())
+	}
+	require.Equal(t, int32(1), primary.count.Load())
+	require.Equal(t, int32(0), fallback.count.Load())
+
+	// found in fallback
+	for i := 0; i < 3; i++ {
+		mt, err := res.FindMessageByURL("type.googleapis.com/testprotos.TestRequest")
+		require.NoError(t, err)
+		require.Equal(t, protoreflect.FullName("testprotos.TestRequest"), mt.Descriptor().FullName())
+	}
+	require.Equal(t, int32(2), primary.count.Load())
+	require.Equal(t, int32(1), fallback.count.Load())
+
+	// not found results are cached, too
+	for i := 0; i < 3; i++ {
+		_, err := res.FindExtensionByNumber("testprotos.AnotherTestMessage", 999)
+		require.ErrorIs(t, err, protoregistry.NotFound)
+	}
+	require.Equal(t, int32(3), primary.count.Load())
+	require.Equal(t, int32(2), fallback.count.Load())
+
+	res.ClearNotFound()
+	_, err := res.FindExtensionByNumber("testprotos.AnotherTestMessage", 999)
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	_, err = res.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, int32(4), primary.count.Load())
+	require.Equal(t, int32(3), fallback.count.Load())
+
+	res.Clear()
+	_, err = res.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, int32(5), primary.count.Load())
+}
+
+func TestCachingResolver_TTL(t *testing.T) {
+	var types protoregistry.Types
+	require.NoError(t, protoresolve.RegisterTypesInFile(testprotos.File_desc_test1_proto, &types, protoresolve.TypeKindsAll))
+	primary := &countingResolver{TypeResolver: &types}
+	res := protoresolve.CachingOptions{TTL: 50 * time.Millisecond, NotFoundTTL: -1}.NewResolver(primary)
+
+	_, err := res.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	_, err = res.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), primary.count.Load())
+	time.Sleep(60 * time.Millisecond)
+	_, err = res.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), primary.count.Load())
+
+	// negative TTL means not-found results are not cached
+	_, err = res.FindMessageByName("foo.Bar")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	_, err = res.FindMessageByName("foo.Bar")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	require.Equal(t, int32(4), primary.count.Load())
+
+	// other errors are returned immediately and not cached
+	primary.err = errors.New("boom")
+	fallback := &countingResolver{TypeResolver: &types}
+	res = protoresolve.NewCachingResolver(primary, fallback)
+	_, err = res.FindMessageByName("testprotos.TestMessage")
+	require.EqualError(t, err, "boom")
+	_, err = res.FindMessageByName("testprotos.TestMessage")
+	require.EqualError(t, err, "boom")
+	require.Equal(t, int32(6), primary.count.Load())
+	require.Equal(t, int32(0), fallback.count.Load())
+}
+
+func TestCachingResolver_MaxEntries(t *testing.T) {
+	var types protoregistry.Types
+	require.NoError(t, protoresolve.RegisterTypesInFile(testprotos.File_desc_test1_proto, &types, protoresolve.TypeKindsAll))
+	primary := &countingResolver{TypeResolver: &types}
+	res := protoresolve.CachingOptions{MaxEntries: 2}.NewResolver(primary)
+
+	names := []protoreflect.FullName{"testprotos.TestMessage", "testprotos.AnotherTestMessage", "testprotos.TestMessage.NestedMessage"}
+	for _, name := range names[:2] {
+		_, err := res.FindMessageByName(name)
+		require.NoError(t, err)
+	}
+	// use the first again, so the second is least recently used
+	_, err := res.FindMessageByName(names[0])
+	require.NoError(t, err)
+	require.Equal(t, int32(2), primary.count.Load())
+	require.Equal(t, protoresolve.CachingStats{Entries: 2, Hits: 1, Misses: 2}, statsWithoutBytes(res))
+
+	// adding a third evicts the second
+	_, err = res.FindMessageByName(names[2])
+	require.NoError(t, err)
+	require.Equal(t, protoresolve.CachingStats{Entries: 2, Hits: 1, Misses: 3, Evictions: 1}, statsWithoutBytes(res))
+	_, err = res.FindMessageByName(names[0])
+	require.NoError(t, err)
+	require.Equal(t, int32(3), primary.count.Load())
+	_, err = res.FindMessageByName(names[1])
+	require.NoError(t, err)
+	require.Equal(t, int32(4), primary.count.Load())
+	require.Equal(t, protoresolve.CachingStats{Entries: 2, Hits: 2, Misses: 4, Evictions: 2}, statsWithoutBytes(res))
+
+	res.Clear()
+	require.Equal(t, 0, res.Stats().Entries)
+}
+
+func TestCachingResolver_MaxBytes(t *testing.T) {
+	var types protoregistry.Types
+	require.NoError(t, protoresolve.RegisterTypesInFile(testprotos.File_desc_test1_proto, &types, protoresolve.TypeKindsAll))
+	primary := &countingResolver{TypeResolver: &types}
+	names := []protoreflect.FullName{"testprotos.TestMessage.NestedMessage", "testprotos.AnotherTestMessage", "testprotos.TestMessage"}
+
+	// sizes are not computed without a limit
+	res := protoresolve.NewCachingResolver(primary)
+	_, err := res.FindMessageByName(names[0])
+	require.NoError(t, err)
+	require.Zero(t, res.Stats().Bytes)
+
+	// find out how big each result is
+	sizes := make([]int64, len(names))
+	res = protoresolve.CachingOptions{MaxBytes: math.MaxInt64}.NewResolver(primary)
+	var total int64
+	for i, name := range names {
+		_, err := res.FindMessageByName(name)
+		require.NoError(t, err)
+		sizes[i] = res.Stats().Bytes - total
+		require.Greater(t, sizes[i], int64(len(name)))
+		total += sizes[i]
+	}
+	res.Clear()
+	require.Zero(t, res.Stats().Bytes)
+
+	// room for the first two, but not all three
+	res = protoresolve.CachingOptions{MaxBytes: sizes[0] + sizes[1]}.NewResolver(primary)
+	primary.count.Store(0)
+	for _, name := range names[:2] {
+		_, err := res.FindMessageByName(name)
+		require.NoError(t, err)
+	}
+	require.Equal(t, protoresolve.CachingStats{Entries: 2, Bytes: sizes[0] + sizes[1], Misses: 2}, res.Stats())
+	// adding the third evicts as many of the least recently used as needed
+	_, err = res.FindMessageByName(names[2])
+	require.NoError(t, err)
+	stats := res.Stats()
+	require.LessOrEqual(t, stats.Bytes, sizes[0]+sizes[1])
+	require.Equal(t, int64(3), stats.Misses)
+	require.Less(t, stats.Entries, 3)
+	require.Equal(t, int64(3-stats.Entries), stats.Evictions)
+	// the least recently used was evicted, so it must be queried again
+	_, err = res.FindMessageByName(names[0])
+	require.NoError(t, err)
+	require.Equal(t, int32(4), primary.count.Load())
+
+	// a result that is bigger than the limit by itself is not kept
+	res = protoresolve.CachingOptions{MaxBytes: 1}.NewResolver(primary)
+	_, err = res.FindMessageByName(names[0])
+	require.NoError(t, err)
+	require.Equal(t, protoresolve.CachingStats{Misses: 1, Evictions: 1}, res.Stats())
+}
+
+func TestCachingResolver_Snapshot(t *testing.T) {
+	var types protoregistry.Types
+	require.NoError(t, protoresolve.RegisterTypesInFile(testprotos.File_desc_test1_proto, &types, protoresolve.TypeKindsAll))
+	primary := &countingResolver{TypeResolver: &types}
+	res := protoresolve.CachingOptions{MaxEntries: 2}.NewResolver(primary)
+
+	_, err := res.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	_, err = res.FindMessageByName("foo.Bar")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	stats := res.Stats()
+
+	snapshot := res.Snapshot()
+	require.Equal(t, protoresolve.CachingStats{Entries: 2, Bytes: stats.Bytes}, snapshot.Stats())
+	res.Clear()
+
+	// snapshot still has both results
+	mt, err := snapshot.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("testprotos.TestMessage"), mt.Descriptor().FullName())
+	_, err = snapshot.FindMessageByName("foo.Bar")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	require.Equal(t, int32(2), primary.count.Load())
+	require.Equal(t, protoresolve.CachingStats{Entries: 2, Bytes: stats.Bytes, Hits: 2}, snapshot.Stats())
+
+	// and uses the same options, so adding another evicts the least recently used
+	_, err = snapshot.FindMessageByName("testprotos.AnotherTestMessage")
+	require.NoError(t, err)
+	require.Equal(t, int32(3), primary.count.Load())
+	require.Equal(t, 2, snapshot.Stats().Entries)
+	_, err = snapshot.FindMessageByName("foo.Bar")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	require.Equal(t, int32(3), primary.count.Load())
+	_, err = snapshot.FindMessageByName("testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, int32(4), primary.count.Load())
+
+	// the original is unaffected
+	require.Equal(t, 0, res.Stats().Entries)
+}
+
+func statsWithoutBytes(res *protoresolve.CachingResolver) protoresolve.CachingStats {
+	stats := res.Stats()
+	stats.Bytes = 0
+	return stats
+}
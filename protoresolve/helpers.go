@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
@@ -195,12 +196,30 @@ func findSymbolInMessage(symbolParts []string, md protoreflect.MessageDescriptor
 
 // ExtensionType returns a [protoreflect.ExtensionType] for the given descriptor.
 // If the given descriptor implements [protoreflect.ExtensionTypeDescriptor], then
-// the corresponding type is returned. Otherwise, a dynamic extension type is
-// returned (created using "google.golang.org/protobuf/types/dynamicpb").
+// the corresponding type is returned. If the given descriptor is that of a
+// generated extension that is linked into the current program, the generated
+// type is returned. Otherwise, a dynamic extension type is returned (created
+// using "google.golang.org/protobuf/types/dynamicpb").
+//
+// Returning the generated type means that values of linked-in extensions can be
+// accessed using the generated extension variables. The runtime relies on this,
+// too: it expects the value of a generated message-typed extension to be of the
+// generated Go type, so a dynamic type can cause panics. For example, the
+// protodesc package panics when resolving Go features in a file if the
+// extension type for the "pb.go" feature extension is dynamic.
+//
+// The other functions in this package that create extension types from
+// descriptors all use this function.
 func ExtensionType(ext protoreflect.ExtensionDescriptor) protoreflect.ExtensionType {
 	if xtd, ok := ext.(protoreflect.ExtensionTypeDescriptor); ok {
 		return xtd.Type()
 	}
+	// Using a dynamic type for a generated extension can result in panics
+	// when the generated type is used to access the value.
+	if xt, err := protoregistry.GlobalTypes.FindExtensionByName(ext.FullName()); err == nil &&
+		xt.TypeDescriptor().Descriptor() == ext {
+		return xt
+	}
 	return dynamicpb.NewExtensionType(ext)
 }
 
@@ -271,9 +290,8 @@ func (k TypeKind) String() string {
 // in an error if any of the types in the given file are already registered as belonging
 // to a different file.
 //
-// All types will be dynamic types, created with the "google.golang.org/protobuf/types/dynamicpb"
-// package. The only exception is for extension descriptors that also implement
-// [protoreflect.ExtensionTypeDescriptor], in which case the corresponding extension type is used.
+// Message and enum types will be dynamic types, created with the "google.golang.org/protobuf/types/dynamicpb"
+// package. Extension types are computed using [ExtensionType].
 func RegisterTypesInFile(file protoreflect.FileDescriptor, reg TypeRegistry, kindMask TypeKind) error {
 	return registerTypes(file, reg, kindMask)
 }
@@ -283,9 +301,8 @@ func RegisterTypesInFile(file protoreflect.FileDescriptor, reg TypeRegistry, kin
 // its imports, and their imports, etc.). This will result in an error if any of the types in
 // the given file (and its dependencies) are already registered as belonging to a different file.
 //
-// All types will be dynamic types, created with the "google.golang.org/protobuf/types/dynamicpb"
-// package. The only exception is for extension descriptors that also implement
-// [protoreflect.ExtensionTypeDescriptor], in which case the corresponding extension type is used.
+// Message and enum types will be dynamic types, created with the "google.golang.org/protobuf/types/dynamicpb"
+// package. Extension types are computed using [ExtensionType].
 func RegisterTypesInFileRecursive(file protoreflect.FileDescriptor, reg TypeRegistry, kindMask TypeKind) error {
 	pathsSeen := map[string]struct{}{}
 	return registerTypesInFileRecursive(file, reg, kindMask, pathsSeen)
@@ -305,9 +322,8 @@ func RegisterTypesInFileRecursive(file protoreflect.FileDescriptor, reg TypeRegi
 // However, the actual implementation is a little more efficient for cases where some files
 // are imported by many other files.
 //
-// All types will be dynamic types, created with the "google.golang.org/protobuf/types/dynamicpb"
-// package. The only exception is for extension descriptors that also implement
-// [protoreflect.ExtensionTypeDescriptor], in which case the corresponding extension type is used.
+// Message and enum types will be dynamic types, created with the "google.golang.org/protobuf/types/dynamicpb"
+// package. Extension types are computed using [ExtensionType].
 func RegisterTypesInFilesRecursive(files FilePool, reg TypeRegistry, kindMask TypeKind) error {
 	pathsSeen := map[string]struct{}{}
 	var err error
@@ -318,6 +334,28 @@ func RegisterTypesInFilesRecursive(files FilePool, reg TypeRegistry, kindMask Ty
 	return err
 }
 
+// ExtensionsFromFiles returns a registry of all the extensions defined in the given
+// files and in their transitive dependencies, including extensions that are defined
+// inside of messages. This will result in an error if the files define conflicting
+// extensions, such as two extensions of the same message with the same field number.
+//
+// This is useful for interpreting unrecognized fields, such as when debugging messages
+// that were unmarshaled without knowledge of the extensions they contain. The returned
+// registry can be supplied to the ReparseUnrecognized or FindUnknownExtensions
+// functions in the protomessage package.
+//
+// The extension types in the returned registry are computed using [ExtensionType].
+func ExtensionsFromFiles(files ...protoreflect.FileDescriptor) (*protoregistry.Types, error) {
+	var reg protoregistry.Types
+	pathsSeen := map[string]struct{}{}
+	for _, file := range files {
+		if err := registerTypesInFileRecursive(file, &reg, TypeKindExtension, pathsSeen); err != nil {
+			return nil, err
+		}
+	}
+	return &reg, nil
+}
+
 func registerTypesInFileRecursive(file protoreflect.FileDescriptor, reg TypeRegistry, kindMask TypeKind, pathsSeen map[string]struct{}) error {
 	if _, ok := pathsSeen[file.Path()]; ok {
 		// already processed
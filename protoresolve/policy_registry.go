@@ -0,0 +1,372 @@
+package protoresolve
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ConflictPolicy determines what a PolicyRegistry does when asked to register
+// a file whose path is already registered.
+type ConflictPolicy int
+
+const (
+	// ConflictError causes an error to be returned, even if the two files are
+	// identical. This matches the behavior of Registry and protoregistry.Files.
+	ConflictError ConflictPolicy = iota
+	// ConflictSkipIfIdentical causes the new file to be ignored if it is
+	// identical to the one already registered. If the files differ, an error
+	// is returned.
+	ConflictSkipIfIdentical
+	// ConflictReplace causes the new file to replace the one already registered,
+	// unless the two files are identical, in which case the new file is ignored.
+	// A file cannot be replaced if it is imported by other registered files,
+	// including files registered in a namespace (see PolicyRegistry.Namespace).
+	ConflictReplace
+)
+
+// PolicyRegistry is a thread-safe registry, like Registry, that uses a
+// ConflictPolicy to decide what to do when a file with the same path is
+// registered more than once. This is useful when descriptors come from multiple
+// sources that may overlap, such as several descriptor sets that each include
+// common dependencies. With Registry and protoregistry.Files, such overlap
+// causes "file already registered" errors.
+//
+// Two files are considered identical if their descriptor protos, excluding
+// source code info, have the same binary encoding. Source code info is ignored
+// since the same file compiled by different tools (or with different options)
+// may include different source code info.
+//
+// The policy only applies to files with the same path. If a file defines an
+// element whose name is already defined in a file with a different path, an
+// error is always returned. To allow sources to define conflicting elements,
+// register the files from each source in a separate namespace. (See
+// PolicyRegistry.Namespace.)
+type PolicyRegistry struct {
+	policy ConflictPolicy
+	parent *PolicyRegistry
+	name   string
+
+	mu         sync.RWMutex
+	reg        *Registry
+	namespaces map[string]*PolicyRegistry
+	// nsImports records the imports of files in namespaces, keyed by the path
+	// of the imported file. The values are the number of importing files,
+	// keyed by a description of the importer.
+	nsImports map[string]map[string]int
+}
+
+var _ Resolver = (*PolicyRegistry)(nil)
+var _ DescriptorRegistry = (*PolicyRegistry)(nil)
+
+// NewPolicyRegistry returns a new, empty registry that uses the given policy to
+// handle conflicts.
+func NewPolicyRegistry(policy ConflictPolicy) *PolicyRegistry {
+	return &PolicyRegistry{policy: policy, reg: &Registry{}}
+}
+
+// Namespace returns the registry for the given namespace, creating it if it does
+// not yet exist. The returned registry uses the same conflict policy as r.
+//
+// Files registered in a namespace do not conflict with files in r or in other
+// namespaces, and they are not visible when querying r. But queries on the
+// namespace fall back to r for elements that are not defined in the namespace.
+// So files in a namespace may import files registered in r.
+func (r *PolicyRegistry) Namespace(name string) *PolicyRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ns := r.namespaces[name]
+	if ns == nil {
+		ns = &PolicyRegistry{policy: r.policy, parent: r, name: name, reg: &Registry{}}
+		if r.namespaces == nil {
+			r.namespaces = map[string]*PolicyRegistry{}
+		}
+		r.namespaces[name] = ns
+	}
+	return ns
+}
+
+// RegisterFileProto registers the given file descriptor proto and returns the
+// corresponding [protoreflect.FileDescriptor]. All the file's dependencies must
+// have already been registered. If the file is skipped because it is identical
+// to one already registered, the already registered file is returned.
+//
+// As with [Registry.RegisterFileProto], this will retain the given proto
+// message, so calling code should not attempt to mutate it.
+func (r *PolicyRegistry) RegisterFileProto(fd *descriptorpb.FileDescriptorProto) (protoreflect.FileDescriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The imports are recorded before linking, so an enclosing registry
+	// cannot replace one of them while the file is linked.
+	r.addNamespaceImportsLocked(fd.GetName(), fd.GetDependency(), 1)
+	file, err := newFile(fd, r.resolverLocked())
+	if err != nil {
+		r.addNamespaceImportsLocked(fd.GetName(), fd.GetDependency(), -1)
+		return nil, err
+	}
+	result, err := r.registerLocked(file, fd)
+	if err != nil || result != file {
+		r.addNamespaceImportsLocked(fd.GetName(), fd.GetDependency(), -1)
+	}
+	return result, err
+}
+
+// RegisterFile implements part of the DescriptorRegistry interface.
+func (r *PolicyRegistry) RegisterFile(file protoreflect.FileDescriptor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deps := importPaths(file)
+	r.addNamespaceImportsLocked(file.Path(), deps, 1)
+	result, err := r.registerLocked(file, nil)
+	if err != nil || result != file {
+		r.addNamespaceImportsLocked(file.Path(), deps, -1)
+	}
+	return err
+}
+
+func (r *PolicyRegistry) registerLocked(file protoreflect.FileDescriptor, fd *descriptorpb.FileDescriptorProto) (protoreflect.FileDescriptor, error) {
+	existing, err := r.reg.FindFileByPath(file.Path())
+	if err != nil {
+		return file, r.reg.registerFile(file, fd)
+	}
+	if r.policy == ConflictError {
+		return nil, fmt.Errorf("file %q already registered", file.Path())
+	}
+	if fd == nil {
+		fd = protodesc.ToFileDescriptorProto(file)
+	}
+	existingFd, err := r.reg.ProtoFromFileDescriptor(existing)
+	if err != nil {
+		return nil, err
+	}
+	if sameFileContents(existingFd, fd) {
+		return existing, nil
+	}
+	if r.policy != ConflictReplace {
+		return nil, fmt.Errorf("file %q already registered with different content", file.Path())
+	}
+	if err := r.replaceLocked(existing, file, fd); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// replaceLocked replaces old with file. Since files cannot be removed from a
+// Registry, this creates a new one that has all the other files.
+func (r *PolicyRegistry) replaceLocked(old, file protoreflect.FileDescriptor, fd *descriptorpb.FileDescriptorProto) error {
+	var importedBy string
+	r.reg.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		imports := f.Imports()
+		for i, length := 0, imports.Len(); i < length; i++ {
+			if imports.Get(i).Path() == old.Path() {
+				importedBy = f.Path()
+				return false
+			}
+		}
+		return true
+	})
+	if importedBy != "" {
+		return fmt.Errorf("cannot replace file %q: it is imported by %q", old.Path(), importedBy)
+	}
+	if importers := r.nsImports[old.Path()]; len(importers) > 0 {
+		names := make([]string, 0, len(importers))
+		for importer := range importers {
+			names = append(names, importer)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("cannot replace file %q: it is imported by %s", old.Path(), names[0])
+	}
+
+	reg := &Registry{}
+	var err error
+	r.reg.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		if f == old {
+			return true
+		}
+		r.reg.mu.RLock()
+		fileProto := r.reg.protoLocked(f)
+		r.reg.mu.RUnlock()
+		err = reg.registerFileLocked(f, fileProto)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := reg.registerFileLocked(file, fd); err != nil {
+		return err
+	}
+	// Concurrent queries may still be using the old registry, so it is
+	// swapped rather than modified.
+	r.reg = reg
+	r.addNamespaceImportsLocked(old.Path(), importPaths(old), -1)
+	return nil
+}
+
+// addNamespaceImportsLocked adds delta to the counts of the given imports of
+// the given file in all enclosing registries. It does nothing if r is not a
+// namespace.
+//
+// Namespaces lock their own mutex before those of enclosing registries, never
+// the other way around. So an enclosing registry cannot examine the files in
+// its namespaces and instead relies on these counts.
+func (r *PolicyRegistry) addNamespaceImportsLocked(path string, deps []string, delta int) {
+	if len(deps) == 0 {
+		return
+	}
+	importer := fmt.Sprintf("%q in namespace %q", path, r.name)
+	for p := r.parent; p != nil; p = p.parent {
+		p.mu.Lock()
+		for _, dep := range deps {
+			importers := p.nsImports[dep]
+			if importers == nil {
+				if delta <= 0 {
+					continue
+				}
+				importers = map[string]int{}
+				if p.nsImports == nil {
+					p.nsImports = map[string]map[string]int{}
+				}
+				p.nsImports[dep] = importers
+			}
+			importers[importer] += delta
+			if importers[importer] <= 0 {
+				delete(importers, importer)
+				if len(importers) == 0 {
+					delete(p.nsImports, dep)
+				}
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+func importPaths(file protoreflect.FileDescriptor) []string {
+	imports := file.Imports()
+	paths := make([]string, imports.Len())
+	for i := range paths {
+		paths[i] = imports.Get(i).Path()
+	}
+	return paths
+}
+
+func sameFileContents(a, b *descriptorpb.FileDescriptorProto) bool {
+	if a == b {
+		return true
+	}
+	dataA, errA := marshalWithoutSourceInfo(a)
+	dataB, errB := marshalWithoutSourceInfo(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+func marshalWithoutSourceInfo(fd *descriptorpb.FileDescriptorProto) ([]byte, error) {
+	if fd.SourceCodeInfo != nil {
+		fd = proto.Clone(fd).(*descriptorpb.FileDescriptorProto)
+		fd.SourceCodeInfo = nil
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(fd)
+}
+
+func (r *PolicyRegistry) resolver() Resolver {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolverLocked()
+}
+
+func (r *PolicyRegistry) resolverLocked() Resolver {
+	if r.parent == nil {
+		return r.reg
+	}
+	return Combine(r.reg, r.parent)
+}
+
+// FindFileByPath implements part of the Resolver interface.
+func (r *PolicyRegistry) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	return r.resolver().FindFileByPath(path)
+}
+
+// NumFiles implements part of the FilePool interface. For a namespace, this
+// includes the files in the enclosing registry.
+func (r *PolicyRegistry) NumFiles() int {
+	if r.parent == nil {
+		return r.resolver().NumFiles()
+	}
+	var count int
+	r.RangeFiles(func(protoreflect.FileDescriptor) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// RangeFiles implements part of the FilePool interface. For a namespace, files
+// in the namespace are visited first, followed by files in the enclosing
+// registry whose paths are not also in the namespace.
+func (r *PolicyRegistry) RangeFiles(fn func(protoreflect.FileDescriptor) bool) {
+	r.resolver().RangeFiles(fn)
+}
+
+// NumFilesByPackage implements part of the FilePool interface. For a namespace,
+// this includes the files in the enclosing registry.
+func (r *PolicyRegistry) NumFilesByPackage(name protoreflect.FullName) int {
+	if r.parent == nil {
+		return r.resolver().NumFilesByPackage(name)
+	}
+	var count int
+	r.RangeFilesByPackage(name, func(protoreflect.FileDescriptor) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// RangeFilesByPackage implements part of the FilePool interface.
+func (r *PolicyRegistry) RangeFilesByPackage(name protoreflect.FullName, fn func(protoreflect.FileDescriptor) bool) {
+	r.resolver().RangeFilesByPackage(name, fn)
+}
+
+// FindDescriptorByName implements part of the Resolver interface.
+func (r *PolicyRegistry) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	return r.resolver().FindDescriptorByName(name)
+}
+
+// FindMessageByName implements part of the Resolver interface.
+func (r *PolicyRegistry) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageDescriptor, error) {
+	return r.resolver().FindMessageByName(name)
+}
+
+// FindExtensionByName implements part of the Resolver interface.
+func (r *PolicyRegistry) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionDescriptor, error) {
+	return r.resolver().FindExtensionByName(name)
+}
+
+// FindExtensionByNumber implements part of the Resolver interface.
+func (r *PolicyRegistry) FindExtensionByNumber(message protoreflect.FullName, fieldNumber protoreflect.FieldNumber) (protoreflect.ExtensionDescriptor, error) {
+	return r.resolver().FindExtensionByNumber(message, fieldNumber)
+}
+
+// FindMessageByURL implements part of the Resolver interface.
+func (r *PolicyRegistry) FindMessageByURL(url string) (protoreflect.MessageDescriptor, error) {
+	return r.resolver().FindMessageByURL(url)
+}
+
+// RangeExtensionsByMessage implements part of the Resolver interface.
+func (r *PolicyRegistry) RangeExtensionsByMessage(message protoreflect.FullName, fn func(protoreflect.ExtensionDescriptor) bool) {
+	r.resolver().RangeExtensionsByMessage(message, fn)
+}
+
+// AsTypeResolver implements part of the Resolver interface.
+func (r *PolicyRegistry) AsTypeResolver() TypeResolver {
+	return r.AsTypePool()
+}
+
+// AsTypePool returns a view of this registry as a TypePool. This offers more methods
+// than AsTypeResolver, providing the ability to enumerate types.
+func (r *PolicyRegistry) AsTypePool() TypePool {
+	return TypesFromDescriptorPool(r)
+}
@@ -0,0 +1,170 @@
+package protoresolve_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+func TestPolicyRegistry(t *testing.T) {
+	testResolver(t, protoresolve.NewPolicyRegistry(protoresolve.ConflictError))
+}
+
+func TestPolicyRegistry_Conflicts(t *testing.T) {
+	fileV1 := testPolicyFile("foo.proto", "Foo")
+	fileV1Copy := proto.Clone(fileV1).(*descriptorpb.FileDescriptorProto)
+	fileV1Copy.SourceCodeInfo = &descriptorpb.SourceCodeInfo{}
+	fileV2 := testPolicyFile("foo.proto", "Bar")
+
+	t.Run("error", func(t *testing.T) {
+		reg := protoresolve.NewPolicyRegistry(protoresolve.ConflictError)
+		_, err := reg.RegisterFileProto(fileV1)
+		require.NoError(t, err)
+		_, err = reg.RegisterFileProto(fileV1Copy)
+		require.ErrorContains(t, err, `file "foo.proto" already registered`)
+	})
+
+	t.Run("skip if identical", func(t *testing.T) {
+		reg := protoresolve.NewPolicyRegistry(protoresolve.ConflictSkipIfIdentical)
+		file, err := reg.RegisterFileProto(fileV1)
+		require.NoError(t, err)
+		again, err := reg.RegisterFileProto(fileV1Copy)
+		require.NoError(t, err)
+		require.Same(t, file, again)
+		require.Equal(t, 1, reg.NumFiles())
+		_, err = reg.RegisterFileProto(fileV2)
+		require.ErrorContains(t, err, `file "foo.proto" already registered with different content`)
+		_, err = reg.FindMessageByName("test.Foo")
+		require.NoError(t, err)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		reg := protoresolve.NewPolicyRegistry(protoresolve.ConflictReplace)
+		_, err := reg.RegisterFileProto(fileV1)
+		require.NoError(t, err)
+		other, err := reg.RegisterFileProto(testPolicyFile("other.proto", "Other"))
+		require.NoError(t, err)
+		file, err := reg.RegisterFileProto(fileV2)
+		require.NoError(t, err)
+		require.Equal(t, 2, reg.NumFiles())
+		found, err := reg.FindFileByPath("foo.proto")
+		require.NoError(t, err)
+		require.Same(t, file, found)
+		_, err = reg.FindMessageByName("test.Bar")
+		require.NoError(t, err)
+		_, err = reg.FindMessageByName("test.Foo")
+		require.ErrorIs(t, err, protoresolve.ErrNotFound)
+		found, err = reg.FindFileByPath("other.proto")
+		require.NoError(t, err)
+		require.Same(t, other, found)
+
+		// cannot replace a file that other files import
+		importer := testPolicyFile("importer.proto", "Importer")
+		importer.Dependency = []string{"foo.proto"}
+		_, err = reg.RegisterFileProto(importer)
+		require.NoError(t, err)
+		_, err = reg.RegisterFileProto(fileV1)
+		require.ErrorContains(t, err, `cannot replace file "foo.proto": it is imported by "importer.proto"`)
+	})
+
+	t.Run("symbol conflict", func(t *testing.T) {
+		reg := protoresolve.NewPolicyRegistry(protoresolve.ConflictReplace)
+		_, err := reg.RegisterFileProto(fileV1)
+		require.NoError(t, err)
+		_, err = reg.RegisterFileProto(testPolicyFile("bar.proto", "Foo"))
+		require.ErrorContains(t, err, "test.Foo")
+	})
+}
+
+func TestPolicyRegistry_Namespace(t *testing.T) {
+	reg := protoresolve.NewPolicyRegistry(protoresolve.ConflictError)
+	_, err := reg.RegisterFileProto(testPolicyFile("common.proto", "Common"))
+	require.NoError(t, err)
+
+	nsA := reg.Namespace("a")
+	require.Same(t, nsA, reg.Namespace("a"))
+	nsB := reg.Namespace("b")
+
+	fileA := testPolicyFile("foo.proto", "Foo")
+	fileA.Dependency = []string{"common.proto"}
+	_, err = nsA.RegisterFileProto(fileA)
+	require.NoError(t, err)
+	_, err = nsB.RegisterFileProto(testPolicyFile("foo.proto", "Foo"))
+	require.NoError(t, err)
+
+	msgA, err := nsA.FindMessageByName("test.Foo")
+	require.NoError(t, err)
+	msgB, err := nsB.FindMessageByName("test.Foo")
+	require.NoError(t, err)
+	require.NotSame(t, msgA, msgB)
+	_, err = reg.FindMessageByName("test.Foo")
+	require.ErrorIs(t, err, protoresolve.ErrNotFound)
+
+	_, err = nsA.FindMessageByName("test.Common")
+	require.NoError(t, err)
+	require.Equal(t, 1, reg.NumFiles())
+	require.Equal(t, 2, nsA.NumFiles())
+	require.Equal(t, 2, nsA.NumFilesByPackage("test"))
+}
+
+func TestPolicyRegistry_ReplaceImportedByNamespace(t *testing.T) {
+	reg := protoresolve.NewPolicyRegistry(protoresolve.ConflictReplace)
+	_, err := reg.RegisterFileProto(testPolicyFile("common.proto", "Common"))
+	require.NoError(t, err)
+
+	ns := reg.Namespace("a").Namespace("b")
+	importer := testPolicyFile("importer.proto", "Importer")
+	importer.Dependency = []string{"common.proto"}
+	_, err = ns.RegisterFileProto(importer)
+	require.NoError(t, err)
+
+	_, err = reg.RegisterFileProto(testPolicyFile("common.proto", "Other"))
+	require.ErrorContains(t, err, `cannot replace file "common.proto": it is imported by "importer.proto" in namespace "b"`)
+	_, err = reg.FindMessageByName("test.Common")
+	require.NoError(t, err)
+
+	// once the importer is replaced with a version that has no imports,
+	// the file can be replaced
+	_, err = ns.RegisterFileProto(testPolicyFile("importer.proto", "Importer"))
+	require.NoError(t, err)
+	_, err = reg.RegisterFileProto(testPolicyFile("common.proto", "Other"))
+	require.NoError(t, err)
+	_, err = reg.FindMessageByName("test.Other")
+	require.NoError(t, err)
+}
+
+func TestPolicyRegistry_Concurrent(t *testing.T) {
+	reg := protoresolve.NewPolicyRegistry(protoresolve.ConflictSkipIfIdentical)
+	var wg sync.WaitGroup
+	files := make([]protoreflect.FileDescriptor, 10)
+	errs := make([]error, 10)
+	for i := range files {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			files[i], errs[i] = reg.RegisterFileProto(testPolicyFile("foo.proto", "Foo"))
+		}(i)
+	}
+	wg.Wait()
+	for i := range files {
+		require.NoError(t, errs[i])
+		require.Same(t, files[0], files[i])
+	}
+}
+
+func testPolicyFile(path, msgName string) *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(path),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String(msgName)},
+		},
+	}
+}
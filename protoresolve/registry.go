@@ -3,6 +3,7 @@ package protoresolve
 import (
 	"errors"
 	"fmt"
+	"runtime"
 	"sync"
 
 	"google.golang.org/protobuf/reflect/protodesc"
@@ -11,7 +12,6 @@ import (
 	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/jhump/protoreflect/v2/internal/reparse"
-	"github.com/jhump/protoreflect/v2/internal/sort"
 )
 
 // Registry implements the full Resolver interface defined in this package. It is
@@ -24,13 +24,42 @@ import (
 // this to function most efficiently, use [Registry.RegisterFileProto] to convert the
 // descriptor proto into a [protoreflect.FileDescriptor] and then use
 // [Registry.ProtoFromFileDescriptor] to recover the original proto.
+//
+// A registry can be shared as a base for other registries, without copying
+// its contents, using [Registry.Snapshot] and [Registry.Fork].
 type Registry struct {
-	mu     sync.RWMutex
+	mu sync.RWMutex
+	// The layer to which new files are added. It is never shared with
+	// another registry, though its ancestors may be.
+	layer *registryLayer
+	// If true, the registry is a snapshot, and no files may be added.
+	readOnly bool
+}
+
+// registryLayer holds the files added to a registry since it was created or
+// since its last snapshot or fork. Once a layer becomes the parent of another
+// layer, it is shared and must not be modified.
+type registryLayer struct {
+	parent *registryLayer
+	// the number of layers in the chain, including this one
+	depth  int
 	files  protoregistry.Files
 	exts   map[protoreflect.FullName]map[protoreflect.FieldNumber]protoreflect.FieldDescriptor
 	protos map[protoreflect.FileDescriptor]*descriptorpb.FileDescriptorProto
+	// the packages of the files in this layer, and all of their prefixes
+	pkgs map[protoreflect.FullName]struct{}
 }
 
+// maxLayerDepth is the maximum number of layers in a registry's chain, to
+// bound the cost of queries. When a snapshot or fork is created from a
+// registry whose chain is this deep, the registry's layers are first merged
+// into one.
+const maxLayerDepth = 8
+
+// ErrReadOnly is returned when attempting to register a file with a registry
+// that is a snapshot. See [Registry.Snapshot].
+var ErrReadOnly = errors.New("registry is a read-only snapshot")
+
 var _ Resolver = (*Registry)(nil)
 var _ DescriptorRegistry = (*Registry)(nil)
 var _ ProtoFileRegistry = (*Registry)(nil)
@@ -62,7 +91,7 @@ func FromFiles(files *protoregistry.Files) (*Registry, error) {
 	}
 
 	reg := &Registry{
-		files: *files,
+		layer: &registryLayer{depth: 1, files: *files},
 	}
 	// NB: It's okay to call methods below without first acquiring
 	// lock because reg is not visible to any other goroutines yet.
@@ -76,22 +105,20 @@ func FromFiles(files *protoregistry.Files) (*Registry, error) {
 	}
 	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
 		reg.registerExtensionsLocked(fd)
+		reg.layer.addPackage(fd.Package())
 		return true
 	})
 	return reg, nil
 }
 
 // FromFileDescriptorSet constructs a *Registry from the given file descriptor set.
+// The files in the set need not be topologically sorted. Files are loaded in
+// batch, using [Registry.RegisterFileProtos].
 func FromFileDescriptorSet(files *descriptorpb.FileDescriptorSet) (*Registry, error) {
 	var reg Registry
-	if err := sort.SortFiles(files.File); err != nil {
+	if _, err := reg.RegisterFileProtos(files.File); err != nil {
 		return nil, err
 	}
-	for _, file := range files.File {
-		if _, err := reg.RegisterFileProto(file); err != nil {
-			return nil, fmt.Errorf("failed to register %q: %w", file, err)
-		}
-	}
 	return &reg, nil
 }
 
@@ -107,50 +134,194 @@ func FromFileDescriptorSet(files *descriptorpb.FileDescriptorSet) (*Registry, er
 // In general, prefer calling this method instead of calling [protodesc.NewFile]
 // followed by RegisterFile.
 func (r *Registry) RegisterFileProto(fd *descriptorpb.FileDescriptorProto) (protoreflect.FileDescriptor, error) {
-	file, err := protodesc.NewFile(fd, r)
+	file, err := r.newFile(fd)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.registerFileLocked(file, fd); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// RegisterFileProtos registers all the given file descriptor protos and returns
+// the corresponding [protoreflect.FileDescriptor] values, in the same order as
+// the given protos. The given files need not be topologically sorted, but all
+// dependencies must either be present in the given files or have already been
+// registered.
+//
+// This is more efficient than calling [Registry.RegisterFileProto] for each
+// file, especially for large sets of files. Files are grouped into "layers",
+// where the files in each layer depend only on files in prior layers. All the
+// files in a layer are then constructed concurrently.
+//
+// As with RegisterFileProto, this will retain the given proto messages, so
+// calling code should not attempt to mutate them. If an error is returned,
+// some of the given files may have already been registered.
+func (r *Registry) RegisterFileProtos(fds []*descriptorpb.FileDescriptorProto) ([]protoreflect.FileDescriptor, error) {
+	layers, err := computeFileLayers(fds)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]protoreflect.FileDescriptor, len(fds))
+	errs := make([]error, len(fds))
+	workers := runtime.GOMAXPROCS(0)
+	for _, layer := range layers {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, workers)
+		for _, index := range layer {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(index int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				results[index], errs[index] = r.newFile(fds[index])
+			}(index)
+		}
+		wg.Wait()
+		// Now that all files in the layer are constructed, register them
+		// so that subsequent layers can refer to them.
+		if err := func() error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			for _, index := range layer {
+				if errs[index] == nil {
+					errs[index] = r.registerFileLocked(results[index], fds[index])
+				}
+				if errs[index] != nil {
+					return fmt.Errorf("failed to register %q: %w", fds[index].GetName(), errs[index])
+				}
+			}
+			return nil
+		}(); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (r *Registry) newFile(fd *descriptorpb.FileDescriptorProto) (protoreflect.FileDescriptor, error) {
+	return newFile(fd, r)
+}
+
+func newFile(fd *descriptorpb.FileDescriptorProto, res interface {
+	DependencyResolver
+	ExtensionResolver
+}) (protoreflect.FileDescriptor, error) {
+	file, err := protodesc.NewFile(fd, res)
 	if err != nil {
 		return nil, err
 	}
-	if reparse.ReparseUnrecognized(fd.ProtoReflect(), &extResolverForFile{file, r}) {
+	if reparse.ReparseUnrecognized(fd.ProtoReflect(), &extResolverForFile{file, res}) {
 		// We were able to recognize some custom options, so re-create the
 		// file with these newly recognized fields.
-		file, err = protodesc.NewFile(fd, r)
+		file, err = protodesc.NewFile(fd, res)
 		if err != nil {
 			return nil, err
 		}
 	}
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if err := r.registerFileLocked(file, fd); err != nil {
-		return nil, err
-	}
 	return file, nil
 }
 
+// computeFileLayers groups the given files into layers. Files in the first
+// layer only depend on files that are not in fds. Files in all subsequent
+// layers depend only on files in prior layers. The returned layers contain
+// indexes into fds.
+func computeFileLayers(fds []*descriptorpb.FileDescriptorProto) ([][]int, error) {
+	indexes := make(map[string]int, len(fds))
+	for i, fd := range fds {
+		if _, exists := indexes[fd.GetName()]; exists {
+			return nil, fmt.Errorf("duplicate file %q", fd.GetName())
+		}
+		indexes[fd.GetName()] = i
+	}
+	// depths[i] is zero when not yet computed, -1 when in progress,
+	// and otherwise one more than the file's layer.
+	depths := make([]int, len(fds))
+	var computeDepth func(i int, path []string) (int, error)
+	computeDepth = func(i int, path []string) (int, error) {
+		switch depths[i] {
+		case 0:
+		case -1:
+			return 0, fmt.Errorf("import cycle: %v", append(path, fds[i].GetName()))
+		default:
+			return depths[i], nil
+		}
+		depths[i] = -1
+		path = append(path, fds[i].GetName())
+		depth := 1
+		for _, dep := range fds[i].GetDependency() {
+			depIndex, ok := indexes[dep]
+			if !ok {
+				// must already be registered
+				continue
+			}
+			depDepth, err := computeDepth(depIndex, path)
+			if err != nil {
+				return 0, err
+			}
+			if depDepth >= depth {
+				depth = depDepth + 1
+			}
+		}
+		depths[i] = depth
+		return depth, nil
+	}
+	var layers [][]int
+	for i := range fds {
+		depth, err := computeDepth(i, nil)
+		if err != nil {
+			return nil, err
+		}
+		for len(layers) < depth {
+			layers = append(layers, nil)
+		}
+	}
+	for i, depth := range depths {
+		layers[depth-1] = append(layers[depth-1], i)
+	}
+	return layers, nil
+}
+
 // RegisterFile implements part of the Resolver interface.
 func (r *Registry) RegisterFile(file protoreflect.FileDescriptor) error {
+	return r.registerFile(file, nil)
+}
+
+func (r *Registry) registerFile(file protoreflect.FileDescriptor, fd *descriptorpb.FileDescriptorProto) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.registerFileLocked(file, nil)
+	return r.registerFileLocked(file, fd)
 }
 
 func (r *Registry) registerFileLocked(file protoreflect.FileDescriptor, fd *descriptorpb.FileDescriptorProto) error {
+	if r.readOnly {
+		return ErrReadOnly
+	}
+	if r.layer == nil {
+		r.layer = &registryLayer{depth: 1}
+	}
 	if err := r.checkExtensionsLocked(file); err != nil {
-		_, findFileErr := r.files.FindFileByPath(file.Path())
+		_, findFileErr := r.findFileLocked(file.Path())
 		if findFileErr == nil {
 			return fmt.Errorf("file %q already registered", file.Path())
 		}
 		return err
 	}
-	if err := r.files.RegisterFile(file); err != nil {
+	if err := r.layer.checkAncestors(file); err != nil {
+		return err
+	}
+	if err := r.layer.files.RegisterFile(file); err != nil {
 		return err
 	}
+	r.layer.addPackage(file.Package())
 	r.registerExtensionsLocked(file)
 	if fd != nil {
-		if r.protos == nil {
-			r.protos = map[protoreflect.FileDescriptor]*descriptorpb.FileDescriptorProto{}
-		}
-		r.protos[file] = fd
+		r.layer.saveProto(file, fd)
 	}
 	return nil
 }
@@ -159,7 +330,7 @@ func (r *Registry) checkExtensionsLocked(container TypeContainer) error {
 	exts := container.Extensions()
 	for i, length := 0, exts.Len(); i < length; i++ {
 		ext := exts.Get(i)
-		existing := r.exts[ext.ContainingMessage().FullName()][ext.Number()]
+		existing := r.findExtensionLocked(ext.ContainingMessage().FullName(), ext.Number())
 		if existing != nil {
 			if existing.FullName() == ext.FullName() {
 				return fmt.Errorf("extension named %q already registered", ext.FullName())
@@ -181,16 +352,7 @@ func (r *Registry) checkExtensionsLocked(container TypeContainer) error {
 func (r *Registry) registerExtensionsLocked(container TypeContainer) {
 	exts := container.Extensions()
 	for i, length := 0, exts.Len(); i < length; i++ {
-		ext := exts.Get(i)
-		if r.exts == nil {
-			r.exts = map[protoreflect.FullName]map[protoreflect.FieldNumber]protoreflect.FieldDescriptor{}
-		}
-		extsForMsg := r.exts[ext.ContainingMessage().FullName()]
-		if extsForMsg == nil {
-			extsForMsg = map[protoreflect.FieldNumber]protoreflect.FieldDescriptor{}
-			r.exts[ext.ContainingMessage().FullName()] = extsForMsg
-		}
-		extsForMsg[ext.Number()] = ext
+		r.layer.addExtension(exts.Get(i))
 	}
 
 	msgs := container.Messages()
@@ -219,7 +381,7 @@ func (r *Registry) ProtoFromFileDescriptor(file protoreflect.FileDescriptor) (*d
 		file = imp.FileDescriptor
 	}
 	r.mu.RLock()
-	fd := r.protos[file]
+	fd := r.protoLocked(file)
 	r.mu.RUnlock()
 	if fd != nil {
 		return fd, nil
@@ -231,11 +393,11 @@ func (r *Registry) ProtoFromFileDescriptor(file protoreflect.FileDescriptor) (*d
 		defer r.mu.Unlock()
 		// this file already belongs to the registry
 		// so go ahead and save this proto.
-		if r.protos == nil {
-			r.protos = map[protoreflect.FileDescriptor]*descriptorpb.FileDescriptorProto{}
+		if r.layer == nil {
+			r.layer = &registryLayer{depth: 1}
 		}
-		r.protos[file] = fd
-	} else if errors.Is(err, ErrNotFound) {
+		r.layer.saveProto(file, fd)
+	} else if errors.Is(err, ErrNotFound) && !r.readOnly {
 		r.mu.Lock()
 		defer r.mu.Unlock()
 		// best effort attempt to add file (and save proto if successful)
@@ -248,14 +410,22 @@ func (r *Registry) ProtoFromFileDescriptor(file protoreflect.FileDescriptor) (*d
 func (r *Registry) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.files.FindFileByPath(path)
+	return r.findFileLocked(path)
+}
+
+func (r *Registry) findFileLocked(path string) (protoreflect.FileDescriptor, error) {
+	return r.layer.findFile(path)
 }
 
 // NumFiles implements part of the FilePool interface.
 func (r *Registry) NumFiles() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.files.NumFiles()
+	var count int
+	for l := r.layer; l != nil; l = l.parent {
+		count += l.files.NumFiles()
+	}
+	return count
 }
 
 // RangeFiles implements part of the FilePool interface.
@@ -264,13 +434,12 @@ func (r *Registry) RangeFiles(fn func(protoreflect.FileDescriptor) bool) {
 	func() {
 		r.mu.RLock()
 		defer r.mu.RUnlock()
-		files = make([]protoreflect.FileDescriptor, r.files.NumFiles())
-		i := 0
-		r.files.RangeFiles(func(f protoreflect.FileDescriptor) bool {
-			files[i] = f
-			i++
-			return true
-		})
+		for l := r.layer; l != nil; l = l.parent {
+			l.files.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+				files = append(files, f)
+				return true
+			})
+		}
 	}()
 	for _, file := range files {
 		if !fn(file) {
@@ -283,7 +452,11 @@ func (r *Registry) RangeFiles(fn func(protoreflect.FileDescriptor) bool) {
 func (r *Registry) NumFilesByPackage(name protoreflect.FullName) int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.files.NumFilesByPackage(name)
+	var count int
+	for l := r.layer; l != nil; l = l.parent {
+		count += l.files.NumFilesByPackage(name)
+	}
+	return count
 }
 
 // RangeFilesByPackage implements part of the FilePool interface.
@@ -292,13 +465,12 @@ func (r *Registry) RangeFilesByPackage(name protoreflect.FullName, fn func(proto
 	func() {
 		r.mu.RLock()
 		defer r.mu.RUnlock()
-		files = make([]protoreflect.FileDescriptor, r.files.NumFilesByPackage(name))
-		i := 0
-		r.files.RangeFilesByPackage(name, func(f protoreflect.FileDescriptor) bool {
-			files[i] = f
-			i++
-			return true
-		})
+		for l := r.layer; l != nil; l = l.parent {
+			l.files.RangeFilesByPackage(name, func(f protoreflect.FileDescriptor) bool {
+				files = append(files, f)
+				return true
+			})
+		}
 	}()
 	for _, file := range files {
 		if !fn(file) {
@@ -311,7 +483,12 @@ func (r *Registry) RangeFilesByPackage(name protoreflect.FullName, fn func(proto
 func (r *Registry) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.files.FindDescriptorByName(name)
+	for l := r.layer; l != nil; l = l.parent {
+		if d, err := l.files.FindDescriptorByName(name); err == nil {
+			return d, nil
+		}
+	}
+	return nil, ErrNotFound
 }
 
 // FindMessageByName implements part of the Resolver interface.
@@ -347,13 +524,22 @@ func (r *Registry) FindExtensionByName(name protoreflect.FullName) (protoreflect
 func (r *Registry) FindExtensionByNumber(message protoreflect.FullName, fieldNumber protoreflect.FieldNumber) (protoreflect.ExtensionDescriptor, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	ext := r.exts[message][fieldNumber]
+	ext := r.findExtensionLocked(message, fieldNumber)
 	if ext == nil {
 		return nil, protoregistry.NotFound
 	}
 	return ext, nil
 }
 
+func (r *Registry) findExtensionLocked(message protoreflect.FullName, fieldNumber protoreflect.FieldNumber) protoreflect.FieldDescriptor {
+	for l := r.layer; l != nil; l = l.parent {
+		if ext := l.exts[message][fieldNumber]; ext != nil {
+			return ext
+		}
+	}
+	return nil
+}
+
 // FindMessageByURL implements part of the Resolver interface.
 func (r *Registry) FindMessageByURL(url string) (protoreflect.MessageDescriptor, error) {
 	return r.FindMessageByName(TypeNameFromURL(url))
@@ -365,15 +551,10 @@ func (r *Registry) RangeExtensionsByMessage(message protoreflect.FullName, fn fu
 	func() {
 		r.mu.RLock()
 		defer r.mu.RUnlock()
-		extMap := r.exts[message]
-		if len(extMap) == 0 {
-			return
-		}
-		exts = make([]protoreflect.ExtensionDescriptor, len(extMap))
-		i := 0
-		for _, v := range extMap {
-			exts[i] = v
-			i++
+		for l := r.layer; l != nil; l = l.parent {
+			for _, v := range l.exts[message] {
+				exts = append(exts, v)
+			}
 		}
 	}()
 	for _, ext := range exts {
@@ -383,6 +564,221 @@ func (r *Registry) RangeExtensionsByMessage(message protoreflect.FullName, fn fu
 	}
 }
 
+// Snapshot returns an immutable view of the registry's current contents. Files
+// registered with r after this returns are not visible in the snapshot, and
+// attempts to register files with the snapshot fail with [ErrReadOnly].
+//
+// Creating a snapshot does not copy the registry's contents: they are shared
+// by r and the snapshot. So snapshots are cheap to create, even for large
+// registries. A snapshot is a good base for many forks, such as when a
+// multi-tenant server shares a common set of files among tenants that each
+// add their own files. See [Registry.Fork].
+func (r *Registry) Snapshot() *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Registry{layer: r.shareLocked(), readOnly: true}
+}
+
+// Fork returns a new registry whose initial contents are the same as r. Files
+// can then be registered with the returned registry without affecting r, and
+// vice versa. Like with [Registry.Snapshot], the contents are shared, not
+// copied. Only files added to the returned registry after this returns are
+// stored separately. Files registered with the fork must not conflict with
+// any files that were already in r.
+//
+// Forking a snapshot returns a registry that is not read-only.
+func (r *Registry) Fork() *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Registry{layer: r.shareLocked()}
+}
+
+// shareLocked returns a new layer, to be used by another registry, whose
+// ancestors are shared with r. This may push a new layer onto r, so that r
+// does not modify the shared layers.
+func (r *Registry) shareLocked() *registryLayer {
+	if r.layer == nil {
+		return &registryLayer{depth: 1}
+	}
+	if r.layer.isEmpty() {
+		// Nothing in the top layer, so no need to share it.
+		return newRegistryLayer(r.layer.parent)
+	}
+	if r.layer.depth >= maxLayerDepth {
+		r.layer = r.layer.flatten()
+	}
+	shared := r.layer
+	r.layer = newRegistryLayer(shared)
+	return newRegistryLayer(shared)
+}
+
+func (r *Registry) protoLocked(file protoreflect.FileDescriptor) *descriptorpb.FileDescriptorProto {
+	for l := r.layer; l != nil; l = l.parent {
+		if fd := l.protos[file]; fd != nil {
+			return fd
+		}
+	}
+	return nil
+}
+
+func newRegistryLayer(parent *registryLayer) *registryLayer {
+	layer := &registryLayer{parent: parent, depth: 1}
+	if parent != nil {
+		layer.depth = parent.depth + 1
+	}
+	return layer
+}
+
+func (l *registryLayer) isEmpty() bool {
+	return l.files.NumFiles() == 0 && len(l.exts) == 0
+}
+
+func (l *registryLayer) saveProto(file protoreflect.FileDescriptor, fd *descriptorpb.FileDescriptorProto) {
+	if l.protos == nil {
+		l.protos = map[protoreflect.FileDescriptor]*descriptorpb.FileDescriptorProto{}
+	}
+	l.protos[file] = fd
+}
+
+func (l *registryLayer) addPackage(pkg protoreflect.FullName) {
+	if l.pkgs == nil {
+		l.pkgs = map[protoreflect.FullName]struct{}{}
+	}
+	for ; pkg != ""; pkg = pkg.Parent() {
+		if _, ok := l.pkgs[pkg]; ok {
+			// prefixes were added already, too
+			return
+		}
+		l.pkgs[pkg] = struct{}{}
+	}
+}
+
+func (l *registryLayer) addExtension(ext protoreflect.FieldDescriptor) {
+	if l.exts == nil {
+		l.exts = map[protoreflect.FullName]map[protoreflect.FieldNumber]protoreflect.FieldDescriptor{}
+	}
+	extsForMsg := l.exts[ext.ContainingMessage().FullName()]
+	if extsForMsg == nil {
+		extsForMsg = map[protoreflect.FieldNumber]protoreflect.FieldDescriptor{}
+		l.exts[ext.ContainingMessage().FullName()] = extsForMsg
+	}
+	extsForMsg[ext.Number()] = ext
+}
+
+// flatten returns a single layer with the contents of l and all of its
+// ancestors.
+func (l *registryLayer) flatten() *registryLayer {
+	var chain []*registryLayer
+	for ; l != nil; l = l.parent {
+		chain = append(chain, l)
+	}
+	flat := &registryLayer{depth: 1}
+	// Start with the root, so that protos memoized in later layers
+	// take precedence.
+	for i := len(chain) - 1; i >= 0; i-- {
+		layer := chain[i]
+		layer.files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+			// Files in the chain cannot conflict, so this cannot fail.
+			_ = flat.files.RegisterFile(file)
+			flat.addPackage(file.Package())
+			return true
+		})
+		for _, extsForMsg := range layer.exts {
+			for _, ext := range extsForMsg {
+				flat.addExtension(ext)
+			}
+		}
+		for file, fd := range layer.protos {
+			flat.saveProto(file, fd)
+		}
+	}
+	return flat
+}
+
+// checkAncestors checks that the given file does not conflict with any files
+// in the ancestors of l. Conflicts with files in l itself are detected when
+// the file is registered with l.files.
+func (l *registryLayer) checkAncestors(file protoreflect.FileDescriptor) error {
+	if l.parent == nil {
+		return nil
+	}
+	if _, err := l.parent.findFile(file.Path()); err == nil {
+		return fmt.Errorf("file %q already registered", file.Path())
+	}
+	for pkg := file.Package(); pkg != ""; pkg = pkg.Parent() {
+		if err := l.parent.checkName(file, pkg, true); err != nil {
+			return err
+		}
+	}
+	return l.parent.checkNamesInContainer(file, file)
+}
+
+func (l *registryLayer) checkNamesInContainer(file protoreflect.FileDescriptor, container TypeContainer) error {
+	msgs := container.Messages()
+	for i, length := 0, msgs.Len(); i < length; i++ {
+		msg := msgs.Get(i)
+		if err := l.checkName(file, msg.FullName(), false); err != nil {
+			return err
+		}
+		if err := l.checkNamesInContainer(file, msg); err != nil {
+			return err
+		}
+	}
+	enums := container.Enums()
+	for i, length := 0, enums.Len(); i < length; i++ {
+		enum := enums.Get(i)
+		if err := l.checkName(file, enum.FullName(), false); err != nil {
+			return err
+		}
+		vals := enum.Values()
+		for j, numVals := 0, vals.Len(); j < numVals; j++ {
+			if err := l.checkName(file, vals.Get(j).FullName(), false); err != nil {
+				return err
+			}
+		}
+	}
+	exts := container.Extensions()
+	for i, length := 0, exts.Len(); i < length; i++ {
+		if err := l.checkName(file, exts.Get(i).FullName(), false); err != nil {
+			return err
+		}
+	}
+	if fd, ok := container.(protoreflect.FileDescriptor); ok {
+		svcs := fd.Services()
+		for i, length := 0, svcs.Len(); i < length; i++ {
+			if err := l.checkName(file, svcs.Get(i).FullName(), false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkName checks that the given name, declared by the given file, does not
+// conflict with an element in l or its ancestors. If isPackage is true, the
+// name is a package (or a prefix of one), which only conflicts with elements
+// that are not packages.
+func (l *registryLayer) checkName(file protoreflect.FileDescriptor, name protoreflect.FullName, isPackage bool) error {
+	for layer := l; layer != nil; layer = layer.parent {
+		if d, err := layer.files.FindDescriptorByName(name); err == nil {
+			return fmt.Errorf("file %q has a name conflict over %v (previously from %q)", file.Path(), name, d.ParentFile().Path())
+		}
+		if _, ok := layer.pkgs[name]; ok && !isPackage {
+			return fmt.Errorf("file %q has a name conflict over %v (previously used as a package)", file.Path(), name)
+		}
+	}
+	return nil
+}
+
+func (l *registryLayer) findFile(path string) (protoreflect.FileDescriptor, error) {
+	for layer := l; layer != nil; layer = layer.parent {
+		if file, err := layer.files.FindFileByPath(path); err == nil {
+			return file, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
 // AsTypeResolver implements part of the Resolver interface.
 func (r *Registry) AsTypeResolver() TypeResolver {
 	return r.AsTypePool()
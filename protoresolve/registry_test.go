@@ -1,10 +1,14 @@
 package protoresolve_test
 
 import (
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/jhump/protoreflect/v2/protoresolve"
 )
@@ -24,3 +28,171 @@ func TestFromFiles(t *testing.T) {
 	require.NoError(t, err)
 	testResolver(t, reg)
 }
+
+func TestFromFileDescriptorSet(t *testing.T) {
+	data, err := os.ReadFile("../internal/testprotos/desc_test_proto3.protoset")
+	require.NoError(t, err)
+	var fds descriptorpb.FileDescriptorSet
+	require.NoError(t, proto.Unmarshal(data, &fds))
+	require.Greater(t, len(fds.File), 1)
+	// reverse the order, so that dependencies come after the files that import them
+	for i, j := 0, len(fds.File)-1; i < j; i, j = i+1, j-1 {
+		fds.File[i], fds.File[j] = fds.File[j], fds.File[i]
+	}
+
+	reg, err := protoresolve.FromFileDescriptorSet(&fds)
+	require.NoError(t, err)
+	require.Equal(t, len(fds.File), reg.NumFiles())
+	for _, fdProto := range fds.File {
+		file, err := reg.FindFileByPath(fdProto.GetName())
+		require.NoError(t, err)
+		recovered, err := reg.ProtoFromFileDescriptor(file)
+		require.NoError(t, err)
+		require.Same(t, fdProto, recovered)
+	}
+
+	// duplicate files
+	dupes := &descriptorpb.FileDescriptorSet{File: append(fds.File, fds.File[0])}
+	_, err = protoresolve.FromFileDescriptorSet(dupes)
+	require.ErrorContains(t, err, "duplicate file")
+
+	// import cycle
+	cycle := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			{Name: proto.String("a.proto"), Dependency: []string{"b.proto"}},
+			{Name: proto.String("b.proto"), Dependency: []string{"a.proto"}},
+		},
+	}
+	_, err = protoresolve.FromFileDescriptorSet(cycle)
+	require.ErrorContains(t, err, "import cycle")
+}
+
+func TestRegistry_SnapshotAndFork(t *testing.T) {
+	file := func(name, pkg, msg string, deps ...string) *descriptorpb.FileDescriptorProto {
+		return &descriptorpb.FileDescriptorProto{
+			Name:        proto.String(name),
+			Package:     proto.String(pkg),
+			Dependency:  deps,
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String(msg)}},
+		}
+	}
+	var base protoresolve.Registry
+	baseProto := file("base.proto", "base", "Base")
+	_, err := base.RegisterFileProto(baseProto)
+	require.NoError(t, err)
+	_, err = base.RegisterFileProto(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("ext.proto"),
+		Package:    proto.String("base"),
+		Dependency: []string{"base.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:           proto.String("Extendable"),
+			ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{{Start: proto.Int32(100), End: proto.Int32(200)}},
+		}},
+		Extension: []*descriptorpb.FieldDescriptorProto{{
+			Name:     proto.String("ext"),
+			Number:   proto.Int32(100),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Extendee: proto.String(".base.Extendable"),
+		}},
+	})
+	require.NoError(t, err)
+
+	snapshot := base.Snapshot()
+	require.Equal(t, 2, snapshot.NumFiles())
+	_, err = snapshot.RegisterFileProto(file("other.proto", "other", "Other"))
+	require.ErrorIs(t, err, protoresolve.ErrReadOnly)
+
+	// changes to the original are not visible in the snapshot
+	_, err = base.RegisterFileProto(file("later.proto", "base", "Later"))
+	require.NoError(t, err)
+	require.Equal(t, 3, base.NumFiles())
+	require.Equal(t, 2, snapshot.NumFiles())
+	_, err = snapshot.FindFileByPath("later.proto")
+	require.ErrorIs(t, err, protoresolve.ErrNotFound)
+
+	tenant1 := snapshot.Fork()
+	tenant2 := snapshot.Fork()
+	_, err = tenant1.RegisterFileProto(file("tenant.proto", "tenant", "Foo", "base.proto"))
+	require.NoError(t, err)
+	// same path in another fork does not conflict
+	_, err = tenant2.RegisterFileProto(file("tenant.proto", "tenant", "Bar", "base.proto"))
+	require.NoError(t, err)
+
+	for _, reg := range []*protoresolve.Registry{tenant1, tenant2} {
+		require.Equal(t, 3, reg.NumFiles())
+		require.Equal(t, 2, reg.NumFilesByPackage("base"))
+		_, err = reg.FindMessageByName("base.Base")
+		require.NoError(t, err)
+		ext, err := reg.FindExtensionByNumber("base.Extendable", 100)
+		require.NoError(t, err)
+		require.Equal(t, "base.ext", string(ext.FullName()))
+		file, err := reg.FindFileByPath("base.proto")
+		require.NoError(t, err)
+		recovered, err := reg.ProtoFromFileDescriptor(file)
+		require.NoError(t, err)
+		require.Same(t, baseProto, recovered)
+	}
+	_, err = tenant1.FindMessageByName("tenant.Foo")
+	require.NoError(t, err)
+	_, err = tenant1.FindMessageByName("tenant.Bar")
+	require.ErrorIs(t, err, protoresolve.ErrNotFound)
+	_, err = tenant2.FindMessageByName("tenant.Bar")
+	require.NoError(t, err)
+	_, err = snapshot.FindFileByPath("tenant.proto")
+	require.ErrorIs(t, err, protoresolve.ErrNotFound)
+
+	// forks cannot register files that conflict with the shared files
+	_, err = tenant1.RegisterFileProto(file("base.proto", "base", "Base2"))
+	require.ErrorContains(t, err, `file "base.proto" already registered`)
+	_, err = tenant1.RegisterFileProto(file("dupe.proto", "base", "Base"))
+	require.ErrorContains(t, err, "name conflict over base.Base")
+	_, err = tenant1.RegisterFileProto(file("pkg.proto", "base.Base", "Nested"))
+	require.ErrorContains(t, err, "name conflict over base.Base")
+	_, err = tenant1.RegisterFileProto(file("msg.proto", "", "base"))
+	require.ErrorContains(t, err, "name conflict over base")
+	_, err = tenant1.RegisterFileProto(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("ext2.proto"),
+		Package:    proto.String("tenant"),
+		Dependency: []string{"ext.proto"},
+		Extension: []*descriptorpb.FieldDescriptorProto{{
+			Name:     proto.String("ext"),
+			Number:   proto.Int32(100),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Extendee: proto.String(".base.Extendable"),
+		}},
+	})
+	require.ErrorContains(t, err, "extension number 100 for message \"base.Extendable\" already registered")
+
+	// names also conflict with prefixes of shared packages
+	var deep protoresolve.Registry
+	_, err = deep.RegisterFileProto(file("deep.proto", "a.b.c", "Deep"))
+	require.NoError(t, err)
+	_, err = deep.Fork().RegisterFileProto(file("prefix.proto", "a", "b"))
+	require.ErrorContains(t, err, "name conflict over a.b (previously used as a package)")
+	deepFile, err := deep.FindFileByPath("deep.proto")
+	require.NoError(t, err)
+	var files protoregistry.Files
+	require.NoError(t, files.RegisterFile(deepFile))
+	wrapped, err := protoresolve.FromFiles(&files)
+	require.NoError(t, err)
+	_, err = wrapped.Fork().RegisterFileProto(file("prefix.proto", "", "a"))
+	require.ErrorContains(t, err, "name conflict over a (previously used as a package)")
+	_, err = deep.Fork().RegisterFileProto(file("sibling.proto", "a.b", "D"))
+	require.NoError(t, err)
+
+	// forks of forks, many levels deep
+	reg := &base
+	for i := 0; i < 20; i++ {
+		reg = reg.Fork()
+		_, err = reg.RegisterFileProto(file(fmt.Sprintf("level%d.proto", i), "levels", fmt.Sprintf("Level%d", i)))
+		require.NoError(t, err)
+		_ = reg.Snapshot()
+	}
+	require.Equal(t, 23, reg.NumFiles())
+	_, err = reg.FindMessageByName("levels.Level0")
+	require.NoError(t, err)
+	_, err = reg.FindMessageByName("base.Later")
+	require.NoError(t, err)
+}
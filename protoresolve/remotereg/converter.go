@@ -681,7 +681,7 @@ func (cc *convertContext) recordTypeAndDependencies(ctx context.Context, url str
 	grp, grpCtx := errgroup.WithContext(ctx)
 	for _, f := range mt.Fields {
 		if f.Kind == typepb.Field_TYPE_GROUP || f.Kind == typepb.Field_TYPE_MESSAGE || f.Kind == typepb.Field_TYPE_ENUM {
-			typeURL := ensureScheme(f.TypeUrl)
+			typeURL := cc.reg.resolveURL(f.TypeUrl)
 			kind := f.Kind
 			grp.Go(func() error {
 				// first check the registry for descriptors
@@ -716,7 +716,7 @@ func (cc *convertContext) recordTypeAndDependencies(ctx context.Context, url str
 
 	for _, f := range mt.Fields {
 		if f.Kind == typepb.Field_TYPE_GROUP || f.Kind == typepb.Field_TYPE_MESSAGE || f.Kind == typepb.Field_TYPE_ENUM {
-			typeUrl := ensureScheme(f.TypeUrl)
+			typeUrl := cc.reg.resolveURL(f.TypeUrl)
 			if fe.deps == nil {
 				fe.deps = map[string]struct{}{}
 			}
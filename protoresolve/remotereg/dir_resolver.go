@@ -0,0 +1,241 @@
+package remotereg
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/protodescs"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// DirectoryResolver resolves descriptors using the file descriptor sets found
+// in a directory. It is intended to be used as the Fallback of a Registry, so
+// that type URLs that have not been registered are resolved using schema
+// artifacts on disk instead of requiring a TypeFetcher that queries a remote
+// type server:
+//
+//	reg := &remotereg.Registry{
+//	    Fallback: remotereg.NewDirectoryResolver("/etc/schemas"),
+//	}
+//
+// The directory and its sub-directories are searched for files whose names end
+// in ".protoset" or ".binpb". These files may be in any format supported by
+// protodescs.ReadFileDescriptorSet, which includes buf images. The directory is
+// indexed on first use, and the files are not examined again. So files added
+// to the directory after that will not be seen. Files that cannot be read or
+// that are not valid descriptor sets are skipped, as are sub-directories that
+// cannot be read. If the directory itself cannot be read, the error is
+// returned, and indexing is attempted again on the next use.
+//
+// Files in the sets are converted to descriptors on first use, when an element
+// they contain is resolved. If the same file path appears in more than one
+// set, the first one found (in lexical order of the set's path) is used.
+// Dependencies that are not present in any set are resolved using
+// protoregistry.GlobalFiles.
+//
+// A DirectoryResolver is safe to use concurrently from multiple goroutines.
+type DirectoryResolver struct {
+	dir string
+
+	mu          sync.Mutex
+	indexed     bool
+	files       protoresolve.Registry
+	fileProtos  map[string]*descriptorpb.FileDescriptorProto
+	symbolFiles map[protoreflect.FullName]string
+}
+
+var _ protoresolve.DescriptorResolver = (*DirectoryResolver)(nil)
+var _ protoresolve.FileResolver = (*DirectoryResolver)(nil)
+
+// NewDirectoryResolver returns a resolver that uses the file descriptor sets in
+// the given directory.
+func NewDirectoryResolver(dir string) *DirectoryResolver {
+	return &DirectoryResolver{dir: dir}
+}
+
+// FindFileByPath returns the file with the given path. The path refers to
+// the name of a file inside a descriptor set, not to the path of a set in the
+// directory.
+func (r *DirectoryResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.indexLocked(); err != nil {
+		return nil, err
+	}
+	return r.findFileLocked(path, nil)
+}
+
+// FindDescriptorByName returns the element with the given fully-qualified
+// name.
+func (r *DirectoryResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.indexLocked(); err != nil {
+		return nil, err
+	}
+	// Only types, enum values, extensions, and services are indexed. So for
+	// other elements, like fields, we look for the file of an enclosing element.
+	for scope := name; scope != ""; scope = scope.Parent() {
+		path, ok := r.symbolFiles[scope]
+		if !ok {
+			continue
+		}
+		if _, err := r.findFileLocked(path, nil); err != nil {
+			return nil, err
+		}
+		break
+	}
+	return r.files.FindDescriptorByName(name)
+}
+
+// findFileLocked returns the descriptor for the file with the given path,
+// creating it and its dependencies if necessary. The given stack holds the
+// paths of the files whose dependencies are being resolved, so that import
+// cycles can be reported instead of recursing forever.
+func (r *DirectoryResolver) findFileLocked(path string, stack []string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.files.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	fileProto := r.fileProtos[path]
+	if fileProto == nil {
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.registerFileAndDepsLocked(fd); err != nil {
+			return nil, err
+		}
+		return fd, nil
+	}
+	for i, p := range stack {
+		if p == path {
+			cycle := append(stack[i:len(stack):len(stack)], path)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	stack = append(stack, path)
+	for _, dep := range fileProto.GetDependency() {
+		if _, err := r.findFileLocked(dep, stack); err != nil {
+			return nil, fmt.Errorf("failed to resolve dependency %q of %q: %w", dep, path, err)
+		}
+	}
+	fd, err := protodesc.NewFile(fileProto, &r.files)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.files.RegisterFile(fd); err != nil {
+		return nil, err
+	}
+	// no longer needed, since the descriptor is now in r.files
+	delete(r.fileProtos, path)
+	return fd, nil
+}
+
+func (r *DirectoryResolver) registerFileAndDepsLocked(fd protoreflect.FileDescriptor) error {
+	if _, err := r.files.FindFileByPath(fd.Path()); err == nil {
+		return nil
+	}
+	imports := fd.Imports()
+	for i, length := 0, imports.Len(); i < length; i++ {
+		if err := r.registerFileAndDepsLocked(imports.Get(i).FileDescriptor); err != nil {
+			return err
+		}
+	}
+	return r.files.RegisterFile(fd)
+}
+
+func (r *DirectoryResolver) indexLocked() error {
+	if r.indexed {
+		return nil
+	}
+	r.fileProtos = map[string]*descriptorpb.FileDescriptorProto{}
+	r.symbolFiles = map[protoreflect.FullName]string{}
+	// WalkDir visits entries in lexical order, so results are deterministic
+	err := filepath.WalkDir(r.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == r.dir {
+				return err
+			}
+			// skip unreadable entries; for a directory, this only skips
+			// its contents since WalkDir has already visited it
+			return nil
+		}
+		if d.IsDir() || !isDescriptorSetFile(path) {
+			return nil
+		}
+		set, err := protodescs.LoadFileDescriptorSet(path)
+		if err != nil {
+			// not a valid descriptor set, so skip it
+			return nil
+		}
+		for _, fileProto := range set.File {
+			if _, ok := r.fileProtos[fileProto.GetName()]; ok {
+				continue
+			}
+			r.fileProtos[fileProto.GetName()] = fileProto
+			r.indexFile(fileProto)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.indexed = true
+	return nil
+}
+
+func isDescriptorSetFile(path string) bool {
+	return strings.HasSuffix(path, ".protoset") || strings.HasSuffix(path, ".binpb")
+}
+
+func (r *DirectoryResolver) indexFile(fileProto *descriptorpb.FileDescriptorProto) {
+	path := fileProto.GetName()
+	addSymbol := func(scope protoreflect.FullName, name string) protoreflect.FullName {
+		fqn := scope.Append(protoreflect.Name(name))
+		if _, ok := r.symbolFiles[fqn]; !ok {
+			r.symbolFiles[fqn] = path
+		}
+		return fqn
+	}
+	addEnum := func(scope protoreflect.FullName, enum *descriptorpb.EnumDescriptorProto) {
+		addSymbol(scope, enum.GetName())
+		// enum values are siblings of the enum, not children
+		for _, val := range enum.GetValue() {
+			addSymbol(scope, val.GetName())
+		}
+	}
+	var addMessage func(scope protoreflect.FullName, msg *descriptorpb.DescriptorProto)
+	addMessage = func(scope protoreflect.FullName, msg *descriptorpb.DescriptorProto) {
+		fqn := addSymbol(scope, msg.GetName())
+		for _, nested := range msg.GetNestedType() {
+			addMessage(fqn, nested)
+		}
+		for _, enum := range msg.GetEnumType() {
+			addEnum(fqn, enum)
+		}
+		for _, ext := range msg.GetExtension() {
+			addSymbol(fqn, ext.GetName())
+		}
+	}
+	pkg := protoreflect.FullName(fileProto.GetPackage())
+	for _, msg := range fileProto.GetMessageType() {
+		addMessage(pkg, msg)
+	}
+	for _, enum := range fileProto.GetEnumType() {
+		addEnum(pkg, enum)
+	}
+	for _, ext := range fileProto.GetExtension() {
+		addSymbol(pkg, ext.GetName())
+	}
+	for _, svc := range fileProto.GetService() {
+		addSymbol(pkg, svc.GetName())
+	}
+}
@@ -0,0 +1,128 @@
+package remotereg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+	. "github.com/jhump/protoreflect/v2/protoresolve/remotereg"
+)
+
+func TestDirectoryResolver(t *testing.T) {
+	dir := t.TempDir()
+	copyFile := func(src, dest string) {
+		data, err := os.ReadFile(filepath.Join("../../internal/testprotos", src))
+		require.NoError(t, err)
+		dest = filepath.Join(dir, dest)
+		require.NoError(t, os.MkdirAll(filepath.Dir(dest), 0755))
+		require.NoError(t, os.WriteFile(dest, data, 0644))
+	}
+	copyFile("desc_test_complex.protoset", "complex/complex.protoset")
+	copyFile("desc_test1.protoset", "test1.binpb")
+	// files with other extensions are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a descriptor set"), 0644))
+
+	res := NewDirectoryResolver(dir)
+	rr := &Registry{Fallback: res}
+
+	md, err := rr.FindMessageByURL("type.googleapis.com/foo.bar.Test")
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("foo.bar.Test"), md.FullName())
+	// the type comes from the directory, not from the generated code
+	require.NotEqual(t, testprotos.File_desc_test_complex_proto, md.ParentFile())
+	ed, err := rr.FindEnumByURL("type.googleapis.com/foo.bar.Test.Nested._NestedNested.EEE")
+	require.NoError(t, err)
+	require.Equal(t, md.ParentFile(), ed.ParentFile())
+	md, err = rr.FindMessageByURL("type.googleapis.com/testprotos.TestMessage.NestedMessage")
+	require.NoError(t, err)
+	require.Equal(t, "desc_test1.proto", md.ParentFile().Path())
+
+	// repeated lookups return the same descriptors
+	d, err := res.FindDescriptorByName("foo.bar.Test")
+	require.NoError(t, err)
+	require.Equal(t, ed.ParentFile(), d.ParentFile())
+	// elements that are not types can be found, too
+	d, err = res.FindDescriptorByName("foo.bar.Simple.name")
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("foo.bar.Simple.name"), d.FullName())
+	fd, err := res.FindFileByPath("desc_test_complex.proto")
+	require.NoError(t, err)
+	require.Equal(t, ed.ParentFile(), fd)
+
+	_, err = rr.FindMessageByURL("type.googleapis.com/foo.bar.DoesNotExist")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	_, err = res.FindFileByPath("does/not/exist.proto")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+
+	// enum values in package scope can be found, even before their file has
+	// been loaded
+	res = NewDirectoryResolver(dir)
+	d, err = res.FindDescriptorByName("foo.bar.X")
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("foo.bar.X"), d.FullName())
+	_, ok := d.(protoreflect.EnumValueDescriptor)
+	require.True(t, ok)
+
+	// a directory that can't be read results in errors
+	missingDir := filepath.Join(dir, "does-not-exist")
+	res = NewDirectoryResolver(missingDir)
+	_, err = res.FindDescriptorByName("foo.bar.Test")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	// but it is retried on the next use
+	require.NoError(t, os.Mkdir(missingDir, 0755))
+	data, err := os.ReadFile("../../internal/testprotos/desc_test_complex.protoset")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(missingDir, "complex.protoset"), data, 0644))
+	d, err = res.FindDescriptorByName("foo.bar.Test")
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("foo.bar.Test"), d.FullName())
+}
+
+func TestDirectoryResolver_SkipsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("../../internal/testprotos/desc_test_complex.protoset")
+	require.NoError(t, err)
+	// sorts before the valid file, so it is encountered first
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a-corrupt.protoset"), []byte("not a descriptor set"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b-complex.protoset"), data, 0644))
+
+	res := NewDirectoryResolver(dir)
+	d, err := res.FindDescriptorByName("foo.bar.Test")
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("foo.bar.Test"), d.FullName())
+}
+
+func TestDirectoryResolver_ImportCycle(t *testing.T) {
+	newFile := func(path, msgName string, deps ...string) *descriptorpb.FileDescriptorProto {
+		return &descriptorpb.FileDescriptorProto{
+			Name:        proto.String(path),
+			Package:     proto.String("cycle"),
+			Dependency:  deps,
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String(msgName)}},
+		}
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		newFile("a.proto", "A", "b.proto"),
+		newFile("b.proto", "B", "a.proto"),
+		newFile("self.proto", "Self", "self.proto"),
+	}}
+	data, err := proto.Marshal(set)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cycle.protoset"), data, 0644))
+
+	res := NewDirectoryResolver(dir)
+	_, err = res.FindDescriptorByName("cycle.A")
+	require.ErrorContains(t, err, "import cycle: a.proto -> b.proto -> a.proto")
+	_, err = res.FindFileByPath("b.proto")
+	require.ErrorContains(t, err, "import cycle: b.proto -> a.proto -> b.proto")
+	_, err = res.FindDescriptorByName("cycle.Self")
+	require.ErrorContains(t, err, "import cycle: self.proto -> self.proto")
+}
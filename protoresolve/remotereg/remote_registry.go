@@ -11,6 +11,7 @@ import (
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
 
 	"github.com/jhump/protoreflect/v2/protoresolve"
@@ -48,7 +49,8 @@ type Registry struct {
 	PackageBaseURLMapper func(packageName protoreflect.FullName) string
 	// A value that can retrieve type definitions at runtime. If non-nil,
 	// this will be used to resolve types for URLs that have not been
-	// explicitly registered.
+	// explicitly registered. To fetch types from different sources based
+	// on the URL's domain, use a TypeFetcherRouter.
 	TypeFetcher TypeFetcher
 	// The final fallback for resolving types. If a type URL has not been
 	// explicitly registered and cannot be resolved by TypeFetcher (or
@@ -63,12 +65,38 @@ type Registry struct {
 	// an empty resolver, such as a new, empty Registry or
 	// protoregistry.Files.
 	Fallback protoresolve.DescriptorResolver
+	// A function that canonicalizes type URLs. If non-nil, this is applied
+	// to all type URLs that are registered or looked up, so that URLs that
+	// refer to the same type but differ in some way (for example, different
+	// hosts or the presence of a version suffix) all resolve to the same
+	// type. The given URL will always include a scheme. If the function
+	// returns the empty string, the URL is used as is.
+	//
+	// The function is applied before any aliases are resolved. (See
+	// RegisterURLAlias.) So aliases should be registered using canonical
+	// URLs.
+	URLCanonicalizer func(url string) string
+	// If true, extensions declared in files registered with this registry
+	// (via RegisterTypesInFile, RegisterTypesInFileWithBaseURL, or
+	// RegisterTypesInFileDescriptorSet) are resolved by the registry's type
+	// resolver, before consulting the Fallback. This allows extensions in
+	// messages unpacked from google.protobuf.Any values to be decoded into
+	// known extension fields instead of being left as unknown fields, even
+	// if the Fallback does not know about them. In this case, registering a
+	// file fails if it declares an extension with the same name, or the same
+	// extendee and number, as one that is already registered, just like
+	// registration fails for conflicting messages and enums.
+	//
+	// If false, extensions are only resolved via the Fallback.
+	ResolveKnownExtensions bool
 
 	mu          sync.RWMutex
 	typeCache   map[string]protoreflect.Descriptor
+	urlAliases  map[string]string
 	typeURLs    map[protoreflect.FullName]string
 	descProtos  map[protoreflect.Descriptor]proto.Message
 	pkgBaseURLs map[protoreflect.FullName]pkgBaseURL
+	extensions  protoregistry.Types
 	// Used to synthesize file names when source context information is insufficient
 	// when converting google.protobuf.Type, google.protobuf.Enum, and google.protobuf.Api
 	// to descriptors.
@@ -89,17 +117,24 @@ var _ protoresolve.MessageResolver = (*Registry)(nil)
 // the type. Computing the URL will first look at explicitly registered
 // package base URLs, then the registry's PackageBaseURLMapper (if
 // configured), and finally the registry's DefaultBaseURL (if configured).
+// The registry's URLCanonicalizer (if configured) is applied to the result.
 func (r *Registry) URLForType(desc protoreflect.Descriptor) string {
 	return r.urlForType(desc.FullName(), desc.ParentFile().Package())
 }
 
 func (r *Registry) urlForType(typeName, pkgName protoreflect.FullName) string {
 	// Check known types and explicit package registrations first.
-	if url := r.urlFromRegistrations(typeName, pkgName); url != "" {
+	url := r.urlFromRegistrations(typeName, pkgName)
+	if url == "" {
+		// Then consult package mapper and default base URL.
+		url = r.baseURLWithoutRegistrations(pkgName) + "/" + string(typeName)
+	}
+	if r.URLCanonicalizer == nil {
 		return url
 	}
-	// Then consult package mapper and default base URL.
-	return r.baseURLWithoutRegistrations(pkgName) + "/" + string(typeName)
+	// This is done after releasing the lock, since it calls the
+	// URLCanonicalizer.
+	return r.canonicalizeURL(url)
 }
 
 func (r *Registry) urlFromRegistrations(typeName, pkgName protoreflect.FullName) string {
@@ -151,11 +186,17 @@ func (r *Registry) baseURLWithoutRegistrations(pkgName protoreflect.FullName) st
 // RegisterPackageBaseURL for a particular sub-package).
 func (r *Registry) RegisterPackageBaseURL(pkgName protoreflect.FullName, baseURL string, includeSubPackages bool) (string, bool) {
 	baseURL = ensureScheme(baseURL)
+	// computed before acquiring the lock, since it may call the
+	// PackageBaseURLMapper
+	unregisteredBaseURL := r.baseURLWithoutRegistrations(pkgName)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	previousEntry, previouslyRegistered := r.pkgBaseURLs[pkgName]
 	if !previouslyRegistered {
-		previousEntry.baseURL = r.baseURL(pkgName)
+		previousEntry.baseURL = r.baseURLFromRegistrationsLocked(pkgName)
+		if previousEntry.baseURL == "" {
+			previousEntry.baseURL = unregisteredBaseURL
+		}
 	}
 	if r.pkgBaseURLs == nil {
 		r.pkgBaseURLs = map[protoreflect.FullName]pkgBaseURL{}
@@ -194,7 +235,7 @@ func (r *Registry) RegisterEnum(ed protoreflect.EnumDescriptor) error {
 
 // RegisterMessageWithURL registers the given message type with the given URL.
 func (r *Registry) RegisterMessageWithURL(md protoreflect.MessageDescriptor, url string) error {
-	url = ensureScheme(url)
+	url = r.canonicalizeURL(url)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if err := r.checkTypeLocked(md, "message", url); err != nil {
@@ -213,7 +254,7 @@ func (r *Registry) RegisterMessageWithURL(md protoreflect.MessageDescriptor, url
 
 // RegisterEnumWithURL registers the given enum type with the given URL.
 func (r *Registry) RegisterEnumWithURL(ed protoreflect.EnumDescriptor, url string) error {
-	url = ensureScheme(url)
+	url = r.canonicalizeURL(url)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if err := r.checkTypeLocked(ed, "enum", url); err != nil {
@@ -237,9 +278,76 @@ func (r *Registry) checkTypeLocked(desc protoreflect.Descriptor, descKind string
 	if _, alreadyRegistered := r.typeCache[url]; alreadyRegistered {
 		return fmt.Errorf("type for %s already registered", url)
 	}
+	if _, alreadyRegistered := r.urlAliases[url]; alreadyRegistered {
+		return fmt.Errorf("%s already registered as an alias", url)
+	}
+	return nil
+}
+
+// RegisterURLAlias registers the given alias URL so that it resolves to the same
+// type as the given target URL. The target need not be registered yet; it could
+// be a type that will later be registered or one that will be resolved via the
+// registry's TypeFetcher or Fallback. When finding types by URL, the alias URL
+// will be replaced with the target URL. But URLForType never returns an alias.
+//
+// The registry's URLCanonicalizer, if any, is applied to both URLs. An error is
+// returned if the alias is already registered as an alias or as the URL of a
+// registered type, or if the target is itself an alias.
+func (r *Registry) RegisterURLAlias(alias, target string) error {
+	alias = r.canonicalizeURL(alias)
+	target = r.canonicalizeURL(target)
+	if alias == target {
+		return fmt.Errorf("cannot register %s as an alias of itself", alias)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, alreadyRegistered := r.urlAliases[alias]; alreadyRegistered {
+		return fmt.Errorf("%s already registered as an alias for %s", alias, existing)
+	}
+	if _, alreadyRegistered := r.typeCache[alias]; alreadyRegistered {
+		return fmt.Errorf("type for %s already registered", alias)
+	}
+	if _, isAlias := r.urlAliases[target]; isAlias {
+		return fmt.Errorf("cannot register alias for %s because it is also an alias", target)
+	}
+	if r.urlAliases == nil {
+		r.urlAliases = map[string]string{}
+	}
+	r.urlAliases[alias] = target
 	return nil
 }
 
+// canonicalizeURL makes sure the given URL has a scheme and then applies
+// the registry's URLCanonicalizer, if any.
+func (r *Registry) canonicalizeURL(url string) string {
+	url = ensureScheme(url)
+	if r.URLCanonicalizer != nil {
+		if canonical := r.URLCanonicalizer(url); canonical != "" {
+			url = ensureScheme(canonical)
+		}
+	}
+	return url
+}
+
+// resolveURLLocked resolves the given URL, which must already be in canonical
+// form, if it is an alias. The URL should be canonicalized before acquiring
+// the lock, so that the URLCanonicalizer is not called while it is held.
+func (r *Registry) resolveURLLocked(url string) string {
+	if target, ok := r.urlAliases[url]; ok {
+		return target
+	}
+	return url
+}
+
+// resolveURL returns the canonical form of the given URL, after resolving
+// any alias.
+func (r *Registry) resolveURL(url string) string {
+	url = r.canonicalizeURL(url)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolveURLLocked(url)
+}
+
 // RegisterTypesInFile registers all message and enum types present in the given file.
 // The base URL used for all types will be computed based on explicit base URL
 // registrations, then the registry's PackageBaseURLMapper (if present), and finally
@@ -251,40 +359,167 @@ func (r *Registry) RegisterTypesInFile(fd protoreflect.FileDescriptor) error {
 // RegisterTypesInFileWithBaseURL registers all message and enum types present in the
 // given file. The given base URL is used to construct the URLs for all types.
 func (r *Registry) RegisterTypesInFileWithBaseURL(fd protoreflect.FileDescriptor, baseURL string) error {
-	baseURL = ensureScheme(baseURL)
+	urls := map[protoreflect.FullName]string{}
+	r.computeTypeURLs(fd, ensureScheme(baseURL), urls)
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if err := r.checkTypesInContainerLocked(fd, baseURL); err != nil {
+	if err := r.checkTypesInContainerLocked(fd, urls); err != nil {
 		return err
 	}
-	r.registerTypesInContainerLocked(fd, baseURL)
+	r.registerTypesInContainerLocked(fd, urls)
+	return nil
+}
+
+// RegisterTypesInFileDescriptorSet registers all message and enum types in
+// all the files in the given set, as if by calling RegisterTypesInFile for
+// each file. The files need not be topologically sorted. Dependencies that are
+// not present in the set are resolved using the registry's Fallback, if it is
+// a protoresolve.FileResolver, or protoregistry.GlobalFiles if Fallback is nil.
+// If an error is returned, no types will have been registered.
+//
+// The returned registry contains the files in the set, along with any of their
+// dependencies that were resolved via the fallback. Since this registry only
+// resolves messages and enums, the returned registry can be used to resolve
+// other elements in the set, such as extensions. For example, it can be used
+// as the Fallback for this registry. (Alternatively, set ResolveKnownExtensions
+// so that this registry resolves extensions in the set.)
+func (r *Registry) RegisterTypesInFileDescriptorSet(set *descriptorpb.FileDescriptorSet) (*protoresolve.Registry, error) {
+	var files protoresolve.Registry
+	if err := r.registerMissingDependencies(&files, set.File); err != nil {
+		return nil, err
+	}
+	fds, err := files.RegisterFileProtos(set.File)
+	if err != nil {
+		return nil, err
+	}
+	urls := map[protoreflect.FullName]string{}
+	for _, fd := range fds {
+		r.computeTypeURLs(fd, ensureScheme(r.baseURL(fd.Package())), urls)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fd := range fds {
+		if err := r.checkTypesInContainerLocked(fd, urls); err != nil {
+			return nil, err
+		}
+	}
+	for _, fd := range fds {
+		r.registerTypesInContainerLocked(fd, urls)
+	}
+	return &files, nil
+}
+
+// registerMissingDependencies registers in files any dependencies of the given
+// file protos that are not themselves in the given file protos, by finding
+// them using the registry's fallback.
+func (r *Registry) registerMissingDependencies(files *protoresolve.Registry, fileProtos []*descriptorpb.FileDescriptorProto) error {
+	var fallback protoresolve.FileResolver
+	if r.Fallback == nil {
+		fallback = protoregistry.GlobalFiles
+	} else if fr, ok := r.Fallback.(protoresolve.FileResolver); ok {
+		fallback = fr
+	} else {
+		// can't resolve files; any missing dependencies will be reported
+		// when trying to register the files
+		return nil
+	}
+	inSet := make(map[string]struct{}, len(fileProtos))
+	for _, fileProto := range fileProtos {
+		inSet[fileProto.GetName()] = struct{}{}
+	}
+	var registerFile func(protoreflect.FileDescriptor) error
+	registerFile = func(fd protoreflect.FileDescriptor) error {
+		if _, err := files.FindFileByPath(fd.Path()); err == nil {
+			// already registered
+			return nil
+		}
+		imports := fd.Imports()
+		for i, length := 0, imports.Len(); i < length; i++ {
+			if imports.Get(i).IsPlaceholder() {
+				continue
+			}
+			if err := registerFile(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return files.RegisterFile(fd)
+	}
+	for _, fileProto := range fileProtos {
+		for _, dep := range fileProto.GetDependency() {
+			if _, ok := inSet[dep]; ok {
+				continue
+			}
+			fd, err := fallback.FindFileByPath(dep)
+			if err != nil {
+				// let registration report the missing dependency
+				continue
+			}
+			if err := registerFile(fd); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-func (r *Registry) checkTypesInContainerLocked(container protoresolve.TypeContainer, baseURL string) error {
+// computeTypeURLs adds to urls the canonical URL of every message and enum in
+// the given container, using the given base URL. This must not be called while
+// r.mu is held, since it calls the registry's URLCanonicalizer.
+func (r *Registry) computeTypeURLs(container protoresolve.TypeContainer, baseURL string, urls map[protoreflect.FullName]string) {
+	msgs := container.Messages()
+	for i, length := 0, msgs.Len(); i < length; i++ {
+		md := msgs.Get(i)
+		urls[md.FullName()] = r.canonicalizeURL(baseURL + "/" + string(md.FullName()))
+		r.computeTypeURLs(md, baseURL, urls)
+	}
+	enums := container.Enums()
+	for i, length := 0, enums.Len(); i < length; i++ {
+		ed := enums.Get(i)
+		urls[ed.FullName()] = r.canonicalizeURL(baseURL + "/" + string(ed.FullName()))
+	}
+}
+
+func (r *Registry) checkTypesInContainerLocked(container protoresolve.TypeContainer, urls map[protoreflect.FullName]string) error {
 	msgs := container.Messages()
 	for i, length := 0, msgs.Len(); i < length; i++ {
 		md := msgs.Get(i)
-		url := baseURL + "/" + string(md.FullName())
-		if err := r.checkTypeLocked(md, "message", url); err != nil {
+		if err := r.checkTypeLocked(md, "message", urls[md.FullName()]); err != nil {
 			return err
 		}
-		if err := r.checkTypesInContainerLocked(md, baseURL); err != nil {
+		if err := r.checkTypesInContainerLocked(md, urls); err != nil {
 			return err
 		}
 	}
 	enums := container.Enums()
 	for i, length := 0, enums.Len(); i < length; i++ {
 		ed := enums.Get(i)
-		url := baseURL + "/" + string(ed.FullName())
-		if err := r.checkTypeLocked(ed, "enum", url); err != nil {
+		if err := r.checkTypeLocked(ed, "enum", urls[ed.FullName()]); err != nil {
 			return err
 		}
 	}
+	if r.ResolveKnownExtensions {
+		exts := container.Extensions()
+		for i, length := 0, exts.Len(); i < length; i++ {
+			if err := r.checkExtensionLocked(exts.Get(i)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-func (r *Registry) registerTypesInContainerLocked(container protoresolve.TypeContainer, baseURL string) {
+func (r *Registry) checkExtensionLocked(xd protoreflect.ExtensionDescriptor) error {
+	if _, err := r.extensions.FindExtensionByName(xd.FullName()); err == nil {
+		return fmt.Errorf("extension %s already registered", xd.FullName())
+	}
+	if existing, err := r.extensions.FindExtensionByNumber(xd.ContainingMessage().FullName(), xd.Number()); err == nil {
+		return fmt.Errorf("extension number %d for %s already registered by %s",
+			xd.Number(), xd.ContainingMessage().FullName(), existing.TypeDescriptor().FullName())
+	}
+	return nil
+}
+
+func (r *Registry) registerTypesInContainerLocked(container protoresolve.TypeContainer, urls map[protoreflect.FullName]string) {
 	if r.typeURLs == nil {
 		r.typeURLs = map[protoreflect.FullName]string{}
 	}
@@ -294,18 +529,25 @@ func (r *Registry) registerTypesInContainerLocked(container protoresolve.TypeCon
 	msgs := container.Messages()
 	for i, length := 0, msgs.Len(); i < length; i++ {
 		md := msgs.Get(i)
-		url := baseURL + "/" + string(md.FullName())
+		url := urls[md.FullName()]
 		r.typeURLs[md.FullName()] = url
 		r.typeCache[url] = md
-		r.registerTypesInContainerLocked(md, baseURL)
+		r.registerTypesInContainerLocked(md, urls)
 	}
 	enums := container.Enums()
 	for i, length := 0, enums.Len(); i < length; i++ {
 		ed := enums.Get(i)
-		url := baseURL + "/" + string(ed.FullName())
+		url := urls[ed.FullName()]
 		r.typeURLs[ed.FullName()] = url
 		r.typeCache[url] = ed
 	}
+	if r.ResolveKnownExtensions {
+		exts := container.Extensions()
+		for i, length := 0, exts.Len(); i < length; i++ {
+			// conflicts were already rejected by checkTypesInContainerLocked
+			_ = r.extensions.RegisterExtension(protoresolve.ExtensionType(exts.Get(i)))
+		}
+	}
 }
 
 // FindMessageByName has the same signature as the method of the same name
@@ -403,7 +645,7 @@ func (r *Registry) FindEnumByURLContext(ctx context.Context, url string) (protor
 }
 
 func (r *Registry) findTypeByURL(ctx context.Context, url string, isEnum bool) (protoreflect.Descriptor, error) {
-	url = ensureScheme(url)
+	url = r.resolveURL(url)
 	r.mu.RLock()
 	d := r.typeCache[url]
 	r.mu.RUnlock()
@@ -434,11 +676,15 @@ func (r *Registry) fetchTypeForURL(ctx context.Context, url string, isEnum bool)
 func (r *Registry) findMessageTypesByURL(ctx context.Context, urls []string) (map[string]protoreflect.MessageDescriptor, error) {
 	ret := make(map[string]protoreflect.MessageDescriptor, len(urls))
 	var unresolved []string
+	canonicalURLs := make([]string, len(urls))
+	for i, u := range urls {
+		canonicalURLs[i] = r.canonicalizeURL(u)
+	}
 	err := func() error {
 		r.mu.RLock()
 		defer r.mu.RUnlock()
-		for _, u := range urls {
-			u = ensureScheme(u)
+		for _, u := range canonicalURLs {
+			u = r.resolveURLLocked(u)
 			cached := r.typeCache[u]
 			if cached != nil {
 				if md, ok := cached.(protoreflect.MessageDescriptor); ok {
@@ -568,7 +814,10 @@ var _ protoresolve.TypeResolver = (*RemoteTypeResolver)(nil)
 
 // FindExtensionByName implements the SerializationResolver interface.
 //
-// This method relies on the underlying Registry's fallback resolver.
+// If the underlying Registry's ResolveKnownExtensions field is true, this
+// first looks for the extension in files registered with the registry.
+// If not found there, this method relies on the underlying Registry's fallback
+// resolver.
 // If the registry's fallback resolver is unconfigured or nil, then
 // protoregistry.GlobalTypes will be used to find the extension. Otherwise,
 // if the fallback has a method named AsTypeResolver that returns a
@@ -583,7 +832,10 @@ func (r *RemoteTypeResolver) FindExtensionByName(field protoreflect.FullName) (p
 
 // FindExtensionByNumber implements the SerializationResolver interface.
 //
-// This method relies on the underlying Registry's fallback resolver.
+// If the underlying Registry's ResolveKnownExtensions field is true, this
+// first looks for the extension in files registered with the registry.
+// If not found there, this method relies on the underlying Registry's fallback
+// resolver.
 // If the registry's fallback resolver is unconfigured or nil, then
 // protoregistry.GlobalTypes will be used to find the extension. Otherwise,
 // if the fallback has a method named AsTypeResolver that returns a
@@ -686,6 +938,14 @@ type remoteSubResolver Registry
 var _ protoresolve.SerializationResolver = (*remoteSubResolver)(nil)
 
 func (r *remoteSubResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	if r.ResolveKnownExtensions {
+		r.mu.RLock()
+		xt, err := r.extensions.FindExtensionByName(field)
+		r.mu.RUnlock()
+		if err == nil {
+			return xt, nil
+		}
+	}
 	fb := r.Fallback
 	if fb == nil {
 		return protoregistry.GlobalTypes.FindExtensionByName(field)
@@ -715,6 +975,14 @@ type typeResolvable interface {
 }
 
 func (r *remoteSubResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	if r.ResolveKnownExtensions {
+		r.mu.RLock()
+		xt, err := r.extensions.FindExtensionByNumber(message, field)
+		r.mu.RUnlock()
+		if err == nil {
+			return xt, nil
+		}
+	}
 	fb := r.Fallback
 	if fb == nil {
 		return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
@@ -737,7 +1005,7 @@ func (r *remoteSubResolver) FindMessageByName(message protoreflect.FullName) (pr
 }
 
 func (r *remoteSubResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
-	url = ensureScheme(url)
+	url = (*Registry)(r).resolveURL(url)
 	r.mu.RLock()
 	d := r.typeCache[url]
 	r.mu.RUnlock()
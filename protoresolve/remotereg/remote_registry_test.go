@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/require"
@@ -109,6 +111,150 @@ func TestRemoteRegistry_Basic(t *testing.T) {
 	require.Equal(t, 2, enumCount)
 }
 
+func TestRemoteRegistry_AliasesAndCanonicalization(t *testing.T) {
+	rr := &Registry{
+		Fallback: &protoresolve.Registry{}, /* empty fallback */
+		URLCanonicalizer: func(url string) string {
+			// strip version suffixes, like "/v2"
+			if pos := strings.LastIndex(url, "/v"); pos > 0 && !strings.Contains(url[pos+1:], ".") {
+				return url[:pos]
+			}
+			return ""
+		},
+	}
+	md := (*descriptorpb.DescriptorProto)(nil).ProtoReflect().Descriptor()
+	err := rr.RegisterMessageWithURL(md, "foo.bar/google.protobuf.DescriptorProto/v1")
+	require.NoError(t, err)
+	require.Equal(t, "https://foo.bar/google.protobuf.DescriptorProto", rr.URLForType(md))
+
+	for _, url := range []string{
+		"foo.bar/google.protobuf.DescriptorProto",
+		"foo.bar/google.protobuf.DescriptorProto/v1",
+		"https://foo.bar/google.protobuf.DescriptorProto/v2",
+	} {
+		msg, err := rr.FindMessageByURL(url)
+		require.NoError(t, err)
+		require.Equal(t, md, msg)
+	}
+
+	// aliases
+	err = rr.RegisterURLAlias("legacy.host/google.protobuf.DescriptorProto", "foo.bar/google.protobuf.DescriptorProto")
+	require.NoError(t, err)
+	for _, url := range []string{
+		"legacy.host/google.protobuf.DescriptorProto",
+		"legacy.host/google.protobuf.DescriptorProto/v3",
+	} {
+		msg, err := rr.FindMessageByURL(url)
+		require.NoError(t, err, "url: %s", url)
+		require.Equal(t, md, msg)
+	}
+	// URLForType never returns an alias
+	require.Equal(t, "https://foo.bar/google.protobuf.DescriptorProto", rr.URLForType(md))
+	// aliases work with Any messages, too
+	b, err := proto.Marshal(protodesc.ToDescriptorProto(md))
+	require.NoError(t, err)
+	a := &anypb.Any{TypeUrl: "legacy.host/google.protobuf.DescriptorProto", Value: b}
+	pm, err := anypb.UnmarshalNew(a, proto.UnmarshalOptions{Resolver: rr.AsTypeResolver()})
+	require.NoError(t, err)
+	protosEqual(t, protodesc.ToDescriptorProto(md), pm)
+
+	// alias target can be registered later
+	ed := md.ParentFile().Messages().ByName("FieldDescriptorProto").Enums().ByName("Type")
+	err = rr.RegisterURLAlias("legacy.host/google.protobuf.FieldDescriptorProto.Type", "foo.bar/google.protobuf.FieldDescriptorProto.Type")
+	require.NoError(t, err)
+	_, err = rr.FindEnumByURL("legacy.host/google.protobuf.FieldDescriptorProto.Type")
+	require.ErrorIs(t, err, protoresolve.ErrNotFound)
+	err = rr.RegisterEnumWithURL(ed, "foo.bar/google.protobuf.FieldDescriptorProto.Type")
+	require.NoError(t, err)
+	en, err := rr.FindEnumByURL("legacy.host/google.protobuf.FieldDescriptorProto.Type")
+	require.NoError(t, err)
+	require.Equal(t, ed, en)
+
+	// invalid aliases
+	err = rr.RegisterURLAlias("legacy.host/google.protobuf.DescriptorProto", "foo.bar/google.protobuf.FileDescriptorProto")
+	require.ErrorContains(t, err, "already registered as an alias")
+	err = rr.RegisterURLAlias("foo.bar/google.protobuf.DescriptorProto", "foo.bar/google.protobuf.FileDescriptorProto")
+	require.ErrorContains(t, err, "already registered")
+	err = rr.RegisterURLAlias("other.host/google.protobuf.DescriptorProto", "legacy.host/google.protobuf.DescriptorProto")
+	require.ErrorContains(t, err, "because it is also an alias")
+	err = rr.RegisterURLAlias("foo.bar/Foo", "foo.bar/Foo/v1")
+	require.ErrorContains(t, err, "as an alias of itself")
+	// can't register a type with a URL that is an alias
+	fmd := (*descriptorpb.FileDescriptorProto)(nil).ProtoReflect().Descriptor()
+	err = rr.RegisterMessageWithURL(fmd, "legacy.host/google.protobuf.DescriptorProto")
+	require.ErrorContains(t, err, "already registered as an alias")
+}
+
+func TestRemoteRegistry_CanonicalizationOfComputedURLs(t *testing.T) {
+	rr := &Registry{
+		DefaultBaseURL: "legacy.host",
+		Fallback:       &protoresolve.Registry{}, /* empty fallback */
+		URLCanonicalizer: func(url string) string {
+			return strings.Replace(url, "https://legacy.host/", "https://foo.bar/", 1)
+		},
+	}
+	md := (*descriptorpb.DescriptorProto)(nil).ProtoReflect().Descriptor()
+	require.Equal(t, "https://foo.bar/google.protobuf.DescriptorProto", rr.URLForType(md))
+	rr.RegisterPackageBaseURL("google.protobuf", "legacy.host/protos", false)
+	require.Equal(t, "https://foo.bar/protos/google.protobuf.DescriptorProto", rr.URLForType(md))
+
+	rr.RegisterPackageBaseURL("google.protobuf", "legacy.host", false)
+	fld := md.Fields().ByName("options")
+	typ := rr.AsDescriptorConverter().DescriptorAsType(md)
+	for _, f := range typ.Fields {
+		if f.Name == string(fld.Name()) {
+			require.Equal(t, rr.URLForType(fld.Message()), f.TypeUrl)
+			require.Equal(t, "https://foo.bar/google.protobuf.MessageOptions", f.TypeUrl)
+		}
+	}
+}
+
+func TestRemoteRegistry_CanonicalizationForFiles(t *testing.T) {
+	var rr *Registry
+	rr = &Registry{
+		Fallback: &protoresolve.Registry{}, /* empty fallback */
+		URLCanonicalizer: func(url string) string {
+			// must not be called while the registry's lock is held, so
+			// this must not block
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				rr.RegisterPackageBaseURL("unused", "foo.bar", false)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Error("URLCanonicalizer called while registry is locked")
+			}
+			return strings.Replace(url, "https://legacy.host/", "https://foo.bar/", 1)
+		},
+	}
+	fd := (*descriptorpb.DescriptorProto)(nil).ProtoReflect().Descriptor().ParentFile()
+	err := rr.RegisterTypesInFileWithBaseURL(fd, "legacy.host")
+	require.NoError(t, err)
+	md := fd.Messages().ByName("DescriptorProto")
+	require.Equal(t, "https://foo.bar/google.protobuf.DescriptorProto", rr.URLForType(md))
+	for _, url := range []string{
+		"foo.bar/google.protobuf.DescriptorProto",
+		"legacy.host/google.protobuf.DescriptorProto",
+	} {
+		msg, err := rr.FindMessageByURL(url)
+		require.NoError(t, err, "url: %s", url)
+		require.Equal(t, md, msg)
+	}
+	ed := md.ParentFile().Messages().ByName("FieldDescriptorProto").Enums().ByName("Type")
+	en, err := rr.FindEnumByURL("https://foo.bar/google.protobuf.FieldDescriptorProto.Type")
+	require.NoError(t, err)
+	require.Equal(t, ed, en)
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(testprotos.File_desc_test1_proto)}}
+	rr.RegisterPackageBaseURL("testprotos", "legacy.host", false)
+	_, err = rr.RegisterTypesInFileDescriptorSet(set)
+	require.NoError(t, err)
+	_, err = rr.FindMessageByURL("foo.bar/testprotos.TestMessage")
+	require.NoError(t, err)
+}
+
 func TestRemoteRegistry_Fallback(t *testing.T) {
 	rr := &Registry{}
 
@@ -134,6 +280,38 @@ func TestRemoteRegistry_Fallback(t *testing.T) {
 	require.Equal(t, ed, en)
 }
 
+func TestRemoteRegistry_RegisterTypesInFileDescriptorSet(t *testing.T) {
+	// descriptor.proto is not in the set, so must come from the fallback
+	fileProto := protodesc.ToFileDescriptorProto(testprotos.File_desc_test_complex_proto)
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fileProto}}
+
+	rr := &Registry{Fallback: &protoresolve.Registry{} /* empty fallback */}
+	_, err := rr.RegisterTypesInFileDescriptorSet(set)
+	require.ErrorContains(t, err, "google/protobuf/descriptor.proto")
+	_, err = rr.FindMessageByURL("type.googleapis.com/foo.bar.Test")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+
+	rr = &Registry{}
+	files, err := rr.RegisterTypesInFileDescriptorSet(set)
+	require.NoError(t, err)
+	md, err := rr.FindMessageByURL("type.googleapis.com/foo.bar.Test")
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("foo.bar.Test"), md.FullName())
+	// the type comes from the set, not from the generated code
+	require.NotEqual(t, testprotos.File_desc_test_complex_proto, md.ParentFile())
+	ed, err := rr.FindEnumByURL("type.googleapis.com/foo.bar.Test.Nested._NestedNested.EEE")
+	require.NoError(t, err)
+	require.Equal(t, md.ParentFile(), ed.ParentFile())
+
+	// returned registry can resolve other elements, too
+	fd, err := files.FindFileByPath("google/protobuf/descriptor.proto")
+	require.NoError(t, err)
+	require.Equal(t, descriptorpb.File_google_protobuf_descriptor_proto, fd)
+	xd, err := files.FindExtensionByName("foo.bar.rept")
+	require.NoError(t, err)
+	require.Equal(t, md.ParentFile(), xd.ParentFile())
+}
+
 func TestRemoteRegistry_FindMessage_TypeFetcher(t *testing.T) {
 	tf := createFetcher(t)
 	// we want "defaults" for the message factory so that we can properly process
@@ -1215,3 +1393,134 @@ func asAny(t *testing.T, msg proto.Message) *anypb.Any {
 	require.NoError(t, err)
 	return &a
 }
+
+func TestRemoteRegistry_ResolveKnownExtensions(t *testing.T) {
+	fileProto := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("ext.proto"),
+		Package: proto.String("ext"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Extendable"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:   proto.String("name"),
+						Number: proto.Int32(1),
+						Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+				ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{
+					{Start: proto.Int32(100), End: proto.Int32(200)},
+				},
+			},
+		},
+		Extension: []*descriptorpb.FieldDescriptorProto{
+			{
+				Name:     proto.String("tag"),
+				Number:   proto.Int32(100),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Extendee: proto.String(".ext.Extendable"),
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fileProto, nil)
+	require.NoError(t, err)
+	md := fd.Messages().ByName("Extendable")
+	xt := dynamicpb.NewExtensionType(fd.Extensions().ByName("tag"))
+
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("name"), protoreflect.ValueOfString("abc"))
+	msg.Set(xt.TypeDescriptor(), protoreflect.ValueOfString("xyz"))
+	anyMsg, err := anypb.New(msg)
+	require.NoError(t, err)
+
+	for _, resolveExts := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ResolveKnownExtensions=%v", resolveExts), func(t *testing.T) {
+			rr := &Registry{
+				Fallback:               &protoresolve.Registry{}, // empty fallback
+				ResolveKnownExtensions: resolveExts,
+			}
+			require.NoError(t, rr.RegisterTypesInFile(fd))
+			res := rr.AsTypeResolver()
+
+			unpacked, err := anypb.UnmarshalNew(anyMsg, proto.UnmarshalOptions{Resolver: res})
+			require.NoError(t, err)
+			require.Equal(t, "abc", unpacked.ProtoReflect().Get(md.Fields().ByName("name")).String())
+			if !resolveExts {
+				require.False(t, unpacked.ProtoReflect().Has(xt.TypeDescriptor()))
+				require.NotEmpty(t, unpacked.ProtoReflect().GetUnknown())
+				_, err := res.FindExtensionByName("ext.tag")
+				require.ErrorIs(t, err, protoregistry.NotFound)
+				return
+			}
+			require.Empty(t, unpacked.ProtoReflect().GetUnknown())
+			require.Equal(t, "xyz", unpacked.ProtoReflect().Get(xt.TypeDescriptor()).String())
+
+			found, err := res.FindExtensionByName("ext.tag")
+			require.NoError(t, err)
+			require.Equal(t, xt.TypeDescriptor().Descriptor(), found.TypeDescriptor().Descriptor())
+			found, err = res.FindExtensionByNumber("ext.Extendable", 100)
+			require.NoError(t, err)
+			require.Equal(t, xt.TypeDescriptor().Descriptor(), found.TypeDescriptor().Descriptor())
+		})
+	}
+}
+
+func TestRemoteRegistry_ResolveKnownExtensions_Conflicts(t *testing.T) {
+	extendable, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("ext.proto"),
+		Package: proto.String("ext"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Extendable"),
+				ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{
+					{Start: proto.Int32(100), End: proto.Int32(200)},
+				},
+			},
+		},
+	}, nil)
+	require.NoError(t, err)
+	var deps protoresolve.Registry
+	require.NoError(t, deps.RegisterFile(extendable))
+	newExtFile := func(pkg, msgName, extName string, extNum int32) protoreflect.FileDescriptor {
+		fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+			Name:        proto.String(pkg + ".proto"),
+			Package:     proto.String(pkg),
+			Dependency:  []string{"ext.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String(msgName)}},
+			Extension: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String(extName),
+					Number:   proto.Int32(extNum),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Extendee: proto.String(".ext.Extendable"),
+				},
+			},
+		}, &deps)
+		require.NoError(t, err)
+		return fd
+	}
+	first := newExtFile("foo", "Foo", "tag", 100)
+	sameNumber := newExtFile("bar", "Bar", "tag", 100)
+	different := newExtFile("baz", "Baz", "tag", 101)
+
+	// like conflicting messages and enums, conflicting extensions are
+	// rejected, and nothing in the file is registered
+	rr := &Registry{ResolveKnownExtensions: true}
+	require.NoError(t, rr.RegisterTypesInFile(first))
+	err = rr.RegisterTypesInFile(sameNumber)
+	require.ErrorContains(t, err, "extension number 100 for ext.Extendable already registered by foo.tag")
+	_, err = rr.FindMessageByName("bar.Bar")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+	require.NoError(t, rr.RegisterTypesInFile(different))
+	found, err := rr.AsTypeResolver().FindExtensionByNumber("ext.Extendable", 100)
+	require.NoError(t, err)
+	require.Equal(t, protoreflect.FullName("foo.tag"), found.TypeDescriptor().FullName())
+
+	// without ResolveKnownExtensions, extensions are not checked
+	rr = &Registry{}
+	require.NoError(t, rr.RegisterTypesInFile(first))
+	require.NoError(t, rr.RegisterTypesInFile(sameNumber))
+}
@@ -0,0 +1,177 @@
+package remotereg
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/typepb"
+
+	"github.com/jhump/protoreflect/v2/protoresolve"
+)
+
+// TypeFetcherRouter is a TypeFetcher that dispatches each query to another
+// TypeFetcher based on the type URL. This allows a Registry to fetch types
+// from several sources, such as a public schema server, a private schema
+// registry with its own domain and authentication, and descriptor sets on
+// local disk.
+//
+// Routes are registered for URL prefixes, which are typically just a domain
+// name, like "schemas.example.com". A prefix may also include a path, like
+// "schemas.example.com/tenants/acme", in which case it only matches URLs in
+// that path. The scheme of a type URL is ignored when matching routes. When
+// more than one prefix matches a URL, the longest one is used. The empty
+// prefix matches all URLs, so a route for it is used for any URL that does
+// not match a longer prefix, instead of Default.
+//
+// A TypeFetcherRouter is safe to use concurrently from multiple goroutines,
+// including registering routes while it is in use.
+type TypeFetcherRouter struct {
+	// The fetcher used for URLs that do not match any route. If nil, such
+	// URLs are reported as not found.
+	Default TypeFetcher
+
+	mu     sync.RWMutex
+	routes map[string]TypeFetcher
+}
+
+var _ TypeFetcher = (*TypeFetcherRouter)(nil)
+
+// Route registers the given fetcher for type URLs that start with the given
+// prefix. If the prefix includes a scheme, like "https://", it is ignored. If
+// a fetcher was already registered for the prefix, it is replaced. If the given
+// fetcher is nil, any route for the prefix is removed.
+func (r *TypeFetcherRouter) Route(prefix string, fetcher TypeFetcher) {
+	prefix = strings.TrimSuffix(stripScheme(prefix), "/")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fetcher == nil {
+		delete(r.routes, prefix)
+		return
+	}
+	if r.routes == nil {
+		r.routes = map[string]TypeFetcher{}
+	}
+	r.routes[prefix] = fetcher
+}
+
+// FetchMessageType implements the TypeFetcher interface.
+func (r *TypeFetcherRouter) FetchMessageType(ctx context.Context, url string) (*typepb.Type, error) {
+	fetcher := r.fetcherFor(url)
+	if fetcher == nil {
+		return nil, protoresolve.NewNotFoundError(url)
+	}
+	return fetcher.FetchMessageType(ctx, url)
+}
+
+// FetchEnumType implements the TypeFetcher interface.
+func (r *TypeFetcherRouter) FetchEnumType(ctx context.Context, url string) (*typepb.Enum, error) {
+	fetcher := r.fetcherFor(url)
+	if fetcher == nil {
+		return nil, protoresolve.NewNotFoundError(url)
+	}
+	return fetcher.FetchEnumType(ctx, url)
+}
+
+func (r *TypeFetcherRouter) fetcherFor(url string) TypeFetcher {
+	// The last path component is the type name, so it is not considered.
+	prefix := stripScheme(url)
+	if pos := strings.LastIndexByte(prefix, '/'); pos >= 0 {
+		prefix = prefix[:pos]
+	} else {
+		prefix = ""
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for {
+		if fetcher, ok := r.routes[prefix]; ok {
+			return fetcher
+		}
+		if prefix == "" {
+			return r.Default
+		}
+		if pos := strings.LastIndexByte(prefix, '/'); pos >= 0 {
+			prefix = prefix[:pos]
+		} else {
+			prefix = ""
+		}
+	}
+}
+
+func stripScheme(url string) string {
+	if pos := strings.Index(url, "://"); pos >= 0 {
+		return url[pos+3:]
+	}
+	return url
+}
+
+// DescriptorFetcher is a value that knows how to fetch the descriptor for a
+// type URL. This is an alternative to TypeFetcher for sources that provide
+// descriptors instead of google.protobuf.Type and google.protobuf.Enum
+// messages, such as descriptor sets or gRPC server reflection. Use
+// TypeFetcherFromDescriptors to adapt it to a TypeFetcher.
+type DescriptorFetcher interface {
+	// FetchDescriptor fetches the descriptor for the type identified by the
+	// given URL. The returned descriptor should be a message or enum. If the
+	// type is not known, the returned error should wrap protoresolve.ErrNotFound.
+	FetchDescriptor(ctx context.Context, url string) (protoreflect.Descriptor, error)
+}
+
+// DescriptorFetcherFunc is a DescriptorFetcher implementation backed by a
+// single function.
+type DescriptorFetcherFunc func(ctx context.Context, url string) (protoreflect.Descriptor, error)
+
+var _ DescriptorFetcher = DescriptorFetcherFunc(nil)
+
+// FetchDescriptor implements the DescriptorFetcher interface.
+func (f DescriptorFetcherFunc) FetchDescriptor(ctx context.Context, url string) (protoreflect.Descriptor, error) {
+	return f(ctx, url)
+}
+
+// DescriptorFetcherFromResolver returns a DescriptorFetcher that finds types
+// in the given resolver, using the type name in the last component of the URL.
+// This can be used to fetch types from a DirectoryResolver or from a
+// protoresolve.Registry that has been populated with a descriptor set.
+func DescriptorFetcherFromResolver(res protoresolve.DescriptorResolver) DescriptorFetcher {
+	return DescriptorFetcherFunc(func(_ context.Context, url string) (protoreflect.Descriptor, error) {
+		return res.FindDescriptorByName(protoresolve.TypeNameFromURL(url))
+	})
+}
+
+// TypeFetcherFromDescriptors returns a TypeFetcher that uses the given
+// DescriptorFetcher and converts the resulting descriptors into
+// google.protobuf.Type and google.protobuf.Enum messages.
+//
+// In the returned types, the URLs of referenced types (like the types of
+// fields) use the same base URL as the type being fetched. So they are also
+// routed to the same source when used with a TypeFetcherRouter.
+func TypeFetcherFromDescriptors(fetcher DescriptorFetcher) TypeFetcher {
+	return TypeFetcherFunc(func(ctx context.Context, url string, enum bool) (proto.Message, error) {
+		d, err := fetcher.FetchDescriptor(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		baseURL := url
+		if pos := strings.LastIndexByte(baseURL, '/'); pos >= 0 {
+			baseURL = baseURL[:pos]
+		}
+		dc := (*DescriptorConverter)(&Registry{DefaultBaseURL: baseURL})
+		switch d := d.(type) {
+		case protoreflect.MessageDescriptor:
+			if !enum {
+				return dc.DescriptorAsType(d), nil
+			}
+		case protoreflect.EnumDescriptor:
+			if enum {
+				return dc.DescriptorAsEnum(d), nil
+			}
+		}
+		wanted := protoresolve.DescriptorKindMessage
+		if enum {
+			wanted = protoresolve.DescriptorKindEnum
+		}
+		return nil, protoresolve.NewUnexpectedTypeError(wanted, d, url)
+	})
+}
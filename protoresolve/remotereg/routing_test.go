@@ -0,0 +1,81 @@
+package remotereg_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/jhump/protoreflect/v2/internal/testprotos"
+	"github.com/jhump/protoreflect/v2/protoresolve"
+	. "github.com/jhump/protoreflect/v2/protoresolve/remotereg"
+)
+
+func TestTypeFetcherRouter(t *testing.T) {
+	var files protoresolve.Registry
+	require.NoError(t, files.RegisterFile(testprotos.File_desc_test1_proto))
+	// dependencies are fetched concurrently
+	var mu sync.Mutex
+	var privateURLs []string
+	private := TypeFetcherFromDescriptors(DescriptorFetcherFunc(func(ctx context.Context, url string) (protoreflect.Descriptor, error) {
+		mu.Lock()
+		privateURLs = append(privateURLs, url)
+		mu.Unlock()
+		return DescriptorFetcherFromResolver(&files).FetchDescriptor(ctx, url)
+	}))
+	var defaultURLs []string
+	router := &TypeFetcherRouter{
+		Default: TypeFetcherFunc(func(_ context.Context, url string, _ bool) (proto.Message, error) {
+			mu.Lock()
+			defaultURLs = append(defaultURLs, url)
+			mu.Unlock()
+			return nil, protoresolve.NewNotFoundError(url)
+		}),
+	}
+	router.Route("https://schemas.example.com/", private)
+	router.Route("schemas.example.com/other", TypeFetcherFunc(func(_ context.Context, url string, _ bool) (proto.Message, error) {
+		t.Errorf("unexpected fetch of %s", url)
+		return nil, protoresolve.NewNotFoundError(url)
+	}))
+
+	reg := &Registry{TypeFetcher: router, Fallback: &protoregistry.Files{}}
+	md, err := reg.FindMessageByURL("schemas.example.com/testprotos.TestMessage")
+	require.NoError(t, err)
+	require.Equal(t, "testprotos.TestMessage", string(md.FullName()))
+	nested := md.Fields().ByName("nm")
+	require.NotNil(t, nested)
+	require.Equal(t, "testprotos.TestMessage.NestedMessage", string(nested.Message().FullName()))
+	// referenced types were fetched from the same source
+	require.Contains(t, privateURLs, "https://schemas.example.com/testprotos.TestMessage")
+	require.Contains(t, privateURLs, "https://schemas.example.com/testprotos.TestMessage.NestedMessage")
+	require.Empty(t, defaultURLs)
+
+	// wrong kind of element
+	_, err = reg.FindEnumByURL("schemas.example.com/testprotos.AnotherTestMessage")
+	require.ErrorContains(t, err, "wrong kind of descriptor")
+
+	// unrouted URLs use the default
+	_, err = reg.FindMessageByURL("type.googleapis.com/foo.Bar")
+	require.ErrorIs(t, err, protoresolve.ErrNotFound)
+	require.Equal(t, []string{"https://type.googleapis.com/foo.Bar"}, defaultURLs)
+
+	// removing a route
+	router.Route("schemas.example.com", nil)
+	_, err = router.FetchMessageType(context.Background(), "https://schemas.example.com/testprotos.AnotherTestMessage")
+	require.ErrorIs(t, err, protoresolve.ErrNotFound)
+	require.Equal(t, "https://schemas.example.com/testprotos.AnotherTestMessage", defaultURLs[1])
+
+	// the empty prefix matches everything not matched by a longer prefix
+	router.Route("", private)
+	privateURLs = nil
+	_, err = router.FetchMessageType(context.Background(), "type.googleapis.com/testprotos.AnotherTestMessage")
+	require.NoError(t, err)
+	_, err = router.FetchMessageType(context.Background(), "testprotos.AnotherTestMessage")
+	require.NoError(t, err)
+	require.Equal(t, []string{"type.googleapis.com/testprotos.AnotherTestMessage", "testprotos.AnotherTestMessage"}, privateURLs)
+	require.Len(t, defaultURLs, 2)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 
@@ -45,6 +46,22 @@ func TestFindExtensionByNumber(t *testing.T) {
 	assert.Equal(t, "desc_test_complex.proto", extd.ParentFile().Path())
 }
 
+func TestExtensionType(t *testing.T) {
+	// generated extension
+	extd := testprotos.File_desc_test1_proto.Extensions().ByName("xtm")
+	require.NotNil(t, extd)
+	xt := protoresolve.ExtensionType(extd)
+	assert.Same(t, testprotos.E_Xtm, xt)
+
+	// same extension, but a different descriptor
+	fd, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(testprotos.File_desc_test1_proto), protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	extd = fd.Extensions().ByName("xtm")
+	xt = protoresolve.ExtensionType(extd)
+	assert.NotSame(t, testprotos.E_Xtm, xt)
+	assert.Equal(t, extd, xt.TypeDescriptor().Descriptor())
+}
+
 func TestFindExtensionByNumberInFile(t *testing.T) {
 	extd := protoresolve.FindExtensionByNumberInFile(testprotos.File_desc_test1_proto, "testprotos.AnotherTestMessage", 100)
 	require.NotNil(t, extd)
@@ -249,3 +266,22 @@ func TestResolverFromPools(t *testing.T) {
 	// TODO
 	testResolver(t, protoresolve.ResolverFromPools(nil, nil))
 }
+
+func TestExtensionsFromFiles(t *testing.T) {
+	reg, err := protoresolve.ExtensionsFromFiles(testprotos.File_desc_test_complex_proto, testprotos.File_desc_test1_proto)
+	require.NoError(t, err)
+	// top-level and nested extensions, including ones in nested scopes
+	for _, name := range []protoreflect.FullName{
+		"foo.bar.rept",
+		"foo.bar.Test.Nested.fooblez",
+		"foo.bar.Test.Nested._NestedNested._garblez",
+		"testprotos.TestMessage.NestedMessage.AnotherNestedMessage.flags",
+	} {
+		xt, err := reg.FindExtensionByName(name)
+		require.NoError(t, err, "extension %s", name)
+		require.Equal(t, name, xt.TypeDescriptor().FullName())
+	}
+	// only extensions are registered
+	_, err = reg.FindMessageByName("foo.bar.Test")
+	require.ErrorIs(t, err, protoregistry.NotFound)
+}
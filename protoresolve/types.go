@@ -34,10 +34,8 @@ var _ TypeRegistry = (*protoregistry.Types)(nil)
 // that returns types. This can be used by implementations of Resolver to
 // implement the [Resolver.AsTypeResolver] method.
 //
-// It returns all dynamic types except for extensions, in which case, if an
-// extension implements [protoreflect.ExtensionTypeDescriptor], it will return
-// its associated [protoreflect.ExtensionType]. (Otherwise it returns a dynamic
-// extension.)
+// It returns dynamic types for messages and enums. Extension types are computed
+// using [ExtensionType].
 //
 // If the given value implements DescriptorPool, then the returned value will
 // implement TypePool.